@@ -141,7 +141,8 @@ def send_message(plate, url, parking_id, type, parking_time):
         "parking_time": parking_time.isoformat(),
         "type": type
     }
-    headers = {'Content-Type': 'application/json'}
+    # 设备密钥由管理端签发，通过环境变量 DEVICE_KEY 配置
+    headers = {'Content-Type': 'application/json', 'X-Device-Key': os.environ.get('DEVICE_KEY', '')}
     response = requests.post(url, json=data, headers=headers)
 
     if response.ok:
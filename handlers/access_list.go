@@ -0,0 +1,243 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"urban_traffic_backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccessListEntryRequest 新增或修改黑白名单记录请求
+type AccessListEntryRequest struct {
+	PlateNumber string     `json:"plate_number"`
+	ListType    string     `json:"list_type"`
+	Reason      string     `json:"reason"`
+	ValidFrom   *time.Time `json:"valid_from"`
+	ValidUntil  *time.Time `json:"valid_until"`
+}
+
+// GetParkingLotAccessList 管理员查询停车场黑白名单，可按名单类型、车牌和当前是否有效筛选
+func GetParkingLotAccessList(c *gin.Context) {
+	var lot models.ParkingLot
+	if err := models.DB.Scopes(orgScope(c, "organization_id")).First(&lot, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "停车场不存在"})
+		return
+	}
+
+	query := models.DB.Where("parking_lot_id = ?", lot.ID)
+	if listType := c.Query("list_type"); listType != "" {
+		query = query.Where("list_type = ?", listType)
+	}
+	if plate := c.Query("plate"); plate != "" {
+		query = query.Where("plate_number = ?", models.NormalizePlate(plate))
+	}
+	if c.Query("active") == "true" {
+		now := time.Now()
+		query = query.Where("(valid_from IS NULL OR valid_from <= ?) AND (valid_until IS NULL OR valid_until > ?)", now, now)
+	}
+
+	var entries []models.AccessListEntry
+	if err := query.Order("created_at DESC").Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取车辆名单失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    entries,
+		"message": "获取车辆名单成功",
+	})
+}
+
+// CreateAccessListEntry 管理员将车辆加入停车场黑名单或白名单
+func CreateAccessListEntry(c *gin.Context) {
+	var lot models.ParkingLot
+	if err := models.DB.Scopes(orgScope(c, "organization_id")).First(&lot, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "停车场不存在"})
+		return
+	}
+
+	var req AccessListEntryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	plate := models.NormalizePlate(req.PlateNumber)
+	if plate == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "车牌号不能为空"})
+		return
+	}
+	if req.ListType != models.AccessListWhitelist && req.ListType != models.AccessListBlacklist {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的名单类型"})
+		return
+	}
+	if req.ValidFrom != nil && req.ValidUntil != nil && !req.ValidUntil.After(*req.ValidFrom) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "失效时间必须晚于生效时间"})
+		return
+	}
+
+	entry := models.AccessListEntry{
+		ParkingLotID: lot.ID,
+		PlateNumber:  plate,
+		ListType:     req.ListType,
+		Reason:       req.Reason,
+		ValidFrom:    req.ValidFrom,
+		ValidUntil:   req.ValidUntil,
+	}
+	if userID, ok := c.Get("user_id"); ok {
+		uid := userID.(uint)
+		entry.CreatedBy = &uid
+	}
+	if err := models.DB.Create(&entry).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "添加车辆名单失败"})
+		return
+	}
+	auditTarget(c, "access_list_entry", entry.ID)
+	auditAfter(c, entry)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    entry,
+		"message": "车辆名单添加成功",
+	})
+}
+
+// UpdateAccessListEntry 管理员修改名单记录的原因和有效期
+func UpdateAccessListEntry(c *gin.Context) {
+	var entry models.AccessListEntry
+	if err := models.DB.Scopes(lotScope(c, "parking_lot_id")).First(&entry, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "名单记录不存在"})
+		return
+	}
+
+	var req AccessListEntryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	if req.ValidFrom != nil && req.ValidUntil != nil && !req.ValidUntil.After(*req.ValidFrom) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "失效时间必须晚于生效时间"})
+		return
+	}
+
+	auditTarget(c, "access_list_entry", entry.ID)
+	auditBefore(c, entry)
+	entry.Reason = req.Reason
+	entry.ValidFrom = req.ValidFrom
+	entry.ValidUntil = req.ValidUntil
+	if err := models.DB.Model(&entry).Updates(map[string]interface{}{
+		"reason":      entry.Reason,
+		"valid_from":  entry.ValidFrom,
+		"valid_until": entry.ValidUntil,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改车辆名单失败"})
+		return
+	}
+	auditAfter(c, entry)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    entry,
+		"message": "车辆名单修改成功",
+	})
+}
+
+// DeleteAccessListEntry 管理员移除名单记录，进行中的白名单会话从移除时起恢复计费
+func DeleteAccessListEntry(c *gin.Context) {
+	var entry models.AccessListEntry
+	if err := models.DB.Scopes(lotScope(c, "parking_lot_id")).First(&entry, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "名单记录不存在"})
+		return
+	}
+	auditTarget(c, "access_list_entry", entry.ID)
+	auditBefore(c, entry)
+
+	if err := models.DB.Delete(&entry).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "移除车辆名单失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "车辆名单移除成功",
+	})
+}
+
+// GetPlateAlarms 管理员查询车牌报警，默认返回未处理的报警
+func GetPlateAlarms(c *gin.Context) {
+	query := models.DB.Scopes(lotScope(c, "parking_lot_id")).Where("status = ?", c.DefaultQuery("status", "active"))
+	if lotID, err := strconv.ParseUint(c.Query("parking_lot_id"), 10, 32); err == nil {
+		query = query.Where("parking_lot_id = ?", lotID)
+	}
+
+	var alarms []models.PlateAlarm
+	if err := query.Order("alarm_time desc").Limit(50).Find(&alarms).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取数据失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    alarms,
+		"message": "获取车牌报警成功",
+	})
+}
+
+// UpdatePlateAlarmStatus 管理员确认或解决车牌报警
+func UpdatePlateAlarmStatus(c *gin.Context) {
+	var req struct {
+		Status string `json:"status" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	var alarm models.PlateAlarm
+	if err := models.DB.Scopes(lotScope(c, "parking_lot_id")).First(&alarm, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "报警不存在"})
+		return
+	}
+
+	auditTarget(c, "plate_alarm", alarm.ID)
+	auditBefore(c, alarm)
+
+	now := time.Now()
+	updates := map[string]interface{}{"status": req.Status}
+	switch req.Status {
+	case "acknowledged":
+		updates["ack_time"] = now
+	case "resolved":
+		if alarm.AckTime == nil {
+			updates["ack_time"] = now
+		}
+		updates["resolve_time"] = now
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的报警状态"})
+		return
+	}
+
+	if err := models.DB.Model(&alarm).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新报警状态失败"})
+		return
+	}
+	models.DB.First(&alarm, alarm.ID)
+	auditAfter(c, alarm)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    alarm,
+		"message": "报警状态更新成功",
+	})
+}
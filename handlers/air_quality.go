@@ -135,8 +135,9 @@ func UpdateAirQuality(c *gin.Context) {
 		return
 	}
 
-	// 设置时间戳
+	// 设置时间戳，记录归属到上报的监测设备
 	airQuality.Timestamp = time.Now()
+	airQuality.CredentialID = deviceCredentialID(c)
 
 	// 根据AQI计算等级
 	if airQuality.AQI <= 50 {
@@ -157,6 +158,8 @@ func UpdateAirQuality(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新空气质量数据失败"})
 		return
 	}
+	auditTarget(c, "air_quality", airQuality.ID)
+	auditAfter(c, airQuality)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"urban_traffic_backend/models"
+	"urban_traffic_backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// auditTarget 指定本次写操作的审计对象，由 AuditMiddleware 写入审计日志
+func auditTarget(c *gin.Context, targetType string, targetID interface{}) {
+	c.Set("audit_target_type", targetType)
+	c.Set("audit_target_id", fmt.Sprint(targetID))
+}
+
+// auditBefore 记录修改前快照，须在修改对象之前调用
+func auditBefore(c *gin.Context, value interface{}) {
+	c.Set("audit_before", services.AuditSnapshot(value))
+}
+
+// auditAfter 记录修改后快照
+func auditAfter(c *gin.Context, value interface{}) {
+	c.Set("audit_after", services.AuditSnapshot(value))
+}
+
+// GetAuditLogs 查询审计日志，可按操作者、角色、路由、操作对象和时间范围筛选，
+// 组织管理员只能看到本组织工作人员的操作
+func GetAuditLogs(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	query := models.DB.Model(&models.AuditLog{}).Scopes(orgScope(c, "organization_id"))
+	for param, column := range map[string]string{
+		"actor_type":  "actor_type",
+		"actor_id":    "actor_id",
+		"role":        "role",
+		"method":      "method",
+		"target_type": "target_type",
+		"target_id":   "target_id",
+		"status_code": "status_code",
+	} {
+		if value := c.Query(param); value != "" {
+			query = query.Where(column+" = ?", value)
+		}
+	}
+	if route := c.Query("route"); route != "" {
+		query = query.Where("route LIKE ?", "%"+route+"%")
+	}
+	if from := c.Query("from"); from != "" {
+		t, err := parseAuditTime(from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的开始时间"})
+			return
+		}
+		query = query.Where("created_at >= ?", t)
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := parseAuditTime(to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的结束时间"})
+			return
+		}
+		query = query.Where("created_at < ?", t)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取审计日志失败"})
+		return
+	}
+
+	var logs []models.AuditLog
+	if err := query.Order("id DESC").Limit(pageSize).Offset((page - 1) * pageSize).Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取审计日志失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"data":      logs,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// parseAuditTime 支持 RFC3339 时间和 2006-01-02 日期
+func parseAuditTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
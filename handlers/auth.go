@@ -9,14 +9,18 @@
 package handlers
 
 import (
+	"errors"
+	"math"
 	"net/http"
-	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"urban_traffic_backend/models"
+	"urban_traffic_backend/services"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
 )
 
 type LoginRequest struct {
@@ -26,9 +30,39 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	Token   string      `json:"token"`
-	User    models.User `json:"user"`
-	Message string      `json:"message"`
+	Token        string      `json:"token"`
+	RefreshToken string      `json:"refresh_token"`
+	ExpiresIn    int         `json:"expires_in"` // 访问令牌有效期（秒）
+	User         models.User `json:"user"`
+	Message      string      `json:"message"`
+}
+
+// RegisterRequest 用户注册请求
+type RegisterRequest struct {
+	Username string `json:"username" binding:"required"`
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Nickname string `json:"nickname"`
+	Phone    string `json:"phone"`
+}
+
+// UpdateProfileRequest 修改个人资料请求，未提供的字段保持不变
+type UpdateProfileRequest struct {
+	Email    *string `json:"email"`
+	Nickname *string `json:"nickname"`
+	Phone    *string `json:"phone"`
+}
+
+// ChangePasswordRequest 修改密码请求
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// ResetPasswordRequest 使用重置令牌设置新密码请求
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
 }
 
 func Login(c *gin.Context) {
@@ -38,49 +72,211 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	// 查找用户
+	// 查找用户，管理端（userType=admin）登录接受所有后台工作人员角色
 	var user models.User
-	if err := models.DB.Where("username = ? AND user_type = ?", req.Username, req.UserType).First(&user).Error; err != nil {
+	if err := models.DB.Where("username = ?", req.Username).First(&user).Error; err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户名或密码错误"})
 		return
 	}
+	if req.UserType == models.RoleAdmin && !models.IsStaffRole(user.UserType) ||
+		req.UserType != models.RoleAdmin && user.UserType != req.UserType {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户名或密码错误"})
+		return
+	}
+
+	// 连续失败被锁定期间不校验密码，避免锁定期内继续暴力尝试
+	now := time.Now()
+	if remaining := services.LoginLockRemaining(&user, now); remaining > 0 {
+		respondLoginLocked(c, remaining)
+		return
+	}
 
-	// 验证密码
+	// 验证密码，失败次数达到上限后按指数退避锁定账号
 	if !user.CheckPassword(req.Password) {
+		lockFor, err := services.RecordLoginFailure(models.DB, &user, now)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "登录失败"})
+			return
+		}
+		if lockFor > 0 {
+			respondLoginLocked(c, lockFor)
+			return
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户名或密码错误"})
 		return
 	}
+	if !user.IsActive {
+		c.JSON(http.StatusForbidden, gin.H{"error": "账号已停用，请联系管理员"})
+		return
+	}
+	if err := services.RecordLoginSuccess(models.DB, &user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "登录失败"})
+		return
+	}
 
-	// 生成JWT token
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		jwtSecret = "urban-traffic-secret-key-2024"
+	// 创建登录会话，签发短期访问令牌和刷新令牌
+	tokens, err := services.IssueTokens(&user, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成token失败"})
+		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":   user.ID,
-		"username":  user.Username,
-		"user_type": user.UserType,
-		"exp":       time.Now().Add(time.Hour * 24).Unix(),
+	c.JSON(http.StatusOK, LoginResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    tokens.ExpiresIn,
+		User:         user,
+		Message:      "登录成功",
+	})
+}
+
+// respondLoginLocked 账号被临时锁定时返回 429，Retry-After 为剩余锁定秒数
+func respondLoginLocked(c *gin.Context, remaining time.Duration) {
+	retryAfter := int(math.Ceil(remaining.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       "登录失败次数过多，账号已临时锁定，请稍后再试",
+		"retry_after": retryAfter,
 	})
+}
+
+// RefreshToken 使用刷新令牌换取新的访问令牌和刷新令牌，旧刷新令牌随即失效
+func RefreshToken(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
 
-	tokenString, err := token.SignedString([]byte(jwtSecret))
+	tokens, err := services.RefreshTokens(req.RefreshToken, c.Request.UserAgent(), c.ClientIP())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成token失败"})
+		if errors.Is(err, services.ErrInvalidRefreshToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "刷新token失败"})
 		return
 	}
 
-	c.JSON(http.StatusOK, LoginResponse{
-		Token:   tokenString,
-		User:    user,
-		Message: "登录成功",
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    tokens,
+		"message": "刷新token成功",
 	})
 }
 
+// Logout 退出登录：撤销当前访问令牌和所属的登录会话
 func Logout(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	claims, ok := c.Get("token_claims")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := services.RevokeAccessToken(tx, claims.(*services.AccessClaims)); err != nil {
+			return err
+		}
+		_, err := services.RevokeSession(tx, userID, c.GetUint("session_id"))
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "退出登录失败"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "退出登录成功"})
 }
 
+// LogoutAll 退出所有设备：撤销当前用户的全部登录会话
+func LogoutAll(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	count, err := services.RevokeUserSessions(models.DB, userID.(uint), 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "退出登录失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    gin.H{"revoked_sessions": count},
+		"message": "已退出所有设备",
+	})
+}
+
+// GetAuthSessions 获取当前用户有效的登录会话（登录设备）列表
+func GetAuthSessions(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	sessions, err := services.ActiveSessions(models.DB, userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取登录设备失败"})
+		return
+	}
+
+	currentID := c.GetUint("session_id")
+	data := make([]gin.H, 0, len(sessions))
+	for _, session := range sessions {
+		data = append(data, gin.H{
+			"id":           session.ID,
+			"user_agent":   session.UserAgent,
+			"ip":           session.IP,
+			"created_at":   session.CreatedAt,
+			"last_used_at": session.LastUsedAt,
+			"expires_at":   session.ExpiresAt,
+			"current":      session.ID == currentID,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    data,
+		"message": "获取登录设备成功",
+	})
+}
+
+// RevokeAuthSession 注销当前用户的指定登录会话（下线某台设备）
+func RevokeAuthSession(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	sessionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的会话ID"})
+		return
+	}
+
+	revoked, err := services.RevokeSession(models.DB, userID.(uint), uint(sessionID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "注销登录设备失败"})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "登录会话不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "登录设备已下线",
+	})
+}
+
 func GetCurrentUser(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -96,3 +292,196 @@ func GetCurrentUser(c *gin.Context) {
 
 	c.JSON(http.StatusOK, user)
 }
+
+// Register 用户注册，注册的账号均为普通用户
+func Register(c *gin.Context) {
+	var req RegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	user, err := services.RegisterUser(req.Username, req.Email, req.Password, req.Nickname, req.Phone)
+	if err != nil {
+		respondAccountError(c, err, "注册失败")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    user,
+		"message": "注册成功",
+	})
+}
+
+// UpdateProfile 修改当前用户的个人资料
+func UpdateProfile(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	var req UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	var user models.User
+	if err := models.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	auditTarget(c, "user", user.ID)
+	auditBefore(c, user)
+
+	updates := map[string]interface{}{}
+	if req.Email != nil {
+		email, err := services.NormalizeEmail(*req.Email)
+		if err != nil {
+			respondAccountError(c, err, "修改资料失败")
+			return
+		}
+		if err := services.CheckAccountAvailable(models.DB, "", email, user.ID); err != nil {
+			respondAccountError(c, err, "修改资料失败")
+			return
+		}
+		updates["email"] = email
+	}
+	if req.Nickname != nil {
+		nickname := strings.TrimSpace(*req.Nickname)
+		if len([]rune(nickname)) > 50 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "昵称不能超过50个字符"})
+			return
+		}
+		updates["nickname"] = nickname
+	}
+	if req.Phone != nil {
+		phone := strings.TrimSpace(*req.Phone)
+		if len(phone) > 20 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "手机号格式不正确"})
+			return
+		}
+		updates["phone"] = phone
+	}
+
+	if len(updates) > 0 {
+		if err := models.DB.Model(&user).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "修改资料失败"})
+			return
+		}
+		models.DB.First(&user, user.ID)
+	}
+	auditAfter(c, user)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    user,
+		"message": "资料修改成功",
+	})
+}
+
+// ChangePassword 当前用户验证原密码后修改密码
+func ChangePassword(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	var user models.User
+	if err := models.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	if !user.CheckPassword(req.OldPassword) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "原密码错误"})
+		return
+	}
+	if err := services.ValidatePassword(req.NewPassword); err != nil {
+		respondAccountError(c, err, "修改密码失败")
+		return
+	}
+
+	// 修改密码后其他设备的登录全部失效，当前设备保持登录
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := services.SetUserPassword(tx, &user, req.NewPassword); err != nil {
+			return err
+		}
+		_, err := services.RevokeUserSessions(tx, user.ID, c.GetUint("session_id"))
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改密码失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "密码修改成功",
+	})
+}
+
+// ForgotPassword 申请重置密码，重置令牌通过通知渠道发送到注册邮箱
+func ForgotPassword(c *gin.Context) {
+	var req struct {
+		Email string `json:"email" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	if err := services.RequestPasswordReset(req.Email); err != nil {
+		respondAccountError(c, err, "发送重置令牌失败")
+		return
+	}
+
+	// 无论邮箱是否注册都返回相同结果
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "如果该邮箱已注册，重置令牌已发送",
+	})
+}
+
+// ResetPassword 使用一次性令牌重置密码
+func ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	if err := services.ResetPassword(req.Token, req.NewPassword); err != nil {
+		respondAccountError(c, err, "重置密码失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "密码重置成功，请使用新密码登录",
+	})
+}
+
+// respondAccountError 将账号相关的校验错误转换为对应的响应
+func respondAccountError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrUsernameTaken), errors.Is(err, services.ErrEmailTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidUsername), errors.Is(err, services.ErrInvalidEmail),
+		errors.Is(err, services.ErrWeakPassword), errors.Is(err, services.ErrInvalidResetToken):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrNotifierNotConfigured):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
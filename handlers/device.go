@@ -21,7 +21,7 @@ func GetDeviceExpenses(c *gin.Context) {
 	period := c.DefaultQuery("period", "month")
 
 	var expenses []models.DeviceExpense
-	result := models.DB.Where("period = ?", period).
+	result := models.DB.Scopes(deviceScope(c, "device_id")).Where("period = ?", period).
 		Order("expense_date desc").
 		Find(&expenses)
 
@@ -55,7 +55,7 @@ func GetDeviceExpenses(c *gin.Context) {
 // GetDeviceMaintenanceRecords 获取设备维修记录
 func GetDeviceMaintenanceRecords(c *gin.Context) {
 	var records []models.DeviceMaintenanceRecord
-	result := models.DB.Preload("Device").
+	result := models.DB.Scopes(deviceScope(c, "device_id")).Preload("Device").
 		Order("start_time desc").
 		Limit(100).
 		Find(&records)
@@ -75,7 +75,7 @@ func GetDeviceMaintenanceRecords(c *gin.Context) {
 // GetDeviceFaultStats 获取设备故障统计
 func GetDeviceFaultStats(c *gin.Context) {
 	var stats []models.DeviceFaultStats
-	result := models.DB.Order("stat_date desc").
+	result := models.DB.Scopes(orgScope(c, "organization_id")).Order("stat_date desc").
 		Limit(10).
 		Find(&stats)
 
@@ -114,7 +114,7 @@ func GetDeviceFaultStats(c *gin.Context) {
 // GetDeviceAlarms 获取设备报警
 func GetDeviceAlarms(c *gin.Context) {
 	var alarms []models.DeviceAlarm
-	result := models.DB.Preload("Device").
+	result := models.DB.Scopes(deviceScope(c, "device_id")).Preload("Device").
 		Where("status = ?", "active").
 		Order("alarm_time desc").
 		Limit(50).
@@ -135,7 +135,7 @@ func GetDeviceAlarms(c *gin.Context) {
 // GetDeviceAlarmStats 获取设备报警统计
 func GetDeviceAlarmStats(c *gin.Context) {
 	var alarmStats []models.DeviceAlarmStats
-	result := models.DB.Order("stat_date desc, hour").
+	result := models.DB.Scopes(orgScope(c, "organization_id")).Order("stat_date desc, hour").
 		Limit(24). // 最近24小时
 		Find(&alarmStats)
 
@@ -175,7 +175,7 @@ func GetDeviceAlarmStats(c *gin.Context) {
 // GetDeviceFaultTrend 获取设备故障趋势
 func GetDeviceFaultTrend(c *gin.Context) {
 	var trends []models.DeviceFaultStats
-	result := models.DB.Where("period = ?", "daily").
+	result := models.DB.Scopes(orgScope(c, "organization_id")).Where("period = ?", "daily").
 		Order("stat_date desc").
 		Limit(30). // 最近30天
 		Find(&trends)
@@ -0,0 +1,213 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"urban_traffic_backend/models"
+	"urban_traffic_backend/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// DeviceCredentialRequest 签发设备凭证请求，device_id 与 camera_id 二选一
+type DeviceCredentialRequest struct {
+	Name     string `json:"name" binding:"required"`
+	DeviceID *uint  `json:"device_id"`
+	CameraID *uint  `json:"camera_id"`
+	Global   bool   `json:"global"` // 平台级凭证，只有平台超级管理员可以签发
+}
+
+// GetDeviceCredentials 查询设备凭证列表，可按设备、摄像头和状态筛选
+func GetDeviceCredentials(c *gin.Context) {
+	query := models.DB.Scopes(credentialScope(c)).Preload("Device").Preload("Camera")
+	if deviceID := c.Query("device_id"); deviceID != "" {
+		query = query.Where("device_id = ?", deviceID)
+	}
+	if cameraID := c.Query("camera_id"); cameraID != "" {
+		query = query.Where("camera_id = ?", cameraID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var credentials []models.DeviceCredential
+	if err := query.Order("created_at DESC").Find(&credentials).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取设备凭证失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    credentials,
+		"message": "获取设备凭证成功",
+	})
+}
+
+// CreateDeviceCredential 为设备或监控摄像头签发凭证，明文密钥只在本次响应中返回
+func CreateDeviceCredential(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	var req DeviceCredentialRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	if req.Global && c.GetString("user_type") != models.RoleSuperAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只有平台超级管理员可以签发平台级凭证"})
+		return
+	}
+
+	// 只能为本组织的设备或摄像头签发凭证
+	var owned int64
+	if req.DeviceID != nil {
+		models.DB.Model(&models.Device{}).Scopes(orgScope(c, "organization_id")).Where("id = ?", *req.DeviceID).Count(&owned)
+	} else if req.CameraID != nil {
+		models.DB.Model(&models.MonitoringCamera{}).Scopes(orgScope(c, "organization_id")).Where("id = ?", *req.CameraID).Count(&owned)
+	}
+	if (req.DeviceID != nil || req.CameraID != nil) && owned == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "设备或摄像头不存在"})
+		return
+	}
+
+	credential, key, err := services.CreateDeviceCredential(models.DB, req.Name, req.DeviceID, req.CameraID, req.Global, userID.(uint))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrCredentialSubject):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "设备或摄像头不存在"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "签发设备凭证失败"})
+		}
+		return
+	}
+
+	auditTarget(c, "device_credential", credential.ID)
+	auditAfter(c, credential)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data": gin.H{
+			"credential": credential,
+			"key":        key,
+		},
+		"message": "设备凭证签发成功，请妥善保存密钥，之后将无法再次查看",
+	})
+}
+
+// RotateDeviceCredential 轮换设备密钥，旧密钥在宽限期内仍可使用
+func RotateDeviceCredential(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的凭证ID"})
+		return
+	}
+
+	var before models.DeviceCredential
+	if err := models.DB.Scopes(credentialScope(c)).First(&before, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "设备凭证不存在"})
+		return
+	}
+	auditBefore(c, before)
+
+	credential, key, err := services.RotateDeviceCredential(models.DB, uint(id), time.Now())
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "设备凭证不存在"})
+		case errors.Is(err, services.ErrCredentialRevoked):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "轮换设备密钥失败"})
+		}
+		return
+	}
+
+	auditTarget(c, "device_credential", credential.ID)
+	auditAfter(c, credential)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"credential": credential,
+			"key":        key,
+		},
+		"message": "设备密钥轮换成功",
+	})
+}
+
+// RevokeDeviceCredential 吊销设备凭证，设备随即无法上报数据
+func RevokeDeviceCredential(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的凭证ID"})
+		return
+	}
+
+	var before models.DeviceCredential
+	if err := models.DB.Scopes(credentialScope(c)).First(&before, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "设备凭证不存在"})
+		return
+	}
+	auditBefore(c, before)
+
+	credential, err := services.RevokeDeviceCredential(models.DB, uint(id), time.Now())
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "设备凭证不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "吊销设备凭证失败"})
+		return
+	}
+
+	auditTarget(c, "device_credential", credential.ID)
+	auditAfter(c, credential)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    credential,
+		"message": "设备凭证已吊销",
+	})
+}
+
+// deviceCredentialID 当前请求的设备凭证ID，用于把写入记录归属到上报的设备
+func deviceCredentialID(c *gin.Context) *uint {
+	id, ok := c.Get("device_credential_id")
+	if !ok {
+		return nil
+	}
+	credentialID := id.(uint)
+	return &credentialID
+}
+
+// credentialScope 按设备或摄像头所属组织过滤设备凭证
+func credentialScope(c *gin.Context) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		orgID, all := callerOrganization(c)
+		if all {
+			return db
+		}
+		return db.Where("global = ? AND (device_id IN (?) OR camera_id IN (?))", false,
+			models.DB.Model(&models.Device{}).Select("id").Where("organization_id = ?", orgID),
+			models.DB.Model(&models.MonitoringCamera{}).Select("id").Where("organization_id = ?", orgID))
+	}
+}
@@ -0,0 +1,271 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"urban_traffic_backend/models"
+	"urban_traffic_backend/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// IssueInvoiceRequest 开具收据请求，会话和历史停车记录二选一
+type IssueInvoiceRequest struct {
+	SessionID       *uint `json:"session_id"`
+	ParkingRecordID *uint `json:"parking_record_id"`
+}
+
+// invoiceTemplate 收据下载使用的 HTML 模板，可直接打印
+var invoiceTemplate = template.Must(template.New("invoice").Funcs(template.FuncMap{
+	"money": func(amount float64) string { return fmt.Sprintf("%.2f", amount) },
+	"time":  func(t time.Time) string { return t.Format("2006-01-02 15:04:05") },
+	"spot":  services.SpotTypeName,
+}).Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head><meta charset="utf-8"><title>停车费收据 {{.InvoiceNo}}</title></head>
+<body>
+<h2>停车费收据</h2>
+<p>收据编号：{{.InvoiceNo}}<br>开具时间：{{time .IssuedAt}}</p>
+<table border="1" cellspacing="0" cellpadding="4">
+<tr><td>停车场</td><td>{{.ParkingLotName}}</td></tr>
+<tr><td>地址</td><td>{{.ParkingLotAddr}}</td></tr>
+<tr><td>车牌号</td><td>{{.PlateNumber}}</td></tr>
+<tr><td>车位类型</td><td>{{spot .SpotType}}{{if .SpotCode}}（{{.SpotCode}}）{{end}}</td></tr>
+<tr><td>入场时间</td><td>{{time .StartTime}}</td></tr>
+<tr><td>离场时间</td><td>{{time .EndTime}}</td></tr>
+<tr><td>停车时长</td><td>{{.DurationMinutes}} 分钟</td></tr>
+{{if .TariffRule}}<tr><td>计费规则</td><td>{{.TariffRule}}</td></tr>{{end}}
+</table>
+<h3>费用明细</h3>
+<table border="1" cellspacing="0" cellpadding="4">
+<tr><th>项目</th><th>数量</th><th>单价</th><th>金额</th></tr>
+{{range .Items}}<tr><td>{{.Name}}</td><td>{{.Quantity}}</td><td>{{money .UnitPrice}}</td><td>{{money .Amount}}</td></tr>
+{{end}}</table>
+<p>停车费：{{money .Subtotal}} 元<br>附加费：{{money .Surcharge}} 元<br><strong>合计：{{money .Total}} 元</strong></p>
+<p>支付状态：{{if eq .PaymentStatus "paid"}}已支付{{else}}未支付{{end}}{{if .PaymentMethod}}<br>支付方式：{{.PaymentMethod}}{{end}}{{if .PaymentOrderNo}}<br>支付订单号：{{.PaymentOrderNo}}{{end}}</p>
+</body>
+</html>
+`))
+
+// driverInvoiceScope 用户可见的收据：本人的收据，以及本人作为车主或驾驶人的车辆的会话和停车记录的收据
+func driverInvoiceScope(userID interface{}) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		uid, _ := userID.(uint)
+		vehicleIDs := services.MemberVehicleIDs(uid)
+		return db.Where("(user_id = ? OR session_id IN (?) OR parking_record_id IN (?))", uid,
+			models.DB.Model(&models.ParkingSession{}).Select("id").Where("vehicle_id IN (?)", vehicleIDs),
+			models.DB.Model(&models.ParkingRecord{}).Select("id").Where("vehicle_id IN (?)", vehicleIDs))
+	}
+}
+
+// IssueInvoice 为当前用户可见的已结束或已支付的停车会话（或历史停车记录）开具收据，
+// 车辆的车主和驾驶人均可申请，重复申请返回同一张收据
+func IssueInvoice(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	var req IssueInvoiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil || (req.SessionID == nil) == (req.ParkingRecordID == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请指定停车会话或停车记录"})
+		return
+	}
+
+	tx := models.DB.Begin()
+
+	var invoice *models.Invoice
+	var err error
+	if req.SessionID != nil {
+		var count int64
+		if err := tx.Model(&models.ParkingSession{}).Scopes(driverSessionScope(userID)).
+			Where("id = ?", *req.SessionID).Count(&count).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "开具收据失败"})
+			return
+		}
+		if count == 0 {
+			tx.Rollback()
+			c.JSON(http.StatusNotFound, gin.H{"error": "停车会话不存在"})
+			return
+		}
+		invoice, err = services.IssueSessionInvoice(tx, *req.SessionID)
+	} else {
+		var count int64
+		uid, _ := userID.(uint)
+		if err := tx.Model(&models.ParkingRecord{}).
+			Where("id = ? AND vehicle_id IN (?)", *req.ParkingRecordID, services.MemberVehicleIDs(uid)).
+			Count(&count).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "开具收据失败"})
+			return
+		}
+		if count == 0 {
+			tx.Rollback()
+			c.JSON(http.StatusNotFound, gin.H{"error": "停车记录不存在"})
+			return
+		}
+		invoice, err = services.IssueRecordInvoice(tx, *req.ParkingRecordID)
+	}
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, services.ErrInvoiceNotAllowed) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "开具收据失败"})
+		return
+	}
+
+	tx.Commit()
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    invoice,
+		"message": "收据开具成功",
+	})
+}
+
+// GetInvoices 获取当前用户的收据列表，包括本人作为车主或驾驶人的车辆的收据
+func GetInvoices(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 50 {
+		pageSize = 10
+	}
+
+	var total int64
+	models.DB.Model(&models.Invoice{}).Scopes(driverInvoiceScope(userID)).Count(&total)
+
+	var invoices []models.Invoice
+	models.DB.Preload("Items").Scopes(driverInvoiceScope(userID)).
+		Order("issued_at DESC").Limit(pageSize).Offset((page - 1) * pageSize).Find(&invoices)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"data":      invoices,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// DownloadInvoice 下载收据（HTML 文档）
+func DownloadInvoice(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	scope := financeScope(c, userID)
+	if !hasPermission(c, models.PermFinanceRead) {
+		scope = driverInvoiceScope(userID)
+	}
+	query := models.DB.Preload("Items").Where("id = ?", c.Param("id")).Scopes(scope)
+
+	var invoice models.Invoice
+	if err := query.First(&invoice).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "收据不存在"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.html"`, invoice.InvoiceNo))
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := invoiceTemplate.Execute(c.Writer, &invoice); err != nil {
+		log.Printf("render invoice %s failed: %v", invoice.InvoiceNo, err)
+	}
+}
+
+// ExportInvoices 管理员按时间段批量导出已开具的收据（CSV），只读；漏开的收据由 InvoiceBackfillJob 补开
+func ExportInvoices(c *gin.Context) {
+	from, err := time.ParseInLocation("2006-01-02", c.Query("from"), time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的开始日期"})
+		return
+	}
+	to, err := time.ParseInLocation("2006-01-02", c.Query("to"), time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的结束日期"})
+		return
+	}
+	// 结束日期包含当天
+	to = to.AddDate(0, 0, 1)
+	if !to.After(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "结束日期必须晚于开始日期"})
+		return
+	}
+
+	var invoices []models.Invoice
+	if err := models.DB.Scopes(lotScope(c, "parking_lot_id")).Where("end_time >= ? AND end_time < ?", from, to).
+		Order("invoice_no").Find(&invoices).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "导出收据失败"})
+		return
+	}
+
+	filename := fmt.Sprintf("invoices_%s_%s.csv", from.Format("20060102"), to.AddDate(0, 0, -1).Format("20060102"))
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	// 写入 UTF-8 BOM，便于 Excel 正确识别中文
+	c.Writer.Write([]byte("\xEF\xBB\xBF"))
+	writer := csv.NewWriter(c.Writer)
+	writer.Write([]string{"收据编号", "开具时间", "停车场", "车牌号", "车位类型", "入场时间", "离场时间",
+		"停车时长(分钟)", "停车费", "附加费", "合计", "支付状态", "支付方式", "支付订单号"})
+	for _, invoice := range invoices {
+		writer.Write([]string{
+			invoice.InvoiceNo,
+			invoice.IssuedAt.Format("2006-01-02 15:04:05"),
+			csvCell(invoice.ParkingLotName),
+			csvCell(invoice.PlateNumber),
+			services.SpotTypeName(invoice.SpotType),
+			invoice.StartTime.Format("2006-01-02 15:04:05"),
+			invoice.EndTime.Format("2006-01-02 15:04:05"),
+			strconv.Itoa(invoice.DurationMinutes),
+			fmt.Sprintf("%.2f", invoice.Subtotal),
+			fmt.Sprintf("%.2f", invoice.Surcharge),
+			fmt.Sprintf("%.2f", invoice.Total),
+			invoice.PaymentStatus,
+			csvCell(invoice.PaymentMethod),
+			csvCell(invoice.PaymentOrderNo),
+		})
+	}
+	writer.Flush()
+}
+
+// csvCell 以 =、+、-、@、制表符或回车开头的文本前加单引号，避免在表格软件中被当作公式执行
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
@@ -0,0 +1,235 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"urban_traffic_backend/models"
+	"urban_traffic_backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WeeklyHoursRequest 替换每周营业时段请求，hours 为空表示恢复按营业时间文本营业
+type WeeklyHoursRequest struct {
+	Hours []struct {
+		Weekday   int    `json:"weekday"`
+		OpenTime  string `json:"open_time"`
+		CloseTime string `json:"close_time"`
+	} `json:"hours"`
+}
+
+// HolidayRequest 节假日安排请求
+type HolidayRequest struct {
+	Date      string `json:"date" binding:"required"`
+	Name      string `json:"name"`
+	Closed    bool   `json:"closed"`
+	OpenTime  string `json:"open_time"`
+	CloseTime string `json:"close_time"`
+}
+
+// ClosureRequest 临时关闭请求
+type ClosureRequest struct {
+	StartAt time.Time `json:"start_at" binding:"required"`
+	EndAt   time.Time `json:"end_at" binding:"required"`
+	Reason  string    `json:"reason"`
+}
+
+// respondHoursError 将营业时间相关的校验错误转换为响应
+func respondHoursError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidHours), errors.Is(err, services.ErrInvalidWeekday),
+		errors.Is(err, services.ErrInvalidHolidayDate), errors.Is(err, services.ErrInvalidClosure):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// GetParkingLotHours 查看停车场的营业安排和当前是否营业
+func GetParkingLotHours(c *gin.Context) {
+	lot, ok := findManagedParkingLot(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	schedule, err := services.LoadLotSchedule(models.DB, lot, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取营业时间失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"schedule": schedule,
+			"open_now": schedule.IsOpen(now),
+		},
+		"message": "获取营业时间成功",
+	})
+}
+
+// SetParkingLotWeeklyHours 替换停车场的每周营业时段
+func SetParkingLotWeeklyHours(c *gin.Context) {
+	lot, ok := findManagedParkingLot(c)
+	if !ok {
+		return
+	}
+
+	var req WeeklyHoursRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	entries := make([]models.ParkingLotHours, 0, len(req.Hours))
+	for _, item := range req.Hours {
+		entries = append(entries, models.ParkingLotHours{
+			Weekday:   item.Weekday,
+			OpenTime:  strings.TrimSpace(item.OpenTime),
+			CloseTime: strings.TrimSpace(item.CloseTime),
+		})
+	}
+
+	var before []models.ParkingLotHours
+	models.DB.Where("parking_lot_id = ?", lot.ID).Find(&before)
+	auditTarget(c, "parking_lot", lot.ID)
+	auditBefore(c, before)
+	saved, err := services.SetWeeklyHours(models.DB, lot.ID, entries)
+	if err != nil {
+		respondHoursError(c, err, "保存营业时段失败")
+		return
+	}
+	auditAfter(c, saved)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    saved,
+		"message": "营业时段保存成功",
+	})
+}
+
+// SaveParkingLotHoliday 新增或覆盖停车场某天的节假日安排
+func SaveParkingLotHoliday(c *gin.Context) {
+	lot, ok := findManagedParkingLot(c)
+	if !ok {
+		return
+	}
+
+	var req HolidayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	holiday := models.ParkingLotHoliday{
+		ParkingLotID: lot.ID,
+		Date:         strings.TrimSpace(req.Date),
+		Name:         strings.TrimSpace(req.Name),
+		Closed:       req.Closed,
+		OpenTime:     strings.TrimSpace(req.OpenTime),
+		CloseTime:    strings.TrimSpace(req.CloseTime),
+	}
+	if err := services.SaveHoliday(models.DB, &holiday); err != nil {
+		respondHoursError(c, err, "保存节假日安排失败")
+		return
+	}
+	auditTarget(c, "parking_lot_holiday", holiday.ID)
+	auditAfter(c, holiday)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    holiday,
+		"message": "节假日安排保存成功",
+	})
+}
+
+// DeleteParkingLotHoliday 删除节假日安排，当天恢复按每周时段营业
+func DeleteParkingLotHoliday(c *gin.Context) {
+	lot, ok := findManagedParkingLot(c)
+	if !ok {
+		return
+	}
+
+	var holiday models.ParkingLotHoliday
+	if err := models.DB.Where("id = ? AND parking_lot_id = ?", c.Param("holidayId"), lot.ID).First(&holiday).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "节假日安排不存在"})
+		return
+	}
+	auditTarget(c, "parking_lot_holiday", holiday.ID)
+	auditBefore(c, holiday)
+	if err := models.DB.Delete(&holiday).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除节假日安排失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "节假日安排删除成功"})
+}
+
+// CreateParkingLotClosure 新增临时关闭时段，时段内不能开始停车或预约
+func CreateParkingLotClosure(c *gin.Context) {
+	lot, ok := findManagedParkingLot(c)
+	if !ok {
+		return
+	}
+
+	var req ClosureRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	createdBy := c.GetUint("user_id")
+	closure := models.ParkingLotClosure{
+		ParkingLotID: lot.ID,
+		StartAt:      req.StartAt,
+		EndAt:        req.EndAt,
+		Reason:       strings.TrimSpace(req.Reason),
+		CreatedBy:    &createdBy,
+	}
+	if err := services.CreateClosure(models.DB, &closure); err != nil {
+		respondHoursError(c, err, "创建临时关闭失败")
+		return
+	}
+	auditTarget(c, "parking_lot_closure", closure.ID)
+	auditAfter(c, closure)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    closure,
+		"message": "临时关闭创建成功",
+	})
+}
+
+// DeleteParkingLotClosure 取消临时关闭
+func DeleteParkingLotClosure(c *gin.Context) {
+	lot, ok := findManagedParkingLot(c)
+	if !ok {
+		return
+	}
+
+	var closure models.ParkingLotClosure
+	if err := models.DB.Where("id = ? AND parking_lot_id = ?", c.Param("closureId"), lot.ID).First(&closure).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "临时关闭不存在"})
+		return
+	}
+	auditTarget(c, "parking_lot_closure", closure.ID)
+	auditBefore(c, closure)
+	if err := models.DB.Delete(&closure).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "取消临时关闭失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "临时关闭已取消"})
+}
@@ -0,0 +1,267 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"urban_traffic_backend/models"
+	"urban_traffic_backend/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// OrganizationRequest 新建或修改组织请求
+type OrganizationRequest struct {
+	Code         string `json:"code"`
+	Name         string `json:"name"`
+	ContactName  string `json:"contact_name"`
+	ContactPhone string `json:"contact_phone"`
+	IsActive     *bool  `json:"is_active"`
+}
+
+// AssignOrganizationRequest 将停车场、设备、摄像头和后台工作人员划归组织
+type AssignOrganizationRequest struct {
+	ParkingLotIDs []uint `json:"parking_lot_ids"`
+	DeviceIDs     []uint `json:"device_ids"`
+	CameraIDs     []uint `json:"camera_ids"`
+	UserIDs       []uint `json:"user_ids"`
+}
+
+// callerOrganization 当前用户的组织范围，平台超级管理员 all 为 true，不受组织限制，
+// 也可以通过 organization_id 查询参数只看某个组织。未归属任何组织的工作人员返回 0，匹配不到任何数据
+func callerOrganization(c *gin.Context) (orgID uint, all bool) {
+	if c.GetString("user_type") == models.RoleSuperAdmin {
+		if id, err := strconv.ParseUint(c.Query("organization_id"), 10, 32); err == nil {
+			return uint(id), false
+		}
+		return 0, true
+	}
+	return c.GetUint("organization_id"), false
+}
+
+// orgScope 按调用者组织过滤带 organization_id 列的表
+func orgScope(c *gin.Context, column string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		orgID, all := callerOrganization(c)
+		if all {
+			return db
+		}
+		return db.Where(column+" = ?", orgID)
+	}
+}
+
+// lotScope 按停车场所属组织过滤带停车场ID列的表
+func lotScope(c *gin.Context, column string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		orgID, all := callerOrganization(c)
+		if all {
+			return db
+		}
+		return db.Where(column+" IN (?)",
+			models.DB.Model(&models.ParkingLot{}).Select("id").Where("organization_id = ?", orgID))
+	}
+}
+
+// deviceScope 按设备所属组织过滤带设备ID列的表
+func deviceScope(c *gin.Context, column string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		orgID, all := callerOrganization(c)
+		if all {
+			return db
+		}
+		return db.Where(column+" IN (?)",
+			models.DB.Model(&models.Device{}).Select("id").Where("organization_id = ?", orgID))
+	}
+}
+
+// financeScope 订单、收据等财务记录的可见范围：本人的记录，
+// 拥有财务查看权限时还包括本组织停车场的全部记录
+func financeScope(c *gin.Context, userID interface{}) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if !hasPermission(c, models.PermFinanceRead) {
+			return db.Where("user_id = ?", userID)
+		}
+		orgID, all := callerOrganization(c)
+		if all {
+			return db
+		}
+		return db.Where("(user_id = ? OR parking_lot_id IN (?))", userID,
+			models.DB.Model(&models.ParkingLot{}).Select("id").Where("organization_id = ?", orgID))
+	}
+}
+
+// GetOrganizations 平台超级管理员查询组织列表
+func GetOrganizations(c *gin.Context) {
+	var organizations []models.Organization
+	if err := models.DB.Order("id").Find(&organizations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取组织列表失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    organizations,
+		"message": "获取组织列表成功",
+	})
+}
+
+// CreateOrganization 平台超级管理员新建组织
+func CreateOrganization(c *gin.Context) {
+	var req OrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	req.Code = strings.TrimSpace(req.Code)
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Code == "" || req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "组织编码和名称不能为空"})
+		return
+	}
+
+	var count int64
+	models.DB.Model(&models.Organization{}).Where("code = ?", req.Code).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "组织编码已存在"})
+		return
+	}
+
+	organization := models.Organization{
+		Code:         req.Code,
+		Name:         req.Name,
+		ContactName:  req.ContactName,
+		ContactPhone: req.ContactPhone,
+		IsActive:     req.IsActive == nil || *req.IsActive,
+	}
+	if err := models.DB.Create(&organization).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建组织失败"})
+		return
+	}
+	auditTarget(c, "organization", organization.ID)
+	auditAfter(c, organization)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    organization,
+		"message": "组织创建成功",
+	})
+}
+
+// UpdateOrganization 平台超级管理员修改组织信息，组织编码不可修改
+func UpdateOrganization(c *gin.Context) {
+	var organization models.Organization
+	if err := models.DB.First(&organization, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "组织不存在"})
+		return
+	}
+
+	var req OrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	auditTarget(c, "organization", organization.ID)
+	auditBefore(c, organization)
+	updates := map[string]interface{}{
+		"contact_name":  req.ContactName,
+		"contact_phone": req.ContactPhone,
+	}
+	if name := strings.TrimSpace(req.Name); name != "" {
+		updates["name"] = name
+	}
+	if req.IsActive != nil {
+		updates["is_active"] = *req.IsActive
+	}
+	if err := models.DB.Model(&organization).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改组织失败"})
+		return
+	}
+	models.DB.First(&organization, organization.ID)
+	auditAfter(c, organization)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    organization,
+		"message": "组织修改成功",
+	})
+}
+
+// AssignOrganization 平台超级管理员将停车场、设备、摄像头和后台工作人员划归组织。
+// 停车场的统计数据按停车场归属，设备的支出、维修和报警记录按设备归属，随之转移
+func AssignOrganization(c *gin.Context) {
+	var organization models.Organization
+	if err := models.DB.First(&organization, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "组织不存在"})
+		return
+	}
+
+	var req AssignOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	assigned := gin.H{}
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		targets := []struct {
+			key   string
+			model interface{}
+			ids   []uint
+			where string
+		}{
+			{"parking_lots", &models.ParkingLot{}, req.ParkingLotIDs, ""},
+			{"devices", &models.Device{}, req.DeviceIDs, ""},
+			{"cameras", &models.MonitoringCamera{}, req.CameraIDs, ""},
+			// 只有后台工作人员可以归属组织，普通用户和平台超级管理员不受影响
+			{"users", &models.User{}, req.UserIDs, "user_type NOT IN ('user', 'super_admin')"},
+		}
+		for _, target := range targets {
+			if len(target.ids) == 0 {
+				continue
+			}
+			query := tx.Model(target.model).Where("id IN ?", target.ids)
+			if target.where != "" {
+				query = query.Where(target.where)
+			}
+			result := query.Update("organization_id", organization.ID)
+			if result.Error != nil {
+				return result.Error
+			}
+			assigned[target.key] = result.RowsAffected
+		}
+		// 工作人员的组织写在访问令牌中，撤销其登录会话使新的组织范围立即生效
+		var staffIDs []uint
+		if len(req.UserIDs) > 0 {
+			tx.Model(&models.User{}).Where("id IN ? AND organization_id = ?", req.UserIDs, organization.ID).Pluck("id", &staffIDs)
+		}
+		for _, userID := range staffIDs {
+			if _, err := services.RevokeUserSessions(tx, userID, 0); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "划归组织失败"})
+		return
+	}
+	auditTarget(c, "organization", organization.ID)
+	auditAfter(c, req)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    assigned,
+		"message": "划归组织成功",
+	})
+}
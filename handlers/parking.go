@@ -9,33 +9,70 @@
 package handlers
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"math"
 	"net/http"
-	"sort"
 	"strconv"
+	"time"
 
 	"urban_traffic_backend/models"
+	"urban_traffic_backend/services"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
-// 计算两点间距离
+// 计算两点间距离（公里）
 func calculateDistance(lat1, lon1, lat2, lon2 float64) float64 {
-	const earthRadius = 6371 // 地球半径（公里）
+	return services.DistanceMeters(lat1, lon1, lat2, lon2) / 1000
+}
 
-	dLat := (lat2 - lat1) * math.Pi / 180
-	dLon := (lon2 - lon1) * math.Pi / 180
+// formatDistance 距离的展示文本，1 公里以内显示米
+func formatDistance(meters float64) string {
+	if meters < 1000 {
+		return strconv.FormatFloat(meters, 'f', 0, 64) + "m"
+	}
+	return strconv.FormatFloat(meters/1000, 'f', 1, 64) + "km"
+}
 
-	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
-		math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*
-			math.Sin(dLon/2)*math.Sin(dLon/2)
+// 附近停车场检索参数的默认值和上限
+const (
+	nearbyDefaultRadius = 10000 // 默认检索半径（米）
+	nearbyMaxRadius     = 50000 // 最大检索半径（米）
+	nearbyDefaultLimit  = 20
+	nearbyMaxLimit      = 100
+)
 
-	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+// nearbyCursor 附近停车场分页游标：上一页最后一条的排序键和ID
+type nearbyCursor struct {
+	Key float64 `json:"k"`
+	ID  uint    `json:"id"`
+}
+
+func encodeNearbyCursor(cursor nearbyCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
 
-	return earthRadius * c
+func decodeNearbyCursor(value string) (nearbyCursor, error) {
+	var cursor nearbyCursor
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, err
+	}
+	err = json.Unmarshal(data, &cursor)
+	return cursor, err
 }
 
-// GetNearbyParkingLots 获取附近停车场
+// GetNearbyParkingLots 获取附近停车场。
+// 检索范围：bbox（最小经度,最小纬度,最大经度,最大纬度）或以 lat/lon 为中心、radius 米为半径的圆，
+// 两者都未提供时使用默认半径，bbox 对角线不能超过最大检索直径；按 geohash 索引只读取范围内的停车场。
+// 排序：distance（默认）、available 或 rate，limit 控制每页条数，cursor 为上一页返回的 next_cursor，
+// 排序和分页在数据库中完成。
+// open_now=true 只返回当前营业的停车场，open_at（RFC3339）只返回该时刻营业的停车场。
+// 设施筛选：min_height（车辆高度，米）、coverage（indoor/outdoor）、ev_connector（逗号分隔的充电接口，匹配任一）、
+// ev、security、restroom、accessible（为 true 时只返回具备该设施的停车场）
 func GetNearbyParkingLots(c *gin.Context) {
 	// 获取用户当前位置（从查询参数）
 	latStr := c.DefaultQuery("lat", "30.2594")
@@ -43,71 +80,191 @@ func GetNearbyParkingLots(c *gin.Context) {
 	sortBy := c.DefaultQuery("sort", "distance")
 
 	lat, err := strconv.ParseFloat(latStr, 64)
-	if err != nil {
+	if err != nil || lat < -90 || lat > 90 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid latitude"})
 		return
 	}
 
 	lon, err := strconv.ParseFloat(lonStr, 64)
-	if err != nil {
+	if err != nil || lon < -180 || lon > 180 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid longitude"})
 		return
 	}
 
-	// 获取所有活跃的停车场
-	var parkingLots []models.ParkingLot
-	if err := models.DB.Preload("SpecialSpots").Where("is_active = ?", true).Find(&parkingLots).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch parking lots"})
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(nearbyDefaultLimit)))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
 		return
 	}
+	if limit > nearbyMaxLimit {
+		limit = nearbyMaxLimit
+	}
 
-	// 计算距离并构建响应数据
-	var parkingLotsWithDistance []models.ParkingLotWithDistance
-	for _, lot := range parkingLots {
-		distance := calculateDistance(lat, lon, lot.Latitude, lot.Longitude)
-		distanceStr := ""
-		if distance < 1 {
-			distanceStr = strconv.FormatFloat(distance*1000, 'f', 0, 64) + "m"
-		} else {
-			distanceStr = strconv.FormatFloat(distance, 'f', 1, 64) + "km"
+	var cursor *nearbyCursor
+	if value := c.Query("cursor"); value != "" {
+		decoded, err := decodeNearbyCursor(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
 		}
+		cursor = &decoded
+	}
 
-		// 构建特殊车位映射
-		specialSpotsMap := make(map[string]models.SpecialSpot)
-		for _, spot := range lot.SpecialSpots {
-			specialSpotsMap[spot.SpotType] = spot
+	// 营业时间筛选
+	now := time.Now()
+	var openAt *time.Time
+	if value := c.Query("open_at"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid open_at"})
+			return
 		}
+		openAt = &t
+	} else if c.Query("open_now") == "true" {
+		openAt = &now
+	}
 
-		parkingLotsWithDistance = append(parkingLotsWithDistance, models.ParkingLotWithDistance{
-			ParkingLot:      lot,
-			Distance:        distanceStr,
-			SpecialSpotsMap: specialSpotsMap,
-		})
+	amenities, err := services.ParseAmenityFilter(c.Query)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 检索范围：矩形或圆形，矩形的对角线不能超过最大检索直径
+	var box services.BoundingBox
+	radius := 0.0
+	if bbox := c.Query("bbox"); bbox != "" {
+		box, err = services.ParseBoundingBox(bbox)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if box.DiagonalMeters() > 2*nearbyMaxRadius {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bounding box too large"})
+			return
+		}
+	} else {
+		radius, err = strconv.ParseFloat(c.DefaultQuery("radius", strconv.Itoa(nearbyDefaultRadius)), 64)
+		if err != nil || radius <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid radius"})
+			return
+		}
+		if radius > nearbyMaxRadius {
+			radius = nearbyMaxRadius
+		}
+		box = services.RadiusBoundingBox(lat, lon, radius)
 	}
 
-	// 根据排序条件排序
+	// 按 geohash 索引筛选范围内的活跃停车场，排序键在数据库中计算，按排序键和ID分页
+	distanceSQL, distanceArgs := services.DistanceSQL(lat, lon)
+	keySQL, keyArgs := distanceSQL, distanceArgs
 	switch sortBy {
 	case "available":
-		sort.Slice(parkingLotsWithDistance, func(i, j int) bool {
-			return parkingLotsWithDistance[i].AvailableSpots > parkingLotsWithDistance[j].AvailableSpots
-		})
+		keySQL, keyArgs = "(-parking_lots.available_spots)", nil
 	case "rate":
-		sort.Slice(parkingLotsWithDistance, func(i, j int) bool {
-			rateI := float64(parkingLotsWithDistance[i].AvailableSpots) / float64(parkingLotsWithDistance[i].TotalSpots)
-			rateJ := float64(parkingLotsWithDistance[j].AvailableSpots) / float64(parkingLotsWithDistance[j].TotalSpots)
-			return rateI > rateJ
-		})
-	default: // distance
-		sort.Slice(parkingLotsWithDistance, func(i, j int) bool {
-			distI := calculateDistance(lat, lon, parkingLotsWithDistance[i].Latitude, parkingLotsWithDistance[i].Longitude)
-			distJ := calculateDistance(lat, lon, parkingLotsWithDistance[j].Latitude, parkingLotsWithDistance[j].Longitude)
-			return distI < distJ
-		})
+		keySQL, keyArgs = "(CASE WHEN parking_lots.total_spots > 0 THEN -parking_lots.available_spots / parking_lots.total_spots ELSE 0 END)", nil
+	}
+	query := models.DB.Model(&models.ParkingLot{}).Where("parking_lots.is_active = ?", true).
+		Scopes(services.GeoScope(box), services.AmenityScope(amenities))
+	if radius > 0 {
+		query = query.Where(distanceSQL+" <= ?", append(append([]interface{}{}, distanceArgs...), radius)...)
+	}
+	query = query.Session(&gorm.Session{})
+
+	from := now
+	if openAt != nil && openAt.Before(from) {
+		from = *openAt
+	}
+
+	// 按营业时间筛选时部分记录会被过滤，继续读取下一批直到凑满一页
+	type rankedLot struct {
+		ID      uint
+		SortKey float64
+	}
+	parkingLotsWithDistance := make([]models.ParkingLotWithDistance, 0, limit)
+	var keys []nearbyCursor
+	after := cursor
+	for len(parkingLotsWithDistance) <= limit {
+		batch := query.Select("parking_lots.id, "+keySQL+" AS sort_key", keyArgs...)
+		if after != nil {
+			args := append(append([]interface{}{}, keyArgs...), after.Key)
+			args = append(append(args, keyArgs...), after.Key, after.ID)
+			batch = batch.Where("("+keySQL+" > ? OR ("+keySQL+" = ? AND parking_lots.id > ?))", args...)
+		}
+		var ranked []rankedLot
+		if err := batch.Order("sort_key, parking_lots.id").Limit(limit + 1).Scan(&ranked).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch parking lots"})
+			return
+		}
+		if len(ranked) == 0 {
+			break
+		}
+
+		ids := make([]uint, len(ranked))
+		for i, item := range ranked {
+			ids[i] = item.ID
+		}
+		var parkingLots []models.ParkingLot
+		if err := models.DB.Preload("SpecialSpots").Where("id IN ?", ids).Find(&parkingLots).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch parking lots"})
+			return
+		}
+		schedules, err := services.LoadLotSchedules(models.DB, parkingLots, from)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch operating hours"})
+			return
+		}
+		lots := make(map[uint]models.ParkingLot, len(parkingLots))
+		for _, lot := range parkingLots {
+			lots[lot.ID] = lot
+		}
+
+		for _, item := range ranked {
+			lot, ok := lots[item.ID]
+			schedule := schedules[item.ID]
+			if !ok || openAt != nil && !schedule.IsOpen(*openAt) {
+				continue
+			}
+
+			// 构建特殊车位映射
+			specialSpotsMap := make(map[string]models.SpecialSpot)
+			for _, spot := range lot.SpecialSpots {
+				specialSpotsMap[spot.SpotType] = spot
+			}
+
+			distance := services.DistanceMeters(lat, lon, lot.Latitude, lot.Longitude)
+			parkingLotsWithDistance = append(parkingLotsWithDistance, models.ParkingLotWithDistance{
+				ParkingLot:      lot,
+				Distance:        formatDistance(distance),
+				DistanceM:       math.Round(distance),
+				OpenNow:         schedule.IsOpen(now),
+				SpecialSpotsMap: specialSpotsMap,
+			})
+			keys = append(keys, nearbyCursor{Key: item.SortKey, ID: item.ID})
+			if len(parkingLotsWithDistance) > limit {
+				break
+			}
+		}
+
+		last := ranked[len(ranked)-1]
+		after = &nearbyCursor{Key: last.SortKey, ID: last.ID}
+		if len(ranked) <= limit {
+			break
+		}
+	}
+
+	// 多读取的一条只用于判断是否还有下一页
+	nextCursor := ""
+	if len(parkingLotsWithDistance) > limit {
+		parkingLotsWithDistance = parkingLotsWithDistance[:limit]
+		nextCursor = encodeNearbyCursor(keys[limit-1])
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success":     true,
 		"data":        parkingLotsWithDistance,
+		"next_cursor": nextCursor,
+		"has_more":    nextCursor != "",
 		"update_time": "",
 		"user_location": gin.H{
 			"latitude":  lat,
@@ -121,11 +278,17 @@ func UpdateParkingLotAvailability(c *gin.Context) {
 	lotID := c.Param("id")
 
 	var lot models.ParkingLot
-	if err := models.DB.First(&lot, lotID).Error; err != nil {
+	if err := models.DB.Scopes(orgScope(c, "organization_id")).First(&lot, lotID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Parking lot not found"})
 		return
 	}
 
+	// 登记了车位清单的停车场，可用车位数由车位状态派生，不允许直接改写
+	if services.HasSpotInventory(models.DB, lot.ID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Availability is derived from spot inventory, update spot status instead"})
+		return
+	}
+
 	var updateData struct {
 		AvailableSpots int `json:"available_spots"`
 	}
@@ -142,10 +305,19 @@ func UpdateParkingLotAvailability(c *gin.Context) {
 	}
 
 	// 更新可用车位数
-	if err := models.DB.Model(&lot).Update("available_spots", updateData.AvailableSpots).Error; err != nil {
+	auditTarget(c, "parking_lot", lot.ID)
+	auditBefore(c, gin.H{"available_spots": lot.AvailableSpots})
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&lot).Update("available_spots", updateData.AvailableSpots).Error; err != nil {
+			return err
+		}
+		return services.RecordAvailability(tx, lot.ID)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update parking lot"})
 		return
 	}
+	auditAfter(c, gin.H{"available_spots": updateData.AvailableSpots})
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -163,8 +335,17 @@ func GetParkingLotDetails(c *gin.Context) {
 		return
 	}
 
+	now := time.Now()
+	schedule, err := services.LoadLotSchedule(models.DB, &lot, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch operating hours"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"data":    lot,
+		"success":  true,
+		"data":     lot,
+		"schedule": schedule,
+		"open_now": schedule.IsOpen(now),
 	})
 }
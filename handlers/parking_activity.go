@@ -15,6 +15,7 @@ import (
 	"urban_traffic_backend/models"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // ParkingActivityData 停车活动数据结构
@@ -36,7 +37,8 @@ func GetParkingActivityAnalysis(c *gin.Context) {
 	previousMonth := time.Now().AddDate(0, -1, 0).Format("2006-01")
 
 	// 从数据库获取数据
-	currentData, err := calculateParkingActivityFromDB(currentMonth)
+	scope := lotScope(c, "parking_lot_id")
+	currentData, err := calculateParkingActivityFromDB(currentMonth, scope)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -45,7 +47,7 @@ func GetParkingActivityAnalysis(c *gin.Context) {
 		return
 	}
 
-	previousData, err := calculateParkingActivityFromDB(previousMonth)
+	previousData, err := calculateParkingActivityFromDB(previousMonth, scope)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -72,8 +74,8 @@ func GetParkingActivityAnalysis(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
-// calculateParkingActivityFromDB 从数据库查询停车活动数据
-func calculateParkingActivityFromDB(month string) (map[string]int, error) {
+// calculateParkingActivityFromDB 从数据库查询停车活动数据，scope 限定停车场范围
+func calculateParkingActivityFromDB(month string, scope func(*gorm.DB) *gorm.DB) (map[string]int, error) {
 	activityData := map[string]int{
 		"临时停车":   0,
 		"月租车辆":   0,
@@ -87,9 +89,9 @@ func calculateParkingActivityFromDB(month string) (map[string]int, error) {
 
 	// 查询指定月份的所有停车会话
 	var sessions []models.ParkingSession
-	err := models.DB.Preload("Vehicle").Where(
-		"DATE_FORMAT(start_time, '%Y-%m') = ? AND status = ?",
-		month, "ended",
+	err := models.DB.Scopes(scope).Preload("Vehicle").Where(
+		"DATE_FORMAT(start_time, '%Y-%m') = ? AND status IN ?",
+		month, []string{"ended", "paid"},
 	).Find(&sessions).Error
 
 	if err != nil {
@@ -98,6 +100,12 @@ func calculateParkingActivityFromDB(month string) (map[string]int, error) {
 
 	// 统计各类停车活动
 	for _, session := range sessions {
+		// 开始停车时有有效月卡的会话即为月租车辆
+		if session.PassID != nil {
+			activityData["月租车辆"]++
+			continue
+		}
+
 		duration := session.EndTime.Sub(session.StartTime).Hours()
 		hour := session.StartTime.Hour()
 
@@ -111,12 +119,11 @@ func calculateParkingActivityFromDB(month string) (map[string]int, error) {
 			// 根据停车时长和时间段分类
 			if duration <= 2 { // 2小时以内算短时停车
 				activityData["短时快进快出"]++
-			} else if duration >= 8 { // 8小时以上算夜间停车或长期停车
+			} else if duration >= 8 { // 8小时以上算夜间停车或长时间临时停车
 				if hour >= 18 || hour <= 8 {
 					activityData["夜间停车"]++
 				} else {
-					// 可能是月租车辆（长期停车）
-					activityData["月租车辆"]++
+					activityData["临时停车"]++
 				}
 			} else {
 				// 中等时长停车
@@ -164,7 +171,7 @@ func calculateParkingActivityFromDB(month string) (map[string]int, error) {
 // GetParkingActivityRealtime 获取实时停车活动数据
 func GetParkingActivityRealtime(c *gin.Context) {
 	// 获取实时更新的停车活动数据
-	currentData, err := calculateRealtimeParkingActivityFromDB()
+	currentData, err := calculateRealtimeParkingActivityFromDB(lotScope(c, "parking_lot_id"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -185,8 +192,8 @@ func GetParkingActivityRealtime(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
-// calculateRealtimeParkingActivityFromDB 从数据库查询实时停车活动数据
-func calculateRealtimeParkingActivityFromDB() (map[string]int, error) {
+// calculateRealtimeParkingActivityFromDB 从数据库查询实时停车活动数据，scope 限定停车场范围
+func calculateRealtimeParkingActivityFromDB(scope func(*gorm.DB) *gorm.DB) (map[string]int, error) {
 	activityData := map[string]int{
 		"临时停车":   0,
 		"月租车辆":   0,
@@ -203,7 +210,7 @@ func calculateRealtimeParkingActivityFromDB() (map[string]int, error) {
 
 	// 查询当前活跃的停车会话（正在进行中的）
 	var activeSessions []models.ParkingSession
-	err := models.DB.Preload("Vehicle").Where("status = ?", "active").Find(&activeSessions).Error
+	err := models.DB.Scopes(scope).Preload("Vehicle").Where("status = ?", "active").Find(&activeSessions).Error
 	if err != nil {
 		return nil, err
 	}
@@ -211,9 +218,9 @@ func calculateRealtimeParkingActivityFromDB() (map[string]int, error) {
 	// 查询最近24小时内结束的停车会话（用于分析当前趋势）
 	yesterday := currentTime.Add(-24 * time.Hour)
 	var recentSessions []models.ParkingSession
-	err = models.DB.Preload("Vehicle").Where(
-		"status = ? AND end_time >= ?",
-		"ended", yesterday,
+	err = models.DB.Scopes(scope).Preload("Vehicle").Where(
+		"status IN ? AND end_time >= ?",
+		[]string{"ended", "paid"}, yesterday,
 	).Find(&recentSessions).Error
 	if err != nil {
 		return nil, err
@@ -234,6 +241,12 @@ func calculateRealtimeParkingActivityFromDB() (map[string]int, error) {
 
 		sessionHour := session.StartTime.Hour()
 
+		// 开始停车时有有效月卡的会话即为月租车辆
+		if session.PassID != nil {
+			activityData["月租车辆"]++
+			continue
+		}
+
 		// 根据车位类型和停车特征分类
 		switch session.SpotType {
 		case "charging":
@@ -244,11 +257,11 @@ func calculateRealtimeParkingActivityFromDB() (map[string]int, error) {
 			// 基于时间和停车模式的智能分类
 			if duration <= 1.5 { // 1.5小时以内算快进快出
 				activityData["短时快进快出"]++
-			} else if duration >= 10 { // 10小时以上算夜间或月租
+			} else if duration >= 10 { // 10小时以上算夜间停车或长时间临时停车
 				if sessionHour >= 18 || sessionHour <= 8 {
 					activityData["夜间停车"]++
 				} else {
-					activityData["月租车辆"]++
+					activityData["临时停车"]++
 				}
 			} else {
 				// 中等时长的停车，根据时间段判断
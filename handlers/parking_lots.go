@@ -0,0 +1,397 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"urban_traffic_backend/models"
+	"urban_traffic_backend/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ParkingLotRequest 新建或修改停车场请求，修改时未提供的字段保持不变
+type ParkingLotRequest struct {
+	Name           *string  `json:"name"`
+	Address        *string  `json:"address"`
+	Latitude       *float64 `json:"latitude"`
+	Longitude      *float64 `json:"longitude"`
+	TotalSpots     *int     `json:"total_spots"`
+	AvailableSpots *int     `json:"available_spots"` // 只在新建时使用，默认等于总车位数
+	HourlyRate     *float64 `json:"hourly_rate"`
+	OperatingHours *string  `json:"operating_hours"`
+	PaymentMethods *string  `json:"payment_methods"`
+	IsActive       *bool    `json:"is_active"`
+	OrganizationID *uint    `json:"organization_id"` // 只有平台超级管理员可以指定，组织管理员新建的停车场归属本组织
+	HeightLimit    *float64 `json:"height_limit"`
+	Coverage       *string  `json:"coverage"`
+	EVConnectors   *string  `json:"ev_connectors"`
+	HasSecurity    *bool    `json:"has_security"`
+	HasRestroom    *bool    `json:"has_restroom"`
+}
+
+// SpecialSpotRequest 设置某类特殊车位数量和附加费请求，未提供的字段保持不变
+type SpecialSpotRequest struct {
+	TotalCount    *int     `json:"total_count"`
+	AdditionalFee *float64 `json:"additional_fee"`
+}
+
+// apply 将请求中提供的字段写入停车场
+func (req *ParkingLotRequest) apply(lot *models.ParkingLot) {
+	if req.Name != nil {
+		lot.Name = *req.Name
+	}
+	if req.Address != nil {
+		lot.Address = *req.Address
+	}
+	if req.Latitude != nil {
+		lot.Latitude = *req.Latitude
+	}
+	if req.Longitude != nil {
+		lot.Longitude = *req.Longitude
+	}
+	if req.TotalSpots != nil {
+		lot.TotalSpots = *req.TotalSpots
+	}
+	if req.HourlyRate != nil {
+		lot.HourlyRate = *req.HourlyRate
+	}
+	if req.OperatingHours != nil {
+		lot.OperatingHours = *req.OperatingHours
+	}
+	if req.PaymentMethods != nil {
+		lot.PaymentMethods = *req.PaymentMethods
+	}
+	if req.IsActive != nil {
+		lot.IsActive = *req.IsActive
+	}
+	if req.HeightLimit != nil {
+		lot.HeightLimit = *req.HeightLimit
+	}
+	if req.Coverage != nil {
+		lot.Coverage = *req.Coverage
+	}
+	if req.EVConnectors != nil {
+		lot.EVConnectors = *req.EVConnectors
+	}
+	if req.HasSecurity != nil {
+		lot.HasSecurity = *req.HasSecurity
+	}
+	if req.HasRestroom != nil {
+		lot.HasRestroom = *req.HasRestroom
+	}
+}
+
+// respondParkingLotError 将停车场管理相关的错误转换为响应
+func respondParkingLotError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "停车场不存在"})
+	case errors.Is(err, services.ErrInvalidLotName), errors.Is(err, services.ErrInvalidAddress),
+		errors.Is(err, services.ErrInvalidCoordinates), errors.Is(err, services.ErrInvalidCapacity),
+		errors.Is(err, services.ErrInvalidRate), errors.Is(err, services.ErrInvalidPaymentMethods),
+		errors.Is(err, services.ErrInvalidOperatingHours), errors.Is(err, services.ErrInvalidSpecialSpotType),
+		errors.Is(err, services.ErrInvalidHeightLimit), errors.Is(err, services.ErrInvalidCoverage),
+		errors.Is(err, services.ErrInvalidEVConnectors):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrCapacityDerived), errors.Is(err, services.ErrLotInUse),
+		errors.Is(err, services.ErrSpecialSpotInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// findManagedParkingLot 按路径参数查找调用者所在组织的停车场（含已停用），找不到时已写入响应
+func findManagedParkingLot(c *gin.Context) (*models.ParkingLot, bool) {
+	var lot models.ParkingLot
+	if err := models.DB.Scopes(orgScope(c, "organization_id")).First(&lot, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "停车场不存在"})
+		return nil, false
+	}
+	return &lot, true
+}
+
+// GetManagedParkingLots 管理端分页查询本组织的停车场，包括已停用的停车场
+func GetManagedParkingLots(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	query := models.DB.Model(&models.ParkingLot{}).Scopes(orgScope(c, "organization_id"))
+	if keyword := strings.TrimSpace(c.Query("keyword")); keyword != "" {
+		like := "%" + keyword + "%"
+		query = query.Where("(name LIKE ? OR address LIKE ?)", like, like)
+	}
+	if isActive := c.Query("is_active"); isActive != "" {
+		active, err := strconv.ParseBool(isActive)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的启用状态"})
+			return
+		}
+		query = query.Where("is_active = ?", active)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取停车场列表失败"})
+		return
+	}
+
+	var lots []models.ParkingLot
+	if err := query.Preload("SpecialSpots").Order("id").
+		Limit(pageSize).Offset((page - 1) * pageSize).Find(&lots).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取停车场列表失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"data":      lots,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// CreateParkingLot 新建停车场，组织管理员新建的停车场归属本组织，
+// 平台超级管理员须指定所属组织
+func CreateParkingLot(c *gin.Context) {
+	var req ParkingLotRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	if req.Name == nil || req.Latitude == nil || req.Longitude == nil || req.TotalSpots == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "停车场名称、经纬度和总车位数不能为空"})
+		return
+	}
+
+	var organizationID *uint
+	if c.GetString("user_type") == models.RoleSuperAdmin {
+		if req.OrganizationID == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请指定所属组织"})
+			return
+		}
+		if err := models.DB.First(&models.Organization{}, *req.OrganizationID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "组织不存在"})
+			return
+		}
+		organizationID = req.OrganizationID
+	} else {
+		orgID := c.GetUint("organization_id")
+		if orgID == 0 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "当前账号未归属组织"})
+			return
+		}
+		organizationID = &orgID
+	}
+
+	lot := models.ParkingLot{
+		HourlyRate:     10.00,
+		IsActive:       true,
+		PaymentMethods: "微信,支付宝,现金",
+		OrganizationID: organizationID,
+	}
+	req.apply(&lot)
+	lot.AvailableSpots = lot.TotalSpots
+	if req.AvailableSpots != nil {
+		lot.AvailableSpots = *req.AvailableSpots
+	}
+	if err := services.ValidateParkingLot(&lot); err != nil {
+		respondParkingLotError(c, err, "创建停车场失败")
+		return
+	}
+
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&lot).Error; err != nil {
+			return err
+		}
+		return services.RecordAvailability(tx, lot.ID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建停车场失败"})
+		return
+	}
+	auditTarget(c, "parking_lot", lot.ID)
+	auditAfter(c, lot)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    lot,
+		"message": "停车场创建成功",
+	})
+}
+
+// UpdateParkingLot 修改停车场信息，所属组织只能通过组织划归修改，
+// 可用车位数通过可用车位接口或车位状态修改
+func UpdateParkingLot(c *gin.Context) {
+	lot, ok := findManagedParkingLot(c)
+	if !ok {
+		return
+	}
+
+	var req ParkingLotRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	auditTarget(c, "parking_lot", lot.ID)
+	auditBefore(c, lot)
+	updated, err := services.UpdateParkingLot(models.DB, lot.ID, req.apply)
+	if err != nil {
+		respondParkingLotError(c, err, "修改停车场失败")
+		return
+	}
+	auditAfter(c, updated)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    updated,
+		"message": "停车场修改成功",
+	})
+}
+
+// UpdateParkingLotStatus 启用或停用停车场，停用后不再出现在附近停车场中，也不能开始停车或预约，
+// 进行中的停车会话不受影响
+func UpdateParkingLotStatus(c *gin.Context) {
+	lot, ok := findManagedParkingLot(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		IsActive *bool `json:"is_active" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	auditTarget(c, "parking_lot", lot.ID)
+	auditBefore(c, gin.H{"is_active": lot.IsActive})
+	if err := models.DB.Model(lot).Update("is_active", *req.IsActive).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改停车场状态失败"})
+		return
+	}
+	auditAfter(c, gin.H{"is_active": lot.IsActive})
+
+	message := "停车场已启用"
+	if !lot.IsActive {
+		message = "停车场已停用"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    lot,
+		"message": message,
+	})
+}
+
+// DeleteParkingLot 删除停车场，还有进行中的停车会话、保留中的预约或有效月卡时拒绝删除
+func DeleteParkingLot(c *gin.Context) {
+	lot, ok := findManagedParkingLot(c)
+	if !ok {
+		return
+	}
+
+	auditTarget(c, "parking_lot", lot.ID)
+	auditBefore(c, lot)
+	if err := services.DeleteParkingLot(models.DB, lot); err != nil {
+		respondParkingLotError(c, err, "删除停车场失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "停车场删除成功"})
+}
+
+// GetManagedSpecialSpots 查看停车场各类特殊车位的数量和附加费
+func GetManagedSpecialSpots(c *gin.Context) {
+	lot, ok := findManagedParkingLot(c)
+	if !ok {
+		return
+	}
+
+	var spots []models.SpecialSpot
+	if err := models.DB.Where("parking_lot_id = ?", lot.ID).Order("spot_type").Find(&spots).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取特殊车位失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    spots,
+		"message": "获取特殊车位成功",
+	})
+}
+
+// SaveSpecialSpot 新增或修改停车场某类特殊车位的数量和附加费
+func SaveSpecialSpot(c *gin.Context) {
+	lot, ok := findManagedParkingLot(c)
+	if !ok {
+		return
+	}
+
+	var req SpecialSpotRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	spotType := c.Param("type")
+	var before models.SpecialSpot
+	if err := models.DB.Where("parking_lot_id = ? AND spot_type = ?", lot.ID, spotType).First(&before).Error; err == nil {
+		auditBefore(c, before)
+	}
+	spot, err := services.SaveSpecialSpot(models.DB, lot.ID, spotType, req.TotalCount, req.AdditionalFee)
+	if err != nil {
+		respondParkingLotError(c, err, "保存特殊车位失败")
+		return
+	}
+	auditTarget(c, "special_spot", spot.ID)
+	auditAfter(c, spot)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    spot,
+		"message": "特殊车位保存成功",
+	})
+}
+
+// DeleteSpecialSpot 删除停车场某类特殊车位
+func DeleteSpecialSpot(c *gin.Context) {
+	lot, ok := findManagedParkingLot(c)
+	if !ok {
+		return
+	}
+
+	spot, err := services.DeleteSpecialSpot(models.DB, lot.ID, c.Param("type"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "特殊车位不存在"})
+		return
+	}
+	if err != nil {
+		respondParkingLotError(c, err, "删除特殊车位失败")
+		return
+	}
+	auditTarget(c, "special_spot", spot.ID)
+	auditBefore(c, spot)
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "特殊车位删除成功"})
+}
@@ -0,0 +1,213 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"urban_traffic_backend/models"
+	"urban_traffic_backend/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+// CreateParkingSpotsRequest 批量登记车位请求
+type CreateParkingSpotsRequest struct {
+	Spots []struct {
+		Floor    string `json:"floor" binding:"required"`
+		Zone     string `json:"zone" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+		SpotType string `json:"spot_type"`
+	} `json:"spots" binding:"required,min=1,dive"`
+}
+
+// UpdateParkingSpotStatusRequest 更新车位状态请求
+type UpdateParkingSpotStatusRequest struct {
+	Status string `json:"status" binding:"required"`
+}
+
+// GetParkingLotSpots 获取停车场车位清单，支持按楼层、区域、状态、类型筛选
+func GetParkingLotSpots(c *gin.Context) {
+	lotID := c.Param("id")
+
+	var lot models.ParkingLot
+	if err := models.DB.First(&lot, lotID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "停车场不存在"})
+		return
+	}
+
+	query := models.DB.Where("parking_lot_id = ?", lot.ID)
+	if floor := c.Query("floor"); floor != "" {
+		query = query.Where("floor = ?", floor)
+	}
+	if zone := c.Query("zone"); zone != "" {
+		query = query.Where("zone = ?", zone)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if spotType := c.Query("spot_type"); spotType != "" {
+		query = query.Where("spot_type = ?", spotType)
+	}
+
+	var spots []models.ParkingSpot
+	if err := query.Order("floor, zone, code").Find(&spots).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取车位失败"})
+		return
+	}
+
+	// 按状态汇总筛选结果
+	summary := map[string]int{
+		models.SpotStatusFree:         0,
+		models.SpotStatusOccupied:     0,
+		models.SpotStatusReserved:     0,
+		models.SpotStatusOutOfService: 0,
+	}
+	for _, spot := range spots {
+		summary[spot.Status]++
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"parking_lot_id": lot.ID,
+			"spots":          spots,
+			"summary":        summary,
+			"total":          len(spots),
+		},
+		"message": "获取车位成功",
+	})
+}
+
+// CreateParkingLotSpots 批量登记车位，登记后停车场车位数由车位清单派生
+func CreateParkingLotSpots(c *gin.Context) {
+	lotID := c.Param("id")
+
+	var lot models.ParkingLot
+	if err := models.DB.Scopes(orgScope(c, "organization_id")).First(&lot, lotID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "停车场不存在"})
+		return
+	}
+
+	var req CreateParkingSpotsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	now := time.Now()
+	spots := make([]models.ParkingSpot, 0, len(req.Spots))
+	for _, item := range req.Spots {
+		spotType := item.SpotType
+		if spotType == "" {
+			spotType = "normal"
+		}
+		spots = append(spots, models.ParkingSpot{
+			ParkingLotID:    lot.ID,
+			Floor:           item.Floor,
+			Zone:            item.Zone,
+			Code:            item.Code,
+			SpotType:        spotType,
+			Status:          models.SpotStatusFree,
+			StatusUpdatedAt: now,
+		})
+	}
+
+	tx := models.DB.Begin()
+	if err := tx.Create(&spots).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{"error": "车位已存在或数据无效"})
+		return
+	}
+	if err := services.SyncLotAvailability(tx, lot.ID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新停车场车位数失败"})
+		return
+	}
+	tx.Commit()
+	auditTarget(c, "parking_lot", lot.ID)
+	auditAfter(c, gin.H{"spots": spots})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    spots,
+		"message": "车位登记成功",
+	})
+}
+
+// UpdateParkingSpotStatus 更新单个车位状态（车位传感器上报或管理员停用/恢复）
+func UpdateParkingSpotStatus(c *gin.Context) {
+	spotID := c.Param("id")
+
+	var req UpdateParkingSpotStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	if !models.IsValidSpotStatus(req.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的车位状态"})
+		return
+	}
+
+	tx := models.DB.Begin()
+
+	var spot models.ParkingSpot
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Scopes(lotScope(c, "parking_lot_id")).First(&spot, spotID).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "车位不存在"})
+		return
+	}
+
+	// 车位已分配给进行中的会话、保留中的预约或生效中的月卡时，不允许直接置为空闲
+	if req.Status == models.SpotStatusFree {
+		holders := []struct {
+			model   interface{}
+			status  string
+			message string
+		}{
+			{&models.ParkingSession{}, "active", "车位正被进行中的停车会话占用"},
+			{&models.Reservation{}, models.ReservationStatusHeld, "车位已被预约保留"},
+			{&models.ParkingPass{}, models.PassStatusActive, "车位是生效中月卡的固定车位"},
+		}
+		for _, holder := range holders {
+			var count int64
+			if err := tx.Model(holder.model).
+				Where("parking_spot_id = ? AND status = ?", spot.ID, holder.status).
+				Count(&count).Error; err != nil {
+				tx.Rollback()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "更新车位状态失败"})
+				return
+			}
+			if count > 0 {
+				tx.Rollback()
+				c.JSON(http.StatusConflict, gin.H{"error": holder.message})
+				return
+			}
+		}
+	}
+
+	auditTarget(c, "parking_spot", spot.ID)
+	auditBefore(c, spot)
+	if err := services.SetSpotStatus(tx, &spot, req.Status); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新车位状态失败"})
+		return
+	}
+	tx.Commit()
+	auditAfter(c, spot)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    spot,
+		"message": "车位状态更新成功",
+	})
+}
@@ -0,0 +1,376 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"urban_traffic_backend/models"
+	"urban_traffic_backend/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+// CreatePassPlanRequest 新增月卡套餐请求
+type CreatePassPlanRequest struct {
+	Name         string  `json:"name" binding:"required"`
+	DurationDays int     `json:"duration_days" binding:"required"`
+	Price        float64 `json:"price"`
+	SpotType     string  `json:"spot_type"`
+	ReservedSpot bool    `json:"reserved_spot"`
+	Description  string  `json:"description"`
+}
+
+// PurchasePassRequest 购买月卡请求
+type PurchasePassRequest struct {
+	PlanID    uint   `json:"plan_id" binding:"required"`
+	VehicleID uint   `json:"vehicle_id" binding:"required"`
+	StartDate string `json:"start_date"` // 生效日期（2006-01-02），为空时支付后立即生效
+	Method    string `json:"method"`
+}
+
+// GetParkingLotPassPlans 获取停车场在售的月卡套餐
+func GetParkingLotPassPlans(c *gin.Context) {
+	var lot models.ParkingLot
+	if err := models.DB.First(&lot, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "停车场不存在"})
+		return
+	}
+
+	var plans []models.PassPlan
+	if err := models.DB.Where("parking_lot_id = ? AND is_active = ?", lot.ID, true).
+		Order("duration_days, price").
+		Find(&plans).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取月卡套餐失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    plans,
+		"message": "获取月卡套餐成功",
+	})
+}
+
+// CreateParkingLotPassPlan 新增月卡套餐
+func CreateParkingLotPassPlan(c *gin.Context) {
+	var lot models.ParkingLot
+	if err := models.DB.Scopes(orgScope(c, "organization_id")).First(&lot, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "停车场不存在"})
+		return
+	}
+
+	var req CreatePassPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	if req.SpotType == "" {
+		req.SpotType = "normal"
+	}
+	if req.DurationDays <= 0 || req.Price < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "套餐参数无效"})
+		return
+	}
+	if req.SpotType != "normal" {
+		var count int64
+		models.DB.Model(&models.SpecialSpot{}).
+			Where("parking_lot_id = ? AND spot_type = ?", lot.ID, req.SpotType).
+			Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "该停车场没有此类型车位"})
+			return
+		}
+	}
+	if req.ReservedSpot && !services.HasSpotInventory(models.DB, lot.ID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该停车场未配置车位清单，无法提供固定车位"})
+		return
+	}
+
+	plan := models.PassPlan{
+		ParkingLotID: lot.ID,
+		Name:         req.Name,
+		DurationDays: req.DurationDays,
+		Price:        req.Price,
+		SpotType:     req.SpotType,
+		ReservedSpot: req.ReservedSpot,
+		IsActive:     true,
+		Description:  req.Description,
+	}
+	if err := models.DB.Create(&plan).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建月卡套餐失败"})
+		return
+	}
+	auditTarget(c, "pass_plan", plan.ID)
+	auditAfter(c, plan)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    plan,
+		"message": "月卡套餐创建成功",
+	})
+}
+
+// GetParkingPasses 获取当前用户的月卡列表
+func GetParkingPasses(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	query := models.DB.Preload("Plan").Preload("Vehicle").Preload("ParkingLot").
+		Where("user_id = ?", userID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var passes []models.ParkingPass
+	if err := query.Order("created_at DESC").Find(&passes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取月卡失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    passes,
+		"message": "获取月卡成功",
+	})
+}
+
+// PurchaseParkingPass 购买月卡：创建待支付月卡并发起支付，支付成功后生效
+func PurchaseParkingPass(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+	uid := userID.(uint)
+
+	var req PurchasePassRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	var plan models.PassPlan
+	if err := models.DB.Preload("ParkingLot").
+		Where("id = ? AND is_active = ?", req.PlanID, true).
+		First(&plan).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "月卡套餐不存在"})
+		return
+	}
+
+	now := time.Now()
+	validFrom := now
+	if req.StartDate != "" {
+		start, err := time.ParseInLocation("2006-01-02", req.StartDate, time.Local)
+		if err != nil || start.AddDate(0, 0, 1).Before(now) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的生效日期"})
+			return
+		}
+		if start.After(now) {
+			validFrom = start
+		}
+	}
+	validUntil := validFrom.AddDate(0, 0, plan.DurationDays)
+
+	tx := models.DB.Begin()
+
+	// 锁定车辆行，防止同一车辆并发购买
+	var vehicle models.Vehicle
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND id IN (?)", req.VehicleID, services.MemberVehicleIDs(uid)).
+		First(&vehicle).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "车辆不存在"})
+		return
+	}
+
+	var overlapping int64
+	tx.Model(&models.ParkingPass{}).
+		Where("vehicle_id = ? AND parking_lot_id = ? AND status IN ? AND valid_until > ?",
+			vehicle.ID, plan.ParkingLotID, []string{models.PassStatusPending, models.PassStatusActive}, validFrom).
+		Count(&overlapping)
+	if overlapping > 0 {
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{"error": "该车辆在此停车场已有月卡，请续费或取消后再购买"})
+		return
+	}
+
+	// 固定车位在支付成功时分配，这里仅预先确认仍有空闲车位
+	if plan.ReservedSpot {
+		var free int64
+		tx.Model(&models.ParkingSpot{}).
+			Where("parking_lot_id = ? AND spot_type = ? AND status = ?", plan.ParkingLotID, plan.SpotType, models.SpotStatusFree).
+			Count(&free)
+		if free == 0 {
+			tx.Rollback()
+			c.JSON(http.StatusConflict, gin.H{"error": "暂无可分配的固定车位"})
+			return
+		}
+	}
+
+	pass := models.ParkingPass{
+		UserID:       uid,
+		VehicleID:    vehicle.ID,
+		PlateNumber:  models.NormalizePlate(vehicle.PlateNumber),
+		ParkingLotID: plan.ParkingLotID,
+		PlanID:       plan.ID,
+		ValidFrom:    validFrom,
+		ValidUntil:   validUntil,
+		Status:       models.PassStatusPending,
+	}
+	if err := tx.Create(&pass).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "购买月卡失败"})
+		return
+	}
+
+	tx.Commit()
+
+	startPassPayment(c, uid, &pass, &plan, req.Method, plan.ParkingLot.Name+plan.Name)
+}
+
+// RenewParkingPass 续费月卡：有效期内续费顺延一期，过期后续费从支付时起算；
+// 待支付的月卡重新发起首期支付
+func RenewParkingPass(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+	uid := userID.(uint)
+
+	var request struct {
+		Method string `json:"method"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+			return
+		}
+	}
+
+	var pass models.ParkingPass
+	if err := models.DB.Preload("Plan.ParkingLot").
+		Where("id = ? AND user_id = ?", c.Param("id"), uid).
+		First(&pass).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "月卡不存在"})
+		return
+	}
+	if pass.Status == models.PassStatusCancelled {
+		c.JSON(http.StatusConflict, gin.H{"error": "月卡已取消，无法续费"})
+		return
+	}
+	if !pass.Plan.IsActive {
+		c.JSON(http.StatusConflict, gin.H{"error": "该月卡套餐已停售"})
+		return
+	}
+
+	description := pass.Plan.ParkingLot.Name + pass.Plan.Name
+	if pass.Status != models.PassStatusPending {
+		description += "续费"
+	}
+	startPassPayment(c, uid, &pass, &pass.Plan, request.Method, description)
+}
+
+// CancelParkingPass 取消月卡：待支付的月卡直接作废，生效中的月卡立即停止免费并释放固定车位。
+// 已支付费用的退款由管理员通过退款接口处理
+func CancelParkingPass(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	tx := models.DB.Begin()
+
+	var pass models.ParkingPass
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND user_id = ?", c.Param("id"), userID).
+		First(&pass).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "月卡不存在"})
+		return
+	}
+	if pass.Status != models.PassStatusPending && pass.Status != models.PassStatusActive {
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{"error": "月卡当前状态不可取消"})
+		return
+	}
+
+	if err := services.CancelPass(tx, &pass, time.Now()); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "取消月卡失败"})
+		return
+	}
+
+	tx.Commit()
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    pass,
+		"message": "月卡已取消",
+	})
+}
+
+// startPassPayment 为月卡发起一期费用的支付并返回支付结果
+func startPassPayment(c *gin.Context, uid uint, pass *models.ParkingPass, plan *models.PassPlan, method, description string) {
+	order, err := services.CreatePaymentOrder(services.PaymentRequest{
+		UserID:         &uid,
+		ParkingLot:     &plan.ParkingLot,
+		Purpose:        models.PaymentPurposePass,
+		PassID:         &pass.ID,
+		Amount:         plan.Price,
+		Method:         method,
+		IdempotencyKey: c.GetHeader("Idempotency-Key"),
+		Description:    description,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrPaymentMethodUnavailable):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":           err.Error(),
+				"payment_methods": services.OnlinePaymentMethods(&plan.ParkingLot),
+			})
+		case errors.Is(err, services.ErrIdempotencyConflict):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "创建支付订单失败"})
+		}
+		return
+	}
+
+	status := http.StatusAccepted
+	message := "支付已发起，等待支付结果"
+	switch order.Status {
+	case models.PaymentStatusPending:
+	case models.PaymentStatusFailed:
+		status = http.StatusBadGateway
+		message = "支付失败，请重试"
+	default:
+		status = http.StatusOK
+		message = "支付成功"
+		// 免费套餐下单即生效，返回生效后的月卡
+		models.DB.First(pass, pass.ID)
+	}
+
+	c.JSON(status, gin.H{
+		"success": order.Status != models.PaymentStatusFailed,
+		"data": gin.H{
+			"pass":  pass,
+			"order": order,
+		},
+		"message": message,
+	})
+}
@@ -0,0 +1,168 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"urban_traffic_backend/models"
+	"urban_traffic_backend/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RefundRequest 退款请求，金额小于可退金额时为部分退款
+type RefundRequest struct {
+	Amount float64 `json:"amount" binding:"required"`
+	Reason string  `json:"reason"`
+}
+
+// PaymentCallback 支付渠道异步回调，签名通过 X-Signature 头传递
+func PaymentCallback(c *gin.Context) {
+	provider := c.Param("provider")
+
+	payload, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取回调内容失败"})
+		return
+	}
+
+	if err := services.HandlePaymentCallback(provider, payload, c.GetHeader("X-Signature")); err != nil {
+		log.Printf("payment: callback from %s rejected: %v", provider, err)
+		if errors.Is(err, services.ErrInvalidSignature) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// GetPaymentOrder 查询支付订单状态（含退款记录），用户只能查看自己的订单，财务权限可查看全部订单
+func GetPaymentOrder(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	query := models.DB.Preload("Refunds").Where("order_no = ?", c.Param("orderNo")).
+		Scopes(financeScope(c, userID))
+
+	var order models.PaymentOrder
+	if err := query.First(&order).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "支付订单不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    order,
+	})
+}
+
+// RefundPaymentOrder 对已支付订单发起全额或部分退款，支持 Idempotency-Key 头防止重复退款
+func RefundPaymentOrder(c *gin.Context) {
+	operatorID := c.GetUint("user_id")
+
+	var req RefundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	// 只能对本组织停车场的订单退款
+	var count int64
+	models.DB.Model(&models.PaymentOrder{}).Scopes(lotScope(c, "parking_lot_id")).
+		Where("order_no = ?", c.Param("orderNo")).Count(&count)
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": services.ErrOrderNotFound.Error()})
+		return
+	}
+
+	refund, err := services.RefundOrder(c.Param("orderNo"), req.Amount, req.Reason, c.GetHeader("Idempotency-Key"), &operatorID)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrOrderNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrRefundNotAllowed), errors.Is(err, services.ErrInvalidRefundAmount):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "退款失败"})
+		}
+		return
+	}
+
+	auditTarget(c, "payment_refund", refund.ID)
+	auditAfter(c, refund)
+
+	if refund.Status == models.RefundStatusFailed {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error": "支付渠道退款失败",
+			"data":  refund,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    refund,
+		"message": "退款成功",
+	})
+}
+
+// GetPaymentReconciliation 核对时间段内结束的停车会话与资金流水，默认最近一天
+func GetPaymentReconciliation(c *gin.Context) {
+	to := time.Now()
+	from := to.Add(-24 * time.Hour)
+	if value := c.Query("from"); value != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的开始日期"})
+			return
+		}
+		from = parsed
+	}
+	if value := c.Query("to"); value != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的结束日期"})
+			return
+		}
+		// 结束日期包含当天
+		to = parsed.AddDate(0, 0, 1)
+	}
+	if !to.After(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "结束日期必须晚于开始日期"})
+		return
+	}
+
+	report, err := services.ReconcileSessions(models.DB.Scopes(lotScope(c, "parking_lot_id")).Session(&gorm.Session{}), from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "对账失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    report,
+	})
+}
+
+// hasPermission 判断当前登录用户的角色是否拥有指定权限，用于本人或有权限人员均可访问的接口
+func hasPermission(c *gin.Context, permission string) bool {
+	return models.RoleHasPermission(c.GetString("user_type"), permission)
+}
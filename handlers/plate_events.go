@@ -0,0 +1,364 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"urban_traffic_backend/models"
+	"urban_traffic_backend/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// PlateEventRequest 边缘识别端上报的车牌事件（见 client.py send_message）
+type PlateEventRequest struct {
+	Plate       string      `json:"plate" binding:"required"`
+	ParkingID   json.Number `json:"parking_id" binding:"required"` // 识别端以字符串形式上报
+	ParkingTime string      `json:"parking_time"`                  // ISO8601，缺省为服务器当前时间
+	Type        *int        `json:"type" binding:"required"`       // 0入场 1出场
+}
+
+// 识别端 datetime.isoformat() 可能带或不带微秒与时区
+var plateEventTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+}
+
+func parsePlateEventTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Now(), nil
+	}
+	for _, layout := range plateEventTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("invalid parking_time")
+}
+
+// IngestPlateEvent 接收车牌入场/出场事件，驱动停车会话的开启与结束。
+// 只接受设备凭证，事件记录归属到上报的识别端
+func IngestPlateEvent(c *gin.Context) {
+	var req PlateEventRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	plate := models.NormalizePlate(req.Plate)
+	if plate == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "车牌号不能为空"})
+		return
+	}
+	if *req.Type != models.PlateEventEntry && *req.Type != models.PlateEventExit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的事件类型"})
+		return
+	}
+
+	lotID, err := strconv.ParseUint(strings.TrimSpace(req.ParkingID.String()), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的停车场ID"})
+		return
+	}
+
+	eventTime, err := parsePlateEventTime(req.ParkingTime)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的识别时间"})
+		return
+	}
+
+	var lot models.ParkingLot
+	if err := models.DB.First(&lot, lotID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "停车场不存在"})
+		return
+	}
+
+	// 识别端只能上报本组织停车场的事件，平台级凭证除外
+	credential := c.MustGet("device_credential").(*models.DeviceCredential)
+	allowed, err := services.CredentialCanAccessLot(models.DB, credential, &lot)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "处理车牌事件失败"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "设备无权上报该停车场的事件"})
+		return
+	}
+
+	event := models.PlateEvent{
+		PlateNumber:  plate,
+		ParkingLotID: lot.ID,
+		EventType:    *req.Type,
+		EventTime:    eventTime,
+		CredentialID: deviceCredentialID(c),
+	}
+
+	entry, err := services.CheckAccessList(models.DB, lot.ID, plate, eventTime)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "处理车牌事件失败"})
+		return
+	}
+
+	tx := models.DB.Begin()
+	var session *models.ParkingSession
+	blacklisted := entry != nil && entry.ListType == models.AccessListBlacklist
+	if blacklisted {
+		source := "出场"
+		if event.EventType == models.PlateEventEntry {
+			source = "入场"
+		}
+		err = services.RaiseBlacklistAlarm(tx, &lot, entry, "在"+lot.Name+"识别"+source, eventTime)
+	}
+	if err == nil {
+		switch {
+		case event.EventType == models.PlateEventEntry && blacklisted:
+			// 黑名单车辆禁止入场，不开启会话
+			event.Result = "blocked_blacklist"
+		case event.EventType == models.PlateEventEntry:
+			session, event.Result, err = openSessionForPlate(tx, &lot, plate, eventTime, entry)
+		default:
+			session, event.Result, err = closeSessionForPlate(tx, &lot, plate, eventTime)
+		}
+	}
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "处理车牌事件失败"})
+		return
+	}
+
+	if session != nil {
+		event.SessionID = &session.ID
+	}
+	if err := tx.Create(&event).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "处理车牌事件失败"})
+		return
+	}
+	tx.Commit()
+	auditTarget(c, "plate_event", event.ID)
+	auditAfter(c, event)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"event_id":   event.ID,
+			"session_id": event.SessionID,
+			"result":     event.Result,
+			"blocked":    event.Result == "blocked_blacklist",
+		},
+		"message": "车牌事件处理成功",
+	})
+}
+
+// openSessionForPlate 车辆入场：为车牌开启停车会话并占用车位，whitelist 为命中的白名单记录
+func openSessionForPlate(tx *gorm.DB, lot *models.ParkingLot, plate string, eventTime time.Time, whitelist *models.AccessListEntry) (*models.ParkingSession, string, error) {
+	// 识别端可能重复上报，或用户已在 App 内开始停车，已有进行中的会话时不再重复开启
+	var existing models.ParkingSession
+	err := tx.Where("plate_number = ? AND parking_lot_id = ? AND status = ?", plate, lot.ID, "active").
+		First(&existing).Error
+	if err == nil {
+		if existing.NavigationStatus == "parked" {
+			return &existing, "duplicate", nil
+		}
+		// App 发起的会话在车辆入场时结束导航
+		err = tx.Model(&existing).Updates(map[string]interface{}{
+			"navigation_status":       "parked",
+			"remaining_distance_m":    0,
+			"estimated_minutes":       0,
+			"progress_to_destination": 100,
+		}).Error
+		if err != nil {
+			return nil, "", err
+		}
+		return &existing, "arrived", nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, "", err
+	}
+
+	session := models.ParkingSession{
+		PlateNumber:           plate,
+		ParkingLotID:          lot.ID,
+		SpotType:              "normal",
+		StartTime:             eventTime,
+		Status:                "active",
+		FeeRate:               lot.HourlyRate,
+		NavigationStatus:      "parked",
+		DestinationLat:        lot.Latitude,
+		DestinationLon:        lot.Longitude,
+		ProgressToDestination: 100,
+	}
+
+	// 未登记的车牌仍然开启匿名会话，保证车场占用数准确
+	result := "opened_anonymous"
+	if vehicle, err := findVehicleByPlate(tx, plate); err == nil {
+		session.UserID = &vehicle.UserID
+		session.VehicleID = &vehicle.ID
+		result = "opened"
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, "", err
+	}
+
+	// 白名单车辆放行并免收停车费
+	if whitelist != nil {
+		session.AccessEntryID = &whitelist.ID
+		result = "opened_whitelist"
+	}
+
+	// 月卡有效期内停车免费，含固定车位的月卡优先停入固定车位
+	pass, err := services.FindActivePass(tx, lot.ID, session.VehicleID, plate, eventTime)
+	if err != nil {
+		return nil, "", err
+	}
+	var passSpot *models.ParkingSpot
+	if pass != nil {
+		session.PassID = &pass.ID
+		result = "opened_pass"
+		if passSpot, err = services.ClaimPassSpot(tx, pass); err != nil {
+			return nil, "", err
+		}
+		if passSpot != nil {
+			session.ParkingSpotID = &passSpot.ID
+			session.SpotCode = passSpot.Code
+			session.SpotType = passSpot.SpotType
+		}
+	}
+
+	// 有保留中的预约时使用预约的车位，否则占用一个普通车位
+	reservation, err := services.FindHeldReservation(tx, lot.ID, session.VehicleID, plate)
+	if err != nil {
+		return nil, "", err
+	}
+	if reservation != nil && passSpot != nil {
+		// 已停入月卡固定车位，预约的车位不再需要
+		if err := services.CancelReservation(tx, reservation, eventTime); err != nil {
+			return nil, "", err
+		}
+		reservation = nil
+	}
+	if reservation != nil {
+		if err := services.ClaimReservation(tx, reservation, &session); err != nil {
+			return nil, "", err
+		}
+		result = "opened_reserved"
+	} else if passSpot == nil {
+		// 车辆已实际入场，车位满时只记录日志，不拒绝会话
+		spot, err := services.OccupyCapacity(tx, lot.ID, "normal")
+		if err != nil {
+			if !errors.Is(err, services.ErrLotFull) {
+				return nil, "", err
+			}
+			log.Printf("parking lot %d is full but plate %s entered", lot.ID, plate)
+		}
+		if spot != nil {
+			session.ParkingSpotID = &spot.ID
+			session.SpotCode = spot.Code
+		}
+	}
+
+	tariff, err := services.FindTariff(tx, lot, session.SpotType, eventTime)
+	if err != nil {
+		return nil, "", err
+	}
+	if tariff.ID != 0 {
+		session.TariffID = &tariff.ID
+	}
+	session.PricingRule = services.DescribeTariff(tariff)
+
+	if err := tx.Create(&session).Error; err != nil {
+		return nil, "", err
+	}
+
+	if reservation != nil {
+		if err := services.CompleteReservation(tx, reservation, session.ID, eventTime); err != nil {
+			return nil, "", err
+		}
+	}
+
+	return &session, result, nil
+}
+
+// closeSessionForPlate 车辆出场：结束会话、生成停车记录并释放车位
+func closeSessionForPlate(tx *gorm.DB, lot *models.ParkingLot, plate string, eventTime time.Time) (*models.ParkingSession, string, error) {
+	var session models.ParkingSession
+	err := tx.Where("plate_number = ? AND parking_lot_id = ? AND status = ?", plate, lot.ID, "active").
+		Order("start_time desc").
+		First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// 会话可能已在 App 内支付结束，车位在支付时已释放
+		return nil, "no_active_session", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	if eventTime.Before(session.StartTime) {
+		eventTime = session.StartTime
+	}
+	duration := eventTime.Sub(session.StartTime)
+
+	quote, err := services.QuoteSession(tx, &session, eventTime)
+	if err != nil {
+		return nil, "", err
+	}
+	services.ApplyQuote(&session, quote)
+	session.EndTime = &eventTime
+	session.Status = "ended"
+	session.NextBillingTime = nil
+	session.NextFeeAmount = nil
+	if err := tx.Save(&session).Error; err != nil {
+		return nil, "", err
+	}
+	if err := services.SaveSettledFeeItems(tx, session.ID, quote); err != nil {
+		return nil, "", err
+	}
+
+	if session.VehicleID != nil {
+		record := models.ParkingRecord{
+			VehicleID:    *session.VehicleID,
+			SessionID:    &session.ID,
+			ParkingLotID: &session.ParkingLotID,
+			Location:     lot.Name,
+			StartTime:    session.StartTime.Format("2006-01-02 15:04:05"),
+			EndTime:      eventTime.Format("2006-01-02 15:04:05"),
+			Fee:          session.FeeCurrent,
+			Duration:     duration.Hours(),
+			SpotType:     session.SpotType,
+		}
+		if err := tx.Create(&record).Error; err != nil {
+			return nil, "", err
+		}
+	}
+
+	if err := services.ReleaseSessionCapacity(tx, &session); err != nil {
+		return nil, "", err
+	}
+
+	return &session, "closed", nil
+}
+
+// findVehicleByPlate 按归一化车牌匹配已登记车辆
+func findVehicleByPlate(db *gorm.DB, plate string) (*models.Vehicle, error) {
+	var vehicle models.Vehicle
+	err := db.Where("normalized_plate = ?", plate).First(&vehicle).Error
+	if err != nil {
+		return nil, err
+	}
+	return &vehicle, nil
+}
@@ -0,0 +1,309 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"urban_traffic_backend/models"
+	"urban_traffic_backend/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+// CreateReservationRequest 创建预约请求
+type CreateReservationRequest struct {
+	VehicleID    uint      `json:"vehicle_id" binding:"required"`
+	ParkingLotID uint      `json:"parking_lot_id" binding:"required"`
+	SpotType     string    `json:"spot_type"`
+	StartTime    time.Time `json:"start_time" binding:"required"`
+	EndTime      time.Time `json:"end_time" binding:"required"`
+}
+
+// CreateReservation 预约车位：立即预留一个车位，预约开始后超过宽限期未到达则自动释放并收取违约金
+func CreateReservation(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+	uid := userID.(uint)
+
+	var req CreateReservationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+	if req.SpotType == "" {
+		req.SpotType = "normal"
+	}
+
+	now := time.Now()
+	grace := services.ReservationGracePeriod()
+	if !req.EndTime.After(req.StartTime) || req.StartTime.Add(grace).Before(now) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的预约时段"})
+		return
+	}
+	if req.StartTime.After(now.Add(services.ReservationMaxAdvance())) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "预约开始时间超出可提前预约的范围"})
+		return
+	}
+
+	var lot models.ParkingLot
+	if err := models.DB.Where("id = ? AND is_active = ?", req.ParkingLotID, true).First(&lot).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "停车场不存在"})
+		return
+	}
+
+	if req.SpotType != "normal" {
+		var count int64
+		models.DB.Model(&models.SpecialSpot{}).
+			Where("parking_lot_id = ? AND spot_type = ?", lot.ID, req.SpotType).
+			Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "该停车场没有此类型车位"})
+			return
+		}
+	}
+
+	// 预约开始时（已开始的按当前时间）停车场须在营业
+	arriveAt := req.StartTime
+	if arriveAt.Before(now) {
+		arriveAt = now
+	}
+	if err := services.CheckLotOpen(models.DB, &lot, arriveAt); err != nil {
+		if errors.Is(err, services.ErrLotClosed) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取营业时间失败"})
+		return
+	}
+
+	tx := models.DB.Begin()
+
+	var vehicle models.Vehicle
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND id IN (?)", req.VehicleID, services.MemberVehicleIDs(uid)).
+		First(&vehicle).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "车辆不存在"})
+		return
+	}
+
+	// 同一车辆同时只能有一个保留中的预约，且不能在停车中
+	plate := models.NormalizePlate(vehicle.PlateNumber)
+	var heldCount, activeCount int64
+	err := tx.Model(&models.Reservation{}).
+		Where("vehicle_id = ? AND status = ?", vehicle.ID, models.ReservationStatusHeld).
+		Count(&heldCount).Error
+	if err == nil {
+		err = tx.Model(&models.ParkingSession{}).
+			Where("(vehicle_id = ? OR plate_number = ?) AND status = ?", vehicle.ID, plate, "active").
+			Count(&activeCount).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询预约失败"})
+		return
+	}
+	if heldCount > 0 || activeCount > 0 {
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{"error": "该车辆已有保留中的预约或进行中的停车会话"})
+		return
+	}
+
+	spot, err := services.ReserveCapacity(tx, lot.ID, req.SpotType)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, services.ErrLotFull) || errors.Is(err, services.ErrSpotTypeFull) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "预留车位失败"})
+		return
+	}
+
+	reservation := models.Reservation{
+		UserID:       uid,
+		VehicleID:    vehicle.ID,
+		PlateNumber:  plate,
+		ParkingLotID: lot.ID,
+		SpotType:     req.SpotType,
+		StartTime:    req.StartTime,
+		EndTime:      req.EndTime,
+		HoldUntil:    req.StartTime.Add(grace),
+		Status:       models.ReservationStatusHeld,
+	}
+	if spot != nil {
+		reservation.ParkingSpotID = &spot.ID
+		reservation.SpotCode = spot.Code
+	}
+
+	if err := tx.Create(&reservation).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建预约失败"})
+		return
+	}
+
+	tx.Commit()
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data": gin.H{
+			"reservation":   reservation,
+			"parking_lot":   lot.Name,
+			"vehicle":       vehicle.PlateNumber,
+			"no_show_fee":   services.ReservationNoShowFee(),
+			"grace_minutes": int(grace.Minutes()),
+		},
+		"message": "预约成功",
+	})
+}
+
+// GetReservations 获取当前用户的预约列表，可按状态筛选
+func GetReservations(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	query := models.DB.Preload("Vehicle").Preload("ParkingLot").Where("user_id = ?", userID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var reservations []models.Reservation
+	if err := query.Order("start_time desc").Limit(50).Find(&reservations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取预约失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    reservations,
+	})
+}
+
+// CancelReservation 取消保留中的预约并释放车位
+func CancelReservation(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	reservationID := c.Param("id")
+
+	tx := models.DB.Begin()
+
+	var reservation models.Reservation
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND user_id = ?", reservationID, userID).
+		First(&reservation).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "预约不存在"})
+		return
+	}
+	if reservation.Status != models.ReservationStatusHeld {
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{"error": "预约已结束，无法取消"})
+		return
+	}
+
+	if err := services.CancelReservation(tx, &reservation, time.Now()); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "取消预约失败"})
+		return
+	}
+
+	tx.Commit()
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    reservation,
+		"message": "预约已取消",
+	})
+}
+
+// PayReservationNoShowFee 支付预约未到达产生的违约金
+func PayReservationNoShowFee(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+	uid := userID.(uint)
+
+	var request struct {
+		Method string `json:"method"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+			return
+		}
+	}
+
+	var reservation models.Reservation
+	if err := models.DB.Preload("ParkingLot").
+		Where("id = ? AND user_id = ?", c.Param("id"), uid).
+		First(&reservation).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "预约不存在"})
+		return
+	}
+	if reservation.Status != models.ReservationStatusNoShow || reservation.NoShowFee <= 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "该预约没有待支付的违约金"})
+		return
+	}
+	if reservation.NoShowFeePaidAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "违约金已支付"})
+		return
+	}
+
+	order, err := services.CreatePaymentOrder(services.PaymentRequest{
+		UserID:         &uid,
+		ParkingLot:     &reservation.ParkingLot,
+		Purpose:        models.PaymentPurposeNoShow,
+		ReservationID:  &reservation.ID,
+		Amount:         reservation.NoShowFee,
+		Method:         request.Method,
+		IdempotencyKey: c.GetHeader("Idempotency-Key"),
+		Description:    reservation.ParkingLot.Name + "预约违约金",
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrPaymentMethodUnavailable):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":           err.Error(),
+				"payment_methods": services.OnlinePaymentMethods(&reservation.ParkingLot),
+			})
+		case errors.Is(err, services.ErrIdempotencyConflict):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "创建支付订单失败"})
+		}
+		return
+	}
+
+	if order.Status == models.PaymentStatusFailed {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "支付失败，请重试", "data": order})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+		"data":    order,
+		"message": "支付已发起，等待支付结果",
+	})
+}
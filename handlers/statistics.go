@@ -9,6 +9,7 @@
 package handlers
 
 import (
+	"math"
 	"net/http"
 	"time"
 
@@ -21,7 +22,7 @@ import (
 // GetParkingSaturation 获取停车饱和度数据
 func GetParkingSaturation(c *gin.Context) {
 	var saturationData []models.ParkingSaturation
-	result := models.DB.Preload("ParkingLot").
+	result := models.DB.Scopes(lotScope(c, "parking_lot_id")).Preload("ParkingLot").
 		Where("timestamp >= ?", time.Now().Add(-24*time.Hour)).
 		Order("timestamp desc").
 		Find(&saturationData)
@@ -58,7 +59,7 @@ func GetParkingSaturation(c *gin.Context) {
 // GetParkingOccupancyRate 获取停车占用率数据
 func GetParkingOccupancyRate(c *gin.Context) {
 	var occupancyData []models.ParkingOccupancyRate
-	result := models.DB.Preload("ParkingLot").
+	result := models.DB.Scopes(lotScope(c, "parking_lot_id")).Preload("ParkingLot").
 		Order("timestamp desc").
 		Limit(50).
 		Find(&occupancyData)
@@ -95,31 +96,52 @@ func GetParkingOccupancyRate(c *gin.Context) {
 	})
 }
 
-// GetTotalOccupancyRate 获取总占用率数据
+// occupancyPoint 总占用率的一个统计点，多个运营商的数据按时间合计
+type occupancyPoint struct {
+	Timestamp      time.Time `json:"timestamp"`
+	TotalSpots     int       `json:"total_spots"`
+	OccupiedSpots  int       `json:"occupied_spots"`
+	AvailableSpots int       `json:"available_spots"`
+	OccupancyRate  float64   `json:"occupancy_rate"`
+}
+
+// GetTotalOccupancyRate 获取总占用率数据：当前值和最近7天每小时趋势，平台管理员看到所有运营商的合计
 func GetTotalOccupancyRate(c *gin.Context) {
-	var totalOccupancy models.TotalOccupancy
-	result := models.DB.Order("timestamp desc").First(&totalOccupancy)
+	var historyData []occupancyPoint
+	result := models.DB.Model(&models.TotalOccupancy{}).Scopes(orgScope(c, "organization_id")).
+		Select("timestamp, SUM(total_spots) AS total_spots, SUM(occupied_spots) AS occupied_spots, SUM(available_spots) AS available_spots").
+		Where("period = ? AND timestamp >= ?", "hourly", time.Now().Add(-7*24*time.Hour)).
+		Group("timestamp").
+		Order("timestamp").
+		Scan(&historyData)
 
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取数据失败"})
 		return
 	}
 
-	// 获取历史趋势数据
-	var historyData []models.TotalOccupancy
-	models.DB.Where("timestamp >= ?", time.Now().Add(-7*24*time.Hour)).
-		Order("timestamp").
-		Find(&historyData)
+	for i := range historyData {
+		if historyData[i].TotalSpots > 0 {
+			rate := float64(historyData[i].OccupiedSpots) / float64(historyData[i].TotalSpots) * 100
+			historyData[i].OccupancyRate = math.Round(rate*100) / 100
+		}
+	}
+
+	var current gin.H
+	if len(historyData) > 0 {
+		latest := historyData[len(historyData)-1]
+		current = gin.H{
+			"total_spots":     latest.TotalSpots,
+			"occupied_spots":  latest.OccupiedSpots,
+			"available_spots": latest.AvailableSpots,
+			"occupancy_rate":  latest.OccupancyRate,
+			"timestamp":       latest.Timestamp.Format("2006-01-02 15:04:05"),
+		}
+	}
 
 	response := gin.H{
-		"current": gin.H{
-			"total_spots":     totalOccupancy.TotalSpots,
-			"occupied_spots":  totalOccupancy.OccupiedSpots,
-			"available_spots": totalOccupancy.AvailableSpots,
-			"occupancy_rate":  totalOccupancy.OccupancyRate,
-			"timestamp":       totalOccupancy.Timestamp.Format("2006-01-02 15:04:05"),
-		},
-		"trend": historyData,
+		"current": current,
+		"trend":   historyData,
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -132,7 +154,7 @@ func GetTotalOccupancyRate(c *gin.Context) {
 // GetMotorParkingCongestion 获取非机动车停车拥堵数据
 func GetMotorParkingCongestion(c *gin.Context) {
 	var congestionData []models.MotorParkingCongestion
-	result := models.DB.Order("timestamp desc").
+	result := models.DB.Scopes(orgScope(c, "organization_id")).Order("timestamp desc").
 		Limit(20).
 		Find(&congestionData)
 
@@ -176,24 +198,24 @@ func GetParkingCongestionChart(c *gin.Context) {
 	case "day":
 		// 获取最近24小时的数据，按3小时间隔
 		startTime := now.Add(-24 * time.Hour)
-		result = models.DB.Where("timestamp >= ?", startTime).
+		result = models.DB.Scopes(orgScope(c, "organization_id")).Where("timestamp >= ?", startTime).
 			Order("timestamp asc").
 			Find(&congestionData)
 	case "week":
 		// 获取最近7天的数据，按天分组
 		startTime := now.Add(-7 * 24 * time.Hour)
-		result = models.DB.Where("timestamp >= ?", startTime).
+		result = models.DB.Scopes(orgScope(c, "organization_id")).Where("timestamp >= ?", startTime).
 			Order("timestamp asc").
 			Find(&congestionData)
 	case "month":
 		// 获取最近30天的数据，按周分组
 		startTime := now.Add(-30 * 24 * time.Hour)
-		result = models.DB.Where("timestamp >= ?", startTime).
+		result = models.DB.Scopes(orgScope(c, "organization_id")).Where("timestamp >= ?", startTime).
 			Order("timestamp asc").
 			Find(&congestionData)
 	default:
 		startTime := now.Add(-24 * time.Hour)
-		result = models.DB.Where("timestamp >= ?", startTime).
+		result = models.DB.Scopes(orgScope(c, "organization_id")).Where("timestamp >= ?", startTime).
 			Order("timestamp asc").
 			Find(&congestionData)
 	}
@@ -353,7 +375,7 @@ func GetTollSystemData(c *gin.Context) {
 	}
 
 	var tollRecords []models.TollRecord
-	result := models.DB.Preload("Vehicle").
+	result := models.DB.Scopes(orgScope(c, "organization_id")).Preload("Vehicle").
 		Where("entry_time >= ?", startTime).
 		Order("entry_time desc").
 		Find(&tollRecords)
@@ -392,7 +414,7 @@ func GetTollSystemData(c *gin.Context) {
 // GetConstructionStats 获取施工统计数据
 func GetConstructionStats(c *gin.Context) {
 	var constructionStats []models.ConstructionStats
-	result := models.DB.Order("start_date desc").Find(&constructionStats)
+	result := models.DB.Scopes(orgScope(c, "organization_id")).Order("start_date desc").Find(&constructionStats)
 
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取数据失败"})
@@ -431,7 +453,7 @@ func GetConstructionStats(c *gin.Context) {
 // GetMonitoringCameras 获取监控摄像头列表
 func GetMonitoringCameras(c *gin.Context) {
 	var cameras []models.MonitoringCamera
-	result := models.DB.Order("install_date desc").Find(&cameras)
+	result := models.DB.Scopes(orgScope(c, "organization_id")).Order("install_date desc").Find(&cameras)
 
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取数据失败"})
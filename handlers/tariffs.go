@@ -0,0 +1,227 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"urban_traffic_backend/models"
+	"urban_traffic_backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateTariffRequest 新增收费标准版本请求
+type CreateTariffRequest struct {
+	SpotType           string     `json:"spot_type"`
+	RuleType           string     `json:"rule_type"`
+	FreeMinutes        int        `json:"free_minutes"`
+	FirstPeriodMinutes int        `json:"first_period_minutes"`
+	FirstPeriodPrice   float64    `json:"first_period_price"`
+	UnitMinutes        int        `json:"unit_minutes" binding:"required"`
+	UnitPrice          float64    `json:"unit_price"`
+	DailyCap           float64    `json:"daily_cap"`
+	MaxFee             float64    `json:"max_fee"`
+	EffectiveFrom      *time.Time `json:"effective_from"`
+	Bands              []struct {
+		DayType     string  `json:"day_type"`
+		Name        string  `json:"name"`
+		StartTime   string  `json:"start_time"`
+		EndTime     string  `json:"end_time"`
+		UnitMinutes int     `json:"unit_minutes"`
+		UnitPrice   float64 `json:"unit_price"`
+		Cap         float64 `json:"cap"`
+	} `json:"bands"` // 分时段规则（banded）的时段价格
+}
+
+// GetParkingLotTariffs 获取停车场收费标准（含历史版本）
+func GetParkingLotTariffs(c *gin.Context) {
+	lotID := c.Param("id")
+
+	var lot models.ParkingLot
+	if err := models.DB.First(&lot, lotID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "停车场不存在"})
+		return
+	}
+
+	var tariffs []models.ParkingTariff
+	if err := models.DB.Preload("Bands").Where("parking_lot_id = ?", lot.ID).
+		Order("spot_type, version desc").
+		Find(&tariffs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取收费标准失败"})
+		return
+	}
+
+	var data []gin.H
+	for _, tariff := range tariffs {
+		tariff := tariff
+		data = append(data, gin.H{
+			"tariff":      tariff,
+			"description": services.DescribeTariff(&tariff),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    data,
+		"message": "获取收费标准成功",
+	})
+}
+
+// CreateParkingLotTariff 新增收费标准版本（旧版本保留，进行中的会话继续按旧版本计费）
+func CreateParkingLotTariff(c *gin.Context) {
+	lotID := c.Param("id")
+
+	var lot models.ParkingLot
+	if err := models.DB.Scopes(orgScope(c, "organization_id")).First(&lot, lotID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "停车场不存在"})
+		return
+	}
+
+	var req CreateTariffRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	if req.SpotType == "" {
+		req.SpotType = "normal"
+	}
+	if req.RuleType == "" {
+		req.RuleType = "standard"
+	}
+	if !services.IsPricingRuleRegistered(req.RuleType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的计费规则类型"})
+		return
+	}
+	if req.FreeMinutes < 0 || req.FirstPeriodMinutes < 0 || req.UnitMinutes <= 0 ||
+		req.FirstPeriodPrice < 0 || req.UnitPrice < 0 || req.DailyCap < 0 || req.MaxFee < 0 ||
+		req.RuleType == "standard" && req.FirstPeriodMinutes == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "收费参数无效"})
+		return
+	}
+
+	bands := make([]models.TariffBand, 0, len(req.Bands))
+	for _, band := range req.Bands {
+		bands = append(bands, models.TariffBand{
+			DayType:     strings.TrimSpace(band.DayType),
+			Name:        strings.TrimSpace(band.Name),
+			StartTime:   strings.TrimSpace(band.StartTime),
+			EndTime:     strings.TrimSpace(band.EndTime),
+			UnitMinutes: band.UnitMinutes,
+			UnitPrice:   band.UnitPrice,
+			Cap:         band.Cap,
+		})
+	}
+	if req.RuleType == "banded" && len(bands) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrTariffBandsRequired.Error()})
+		return
+	}
+	if req.RuleType != "banded" && len(bands) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "只有分时段计费规则可以配置时段价格"})
+		return
+	}
+	if err := services.ValidateTariffBands(bands); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	effectiveFrom := time.Now()
+	if req.EffectiveFrom != nil {
+		effectiveFrom = *req.EffectiveFrom
+	}
+
+	var latestVersion int
+	models.DB.Model(&models.ParkingTariff{}).
+		Where("parking_lot_id = ? AND spot_type = ?", lot.ID, req.SpotType).
+		Select("COALESCE(MAX(version), 0)").
+		Scan(&latestVersion)
+
+	tariff := models.ParkingTariff{
+		ParkingLotID:       lot.ID,
+		SpotType:           req.SpotType,
+		Version:            latestVersion + 1,
+		RuleType:           req.RuleType,
+		FreeMinutes:        req.FreeMinutes,
+		FirstPeriodMinutes: req.FirstPeriodMinutes,
+		FirstPeriodPrice:   req.FirstPeriodPrice,
+		UnitMinutes:        req.UnitMinutes,
+		UnitPrice:          req.UnitPrice,
+		DailyCap:           req.DailyCap,
+		MaxFee:             req.MaxFee,
+		EffectiveFrom:      effectiveFrom,
+		IsActive:           true,
+		Bands:              bands,
+	}
+
+	if err := models.DB.Create(&tariff).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建收费标准失败"})
+		return
+	}
+	auditTarget(c, "parking_tariff", tariff.ID)
+	auditAfter(c, tariff)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data": gin.H{
+			"tariff":      tariff,
+			"description": services.DescribeTariff(&tariff),
+		},
+		"message": "收费标准创建成功",
+	})
+}
+
+// maxQuoteMinutes 费用试算的最长停车时长（分钟）
+const maxQuoteMinutes = 7 * 24 * 60
+
+// QuoteParkingFee 按停车场当前收费标准试算停车费用，start_time（RFC3339）可指定入场时间以试算分时段价格
+func QuoteParkingFee(c *gin.Context) {
+	lotID := c.Param("id")
+	spotType := c.DefaultQuery("spot_type", "normal")
+
+	minutes, err := strconv.Atoi(c.DefaultQuery("minutes", "60"))
+	if err != nil || minutes < 0 || minutes > maxQuoteMinutes {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的停车时长，最长可试算7天"})
+		return
+	}
+
+	var lot models.ParkingLot
+	if err := models.DB.First(&lot, lotID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "停车场不存在"})
+		return
+	}
+
+	start := time.Now()
+	if value := c.Query("start_time"); value != "" {
+		start, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的入场时间"})
+			return
+		}
+	}
+	session := models.ParkingSession{
+		ParkingLotID: lot.ID,
+		SpotType:     spotType,
+		StartTime:    start,
+	}
+	quote, err := services.QuoteSession(models.DB, &session, start.Add(time.Duration(minutes)*time.Minute))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "计算停车费用失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    quote,
+		"message": "费用试算成功",
+	})
+}
@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"urban_traffic_backend/models"
+	"urban_traffic_backend/services"
 
 	"github.com/gin-gonic/gin"
 )
@@ -281,19 +282,29 @@ func GetCurrentParkingStatus(c *gin.Context) {
 	}
 
 	// 计算停车时长
-	duration := time.Since(parkingSession.StartTime)
+	now := time.Now()
+	duration := now.Sub(parkingSession.StartTime)
 
-	// 计算当前费用（这里使用简单的计费逻辑）
-	hours := duration.Hours()
-	currentFee := hours * 5.0 // 假设每小时5元
-
-	// 计算下次计费时间
-	nextBillingHour := int(hours) + 1
-	nextBilling := parkingSession.StartTime.Add(time.Duration(nextBillingHour) * time.Hour)
-	remainingMinutes := int(time.Until(nextBilling).Minutes())
+	// 按停车场收费标准计算当前费用
+	quote, err := services.QuoteSession(models.DB, &parkingSession, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "计算停车费用失败"})
+		return
+	}
 
-	// 计算当前计费周期进度
-	billingProgress := int((duration.Minutes() - float64(int(hours)*60)) / 60.0 * 100)
+	// 计算下次计费时间和当前计费周期进度
+	var nextBilling string
+	var nextFee float64
+	var remainingMinutes, billingProgress int
+	if quote.NextBillingTime != nil {
+		nextBilling = quote.NextBillingTime.Format("2006-01-02 15:04:05")
+		nextFee = *quote.NextFeeAmount
+		remainingMinutes = int(quote.NextBillingTime.Sub(now).Minutes())
+		if remainingMinutes > quote.CycleMinutes {
+			remainingMinutes = quote.CycleMinutes
+		}
+		billingProgress = int(float64(quote.CycleMinutes-remainingMinutes) / float64(quote.CycleMinutes) * 100)
+	}
 
 	// 获取停车场信息以获取location
 	var parkingLot models.ParkingLot
@@ -303,13 +314,16 @@ func GetCurrentParkingStatus(c *gin.Context) {
 		"is_parking":        true,
 		"location":          parkingLot.Name + " " + parkingSession.SpotCode,
 		"start_time":        parkingSession.StartTime.Format("2006-01-02 15:04:05"),
-		"duration":          fmt.Sprintf("%.0f小时%.0f分钟", duration.Hours(), duration.Minutes()-duration.Hours()*60),
-		"current_fee":       currentFee,
-		"billing_cycle":     int(hours) + 1,
-		"next_billing":      nextBilling.Format("2006-01-02 15:04:05"),
-		"next_fee":          5.00,
+		"duration":          fmt.Sprintf("%d小时%d分钟", int(duration.Hours()), int(duration.Minutes())%60),
+		"current_fee":       quote.Total,
+		"billing_cycle":     quote.BillingCycle,
+		"next_billing":      nextBilling,
+		"next_fee":          nextFee,
 		"billing_progress":  billingProgress,
 		"remaining_minutes": remainingMinutes,
+		"pricing_rule":      quote.Description,
+		"fee_items":         quote.Items,
+		"fee_bands":         quote.Bands,
 	}
 
 	c.JSON(http.StatusOK, gin.H{
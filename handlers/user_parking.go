@@ -9,34 +9,41 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"log"
 	"math"
 	"net/http"
 	"strconv"
 	"time"
 
 	"urban_traffic_backend/models"
+	"urban_traffic_backend/services"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
 )
 
 // ParkingSessionResponse 停车会话响应结构
 type ParkingSessionResponse struct {
-	ID                            uint           `json:"id"`
-	VehiclePlate                  string         `json:"vehicle_plate"`
-	ParkingLot                    ParkingLotInfo `json:"parking_lot"`
-	SpotCode                      string         `json:"spot_code"`
-	SpotType                      string         `json:"spot_type"`
-	StartTime                     string         `json:"start_time"`
-	DurationMinutes               int            `json:"duration_minutes"`
-	FeeCurrent                    float64        `json:"fee_current"`
-	NextBillingTime               *string        `json:"next_billing_time"`
-	NextFeeAmount                 *float64       `json:"next_fee_amount"`
-	BillingProgressPercent        int            `json:"billing_progress_percent"`
-	RemainingMinutesToNextBilling int            `json:"remaining_minutes_to_next_billing"`
-	CurrentBillingCycle           int            `json:"current_billing_cycle"`
-	PricingRule                   string         `json:"pricing_rule"`
-	Navigation                    NavigationInfo `json:"navigation"`
-	Status                        string         `json:"status"`
+	ID                            uint                  `json:"id"`
+	VehiclePlate                  string                `json:"vehicle_plate"`
+	ParkingLot                    ParkingLotInfo        `json:"parking_lot"`
+	SpotCode                      string                `json:"spot_code"`
+	SpotType                      string                `json:"spot_type"`
+	StartTime                     string                `json:"start_time"`
+	DurationMinutes               int                   `json:"duration_minutes"`
+	FeeCurrent                    float64               `json:"fee_current"`
+	NextBillingTime               *string               `json:"next_billing_time"`
+	NextFeeAmount                 *float64              `json:"next_fee_amount"`
+	BillingProgressPercent        int                   `json:"billing_progress_percent"`
+	RemainingMinutesToNextBilling int                   `json:"remaining_minutes_to_next_billing"`
+	CurrentBillingCycle           int                   `json:"current_billing_cycle"`
+	PricingRule                   string                `json:"pricing_rule"`
+	FeeItems                      []services.FeeItem    `json:"fee_items"`
+	FeeBands                      []services.BandCharge `json:"fee_bands,omitempty"`
+	Navigation                    NavigationInfo        `json:"navigation"`
+	Status                        string                `json:"status"`
 }
 
 type ParkingLotInfo struct {
@@ -67,9 +74,10 @@ type ParkingSessionHistoryItem struct {
 	EndTime         string  `json:"end_time"`
 	TotalFee        float64 `json:"total_fee"`
 	DurationMinutes int     `json:"duration_minutes"`
+	Status          string  `json:"status"` // ended 待支付，paid 已支付
 }
 
-// GetCurrentParkingSession 获取当前用户的活跃停车会话
+// GetCurrentParkingSession 获取当前用户的活跃停车会话，包括本人作为车主或驾驶人的共享车辆的会话
 func GetCurrentParkingSession(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -78,7 +86,9 @@ func GetCurrentParkingSession(c *gin.Context) {
 	}
 
 	var session models.ParkingSession
-	result := models.DB.Preload("Vehicle").Preload("ParkingLot").Where("user_id = ? AND status = ?", userID, "active").First(&session)
+	result := models.DB.Preload("Vehicle").Preload("ParkingLot").Preload("ParkingSpot").
+		Scopes(driverSessionScope(userID)).Where("status = ?", "active").
+		Order("start_time DESC").First(&session)
 
 	if result.Error != nil {
 		// 没有找到活跃会话
@@ -91,18 +101,30 @@ func GetCurrentParkingSession(c *gin.Context) {
 	}
 
 	// 计算停车时长（分钟）
-	durationMinutes := int(time.Since(session.StartTime).Minutes())
+	now := time.Now()
+	durationMinutes := int(now.Sub(session.StartTime).Minutes())
+
+	// 按收费标准实时计费
+	quote, err := services.QuoteSession(models.DB, &session, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "计算停车费用失败"})
+		return
+	}
+	services.ApplyQuote(&session, quote)
 
 	// 计算计费进度
 	var billingProgressPercent int
 	var remainingMinutesToNextBilling int
 
 	if session.NextBillingTime != nil {
-		totalBillingDuration := 60 // 一小时计费周期
-		remainingMinutes := int(session.NextBillingTime.Sub(time.Now()).Minutes())
+		totalBillingDuration := quote.CycleMinutes
+		remainingMinutes := int(session.NextBillingTime.Sub(now).Minutes())
 		if remainingMinutes < 0 {
 			remainingMinutes = 0
 		}
+		if remainingMinutes > totalBillingDuration {
+			remainingMinutes = totalBillingDuration
+		}
 		remainingMinutesToNextBilling = remainingMinutes
 		billingProgressPercent = int((float64(totalBillingDuration-remainingMinutes) / float64(totalBillingDuration)) * 100)
 	}
@@ -112,10 +134,8 @@ func GetCurrentParkingSession(c *gin.Context) {
 		ID:           session.ID,
 		VehiclePlate: session.Vehicle.PlateNumber,
 		ParkingLot: ParkingLotInfo{
-			ID:    session.ParkingLot.ID,
-			Name:  session.ParkingLot.Name,
-			Floor: "B1", // 可以从数据库字段获取
-			Area:  "A区", // 可以从数据库字段获取
+			ID:   session.ParkingLot.ID,
+			Name: session.ParkingLot.Name,
 		},
 		SpotCode:                      session.SpotCode,
 		SpotType:                      session.SpotType,
@@ -128,6 +148,8 @@ func GetCurrentParkingSession(c *gin.Context) {
 		RemainingMinutesToNextBilling: remainingMinutesToNextBilling,
 		CurrentBillingCycle:           session.CurrentBillingCycle,
 		PricingRule:                   session.PricingRule,
+		FeeItems:                      quote.Items,
+		FeeBands:                      quote.Bands,
 		Navigation: NavigationInfo{
 			Status:             session.NavigationStatus,
 			RemainingDistanceM: session.RemainingDistanceM,
@@ -142,6 +164,12 @@ func GetCurrentParkingSession(c *gin.Context) {
 		Status: session.Status,
 	}
 
+	// 已分配车位时返回车位所在楼层和区域
+	if session.ParkingSpot != nil {
+		response.ParkingLot.Floor = session.ParkingSpot.Floor
+		response.ParkingLot.Area = session.ParkingSpot.Zone
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success":     true,
 		"data":        response,
@@ -149,7 +177,261 @@ func GetCurrentParkingSession(c *gin.Context) {
 	})
 }
 
-// GetParkingSessionHistory 获取停车会话历史记录
+// StartParkingSessionRequest 开始停车请求
+type StartParkingSessionRequest struct {
+	VehicleID    uint     `json:"vehicle_id" binding:"required"`
+	ParkingLotID uint     `json:"parking_lot_id" binding:"required"`
+	SpotType     string   `json:"spot_type"`
+	UserLat      *float64 `json:"user_lat"`
+	UserLon      *float64 `json:"user_lon"`
+}
+
+// StartParkingSession 用户在 App 内为自己的车辆开始停车，同时预占车位
+func StartParkingSession(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+	uid := userID.(uint)
+
+	var req StartParkingSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+	if req.SpotType == "" {
+		req.SpotType = "normal"
+	}
+
+	var lot models.ParkingLot
+	if err := models.DB.Where("id = ? AND is_active = ?", req.ParkingLotID, true).First(&lot).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "停车场不存在"})
+		return
+	}
+
+	if req.SpotType != "normal" {
+		var count int64
+		models.DB.Model(&models.SpecialSpot{}).
+			Where("parking_lot_id = ? AND spot_type = ?", lot.ID, req.SpotType).
+			Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "该停车场没有此类型车位"})
+			return
+		}
+	}
+
+	now := time.Now()
+	if err := services.CheckLotOpen(models.DB, &lot, now); err != nil {
+		if errors.Is(err, services.ErrLotClosed) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取营业时间失败"})
+		return
+	}
+
+	tariff, err := services.FindTariff(models.DB, &lot, req.SpotType, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取收费标准失败"})
+		return
+	}
+
+	tx := models.DB.Begin()
+
+	// 锁定车辆行，防止同一车辆并发开启多个会话
+	var vehicle models.Vehicle
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND id IN (?)", req.VehicleID, services.MemberVehicleIDs(uid)).
+		First(&vehicle).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "车辆不存在"})
+		return
+	}
+
+	plate := models.NormalizePlate(vehicle.PlateNumber)
+
+	// 黑名单车辆禁止停车并报警，白名单车辆免收停车费
+	accessEntry, err := services.CheckAccessList(tx, lot.ID, plate, now)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询车辆名单失败"})
+		return
+	}
+	if accessEntry != nil && accessEntry.ListType == models.AccessListBlacklist {
+		tx.Rollback()
+		if err := services.RaiseBlacklistAlarm(models.DB, &lot, accessEntry, "在App内申请开始停车", now); err != nil {
+			log.Printf("raise blacklist alarm for plate %s failed: %v", plate, err)
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": services.ErrPlateBlacklisted.Error()})
+		return
+	}
+
+	var activeCount int64
+	if err := tx.Model(&models.ParkingSession{}).
+		Where("(vehicle_id = ? OR plate_number = ?) AND status = ?", vehicle.ID, plate, "active").
+		Count(&activeCount).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询停车会话失败"})
+		return
+	}
+	if activeCount > 0 {
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{"error": "该车辆已有进行中的停车会话"})
+		return
+	}
+
+	// 该车辆在此停车场有保留中的预约时直接使用预约的车位
+	reservation, err := services.FindHeldReservation(tx, lot.ID, &vehicle.ID, plate)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询预约失败"})
+		return
+	}
+
+	// 月卡有效期内停车免费，含固定车位的月卡优先使用固定车位
+	pass, err := services.FindActivePass(tx, lot.ID, &vehicle.ID, plate, now)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询月卡失败"})
+		return
+	}
+
+	var spot *models.ParkingSpot
+	if pass != nil {
+		if spot, err = services.ClaimPassSpot(tx, pass); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "使用月卡车位失败"})
+			return
+		}
+	}
+	if spot != nil && reservation != nil {
+		// 已使用月卡固定车位，预约的车位不再需要
+		if err := services.CancelReservation(tx, reservation, now); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "取消预约失败"})
+			return
+		}
+		reservation = nil
+	}
+
+	if reservation == nil && spot == nil {
+		spot, err = services.OccupyCapacity(tx, lot.ID, req.SpotType)
+		if err != nil {
+			tx.Rollback()
+			if errors.Is(err, services.ErrLotFull) || errors.Is(err, services.ErrSpotTypeFull) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "预占车位失败"})
+			return
+		}
+	}
+
+	session := models.ParkingSession{
+		UserID:           &uid,
+		VehicleID:        &vehicle.ID,
+		PlateNumber:      plate,
+		ParkingLotID:     lot.ID,
+		SpotType:         req.SpotType,
+		StartTime:        now,
+		Status:           "active",
+		FeeRate:          lot.HourlyRate,
+		NavigationStatus: "en_route",
+		DestinationLat:   lot.Latitude,
+		DestinationLon:   lot.Longitude,
+		UserPositionLat:  req.UserLat,
+		UserPositionLon:  req.UserLon,
+	}
+	if tariff.ID != 0 {
+		session.TariffID = &tariff.ID
+	}
+	if spot != nil {
+		session.ParkingSpotID = &spot.ID
+		session.SpotCode = spot.Code
+		session.SpotType = spot.SpotType
+	}
+	if pass != nil {
+		session.PassID = &pass.ID
+	}
+	if accessEntry != nil {
+		session.AccessEntryID = &accessEntry.ID
+	}
+	if reservation != nil {
+		if err := services.ClaimReservation(tx, reservation, &session); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "使用预约车位失败"})
+			return
+		}
+	}
+	// 预约或月卡固定车位的类型可能与请求不同，按实际车位类型重新匹配收费标准
+	if session.SpotType != req.SpotType {
+		tariff, err = services.FindTariff(tx, &lot, session.SpotType, now)
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取收费标准失败"})
+			return
+		}
+		session.TariffID = nil
+		if tariff.ID != 0 {
+			session.TariffID = &tariff.ID
+		}
+	}
+
+	// 提供用户位置时估算导航距离，按市区平均车速30km/h估算到达时间
+	if req.UserLat != nil && req.UserLon != nil {
+		distanceKm := calculateDistance(*req.UserLat, *req.UserLon, lot.Latitude, lot.Longitude)
+		session.RemainingDistanceM = int(distanceKm * 1000)
+		session.EstimatedMinutes = int(math.Ceil(distanceKm / 30 * 60))
+	}
+
+	quote, err := services.QuoteSession(tx, &session, now)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "计算停车费用失败"})
+		return
+	}
+	services.ApplyQuote(&session, quote)
+
+	if err := tx.Create(&session).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "开始停车失败"})
+		return
+	}
+
+	if reservation != nil {
+		if err := services.CompleteReservation(tx, reservation, session.ID, now); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "开始停车失败"})
+			return
+		}
+	}
+
+	tx.Commit()
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data": gin.H{
+			"session_id":   session.ID,
+			"vehicle":      vehicle.PlateNumber,
+			"parking_lot":  lot.Name,
+			"spot_type":    session.SpotType,
+			"spot_code":    session.SpotCode,
+			"start_time":   session.StartTime.Format("2006-01-02 15:04:05"),
+			"pricing_rule": session.PricingRule,
+			"navigation": NavigationInfo{
+				Status:             session.NavigationStatus,
+				RemainingDistanceM: session.RemainingDistanceM,
+				EstimatedMinutes:   session.EstimatedMinutes,
+				Destination:        Position{Lat: lot.Latitude, Lon: lot.Longitude},
+				UserPosition:       formatPositionPtr(req.UserLat, req.UserLon),
+			},
+		},
+		"message": "开始停车成功",
+	})
+}
+
+// GetParkingSessionHistory 获取停车会话历史记录，包括本人作为车主或驾驶人的共享车辆的会话
 func GetParkingSessionHistory(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -174,10 +456,11 @@ func GetParkingSessionHistory(c *gin.Context) {
 	var total int64
 
 	// 计算总数
-	models.DB.Model(&models.ParkingSession{}).Where("user_id = ? AND status = ?", userID, "ended").Count(&total)
+	models.DB.Model(&models.ParkingSession{}).Scopes(driverSessionScope(userID)).
+		Where("status IN ?", []string{"ended", "paid"}).Count(&total)
 
 	// 获取历史记录
-	models.DB.Preload("ParkingLot").Where("user_id = ? AND status = ?", userID, "ended").
+	models.DB.Preload("ParkingLot").Scopes(driverSessionScope(userID)).Where("status IN ?", []string{"ended", "paid"}).
 		Order("start_time DESC").Limit(pageSize).Offset(offset).Find(&sessions)
 
 	var historyItems []ParkingSessionHistoryItem
@@ -187,6 +470,7 @@ func GetParkingSessionHistory(c *gin.Context) {
 			ParkingLotName: session.ParkingLot.Name,
 			StartTime:      session.StartTime.Format("2006-01-02 15:04:05"),
 			TotalFee:       session.FeeCurrent,
+			Status:         session.Status,
 		}
 
 		if session.EndTime != nil {
@@ -222,7 +506,7 @@ func RefreshParkingNavigation(c *gin.Context) {
 	}
 
 	var session models.ParkingSession
-	result := models.DB.Where("id = ? AND user_id = ?", sessionID, userID).First(&session)
+	result := models.DB.Scopes(driverSessionScope(userID)).Where("id = ?", sessionID).First(&session)
 	if result.Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "停车会话不存在"})
 		return
@@ -272,6 +556,7 @@ func PayCurrentParkingFee(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
 		return
 	}
+	uid := userID.(uint)
 
 	sessionIDStr := c.Param("sessionId")
 	sessionID, err := strconv.ParseUint(sessionIDStr, 10, 32)
@@ -280,49 +565,155 @@ func PayCurrentParkingFee(c *gin.Context) {
 		return
 	}
 
+	// 支付方式可选，默认使用停车场支持的第一种线上支付方式
+	var request struct {
+		Method string `json:"method"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+			return
+		}
+	}
+
 	var session models.ParkingSession
-	result := models.DB.Where("id = ? AND user_id = ?", sessionID, userID).First(&session)
+	result := models.DB.Preload("ParkingLot").Scopes(driverSessionScope(userID)).Where("id = ?", sessionID).First(&session)
 	if result.Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "停车会话不存在"})
 		return
 	}
 
-	// 模拟支付过程
+	if session.Status == "paid" {
+		c.JSON(http.StatusConflict, gin.H{"error": "停车费已支付"})
+		return
+	}
+	if _, err := services.SelectPaymentMethod(&session.ParkingLot, request.Method); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":           err.Error(),
+			"payment_methods": services.OnlinePaymentMethods(&session.ParkingLot),
+		})
+		return
+	}
+
+	// 进行中的会话先结算离场：按收费标准计算最终费用、生成停车记录并释放车位，
+	// 已通过出场事件结束的会话直接按结束时的费用支付
 	now := time.Now()
-	session.EndTime = &now
-	session.Status = "ended"
-
-	// 创建停车记录
-	record := models.ParkingRecord{
-		VehicleID:    session.VehicleID,
-		ParkingLotID: &session.ParkingLotID,
-		Location:     "", // 从ParkingLot获取
-		StartTime:    session.StartTime.Format("2006-01-02 15:04:05"),
-		EndTime:      now.Format("2006-01-02 15:04:05"),
-		Fee:          session.FeeCurrent,
-		Duration:     time.Since(session.StartTime).Hours(),
-		SpotType:     session.SpotType,
-	}
-
-	// 在事务中更新
-	tx := models.DB.Begin()
-	if err := tx.Save(&session).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "支付失败"})
+	quoteAt := now
+	if session.Status != "active" && session.EndTime != nil {
+		quoteAt = *session.EndTime
+	}
+	quote, err := services.QuoteSession(models.DB, &session, quoteAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "计算停车费用失败"})
 		return
 	}
 
-	if err := tx.Create(&record).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "支付失败"})
+	if session.Status == "active" {
+		services.ApplyQuote(&session, quote)
+
+		session.EndTime = &now
+		session.Status = "ended"
+		session.NextBillingTime = nil
+		session.NextFeeAmount = nil
+
+		// 在事务中更新，仅当会话仍为进行中时结算，避免与出场事件重复结算
+		tx := models.DB.Begin()
+		updated := tx.Model(&models.ParkingSession{}).
+			Where("id = ? AND status = ?", session.ID, "active").
+			Updates(map[string]interface{}{
+				"end_time":              session.EndTime,
+				"status":                session.Status,
+				"tariff_id":             session.TariffID,
+				"fee_current":           session.FeeCurrent,
+				"fee_surcharge":         session.FeeSurcharge,
+				"next_billing_time":     nil,
+				"next_fee_amount":       nil,
+				"current_billing_cycle": session.CurrentBillingCycle,
+				"pricing_rule":          session.PricingRule,
+			})
+		if updated.Error != nil || updated.RowsAffected == 0 {
+			tx.Rollback()
+			c.JSON(http.StatusConflict, gin.H{"error": "停车会话状态已变化，请刷新后重试"})
+			return
+		}
+
+		if err := services.SaveSettledFeeItems(tx, session.ID, quote); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "结算失败"})
+			return
+		}
+
+		// 创建停车记录（匿名会话没有关联车辆）
+		if session.VehicleID != nil {
+			record := models.ParkingRecord{
+				VehicleID:    *session.VehicleID,
+				SessionID:    &session.ID,
+				ParkingLotID: &session.ParkingLotID,
+				Location:     session.ParkingLot.Name,
+				StartTime:    session.StartTime.Format("2006-01-02 15:04:05"),
+				EndTime:      now.Format("2006-01-02 15:04:05"),
+				Fee:          session.FeeCurrent,
+				Duration:     now.Sub(session.StartTime).Hours(),
+				SpotType:     session.SpotType,
+			}
+			if err := tx.Create(&record).Error; err != nil {
+				tx.Rollback()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "结算失败"})
+				return
+			}
+		}
+
+		// 结算即离场，释放车位；之后的出场事件不会重复释放
+		if err := services.ReleaseSessionCapacity(tx, &session); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "结算失败"})
+			return
+		}
+
+		tx.Commit()
+	}
+
+	order, err := services.CreatePaymentOrder(services.PaymentRequest{
+		UserID:         &uid,
+		ParkingLot:     &session.ParkingLot,
+		Purpose:        models.PaymentPurposeParking,
+		SessionID:      &session.ID,
+		Amount:         session.FeeCurrent,
+		Method:         request.Method,
+		IdempotencyKey: c.GetHeader("Idempotency-Key"),
+		Description:    fmt.Sprintf("%s停车费", session.ParkingLot.Name),
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrIdempotencyConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建支付订单失败"})
 		return
 	}
 
-	tx.Commit()
+	status := http.StatusAccepted
+	message := "支付已发起，等待支付结果"
+	switch order.Status {
+	case models.PaymentStatusPending:
+	case models.PaymentStatusFailed:
+		status = http.StatusBadGateway
+		message = "支付失败，请重试"
+	default:
+		status = http.StatusOK
+		message = "支付成功"
+	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "支付成功",
+	c.JSON(status, gin.H{
+		"success": order.Status != models.PaymentStatusFailed,
+		"data": gin.H{
+			"session_id": session.ID,
+			"fee":        session.FeeCurrent,
+			"fee_items":  quote.Items,
+			"fee_bands":  quote.Bands,
+			"order":      order,
+		},
+		"message": message,
 	})
 }
 
@@ -350,7 +741,7 @@ func ExtendParkingSession(c *gin.Context) {
 	}
 
 	var session models.ParkingSession
-	result := models.DB.Where("id = ? AND user_id = ?", sessionID, userID).First(&session)
+	result := models.DB.Scopes(driverSessionScope(userID)).Where("id = ?", sessionID).First(&session)
 	if result.Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "停车会话不存在"})
 		return
@@ -0,0 +1,320 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"urban_traffic_backend/models"
+	"urban_traffic_backend/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// UserStatusRequest 启用或停用账号请求
+type UserStatusRequest struct {
+	IsActive *bool `json:"is_active" binding:"required"`
+}
+
+// UserRoleRequest 修改用户角色请求，organization_id 只有平台超级管理员可以指定，
+// 组织管理员设置的工作人员固定归属本组织
+type UserRoleRequest struct {
+	UserType       string `json:"user_type" binding:"required"`
+	OrganizationID *uint  `json:"organization_id"`
+}
+
+// userScope 用户管理的可见范围：平台超级管理员可见全部用户，组织管理员只可见本组织工作人员。
+// 普通用户账号属于平台，不归属任何组织，只有平台超级管理员可以查看和修改
+func userScope(c *gin.Context) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		orgID, all := callerOrganization(c)
+		if all {
+			return db
+		}
+		return db.Where("organization_id = ? AND user_type <> ?", orgID, models.RoleUser)
+	}
+}
+
+// findManagedUser 按路径参数查找调用者可管理的用户，找不到时已写入响应
+func findManagedUser(c *gin.Context) (*models.User, bool) {
+	var user models.User
+	if err := models.DB.Scopes(userScope(c)).First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// checkUserModifiable 不能修改自己的账号状态和角色，只有平台超级管理员可以修改平台超级管理员
+func checkUserModifiable(c *gin.Context, user *models.User) bool {
+	if user.ID == c.GetUint("user_id") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "不能修改自己的账号状态或角色"})
+		return false
+	}
+	if user.UserType == models.RoleSuperAdmin && c.GetString("user_type") != models.RoleSuperAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权修改平台超级管理员"})
+		return false
+	}
+	return true
+}
+
+// GetUsers 分页搜索用户，keyword 匹配用户名、邮箱、昵称和手机号，
+// 可按角色、启用状态筛选
+func GetUsers(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	query := models.DB.Model(&models.User{}).Scopes(userScope(c))
+	if keyword := strings.TrimSpace(c.Query("keyword")); keyword != "" {
+		like := "%" + keyword + "%"
+		query = query.Where("(username LIKE ? OR email LIKE ? OR nickname LIKE ? OR phone LIKE ?)", like, like, like, like)
+	}
+	if userType := c.Query("user_type"); userType != "" {
+		query = query.Where("user_type = ?", userType)
+	}
+	if isActive := c.Query("is_active"); isActive != "" {
+		active, err := strconv.ParseBool(isActive)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的启用状态"})
+			return
+		}
+		query = query.Where("is_active = ?", active)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取用户列表失败"})
+		return
+	}
+
+	var users []models.User
+	if err := query.Order("id DESC").Limit(pageSize).Offset((page - 1) * pageSize).Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取用户列表失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"data":      users,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// GetUserDetail 查看用户资料及其名下车辆
+func GetUserDetail(c *gin.Context) {
+	user, ok := findManagedUser(c)
+	if !ok {
+		return
+	}
+
+	var vehicles []models.Vehicle
+	if err := models.DB.Where("user_id = ?", user.ID).Order("is_default DESC, id").Find(&vehicles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取用户车辆失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"user":        user,
+			"permissions": models.RolePermissions(user.UserType),
+			"vehicles":    vehicles,
+		},
+		"message": "获取用户信息成功",
+	})
+}
+
+// GetUserAuthSessions 查看用户当前有效的登录会话
+func GetUserAuthSessions(c *gin.Context) {
+	user, ok := findManagedUser(c)
+	if !ok {
+		return
+	}
+
+	sessions, err := services.ActiveSessions(models.DB, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取登录设备失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    sessions,
+		"message": "获取登录设备成功",
+	})
+}
+
+// GetUserParkingSessions 分页查看用户的停车会话，组织管理员只能看到本组织停车场的记录
+func GetUserParkingSessions(c *gin.Context) {
+	user, ok := findManagedUser(c)
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	query := models.DB.Model(&models.ParkingSession{}).
+		Scopes(lotScope(c, "parking_lot_id")).
+		Where("user_id = ?", user.ID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取停车记录失败"})
+		return
+	}
+
+	var sessions []models.ParkingSession
+	if err := query.Preload("ParkingLot").Order("start_time DESC").
+		Limit(pageSize).Offset((page - 1) * pageSize).Find(&sessions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取停车记录失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"data":      sessions,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// UpdateUserStatus 启用或停用账号，停用后该用户无法登录，已登录的会话立即失效
+func UpdateUserStatus(c *gin.Context) {
+	user, ok := findManagedUser(c)
+	if !ok || !checkUserModifiable(c, user) {
+		return
+	}
+
+	var req UserStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	auditTarget(c, "user", user.ID)
+	auditBefore(c, user)
+	if err := services.SetUserActive(models.DB, user, *req.IsActive); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改账号状态失败"})
+		return
+	}
+	auditAfter(c, user)
+
+	message := "账号已启用"
+	if !user.IsActive {
+		message = "账号已停用"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    user,
+		"message": message,
+	})
+}
+
+// UpdateUserRole 修改用户角色，只有平台超级管理员可以授予平台超级管理员角色。
+// 组织管理员设置的工作人员归属本组织，平台超级管理员未指定组织时保留用户原组织
+func UpdateUserRole(c *gin.Context) {
+	user, ok := findManagedUser(c)
+	if !ok || !checkUserModifiable(c, user) {
+		return
+	}
+
+	var req UserRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	if req.UserType == models.RoleSuperAdmin && c.GetString("user_type") != models.RoleSuperAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权授予平台超级管理员角色"})
+		return
+	}
+
+	organizationID := user.OrganizationID
+	if c.GetString("user_type") == models.RoleSuperAdmin {
+		if req.OrganizationID != nil {
+			organizationID = req.OrganizationID
+		}
+	} else if orgID := c.GetUint("organization_id"); orgID != 0 {
+		organizationID = &orgID
+	} else {
+		organizationID = nil
+	}
+
+	auditTarget(c, "user", user.ID)
+	auditBefore(c, user)
+	err := services.ChangeUserRole(models.DB, user, req.UserType, organizationID)
+	switch {
+	case errors.Is(err, services.ErrInvalidRole), errors.Is(err, services.ErrStaffOrganization):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "组织不存在"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改用户角色失败"})
+		return
+	}
+	auditAfter(c, user)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    user,
+		"message": "用户角色修改成功",
+	})
+}
+
+// ForceUserPasswordReset 强制用户重置密码：原密码作废、全部会话下线，
+// 重置令牌发送到用户邮箱，不返回给管理员
+func ForceUserPasswordReset(c *gin.Context) {
+	user, ok := findManagedUser(c)
+	if !ok {
+		return
+	}
+	if user.UserType == models.RoleSuperAdmin && c.GetString("user_type") != models.RoleSuperAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权修改平台超级管理员"})
+		return
+	}
+
+	auditTarget(c, "user", user.ID)
+	if err := services.ForcePasswordReset(models.DB, user); err != nil {
+		if errors.Is(err, services.ErrNotifierNotConfigured) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "重置密码失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "已重置密码，重置令牌已发送到用户邮箱",
+	})
+}
@@ -0,0 +1,259 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"urban_traffic_backend/models"
+	"urban_traffic_backend/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// InviteDriverRequest 邀请驾驶人请求，account 为对方的用户名、邮箱或手机号
+type InviteDriverRequest struct {
+	Account string `json:"account" binding:"required"`
+}
+
+// respondVehicleError 将车辆共享相关的错误转换为响应
+func respondVehicleError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrVehicleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvitationNotFound), errors.Is(err, services.ErrInviteeNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrNotVehicleOwner):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrAlreadyMember), errors.Is(err, services.ErrVehicleInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrOwnerCannotLeave):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// driverSessionScope 用户可见的停车会话：本人开启的会话，以及本人作为车主或驾驶人的车辆的会话
+func driverSessionScope(userID interface{}) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		uid, _ := userID.(uint)
+		return db.Where("(user_id = ? OR vehicle_id IN (?))", uid, services.MemberVehicleIDs(uid))
+	}
+}
+
+// GetVehicleMembers 查看车辆的车主、驾驶人和待处理的邀请，车辆的有效成员均可查看
+func GetVehicleMembers(c *gin.Context) {
+	uid := c.GetUint("user_id")
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的车辆ID"})
+		return
+	}
+	if _, err := services.FindMembership(models.DB, uint(id), uid); err != nil {
+		respondVehicleError(c, err, "获取车辆成员失败")
+		return
+	}
+
+	var members []models.VehicleMember
+	if err := models.DB.Preload("User").
+		Where("vehicle_id = ? AND status IN ?", id, []string{models.VehicleMemberActive, models.VehicleMemberPending}).
+		Order("id").Find(&members).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取车辆成员失败"})
+		return
+	}
+
+	data := make([]gin.H, 0, len(members))
+	for _, member := range members {
+		data = append(data, gin.H{
+			"id":         member.ID,
+			"user_id":    member.UserID,
+			"username":   member.User.Username,
+			"nickname":   member.User.Nickname,
+			"role":       member.Role,
+			"status":     member.Status,
+			"created_at": member.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    data,
+		"message": "获取车辆成员成功",
+	})
+}
+
+// InviteVehicleDriver 车主邀请其他用户作为驾驶人共用车辆
+func InviteVehicleDriver(c *gin.Context) {
+	uid := c.GetUint("user_id")
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的车辆ID"})
+		return
+	}
+
+	var req InviteDriverRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	invitation, err := services.InviteDriver(models.DB, uid, uint(id), req.Account)
+	if err != nil {
+		respondVehicleError(c, err, "邀请驾驶人失败")
+		return
+	}
+	auditTarget(c, "vehicle_member", invitation.ID)
+	auditAfter(c, invitation)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data": gin.H{
+			"id":         invitation.ID,
+			"vehicle_id": invitation.VehicleID,
+			"user_id":    invitation.UserID,
+			"username":   invitation.User.Username,
+			"role":       invitation.Role,
+			"status":     invitation.Status,
+		},
+		"message": "邀请已发送",
+	})
+}
+
+// RemoveVehicleMember 车主移除驾驶人或撤回邀请；userId 为本人时表示驾驶人退出共享
+func RemoveVehicleMember(c *gin.Context) {
+	uid := c.GetUint("user_id")
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的车辆ID"})
+		return
+	}
+	memberUserID, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	member, err := services.RemoveMember(models.DB, uid, uint(id), uint(memberUserID))
+	if err != nil {
+		respondVehicleError(c, err, "移除车辆成员失败")
+		return
+	}
+	auditTarget(c, "vehicle_member", member.ID)
+	auditAfter(c, member)
+
+	message := "已移除驾驶人"
+	if member.UserID == uid {
+		message = "已退出共享车辆"
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": message})
+}
+
+// GetVehicleInvitations 当前用户收到的待处理车辆共享邀请
+func GetVehicleInvitations(c *gin.Context) {
+	uid := c.GetUint("user_id")
+
+	var invitations []models.VehicleMember
+	if err := models.DB.Preload("Vehicle").
+		Where("user_id = ? AND status = ?", uid, models.VehicleMemberPending).
+		Order("id DESC").Find(&invitations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取邀请失败"})
+		return
+	}
+
+	// 邀请人信息
+	inviterIDs := make([]uint, 0, len(invitations))
+	for _, invitation := range invitations {
+		if invitation.InvitedBy != nil {
+			inviterIDs = append(inviterIDs, *invitation.InvitedBy)
+		}
+	}
+	inviters := map[uint]models.User{}
+	if len(inviterIDs) > 0 {
+		var users []models.User
+		models.DB.Where("id IN ?", inviterIDs).Find(&users)
+		for _, user := range users {
+			inviters[user.ID] = user
+		}
+	}
+
+	data := make([]gin.H, 0, len(invitations))
+	for _, invitation := range invitations {
+		// 车辆已删除的邀请不再展示
+		if invitation.Vehicle.ID == 0 {
+			continue
+		}
+		item := gin.H{
+			"id":           invitation.ID,
+			"vehicle_id":   invitation.VehicleID,
+			"plate_number": invitation.Vehicle.PlateNumber,
+			"brand":        invitation.Vehicle.Brand,
+			"model":        invitation.Vehicle.Model,
+			"role":         invitation.Role,
+			"created_at":   invitation.CreatedAt,
+		}
+		if invitation.InvitedBy != nil {
+			inviter := inviters[*invitation.InvitedBy]
+			item["invited_by"] = gin.H{"id": inviter.ID, "username": inviter.Username, "nickname": inviter.Nickname}
+		}
+		data = append(data, item)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    data,
+		"message": "获取邀请成功",
+	})
+}
+
+// AcceptVehicleInvitation 接受车辆共享邀请
+func AcceptVehicleInvitation(c *gin.Context) {
+	respondVehicleInvitation(c, true)
+}
+
+// DeclineVehicleInvitation 拒绝车辆共享邀请
+func DeclineVehicleInvitation(c *gin.Context) {
+	respondVehicleInvitation(c, false)
+}
+
+func respondVehicleInvitation(c *gin.Context, accept bool) {
+	uid := c.GetUint("user_id")
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的邀请ID"})
+		return
+	}
+
+	auditTarget(c, "vehicle_member", id)
+	invitation, err := services.RespondInvitation(models.DB, uid, uint(id), accept)
+	if err != nil {
+		respondVehicleError(c, err, "处理邀请失败")
+		return
+	}
+	auditAfter(c, invitation)
+
+	message := "已拒绝邀请"
+	if accept {
+		message = "已接受邀请"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"id":           invitation.ID,
+			"vehicle_id":   invitation.VehicleID,
+			"plate_number": invitation.Vehicle.PlateNumber,
+			"status":       invitation.Status,
+			"is_default":   invitation.IsDefault,
+		},
+		"message": message,
+	})
+}
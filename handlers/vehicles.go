@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"urban_traffic_backend/models"
+	"urban_traffic_backend/services"
 
 	"github.com/gin-gonic/gin"
 )
@@ -27,7 +28,8 @@ type CreateVehicleRequest struct {
 	RegDate     string `json:"reg_date"`
 }
 
-// GetVehicles 获取用户的车辆列表
+// GetVehicles 获取用户的车辆列表，包括自己登记的车辆和他人共享给自己的车辆，
+// is_default 为当前用户自己的默认车辆标记
 func GetVehicles(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -35,16 +37,23 @@ func GetVehicles(c *gin.Context) {
 		return
 	}
 
-	var vehicles []models.Vehicle
-	if err := models.DB.Where("user_id = ?", userID).Find(&vehicles).Error; err != nil {
+	var members []models.VehicleMember
+	if err := models.DB.Preload("Vehicle").
+		Where("user_id = ? AND status = ?", userID, models.VehicleMemberActive).
+		Order("id").Find(&members).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取车辆列表失败"})
 		return
 	}
 
 	// 为每辆车添加统计信息
 	var vehiclesWithStats []models.VehicleWithStats
-	for _, vehicle := range vehicles {
-		vehicleWithStats := models.VehicleWithStats{Vehicle: vehicle}
+	for _, member := range members {
+		if member.Vehicle.ID == 0 {
+			continue
+		}
+		vehicle := member.Vehicle
+		vehicle.IsDefault = member.IsDefault
+		vehicleWithStats := models.VehicleWithStats{Vehicle: vehicle, Role: member.Role}
 
 		// 获取停车统计
 		var stats struct {
@@ -96,19 +105,14 @@ func CreateVehicle(c *gin.Context) {
 		return
 	}
 
-	// 检查车牌号是否已存在
+	// 检查车牌号是否已存在，已被他人登记的车辆需由车主邀请共享
 	var existingVehicle models.Vehicle
-	if err := models.DB.Where("plate_number = ?", req.PlateNumber).First(&existingVehicle).Error; err == nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "该车牌号已存在"})
+	if err := models.DB.Where("normalized_plate = ?", models.NormalizePlate(req.PlateNumber)).First(&existingVehicle).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "该车牌号已存在，如需共用请联系车主邀请"})
 		return
 	}
 
-	// 检查是否是用户的第一辆车
-	var count int64
-	models.DB.Model(&models.Vehicle{}).Where("user_id = ?", userID).Count(&count)
-	isDefault := count == 0
-
-	// 创建新车辆
+	// 创建新车辆，登记人为车主
 	vehicle := models.Vehicle{
 		UserID:      userID.(uint),
 		PlateNumber: req.PlateNumber,
@@ -117,7 +121,6 @@ func CreateVehicle(c *gin.Context) {
 		Color:       req.Color,
 		Type:        req.Type,
 		RegDate:     req.RegDate,
-		IsDefault:   isDefault,
 	}
 
 	if vehicle.Type == "" {
@@ -127,10 +130,12 @@ func CreateVehicle(c *gin.Context) {
 		vehicle.RegDate = time.Now().Format("2006-01-02")
 	}
 
-	if err := models.DB.Create(&vehicle).Error; err != nil {
+	if err := services.RegisterVehicle(models.DB, &vehicle); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "添加车辆失败"})
 		return
 	}
+	auditTarget(c, "vehicle", vehicle.ID)
+	auditAfter(c, vehicle)
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "车辆添加成功",
@@ -138,7 +143,7 @@ func CreateVehicle(c *gin.Context) {
 	})
 }
 
-// SetDefaultVehicle 设置默认车辆
+// SetDefaultVehicle 设置当前用户的默认车辆，自己登记的和共享给自己的车辆均可
 func SetDefaultVehicle(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -153,26 +158,15 @@ func SetDefaultVehicle(c *gin.Context) {
 		return
 	}
 
-	// 验证车辆是否属于当前用户
-	var vehicle models.Vehicle
-	if err := models.DB.Where("id = ? AND user_id = ?", id, userID).First(&vehicle).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "车辆不存在"})
-		return
-	}
-
-	// 取消其他车辆的默认状态
-	models.DB.Model(&models.Vehicle{}).Where("user_id = ?", userID).Update("is_default", false)
-
-	// 设置当前车辆为默认
-	if err := models.DB.Model(&vehicle).Update("is_default", true).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "设置默认车辆失败"})
+	if err := services.SetDefaultVehicle(models.DB, userID.(uint), uint(id)); err != nil {
+		respondVehicleError(c, err, "设置默认车辆失败")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "默认车辆设置成功"})
 }
 
-// DeleteVehicle 删除车辆
+// DeleteVehicle 删除车辆，只有车主可以删除，共享成员随之移除
 func DeleteVehicle(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -187,21 +181,13 @@ func DeleteVehicle(c *gin.Context) {
 		return
 	}
 
-	// 验证车辆是否属于当前用户
-	var vehicle models.Vehicle
-	if err := models.DB.Where("id = ? AND user_id = ?", id, userID).First(&vehicle).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "车辆不存在"})
-		return
-	}
-
-	// 删除相关的停车记录
-	models.DB.Where("vehicle_id = ?", id).Delete(&models.ParkingRecord{})
-
-	// 删除车辆
-	if err := models.DB.Delete(&vehicle).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除车辆失败"})
+	auditTarget(c, "vehicle", id)
+	vehicle, err := services.DeleteVehicle(models.DB, userID.(uint), uint(id))
+	if err != nil {
+		respondVehicleError(c, err, "删除车辆失败")
 		return
 	}
+	auditBefore(c, vehicle)
 
 	c.JSON(http.StatusOK, gin.H{"message": "车辆删除成功"})
 }
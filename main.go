@@ -9,13 +9,19 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"urban_traffic_backend/handlers"
 	"urban_traffic_backend/middleware"
 	"urban_traffic_backend/models"
+	"urban_traffic_backend/services"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -31,63 +37,281 @@ func main() {
 	// 初始化数据库
 	models.InitDB()
 
+	// 注册支付渠道
+	services.InitPaymentProviders()
+
 	// 创建Gin路由器
 	r := gin.Default()
 
+	// 只信任 TRUSTED_PROXIES 中配置的反向代理（逗号分隔的IP或CIDR）转发的 X-Forwarded-For，
+	// 未配置时直接使用连接的来源IP，避免客户端伪造IP绕过限流或写入审计日志
+	if err := r.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES: ", err)
+	}
+
 	// CORS配置 - 允许所有源
 	config := cors.DefaultConfig()
 	config.AllowAllOrigins = true
 	config.AllowCredentials = true
-	config.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization"}
+	config.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization", "Idempotency-Key", "X-Device-Key"}
 	r.Use(cors.New(config))
 
-	// API路由组
+	registerRoutes(r)
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+
+	// 收到退出信号时停止后台任务并优雅关闭HTTP服务
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// 启动后台任务
+	scheduler := services.NewScheduler()
+	scheduler.Register(services.BillingJob())
+	scheduler.Register(services.ReservationJob())
+	scheduler.Register(services.PassJob())
+	scheduler.Register(services.TokenCleanupJob())
+	scheduler.Register(services.AvailabilityRollupJob())
+	scheduler.Register(services.InvoiceBackfillJob())
+	scheduler.Start(ctx)
+
+	srv := &http.Server{
+		Addr:    ":" + port,
+		Handler: r,
+	}
+
+	go func() {
+		log.Printf("Server starting on port %s", port)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down server...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server forced to shutdown: %v", err)
+	}
+
+	scheduler.Wait()
+	log.Println("Server exited")
+}
+
+// trustedProxies 读取 TRUSTED_PROXIES 配置的反向代理地址，未配置时返回 nil
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+// registerRoutes 注册全部 API 路由及其认证、权限和限流中间件
+func registerRoutes(r *gin.Engine) {
+	// API路由组，按来源IP整体限流，所有写请求记录审计日志
 	api := r.Group("/api")
+	api.Use(middleware.RateLimit("api", 20, 40), middleware.AuditMiddleware())
 	{
+		// 登录、注册、找回密码等凭证接口单独按IP严格限流
+		credentialLimit := middleware.RateLimit("auth", 0.2, 5)
+		// 匿名可访问的查询接口按IP限流
+		publicLimit := middleware.RateLimit("public", 5, 20)
+
 		// 用户认证路由
 		auth := api.Group("/auth")
 		{
-			auth.POST("/login", handlers.Login)
+			auth.POST("/login", credentialLimit, handlers.Login)
+			auth.POST("/register", credentialLimit, handlers.Register)
+			auth.POST("/password/forgot", credentialLimit, handlers.ForgotPassword)
+			auth.POST("/password/reset", credentialLimit, handlers.ResetPassword)
+			auth.POST("/refresh", handlers.RefreshToken)
 			auth.POST("/logout", middleware.AuthMiddleware(), handlers.Logout)
+			auth.POST("/logout-all", middleware.AuthMiddleware(), handlers.LogoutAll)
+			auth.GET("/sessions", middleware.AuthMiddleware(), handlers.GetAuthSessions)
+			auth.DELETE("/sessions/:id", middleware.AuthMiddleware(), handlers.RevokeAuthSession)
 			auth.GET("/me", middleware.AuthMiddleware(), handlers.GetCurrentUser)
+			auth.PUT("/me", middleware.AuthMiddleware(), handlers.UpdateProfile)
+			auth.PUT("/password", middleware.AuthMiddleware(), handlers.ChangePassword)
 		}
 
 		// 车辆管理路由
 		vehicles := api.Group("/vehicles")
-		vehicles.Use(middleware.AuthMiddleware())
+		vehicles.Use(middleware.AuthMiddleware(), middleware.RateLimit("user", 5, 20))
 		{
 			vehicles.GET("", handlers.GetVehicles)
 			vehicles.POST("", handlers.CreateVehicle)
 			vehicles.PUT("/:id/default", handlers.SetDefaultVehicle)
 			vehicles.DELETE("/:id", handlers.DeleteVehicle)
+			vehicles.GET("/:id/members", handlers.GetVehicleMembers)
+			vehicles.POST("/:id/invitations", handlers.InviteVehicleDriver)
+			vehicles.DELETE("/:id/members/:userId", handlers.RemoveVehicleMember)
+			vehicles.GET("/invitations", handlers.GetVehicleInvitations)
+			vehicles.POST("/invitations/:id/accept", handlers.AcceptVehicleInvitation)
+			vehicles.POST("/invitations/:id/decline", handlers.DeclineVehicleInvitation)
 		}
 
 		// 停车场路由
 		parking := api.Group("/parking")
+		parking.Use(publicLimit)
 		{
 			parking.GET("/lots/nearby", handlers.GetNearbyParkingLots)
 			parking.GET("/lots/:id", handlers.GetParkingLotDetails)
-			parking.PUT("/lots/:id/availability", handlers.UpdateParkingLotAvailability)
+			parking.GET("/lots/:id/tariffs", handlers.GetParkingLotTariffs)
+			parking.GET("/lots/:id/tariffs/quote", handlers.QuoteParkingFee)
+			parking.GET("/lots/:id/pass-plans", handlers.GetParkingLotPassPlans)
+			parking.GET("/lots/:id/spots", handlers.GetParkingLotSpots)
 			parking.GET("/stats", handlers.GetParkingStats)
 			parking.GET("/current", middleware.AuthMiddleware(), handlers.GetCurrentParkingStatus)
 		}
 
+		// 设备数据上报路由，使用设备密钥认证并按设备限流
+		ingest := api.Group("")
+		ingest.Use(middleware.DeviceAuthMiddleware(), middleware.RateLimit("device", 10, 50))
+		{
+			ingest.POST("/parking/events/plate", handlers.IngestPlateEvent)
+			ingest.POST("/air-quality/update", handlers.UpdateAirQuality)
+		}
+
+		// 停车场管理路由，需要车场管理权限
+		parkingManage := api.Group("/parking")
+		parkingManage.Use(middleware.AuthMiddleware(), middleware.RequirePermission(models.PermParkingManage))
+		{
+			parkingManage.PUT("/lots/:id/availability", handlers.UpdateParkingLotAvailability)
+			parkingManage.POST("/lots/:id/tariffs", handlers.CreateParkingLotTariff)
+			parkingManage.POST("/lots/:id/pass-plans", handlers.CreateParkingLotPassPlan)
+			parkingManage.POST("/lots/:id/spots", handlers.CreateParkingLotSpots)
+			parkingManage.PUT("/spots/:id/status", handlers.UpdateParkingSpotStatus)
+		}
+
 		// 用户停车会话路由
 		user := api.Group("/user")
-		user.Use(middleware.AuthMiddleware())
+		user.Use(middleware.AuthMiddleware(), middleware.RateLimit("user", 5, 20))
 		{
 			userParking := user.Group("/parking")
 			{
 				userParking.GET("/session/current", handlers.GetCurrentParkingSession)
+				userParking.POST("/session/start", handlers.StartParkingSession)
 				userParking.GET("/session/history", handlers.GetParkingSessionHistory)
 				userParking.GET("/session/:sessionId/navigation", handlers.RefreshParkingNavigation)
 				userParking.POST("/session/:sessionId/pay", handlers.PayCurrentParkingFee)
 				userParking.POST("/session/:sessionId/extend", handlers.ExtendParkingSession)
 			}
+
+			reservations := user.Group("/reservations")
+			{
+				reservations.GET("", handlers.GetReservations)
+				reservations.POST("", handlers.CreateReservation)
+				reservations.POST("/:id/cancel", handlers.CancelReservation)
+				reservations.POST("/:id/pay", handlers.PayReservationNoShowFee)
+			}
+
+			passes := user.Group("/passes")
+			{
+				passes.GET("", handlers.GetParkingPasses)
+				passes.POST("", handlers.PurchaseParkingPass)
+				passes.POST("/:id/renew", handlers.RenewParkingPass)
+				passes.POST("/:id/cancel", handlers.CancelParkingPass)
+			}
+
+			invoices := user.Group("/invoices")
+			{
+				invoices.GET("", handlers.GetInvoices)
+				invoices.POST("", handlers.IssueInvoice)
+				invoices.GET("/:id/download", handlers.DownloadInvoice)
+			}
+		}
+
+		// 管理员路由，按权限分组，数据按调用者所属组织隔离
+		admin := api.Group("/admin")
+		admin.Use(middleware.AuthMiddleware())
+		{
+			finance := admin.Group("", middleware.RequirePermission(models.PermFinanceRead))
+			{
+				finance.GET("/invoices/export", handlers.ExportInvoices)
+			}
+
+			accessList := admin.Group("", middleware.RequirePermission(models.PermParkingManage))
+			{
+				accessList.GET("/parking-lots/:id/access-list", handlers.GetParkingLotAccessList)
+				accessList.POST("/parking-lots/:id/access-list", handlers.CreateAccessListEntry)
+				accessList.PUT("/access-list/:id", handlers.UpdateAccessListEntry)
+				accessList.DELETE("/access-list/:id", handlers.DeleteAccessListEntry)
+				accessList.GET("/plate-alarms", handlers.GetPlateAlarms)
+				accessList.PUT("/plate-alarms/:id/status", handlers.UpdatePlateAlarmStatus)
+			}
+
+			parkingLots := admin.Group("/parking-lots", middleware.RequirePermission(models.PermParkingManage))
+			{
+				parkingLots.GET("", handlers.GetManagedParkingLots)
+				parkingLots.POST("", handlers.CreateParkingLot)
+				parkingLots.PUT("/:id", handlers.UpdateParkingLot)
+				parkingLots.PUT("/:id/status", handlers.UpdateParkingLotStatus)
+				parkingLots.DELETE("/:id", handlers.DeleteParkingLot)
+				parkingLots.GET("/:id/special-spots", handlers.GetManagedSpecialSpots)
+				parkingLots.PUT("/:id/special-spots/:type", handlers.SaveSpecialSpot)
+				parkingLots.DELETE("/:id/special-spots/:type", handlers.DeleteSpecialSpot)
+				parkingLots.GET("/:id/hours", handlers.GetParkingLotHours)
+				parkingLots.PUT("/:id/hours/weekly", handlers.SetParkingLotWeeklyHours)
+				parkingLots.POST("/:id/hours/holidays", handlers.SaveParkingLotHoliday)
+				parkingLots.DELETE("/:id/hours/holidays/:holidayId", handlers.DeleteParkingLotHoliday)
+				parkingLots.POST("/:id/hours/closures", handlers.CreateParkingLotClosure)
+				parkingLots.DELETE("/:id/hours/closures/:closureId", handlers.DeleteParkingLotClosure)
+			}
+
+			organizations := admin.Group("/organizations", middleware.RequirePermission(models.PermOrgManage))
+			{
+				organizations.GET("", handlers.GetOrganizations)
+				organizations.POST("", handlers.CreateOrganization)
+				organizations.PUT("/:id", handlers.UpdateOrganization)
+				organizations.POST("/:id/assign", handlers.AssignOrganization)
+			}
+
+			audit := admin.Group("", middleware.RequirePermission(models.PermAuditRead))
+			{
+				audit.GET("/audit-logs", handlers.GetAuditLogs)
+			}
+
+			deviceCredentials := admin.Group("/device-credentials", middleware.RequirePermission(models.PermDeviceManage))
+			{
+				deviceCredentials.GET("", handlers.GetDeviceCredentials)
+				deviceCredentials.POST("", handlers.CreateDeviceCredential)
+				deviceCredentials.POST("/:id/rotate", handlers.RotateDeviceCredential)
+				deviceCredentials.POST("/:id/revoke", handlers.RevokeDeviceCredential)
+			}
+
+			users := admin.Group("/users", middleware.RequirePermission(models.PermUserManage))
+			{
+				users.GET("", handlers.GetUsers)
+				users.GET("/:id", handlers.GetUserDetail)
+				users.GET("/:id/sessions", handlers.GetUserAuthSessions)
+				users.GET("/:id/parking-sessions", handlers.GetUserParkingSessions)
+				users.PUT("/:id/status", handlers.UpdateUserStatus)
+				users.PUT("/:id/role", handlers.UpdateUserRole)
+				users.POST("/:id/password-reset", handlers.ForceUserPasswordReset)
+			}
+		}
+
+		// 支付路由，渠道回调通过签名校验，不需要登录
+		payments := api.Group("/payments")
+		{
+			payments.POST("/callback/:provider", handlers.PaymentCallback)
+			payments.GET("/orders/:orderNo", middleware.AuthMiddleware(), handlers.GetPaymentOrder)
+			payments.POST("/orders/:orderNo/refunds", middleware.AuthMiddleware(),
+				middleware.RequirePermission(models.PermPaymentRefund), handlers.RefundPaymentOrder)
+			payments.GET("/reconciliation", middleware.AuthMiddleware(),
+				middleware.RequirePermission(models.PermFinanceRead), handlers.GetPaymentReconciliation)
 		}
 
 		// 交通流量路由
 		traffic := api.Group("/traffic")
+		traffic.Use(publicLimit)
 		{
 			traffic.GET("/flow", handlers.GetTrafficFlow)
 			traffic.GET("/realtime", handlers.GetRealTimeTraffic)
@@ -101,24 +325,29 @@ func main() {
 
 		// 空气质量路由
 		airQuality := api.Group("/air-quality")
+		airQuality.Use(publicLimit)
 		{
 			airQuality.GET("/current", handlers.GetCurrentAirQuality)
 			airQuality.GET("/history", handlers.GetAirQualityHistory)
 			airQuality.GET("/stats", handlers.GetAirQualityStats)
-			airQuality.POST("/update", handlers.UpdateAirQuality)
 		}
 
 		// 停车统计路由
-		parking.GET("/saturation", handlers.GetParkingSaturation)
-		parking.GET("/occupancy-rate", handlers.GetParkingOccupancyRate)
-		parking.GET("/total-occupancy", handlers.GetTotalOccupancyRate)
-		parking.GET("/motor-congestion", handlers.GetMotorParkingCongestion)
-		parking.GET("/congestion-chart", handlers.GetParkingCongestionChart)
-		parking.GET("/activity-analysis", handlers.GetParkingActivityAnalysis)
-		parking.GET("/activity-realtime", handlers.GetParkingActivityRealtime)
+		parkingStats := api.Group("/parking")
+		parkingStats.Use(middleware.AuthMiddleware(), middleware.RequirePermission(models.PermStatsRead))
+		{
+			parkingStats.GET("/saturation", handlers.GetParkingSaturation)
+			parkingStats.GET("/occupancy-rate", handlers.GetParkingOccupancyRate)
+			parkingStats.GET("/total-occupancy", handlers.GetTotalOccupancyRate)
+			parkingStats.GET("/motor-congestion", handlers.GetMotorParkingCongestion)
+			parkingStats.GET("/congestion-chart", handlers.GetParkingCongestionChart)
+			parkingStats.GET("/activity-analysis", handlers.GetParkingActivityAnalysis)
+			parkingStats.GET("/activity-realtime", handlers.GetParkingActivityRealtime)
+		}
 
 		// 设备管理路由
 		devices := api.Group("/devices")
+		devices.Use(middleware.AuthMiddleware(), middleware.RequirePermission(models.PermDeviceRead))
 		{
 			devices.GET("/expenses", handlers.GetDeviceExpenses)
 			devices.GET("/maintenance", handlers.GetDeviceMaintenanceRecords)
@@ -130,28 +359,23 @@ func main() {
 
 		// 收费系统路由
 		toll := api.Group("/toll")
+		toll.Use(middleware.AuthMiddleware(), middleware.RequirePermission(models.PermTollRead))
 		{
 			toll.GET("/records", handlers.GetTollSystemData)
 		}
 
 		// 施工统计路由
 		construction := api.Group("/construction")
+		construction.Use(middleware.AuthMiddleware(), middleware.RequirePermission(models.PermStatsRead))
 		{
 			construction.GET("/stats", handlers.GetConstructionStats)
 		}
 
 		// 监控系统路由
 		monitoring := api.Group("/monitoring")
+		monitoring.Use(middleware.AuthMiddleware(), middleware.RequirePermission(models.PermDeviceRead))
 		{
 			monitoring.GET("/cameras", handlers.GetMonitoringCameras)
 		}
 	}
-
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
-
-	log.Printf("Server starting on port %s", port)
-	log.Fatal(http.ListenAndServe(":"+port, r))
 }
@@ -0,0 +1,323 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"urban_traffic_backend/models"
+	"urban_traffic_backend/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// 路由的访问方式：匿名、设备密钥、登录即可，其余为所需权限
+const (
+	accessPublic = "public"
+	accessDevice = "device"
+	accessAuth   = "auth"
+)
+
+// accessRules 路由前缀对应的访问方式，按顺序匹配第一条，method 为空表示任意方法
+var accessRules = []struct {
+	method, prefix, access string
+}{
+	{"POST", "/api/parking/events/plate", accessDevice},
+	{"POST", "/api/air-quality/update", accessDevice},
+
+	{"POST", "/api/auth/login", accessPublic},
+	{"POST", "/api/auth/register", accessPublic},
+	{"POST", "/api/auth/password/forgot", accessPublic},
+	{"POST", "/api/auth/password/reset", accessPublic},
+	{"POST", "/api/auth/refresh", accessPublic},
+	{"", "/api/auth/", accessAuth},
+	{"", "/api/vehicles", accessAuth},
+	{"", "/api/user/", accessAuth},
+
+	{"POST", "/api/payments/callback/", accessPublic},
+	{"POST", "/api/payments/orders/:orderNo/refunds", models.PermPaymentRefund},
+	{"GET", "/api/payments/reconciliation", models.PermFinanceRead},
+	{"GET", "/api/payments/orders/", accessAuth},
+
+	{"GET", "/api/parking/current", accessAuth},
+	{"GET", "/api/parking/saturation", models.PermStatsRead},
+	{"GET", "/api/parking/occupancy-rate", models.PermStatsRead},
+	{"GET", "/api/parking/total-occupancy", models.PermStatsRead},
+	{"GET", "/api/parking/motor-congestion", models.PermStatsRead},
+	{"GET", "/api/parking/congestion-chart", models.PermStatsRead},
+	{"GET", "/api/parking/activity-", models.PermStatsRead},
+	{"GET", "/api/parking/", accessPublic},
+	{"", "/api/parking/", models.PermParkingManage},
+
+	{"", "/api/admin/invoices/", models.PermFinanceRead},
+	{"", "/api/admin/organizations", models.PermOrgManage},
+	{"", "/api/admin/audit-logs", models.PermAuditRead},
+	{"", "/api/admin/device-credentials", models.PermDeviceManage},
+	{"", "/api/admin/users", models.PermUserManage},
+	{"", "/api/admin/", models.PermParkingManage},
+
+	{"GET", "/api/traffic/", accessPublic},
+	{"GET", "/api/air-quality/", accessPublic},
+	{"", "/api/devices/", models.PermDeviceRead},
+	{"", "/api/monitoring/", models.PermDeviceRead},
+	{"", "/api/toll/", models.PermTollRead},
+	{"", "/api/construction/", models.PermStatsRead},
+}
+
+func routeAccess(method, path string) (string, bool) {
+	for _, rule := range accessRules {
+		if (rule.method == "" || rule.method == method) && strings.HasPrefix(path, rule.prefix) {
+			return rule.access, true
+		}
+	}
+	return "", false
+}
+
+var allRoles = []string{
+	models.RoleSuperAdmin, models.RoleAdmin, models.RoleOperator,
+	models.RoleTechnician, models.RoleAnalyst, models.RoleUser,
+}
+
+// stubDriver 测试用的数据库驱动：登录会话和用户计数返回 1 使访问令牌校验通过，
+// 停车场和用户查询返回一条 id=1 的空白记录，其余查询没有数据，写入总是成功
+type stubDriver struct{}
+
+func (stubDriver) Open(string) (driver.Conn, error) { return stubConn{}, nil }
+
+type stubConn struct{}
+
+func (stubConn) Prepare(query string) (driver.Stmt, error) { return stubStmt{query: query}, nil }
+func (stubConn) Close() error                              { return nil }
+func (stubConn) Begin() (driver.Tx, error)                 { return stubTx{}, nil }
+
+func (stubConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	return stubQuery(query), nil
+}
+
+func (stubConn) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error) {
+	return stubResult{}, nil
+}
+
+type stubTx struct{}
+
+func (stubTx) Commit() error   { return nil }
+func (stubTx) Rollback() error { return nil }
+
+type stubStmt struct{ query string }
+
+func (stubStmt) Close() error                               { return nil }
+func (stubStmt) NumInput() int                              { return -1 }
+func (stubStmt) Exec([]driver.Value) (driver.Result, error) { return stubResult{}, nil }
+func (s stubStmt) Query([]driver.Value) (driver.Rows, error) {
+	return stubQuery(s.query), nil
+}
+
+type stubResult struct{}
+
+func (stubResult) LastInsertId() (int64, error) { return 1, nil }
+func (stubResult) RowsAffected() (int64, error) { return 1, nil }
+
+// stubTables 查询时返回一条记录的表
+var stubTables = map[string]bool{"`parking_lots`": true, "`users`": true}
+
+func stubQuery(query string) driver.Rows {
+	query = strings.ToLower(query)
+	if strings.Contains(query, "count(") {
+		if strings.Contains(query, "`auth_sessions`") || strings.Contains(query, "`users`") {
+			return &stubRows{columns: []string{"count(*)"}, values: [][]driver.Value{{int64(1)}}}
+		}
+		return &stubRows{columns: []string{"count(*)"}, values: [][]driver.Value{{int64(0)}}}
+	}
+	if i := strings.Index(query, " from "); i >= 0 && stubTables[strings.Fields(query[i:])[1]] {
+		return &stubRows{columns: []string{"id"}, values: [][]driver.Value{{int64(1)}}}
+	}
+	return &stubRows{columns: []string{"id"}}
+}
+
+type stubRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *stubRows) Columns() []string { return r.columns }
+func (r *stubRows) Close() error      { return nil }
+
+func (r *stubRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func init() {
+	sql.Register("routes_stub", stubDriver{})
+}
+
+// newTestRouter 使用测试数据库构建与 main 相同的路由，并关闭限流
+func newTestRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	for _, name := range []string{"API", "AUTH", "PUBLIC", "USER", "DEVICE"} {
+		t.Setenv("RATE_LIMIT_"+name+"_RPS", "0")
+	}
+
+	sqlDB, err := sql.Open("routes_stub", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	models.DB, err = gorm.Open(mysql.New(mysql.Config{Conn: sqlDB, SkipInitializeWithVersion: true}), &gorm.Config{
+		DisableAutomaticPing: true,
+		Logger:               logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(gin.Recovery())
+	registerRoutes(r)
+	return r
+}
+
+// testToken 为指定角色签发访问令牌，后台角色归属组织 1
+func testToken(t *testing.T, role string) string {
+	t.Helper()
+	user := models.User{ID: 1, Username: "route-test", UserType: role}
+	if role != models.RoleUser && role != models.RoleSuperAdmin {
+		orgID := uint(1)
+		user.OrganizationID = &orgID
+	}
+	pair, err := services.IssueTokens(&user, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pair.AccessToken
+}
+
+func serve(r *gin.Engine, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// concretePath 把路由参数替换为实际值
+func concretePath(path string) string {
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, ":") {
+			parts[i] = "1"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// TestRouteAuthorization 每条路由：未登录返回 401，缺少权限的角色返回 403 并说明所需权限
+func TestRouteAuthorization(t *testing.T) {
+	r := newTestRouter(t)
+	tokens := make(map[string]string)
+	for _, role := range allRoles {
+		tokens[role] = testToken(t, role)
+	}
+
+	for _, route := range r.Routes() {
+		access, ok := routeAccess(route.Method, route.Path)
+		if !ok {
+			t.Errorf("%s %s: 路由未在 accessRules 中登记访问方式", route.Method, route.Path)
+			continue
+		}
+		if access == accessPublic {
+			continue
+		}
+		path := concretePath(route.Path)
+
+		if w := serve(r, route.Method, path, "", ""); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s 未登录: status = %d, want 401", route.Method, path, w.Code)
+		}
+		if access == accessDevice || access == accessAuth {
+			if w := serve(r, route.Method, path, "invalid", ""); w.Code != http.StatusUnauthorized {
+				t.Errorf("%s %s 无效凭证: status = %d, want 401", route.Method, path, w.Code)
+			}
+			continue
+		}
+
+		for _, role := range allRoles {
+			if models.RoleHasPermission(role, access) {
+				continue
+			}
+			w := serve(r, route.Method, path, tokens[role], "")
+			if w.Code != http.StatusForbidden {
+				t.Errorf("%s %s 角色 %s: status = %d, want 403", route.Method, path, role, w.Code)
+				continue
+			}
+			var body map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body["required_permission"] != access {
+				t.Errorf("%s %s 角色 %s: body = %s, want required_permission %q", route.Method, path, role, w.Body, access)
+			}
+		}
+	}
+}
+
+// TestRouteGroupsAllowRole 每个路由分组：拥有权限的角色可以正常访问
+func TestRouteGroupsAllowRole(t *testing.T) {
+	r := newTestRouter(t)
+
+	tests := []struct {
+		group        string
+		role         string
+		method, path string
+		body         string
+	}{
+		{"auth", models.RoleUser, "GET", "/api/auth/me", ""},
+		{"vehicles", models.RoleUser, "GET", "/api/vehicles", ""},
+		{"parking", models.RoleUser, "GET", "/api/parking/current", ""},
+		{"user", models.RoleUser, "GET", "/api/user/reservations", ""},
+		{"parkingManage", models.RoleOperator, "PUT", "/api/parking/lots/1/availability", `{"available_spots":0}`},
+		{"finance", models.RoleAnalyst, "GET", "/api/admin/invoices/export?from=2025-01-01&to=2025-01-31", ""},
+		{"accessList", models.RoleOperator, "GET", "/api/admin/plate-alarms", ""},
+		{"parkingLots", models.RoleOperator, "GET", "/api/admin/parking-lots", ""},
+		{"organizations", models.RoleSuperAdmin, "GET", "/api/admin/organizations", ""},
+		{"audit", models.RoleAdmin, "GET", "/api/admin/audit-logs", ""},
+		{"deviceCredentials", models.RoleTechnician, "GET", "/api/admin/device-credentials", ""},
+		{"users", models.RoleAdmin, "GET", "/api/admin/users", ""},
+		{"payments", models.RoleAnalyst, "GET", "/api/payments/reconciliation", ""},
+		{"parkingStats", models.RoleAnalyst, "GET", "/api/parking/saturation", ""},
+		{"devices", models.RoleTechnician, "GET", "/api/devices/alarms", ""},
+		{"toll", models.RoleAnalyst, "GET", "/api/toll/records", ""},
+		{"construction", models.RoleOperator, "GET", "/api/construction/stats", ""},
+		{"monitoring", models.RoleAnalyst, "GET", "/api/monitoring/cameras", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.group, func(t *testing.T) {
+			w := serve(r, tt.method, tt.path, testToken(t, tt.role), tt.body)
+			if w.Code < 200 || w.Code >= 300 {
+				t.Errorf("%s %s 角色 %s: status = %d, body = %s", tt.method, tt.path, tt.role, w.Code, w.Body)
+			}
+		})
+	}
+}
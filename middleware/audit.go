@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"urban_traffic_backend/models"
+	"urban_traffic_backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 作为默认操作对象ID的路由参数，按顺序取第一个
+var auditTargetParams = []string{"id", "sessionId", "orderNo", "provider"}
+
+// AuditMiddleware 为所有写请求（非 GET/HEAD/OPTIONS）追加审计日志。
+// 操作者取自认证中间件写入的上下文；处理函数可通过 audit_target_type、audit_target_id、
+// audit_before、audit_after 指定操作对象和修改前后快照，未指定时按路由参数推断操作对象
+func AuditMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return
+		}
+		route := c.FullPath()
+		if route == "" {
+			return
+		}
+
+		entry := models.AuditLog{
+			ActorType:  models.AuditActorAnonymous,
+			Method:     c.Request.Method,
+			Route:      route,
+			Path:       c.Request.URL.Path,
+			TargetType: c.GetString("audit_target_type"),
+			TargetID:   c.GetString("audit_target_id"),
+			Before:     c.GetString("audit_before"),
+			After:      c.GetString("audit_after"),
+			StatusCode: c.Writer.Status(),
+			IP:         c.ClientIP(),
+			UserAgent:  c.Request.UserAgent(),
+		}
+		if userID, ok := c.Get("user_id"); ok {
+			uid := userID.(uint)
+			entry.ActorType = models.AuditActorUser
+			entry.ActorID = &uid
+			entry.ActorName = c.GetString("username")
+			entry.Role = c.GetString("user_type")
+			if orgID, ok := c.Get("organization_id"); ok {
+				oid := orgID.(uint)
+				entry.OrganizationID = &oid
+			}
+		} else if value, ok := c.Get("device_credential"); ok {
+			credential := value.(*models.DeviceCredential)
+			entry.ActorType = models.AuditActorDevice
+			entry.ActorID = &credential.ID
+			entry.ActorName = credential.Name
+			entry.Role = models.AuditActorDevice
+		}
+		if entry.TargetID == "" {
+			for _, name := range auditTargetParams {
+				if value := c.Param(name); value != "" {
+					entry.TargetID = value
+					if entry.TargetType == "" {
+						entry.TargetType = auditRouteResource(route, ":"+name)
+					}
+					break
+				}
+			}
+		}
+		if entry.TargetType == "" {
+			entry.TargetType = auditRouteResource(route, "")
+		}
+
+		if err := services.RecordAudit(models.DB, &entry); err != nil {
+			log.Printf("audit: failed to record %s %s: %v", entry.Method, entry.Path, err)
+		}
+	}
+}
+
+// auditRouteResource 从路由模板推断资源名：参数前一段，无参数时取最后一段
+func auditRouteResource(route, param string) string {
+	segments := strings.Split(strings.Trim(route, "/"), "/")
+	for i, segment := range segments {
+		if param != "" && segment == param && i > 0 {
+			return segments[i-1]
+		}
+	}
+	for i := len(segments) - 1; i >= 0; i-- {
+		if !strings.HasPrefix(segments[i], ":") {
+			return segments[i]
+		}
+	}
+	return ""
+}
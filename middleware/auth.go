@@ -9,12 +9,13 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
-	"os"
 	"strings"
 
+	"urban_traffic_backend/services"
+
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
 )
 
 func AuthMiddleware() gin.HandlerFunc {
@@ -28,31 +29,27 @@ func AuthMiddleware() gin.HandlerFunc {
 
 		tokenString := strings.Replace(authHeader, "Bearer ", "", 1)
 
-		jwtSecret := os.Getenv("JWT_SECRET")
-		if jwtSecret == "" {
-			jwtSecret = "urban-traffic-secret-key-2024"
-		}
-
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return []byte(jwtSecret), nil
-		})
-
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的token"})
+		// 校验签名和有效期，并检查令牌及其登录会话是否已被撤销
+		claims, err := services.ParseAccessToken(tokenString)
+		if errors.Is(err, services.ErrAccountDisabled) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "账号已停用"})
 			c.Abort()
 			return
 		}
-
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的token格式"})
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的token"})
 			c.Abort()
 			return
 		}
 
-		c.Set("user_id", uint(claims["user_id"].(float64)))
-		c.Set("username", claims["username"].(string))
-		c.Set("user_type", claims["user_type"].(string))
+		c.Set("user_id", claims.UserID)
+		c.Set("username", claims.Username)
+		c.Set("user_type", claims.UserType)
+		c.Set("session_id", claims.SessionID)
+		if claims.OrganizationID != nil {
+			c.Set("organization_id", *claims.OrganizationID)
+		}
+		c.Set("token_claims", claims)
 
 		c.Next()
 	}
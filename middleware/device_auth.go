@@ -0,0 +1,43 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"urban_traffic_backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DeviceAuthMiddleware 设备数据上报接口的认证，只接受 X-Device-Key 请求头中的设备密钥，
+// 不接受用户登录令牌。认证通过后在上下文中写入凭证信息，供写入记录归属到设备
+func DeviceAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("X-Device-Key")
+		if key == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "缺少设备密钥"})
+			c.Abort()
+			return
+		}
+
+		credential, err := services.AuthenticateDevice(key, c.ClientIP(), time.Now())
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的设备密钥"})
+			c.Abort()
+			return
+		}
+
+		c.Set("device_credential_id", credential.ID)
+		c.Set("device_credential", credential)
+
+		c.Next()
+	}
+}
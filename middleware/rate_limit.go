@@ -0,0 +1,64 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"urban_traffic_backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimit 按路由分组的令牌桶限流。已登录请求按用户计数，设备上报按凭证计数，其余按来源IP计数，
+// 因此放在 AuthMiddleware 或 DeviceAuthMiddleware 之后时按身份限流，之前时按IP限流。
+// 同名分组共用令牌桶，超出限制返回 429 并带 Retry-After
+func RateLimit(name string, rate float64, burst int) gin.HandlerFunc {
+	policy := services.NewRateLimitPolicy(name, rate, burst)
+	store, err := services.ActiveRateLimitStore()
+	if err != nil {
+		log.Fatal("rate limit: ", err)
+	}
+
+	return func(c *gin.Context) {
+		if !policy.Enabled() {
+			c.Next()
+			return
+		}
+
+		key := policy.Name + ":ip:" + c.ClientIP()
+		if userID, ok := c.Get("user_id"); ok {
+			key = fmt.Sprintf("%s:user:%v", policy.Name, userID)
+		} else if credentialID, ok := c.Get("device_credential_id"); ok {
+			key = fmt.Sprintf("%s:device:%v", policy.Name, credentialID)
+		}
+
+		allowed, wait := store.Take(key, policy, time.Now())
+		if !allowed {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":       "请求过于频繁，请稍后再试",
+				"retry_after": retryAfter,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,43 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package middleware
+
+import (
+	"net/http"
+
+	"urban_traffic_backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission 要求当前用户的角色拥有指定权限，须在 AuthMiddleware 之后使用。
+// 未登录返回 401，权限不足返回 403 并说明所需权限
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, exists := c.Get("user_type")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+			c.Abort()
+			return
+		}
+
+		if !models.RoleHasPermission(role.(string), permission) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":               "权限不足",
+				"code":                "forbidden",
+				"role":                role,
+				"required_permission": permission,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"urban_traffic_backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func TestRoleHasPermission(t *testing.T) {
+	allPermissions := []string{
+		models.PermParkingManage, models.PermStatsRead, models.PermDeviceRead, models.PermDeviceManage,
+		models.PermTollRead, models.PermFinanceRead, models.PermPaymentRefund, models.PermUserManage,
+		models.PermAuditRead, models.PermOrgManage,
+	}
+	granted := map[string][]string{
+		models.RoleSuperAdmin: allPermissions,
+		models.RoleAdmin: {
+			models.PermParkingManage, models.PermStatsRead, models.PermDeviceRead, models.PermDeviceManage,
+			models.PermTollRead, models.PermFinanceRead, models.PermPaymentRefund, models.PermUserManage,
+			models.PermAuditRead,
+		},
+		models.RoleOperator: {
+			models.PermParkingManage, models.PermStatsRead, models.PermTollRead, models.PermFinanceRead,
+			models.PermPaymentRefund,
+		},
+		models.RoleTechnician: {models.PermDeviceRead, models.PermDeviceManage},
+		models.RoleAnalyst:    {models.PermStatsRead, models.PermDeviceRead, models.PermTollRead, models.PermFinanceRead},
+		models.RoleUser:       nil,
+		"unknown":             nil,
+	}
+
+	for role, permissions := range granted {
+		want := make(map[string]bool)
+		for _, p := range permissions {
+			want[p] = true
+		}
+		for _, permission := range allPermissions {
+			if got := models.RoleHasPermission(role, permission); got != want[permission] {
+				t.Errorf("RoleHasPermission(%q, %q) = %v, want %v", role, permission, got, want[permission])
+			}
+		}
+		if role != "unknown" && len(models.RolePermissions(role)) != len(permissions) {
+			t.Errorf("RolePermissions(%q) = %v, want %v", role, models.RolePermissions(role), permissions)
+		}
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	tests := []struct {
+		name       string
+		role       string // 为空表示未经过 AuthMiddleware
+		permission string
+		wantStatus int
+	}{
+		{"未登录", "", models.PermParkingManage, http.StatusUnauthorized},
+		{"普通用户", models.RoleUser, models.PermParkingManage, http.StatusForbidden},
+		{"运营缺少权限", models.RoleOperator, models.PermUserManage, http.StatusForbidden},
+		{"组织管理员缺少平台权限", models.RoleAdmin, models.PermOrgManage, http.StatusForbidden},
+		{"运营拥有权限", models.RoleOperator, models.PermParkingManage, http.StatusOK},
+		{"技术员拥有权限", models.RoleTechnician, models.PermDeviceManage, http.StatusOK},
+		{"组织管理员", models.RoleAdmin, models.PermAuditRead, http.StatusOK},
+		{"超级管理员", models.RoleSuperAdmin, models.PermOrgManage, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/", func(c *gin.Context) {
+				if tt.role != "" {
+					c.Set("user_type", tt.role)
+				}
+				c.Next()
+			}, RequirePermission(tt.permission), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusForbidden {
+				return
+			}
+
+			var body map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode body: %v", err)
+			}
+			if body["required_permission"] != tt.permission || body["role"] != tt.role {
+				t.Errorf("body = %v, want required_permission %q and role %q", body, tt.permission, tt.role)
+			}
+		})
+	}
+}
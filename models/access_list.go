@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 车辆名单类型
+const (
+	AccessListWhitelist = "whitelist" // 白名单：放行并免收停车费
+	AccessListBlacklist = "blacklist" // 黑名单：禁止入场并报警
+)
+
+// AccessListEntry 停车场车辆黑白名单，按归一化车牌匹配
+type AccessListEntry struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	ParkingLotID uint       `gorm:"not null;index:idx_access_list_lot_plate" json:"parking_lot_id"`
+	PlateNumber  string     `gorm:"size:30;not null;index:idx_access_list_lot_plate" json:"plate_number"` // 车牌号（归一化后）
+	ListType     string     `gorm:"size:20;not null" json:"list_type"`                                    // whitelist, blacklist
+	Reason       string     `gorm:"size:200" json:"reason"`                                               // 加入名单的原因
+	ValidFrom    *time.Time `json:"valid_from"`                                                           // 生效时间，为空时立即生效
+	ValidUntil   *time.Time `json:"valid_until"`                                                          // 失效时间，为空时长期有效
+	CreatedBy    *uint      `json:"created_by"`                                                           // 添加人
+}
+
+// CoversAt 判断名单记录在指定时间是否有效
+func (e *AccessListEntry) CoversAt(t time.Time) bool {
+	if e.ValidFrom != nil && t.Before(*e.ValidFrom) {
+		return false
+	}
+	return e.ValidUntil == nil || t.Before(*e.ValidUntil)
+}
+
+// PlateAlarm 车牌报警（黑名单车辆出现等），字段与设备报警一致
+type PlateAlarm struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	ParkingLotID uint       `gorm:"not null;index" json:"parking_lot_id"`       // 停车场ID
+	PlateNumber  string     `gorm:"size:30;not null;index" json:"plate_number"` // 车牌号（归一化后）
+	EntryID      *uint      `json:"entry_id"`                                   // 命中的名单记录
+	AlarmType    string     `gorm:"size:50;not null" json:"alarm_type"`         // 报警类型
+	Severity     string     `gorm:"size:20;not null" json:"severity"`           // 严重程度
+	Message      string     `gorm:"size:500" json:"message"`                    // 报警消息
+	Status       string     `gorm:"size:20;default:'active'" json:"status"`     // 状态：active, acknowledged, resolved
+	AlarmTime    time.Time  `json:"alarm_time"`                                 // 报警时间
+	AckTime      *time.Time `json:"ack_time"`                                   // 确认时间
+	ResolveTime  *time.Time `json:"resolve_time"`                               // 解决时间
+	Location     string     `gorm:"size:100" json:"location"`                   // 位置
+
+	// 关联
+	ParkingLot ParkingLot `gorm:"foreignKey:ParkingLotID" json:"-"`
+}
@@ -31,6 +31,8 @@ type AirQuality struct {
 	SO2       float64   `gorm:"type:decimal(5,2);not null" json:"so2"`  // 二氧化硫浓度
 	CO        float64   `gorm:"type:decimal(5,2);not null" json:"co"`   // 一氧化碳浓度
 	Timestamp time.Time `json:"timestamp"`                              // 数据时间戳
+
+	CredentialID *uint `gorm:"index" json:"credential_id"` // 上报的设备凭证
 }
 
 // AirQualityStats 空气质量统计
@@ -0,0 +1,45 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package models
+
+// 停车场的遮蔽类型
+const (
+	LotCoverageIndoor  = "indoor"  // 室内或地下
+	LotCoverageOutdoor = "outdoor" // 露天
+	LotCoverageMixed   = "mixed"   // 室内和露天都有
+)
+
+// IsValidLotCoverage 判断遮蔽类型是否合法，空值表示未登记
+func IsValidLotCoverage(coverage string) bool {
+	switch coverage {
+	case "", LotCoverageIndoor, LotCoverageOutdoor, LotCoverageMixed:
+		return true
+	}
+	return false
+}
+
+// EVConnectorTypes 支持登记的充电接口类型
+var EVConnectorTypes = []string{
+	"gbt_ac",  // 国标交流
+	"gbt_dc",  // 国标直流
+	"ccs2",    // 欧标直流
+	"type2",   // 欧标交流
+	"chademo", // 日标直流
+	"tesla",   // 特斯拉
+}
+
+// IsValidEVConnector 判断充电接口类型是否合法
+func IsValidEVConnector(connector string) bool {
+	for _, t := range EVConnectorTypes {
+		if t == connector {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 审计日志操作者类型
+const (
+	AuditActorUser      = "user"      // 登录用户
+	AuditActorDevice    = "device"    // 设备凭证
+	AuditActorAnonymous = "anonymous" // 未认证请求（登录、支付回调等）
+)
+
+// ErrAuditLogImmutable 审计日志只允许追加，不允许修改或删除
+var ErrAuditLogImmutable = errors.New("审计日志不可修改")
+
+// AuditLog 写操作审计日志，只追加不修改
+type AuditLog struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+
+	ActorType  string `gorm:"size:20;not null;index" json:"actor_type"`          // user, device, anonymous
+	ActorID    *uint  `gorm:"index" json:"actor_id"`                             // 用户ID或设备凭证ID
+	ActorName  string `gorm:"size:100" json:"actor_name"`                        // 用户名或凭证名称
+	Role       string `gorm:"size:20" json:"role"`                               // 操作时的角色
+	Method     string `gorm:"size:10;not null" json:"method"`                    // HTTP 方法
+	Route      string `gorm:"size:200;not null;index" json:"route"`              // 路由模板，如 /api/parking/lots/:id/availability
+	Path       string `gorm:"size:255" json:"path"`                              // 实际请求路径
+	TargetType string `gorm:"size:50;index:idx_audit_target" json:"target_type"` // 操作对象类型
+	TargetID   string `gorm:"size:64;index:idx_audit_target" json:"target_id"`   // 操作对象ID
+	Before     string `gorm:"type:text" json:"before,omitempty"`                 // 修改前快照（JSON）
+	After      string `gorm:"type:text" json:"after,omitempty"`                  // 修改后快照（JSON）
+	Changes    string `gorm:"type:text" json:"changes,omitempty"`                // 字段差异（JSON）：{"字段":{"before":..,"after":..}}
+	StatusCode int    `json:"status_code"`                                       // 响应状态码
+	IP         string `gorm:"size:64" json:"ip"`                                 // 来源IP
+	UserAgent  string `gorm:"size:255" json:"user_agent"`                        // 客户端标识
+
+	OrganizationID *uint `gorm:"index" json:"organization_id"` // 操作者所属组织
+}
+
+// BeforeUpdate 禁止修改审计日志
+func (AuditLog) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditLogImmutable
+}
+
+// BeforeDelete 禁止删除审计日志
+func (AuditLog) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditLogImmutable
+}
@@ -0,0 +1,39 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package models
+
+import (
+	"time"
+)
+
+// AuthSession 登录会话（一台设备一次登录），保存当前刷新令牌的哈希，刷新时轮换
+type AuthSession struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	UserID            uint       `gorm:"not null;index" json:"user_id"`
+	RefreshTokenHash  string     `gorm:"size:64;not null;uniqueIndex" json:"-"` // 当前刷新令牌的 SHA-256 哈希
+	PreviousTokenHash string     `gorm:"size:64;index" json:"-"`                // 上一个刷新令牌的哈希，被再次使用说明令牌泄露
+	UserAgent         string     `gorm:"size:255" json:"user_agent"`            // 登录设备
+	IP                string     `gorm:"size:64" json:"ip"`                     // 最近一次使用的 IP
+	LastUsedAt        time.Time  `json:"last_used_at"`                          // 最近一次登录或刷新时间
+	ExpiresAt         time.Time  `gorm:"not null;index" json:"expires_at"`      // 刷新令牌过期时间
+	RevokedAt         *time.Time `gorm:"index" json:"revoked_at"`               // 退出登录或被撤销的时间
+}
+
+// RevokedToken 已撤销的访问令牌（按 jti），过期后可清理
+type RevokedToken struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	JTI       string    `gorm:"size:64;not null;uniqueIndex" json:"jti"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"` // 访问令牌原本的过期时间
+}
@@ -0,0 +1,25 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package models
+
+import (
+	"time"
+)
+
+// AvailabilitySample 停车场可用车位的时序采样，可用车位数或总车位数每次变化时记录一条，
+// 由汇总任务计算饱和度和占用率统计
+type AvailabilitySample struct {
+	ID uint `gorm:"primarykey" json:"id"`
+
+	ParkingLotID   uint      `gorm:"not null;index:idx_availability_lot_time" json:"parking_lot_id"`
+	OrganizationID *uint     `gorm:"index" json:"organization_id"` // 采样时停车场所属运营商
+	TotalSpots     int       `gorm:"not null" json:"total_spots"`
+	AvailableSpots int       `gorm:"not null" json:"available_spots"`
+	SampledAt      time.Time `gorm:"not null;index:idx_availability_lot_time;index" json:"sampled_at"`
+}
@@ -9,7 +9,9 @@
 package models
 
 import (
+	"fmt"
 	"log"
+	"math"
 	"os"
 	"time"
 
@@ -37,15 +39,21 @@ func InitDB() {
 
 	// 自动迁移数据库表
 	err = DB.AutoMigrate(
-		&User{}, &Vehicle{}, &ParkingRecord{}, &ParkingLot{}, &SpecialSpot{}, &ParkingSession{},
+		&Organization{}, &User{}, &Vehicle{}, &VehicleMember{}, &ParkingRecord{}, &ParkingLot{}, &SpecialSpot{}, &ParkingSession{}, &SessionFeeItem{}, &PlateEvent{},
+		&ParkingLotHours{}, &ParkingLotHoliday{}, &ParkingLotClosure{},
+		&ParkingTariff{}, &TariffBand{}, &JobLease{}, &ParkingSpot{}, &Reservation{}, &PassPlan{}, &ParkingPass{},
+		&AccessListEntry{}, &PlateAlarm{},
+		&PaymentOrder{}, &PaymentRefund{}, &LedgerEntry{}, &Invoice{}, &InvoiceItem{}, &InvoiceSequence{},
+		// 账号相关表
+		&PasswordResetToken{}, &AuthSession{}, &RevokedToken{}, &AuditLog{},
 		// 交通相关表
 		&TrafficFlow{}, &TrafficUserStats{}, &TrafficHeatmap{}, &CongestionReport{},
 		&InOutFlowData{}, &CarCrossingRate{},
 		// 设备相关表
 		&Device{}, &DeviceExpense{}, &DeviceMaintenanceRecord{}, &DeviceFaultStats{},
-		&DeviceAlarm{}, &DeviceAlarmStats{},
+		&DeviceAlarm{}, &DeviceAlarmStats{}, &DeviceCredential{},
 		// 统计相关表
-		&ParkingSaturation{}, &ParkingOccupancyRate{}, &TotalOccupancy{},
+		&ParkingSaturation{}, &ParkingOccupancyRate{}, &TotalOccupancy{}, &AvailabilitySample{},
 		&MotorParkingCongestion{}, &TollRecord{}, &ConstructionStats{}, &MonitoringCamera{},
 	)
 	if err != nil {
@@ -55,10 +63,83 @@ func InitDB() {
 	// 创建默认用户和测试数据
 	createDefaultUsers()
 	createTestVehicles()
+	ensureVehicleOwners()
+	createTestParkingTariffs()
+	createTestPassPlans()
+	createTestParkingSpots()
 	createTestParkingSessions()
 
 	// 创建模拟数据
 	CreateSimulationData()
+
+	// 未归属组织的停车场、设备、统计数据和后台账号归入默认组织
+	assignDefaultOrganization()
+
+	// 为升级前创建的停车场补充 geohash 索引
+	backfillLotGeohash()
+
+	// 为升级前登记的车辆补充归一化车牌
+	backfillVehiclePlates()
+
+	// 为升级前结算生成的停车记录关联停车会话
+	backfillRecordSessions()
+}
+
+// backfillLotGeohash 为还没有 geohash 的停车场按经纬度计算 geohash
+func backfillLotGeohash() {
+	var lots []ParkingLot
+	DB.Where("geohash = '' OR geohash IS NULL").Find(&lots)
+	for _, lot := range lots {
+		DB.Model(&lot).UpdateColumn("geohash", EncodeGeohash(lot.Latitude, lot.Longitude, GeohashPrecision))
+	}
+}
+
+// backfillVehiclePlates 为缺少归一化车牌的车辆生成 normalized_plate
+func backfillVehiclePlates() {
+	var vehicles []Vehicle
+	DB.Where("normalized_plate = '' OR normalized_plate IS NULL").Find(&vehicles)
+	for _, vehicle := range vehicles {
+		DB.Model(&vehicle).UpdateColumn("normalized_plate", NormalizePlate(vehicle.PlateNumber))
+	}
+}
+
+// backfillRecordSessions 按车辆、停车场和入场时间为结算生成的停车记录补充 session_id
+func backfillRecordSessions() {
+	var records []ParkingRecord
+	DB.Where("session_id IS NULL AND parking_lot_id IS NOT NULL").Find(&records)
+	for _, record := range records {
+		start, err := time.ParseInLocation("2006-01-02 15:04:05", record.StartTime, time.Local)
+		if err != nil {
+			continue
+		}
+		var session ParkingSession
+		err = DB.Where("vehicle_id = ? AND parking_lot_id = ? AND start_time >= ? AND start_time < ?",
+			record.VehicleID, *record.ParkingLotID, start, start.Add(time.Second)).First(&session).Error
+		if err == nil {
+			DB.Model(&record).UpdateColumn("session_id", session.ID)
+		}
+	}
+}
+
+// assignDefaultOrganization 创建默认组织，并把 organization_id 为空的数据归入该组织，
+// 保证升级前的数据在按组织隔离后仍能被原有的后台账号访问
+func assignDefaultOrganization() {
+	organization := Organization{Code: DefaultOrganizationCode, Name: "默认运营商", IsActive: true}
+	if err := DB.Where("code = ?", DefaultOrganizationCode).FirstOrCreate(&organization).Error; err != nil {
+		log.Println("Failed to create default organization:", err)
+		return
+	}
+
+	for _, model := range []interface{}{
+		&ParkingLot{}, &Device{}, &MonitoringCamera{}, &TollRecord{}, &TotalOccupancy{},
+		&MotorParkingCongestion{}, &ConstructionStats{}, &DeviceFaultStats{}, &DeviceAlarmStats{},
+	} {
+		DB.Model(model).Where("organization_id IS NULL").Update("organization_id", organization.ID)
+	}
+	// 普通用户和平台超级管理员不属于任何组织
+	DB.Model(&User{}).
+		Where("organization_id IS NULL AND user_type NOT IN ?", []string{RoleUser, RoleSuperAdmin}).
+		Update("organization_id", organization.ID)
 }
 
 func createDefaultUsers() {
@@ -67,6 +148,12 @@ func createDefaultUsers() {
 
 	if count == 0 {
 		defaultUsers := []User{
+			{
+				Username: "superadmin",
+				Password: "superadmin",
+				UserType: "super_admin",
+				Email:    "superadmin@example.com",
+			},
 			{
 				Username: "admin",
 				Password: "admin",
@@ -79,6 +166,24 @@ func createDefaultUsers() {
 				UserType: "user",
 				Email:    "user@example.com",
 			},
+			{
+				Username: "operator",
+				Password: "operator",
+				UserType: "operator",
+				Email:    "operator@example.com",
+			},
+			{
+				Username: "technician",
+				Password: "technician",
+				UserType: "technician",
+				Email:    "technician@example.com",
+			},
+			{
+				Username: "analyst",
+				Password: "analyst",
+				UserType: "analyst",
+				Email:    "analyst@example.com",
+			},
 		}
 
 		for _, user := range defaultUsers {
@@ -89,6 +194,19 @@ func createDefaultUsers() {
 	}
 }
 
+// ensureVehicleOwners 为还没有车主成员记录的车辆补充车主，默认车辆标记沿用车辆上的 is_default，
+// 保证共享车辆上线前登记的车辆仍能被车主使用
+func ensureVehicleOwners() {
+	err := DB.Exec(`INSERT INTO vehicle_members (created_at, updated_at, vehicle_id, user_id, role, status, is_default)
+		SELECT NOW(), NOW(), v.id, v.user_id, ?, ?, v.is_default FROM vehicles v
+		WHERE v.deleted_at IS NULL AND NOT EXISTS (
+			SELECT 1 FROM vehicle_members m WHERE m.vehicle_id = v.id AND m.user_id = v.user_id)`,
+		VehicleRoleOwner, VehicleMemberActive).Error
+	if err != nil {
+		log.Println("Failed to create vehicle owners:", err)
+	}
+}
+
 func createTestVehicles() {
 	var count int64
 	DB.Model(&Vehicle{}).Count(&count)
@@ -224,6 +342,8 @@ func createTestParkingLots() {
 				IsActive:       true,
 				OperatingHours: "24小时",
 				PaymentMethods: "微信,支付宝,现金",
+				Coverage:       LotCoverageOutdoor,
+				HasRestroom:    true,
 			},
 			{
 				Name:           "中央公园停车场",
@@ -236,6 +356,10 @@ func createTestParkingLots() {
 				IsActive:       true,
 				OperatingHours: "24小时",
 				PaymentMethods: "微信,支付宝,现金",
+				Coverage:       LotCoverageMixed,
+				EVConnectors:   "gbt_ac",
+				HasSecurity:    true,
+				HasRestroom:    true,
 			},
 			{
 				Name:           "东方广场停车场",
@@ -248,6 +372,10 @@ func createTestParkingLots() {
 				IsActive:       true,
 				OperatingHours: "24小时",
 				PaymentMethods: "微信,支付宝,现金",
+				HeightLimit:    2.1,
+				Coverage:       LotCoverageIndoor,
+				EVConnectors:   "gbt_ac,gbt_dc",
+				HasSecurity:    true,
 			},
 		}
 
@@ -296,6 +424,123 @@ func createTestSpecialSpots() {
 	}
 }
 
+func createTestParkingTariffs() {
+	var count int64
+	DB.Model(&ParkingTariff{}).Count(&count)
+
+	if count == 0 {
+		var parkingLots []ParkingLot
+		DB.Find(&parkingLots)
+
+		// 普通车位：15分钟内免费，首小时按小时费率，后续每小时半价，每24小时最多收取60元
+		// 特殊车位未单独配置时沿用普通车位标准并加收附加费
+		for _, lot := range parkingLots {
+			tariff := ParkingTariff{
+				ParkingLotID:       lot.ID,
+				SpotType:           "normal",
+				Version:            1,
+				RuleType:           "standard",
+				FreeMinutes:        15,
+				FirstPeriodMinutes: 60,
+				FirstPeriodPrice:   lot.HourlyRate,
+				UnitMinutes:        60,
+				UnitPrice:          lot.HourlyRate / 2,
+				DailyCap:           60,
+				EffectiveFrom:      time.Date(2023, 1, 1, 0, 0, 0, 0, time.Local),
+				IsActive:           true,
+			}
+			DB.Create(&tariff)
+		}
+		log.Println("Test parking tariffs created")
+	}
+}
+
+// createTestPassPlans 为每个停车场生成月卡套餐：普通月卡按每天8小时、30天停车费的一半定价，固定车位月卡加价50%
+func createTestPassPlans() {
+	var count int64
+	DB.Model(&PassPlan{}).Count(&count)
+
+	if count == 0 {
+		var parkingLots []ParkingLot
+		DB.Find(&parkingLots)
+
+		for _, lot := range parkingLots {
+			price := math.Round(lot.HourlyRate * 8 * 30 / 2)
+			plans := []PassPlan{
+				{ParkingLotID: lot.ID, Name: "月卡", DurationDays: 30, Price: price, SpotType: "normal", IsActive: true,
+					Description: "有效期内不限次数进出，停车免费"},
+				{ParkingLotID: lot.ID, Name: "固定车位月卡", DurationDays: 30, Price: math.Round(price * 1.5), SpotType: "normal",
+					ReservedSpot: true, IsActive: true, Description: "有效期内保留固定车位，停车免费"},
+			}
+			DB.Create(&plans)
+		}
+		log.Println("Test pass plans created")
+	}
+}
+
+// createTestParkingSpots 按停车场现有车位数生成车位清单：每层3个区域、每区40个车位，
+// 普通车位在前、特殊车位在后，占用数量与停车场和特殊车位的可用数保持一致
+func createTestParkingSpots() {
+	var count int64
+	DB.Model(&ParkingSpot{}).Count(&count)
+
+	if count == 0 {
+		const spotsPerZone, zonesPerFloor = 40, 3
+
+		var parkingLots []ParkingLot
+		DB.Preload("SpecialSpots").Find(&parkingLots)
+
+		now := time.Now()
+		for _, lot := range parkingLots {
+			type spotGroup struct {
+				spotType string
+				total    int
+				occupied int
+			}
+
+			specialTotal, specialOccupied := 0, 0
+			var specials []spotGroup
+			for _, special := range lot.SpecialSpots {
+				occupied := special.TotalCount - special.AvailableCount
+				specials = append(specials, spotGroup{special.SpotType, special.TotalCount, occupied})
+				specialTotal += special.TotalCount
+				specialOccupied += occupied
+			}
+			normalTotal := lot.TotalSpots - specialTotal
+			normalOccupied := lot.TotalSpots - lot.AvailableSpots - specialOccupied
+			if normalTotal < 0 || normalOccupied < 0 || normalOccupied > normalTotal {
+				log.Printf("Skip parking spots for lot %d: inconsistent capacity", lot.ID)
+				continue
+			}
+			groups := append([]spotGroup{{"normal", normalTotal, normalOccupied}}, specials...)
+
+			var spots []ParkingSpot
+			for _, group := range groups {
+				for i := 0; i < group.total; i++ {
+					index := len(spots)
+					floor := index/(spotsPerZone*zonesPerFloor) + 1
+					zone := 'A' + rune(index/spotsPerZone%zonesPerFloor)
+					status := SpotStatusFree
+					if i < group.occupied {
+						status = SpotStatusOccupied
+					}
+					spots = append(spots, ParkingSpot{
+						ParkingLotID:    lot.ID,
+						Floor:           fmt.Sprintf("B%d", floor),
+						Zone:            fmt.Sprintf("%c区", zone),
+						Code:            fmt.Sprintf("%c-%d%02d", zone, floor, index%spotsPerZone+1),
+						SpotType:        group.spotType,
+						Status:          status,
+						StatusUpdatedAt: now,
+					})
+				}
+			}
+			DB.CreateInBatches(&spots, 100)
+		}
+		log.Println("Test parking spots created")
+	}
+}
+
 func createTestParkingSessions() {
 	var count int64
 	DB.Model(&ParkingSession{}).Count(&count)
@@ -311,6 +556,12 @@ func createTestParkingSessions() {
 		var parkingLot ParkingLot
 		DB.Where("name = ?", "西湖停车场").First(&parkingLot)
 
+		var parkingSpot ParkingSpot
+		var parkingSpotID *uint
+		if err := DB.Where("parking_lot_id = ? AND code = ?", parkingLot.ID, "A-101").First(&parkingSpot).Error; err == nil {
+			parkingSpotID = &parkingSpot.ID
+		}
+
 		// 创建一个活跃的停车会话
 		now := time.Now()
 		startTime := now.Add(-2 * time.Hour)         // 2小时前开始停车
@@ -318,9 +569,11 @@ func createTestParkingSessions() {
 		nextFeeAmount := 5.0
 
 		activeSession := ParkingSession{
-			UserID:                user.ID,
-			VehicleID:             vehicle.ID,
+			UserID:                &user.ID,
+			VehicleID:             &vehicle.ID,
+			PlateNumber:           NormalizePlate(vehicle.PlateNumber),
 			ParkingLotID:          parkingLot.ID,
+			ParkingSpotID:         parkingSpotID,
 			SpotCode:              "A-101",
 			SpotType:              "normal",
 			StartTime:             startTime,
@@ -449,43 +702,10 @@ func createDeviceData() {
 	}
 }
 
+// createStatisticsData 创建演示统计数据。停车饱和度、占用率和总占用率由可用车位采样汇总生成，不写入演示数据
 func createStatisticsData() {
-	// 创建停车饱和度数据
-	var count int64
-	DB.Model(&ParkingSaturation{}).Count(&count)
-	if count == 0 {
-		// 获取停车场数据
-		var parkingLots []ParkingLot
-		DB.Find(&parkingLots)
-
-		for _, lot := range parkingLots {
-			saturation := ParkingSaturation{
-				ParkingLotID:   lot.ID,
-				SaturationRate: float64(lot.TotalSpots-lot.AvailableSpots) / float64(lot.TotalSpots) * 100,
-				OccupiedSpots:  lot.TotalSpots - lot.AvailableSpots,
-				TotalSpots:     lot.TotalSpots,
-				Timestamp:      time.Now().Add(-1 * time.Hour),
-				Hour:           8,
-			}
-			DB.Create(&saturation)
-		}
-	}
-
-	// 创建总占用率数据
-	DB.Model(&TotalOccupancy{}).Count(&count)
-	if count == 0 {
-		totalOccupancy := TotalOccupancy{
-			TotalSpots:     700,
-			OccupiedSpots:  548,
-			OccupancyRate:  78.29,
-			AvailableSpots: 152,
-			Timestamp:      time.Now().Add(-1 * time.Hour),
-			Period:         "hourly",
-		}
-		DB.Create(&totalOccupancy)
-	}
-
 	// 创建监控摄像头数据
+	var count int64
 	DB.Model(&MonitoringCamera{}).Count(&count)
 	if count == 0 {
 		cameras := []MonitoringCamera{
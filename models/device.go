@@ -28,6 +28,8 @@ type Device struct {
 	SerialNumber string    `gorm:"size:100;uniqueIndex" json:"serial_number"` // 序列号
 	Manufacturer string    `gorm:"size:100" json:"manufacturer"`              // 制造商
 	InstallDate  time.Time `json:"install_date"`                              // 安装日期
+
+	OrganizationID *uint `gorm:"index" json:"organization_id"` // 所属运营商
 }
 
 // DeviceExpense 设备支出
@@ -84,6 +86,8 @@ type DeviceFaultStats struct {
 	Period           string    `gorm:"size:20" json:"period"`                      // 统计周期
 	TrendDirection   string    `gorm:"size:10" json:"trend_direction"`             // 趋势方向
 	PercentageChange float64   `gorm:"type:decimal(5,2)" json:"percentage_change"` // 变化百分比
+
+	OrganizationID *uint `gorm:"index" json:"organization_id"` // 所属运营商
 }
 
 // DeviceAlarm 设备报警
@@ -119,4 +123,6 @@ type DeviceAlarmStats struct {
 	Hour      int       `gorm:"not null" json:"hour"`               // 小时(0-23)
 	StatDate  time.Time `json:"stat_date"`                          // 统计日期
 	Severity  string    `gorm:"size:20" json:"severity"`            // 严重程度
+
+	OrganizationID *uint `gorm:"index" json:"organization_id"` // 所属运营商
 }
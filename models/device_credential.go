@@ -0,0 +1,49 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DeviceCredential 设备机器凭证（API Key），绑定一台设备或一个监控摄像头，
+// 传感器、摄像头和车牌识别端用它上报数据，无需用户登录
+type DeviceCredential struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	Name              string     `gorm:"size:100;not null" json:"name"`          // 凭证名称
+	DeviceID          *uint      `gorm:"index" json:"device_id"`                 // 绑定的设备
+	CameraID          *uint      `gorm:"index" json:"camera_id"`                 // 绑定的监控摄像头
+	KeyPrefix         string     `gorm:"size:20;not null" json:"key_prefix"`     // 密钥前缀，便于识别，不可用于认证
+	KeyHash           string     `gorm:"size:64;not null;uniqueIndex" json:"-"`  // 当前密钥的 SHA-256
+	PreviousKeyHash   string     `gorm:"size:64;index" json:"-"`                 // 轮换前的密钥，宽限期内仍可使用
+	PreviousExpiresAt *time.Time `json:"previous_expires_at"`                    // 旧密钥宽限期截止时间
+	RotatedAt         *time.Time `json:"rotated_at"`                             // 最近轮换时间
+	RevokedAt         *time.Time `json:"revoked_at"`                             // 吊销时间
+	LastSeenAt        *time.Time `json:"last_seen_at"`                           // 最近一次使用时间
+	LastSeenIP        string     `gorm:"size:64" json:"last_seen_ip"`            // 最近一次使用的来源IP
+	CreatedBy         *uint      `json:"created_by"`                             // 签发人
+	Global            bool       `gorm:"default:false" json:"global"`            // 平台级凭证，可上报任意组织停车场的数据，只能由平台超级管理员签发
+	Status            string     `gorm:"size:20;default:'active'" json:"status"` // 状态：active, revoked
+
+	// 关联
+	Device *Device           `gorm:"foreignKey:DeviceID" json:"device,omitempty"`
+	Camera *MonitoringCamera `gorm:"foreignKey:CameraID" json:"camera,omitempty"`
+}
+
+// 设备凭证状态
+const (
+	DeviceCredentialActive  = "active"
+	DeviceCredentialRevoked = "revoked"
+)
@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// GeohashPrecision 停车场 geohash 索引的长度，9 位约 5 米精度
+const GeohashPrecision = 9
+
+const geohashBase32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// EncodeGeohash 计算经纬度的 geohash，precision 为字符数
+func EncodeGeohash(lat, lon float64, precision int) string {
+	minLat, maxLat := -90.0, 90.0
+	minLon, maxLon := -180.0, 180.0
+	hash := make([]byte, 0, precision)
+	even := true
+	bit, ch := 0, 0
+	for len(hash) < precision {
+		// 偶数位编码经度，奇数位编码纬度
+		if even {
+			mid := (minLon + maxLon) / 2
+			if lon >= mid {
+				ch = ch<<1 | 1
+				minLon = mid
+			} else {
+				ch <<= 1
+				maxLon = mid
+			}
+		} else {
+			mid := (minLat + maxLat) / 2
+			if lat >= mid {
+				ch = ch<<1 | 1
+				minLat = mid
+			} else {
+				ch <<= 1
+				maxLat = mid
+			}
+		}
+		even = !even
+		if bit++; bit == 5 {
+			hash = append(hash, geohashBase32[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return string(hash)
+}
+
+// GeohashCellSize geohash 单元格的纬度高度和经度宽度（度）
+func GeohashCellSize(precision int) (latHeight, lonWidth float64) {
+	bits := 5 * precision
+	lonBits := (bits + 1) / 2
+	latBits := bits / 2
+	return 180 / float64(uint64(1)<<latBits), 360 / float64(uint64(1)<<lonBits)
+}
+
+// BeforeSave 保存停车场时按经纬度维护 geohash 索引
+func (lot *ParkingLot) BeforeSave(tx *gorm.DB) error {
+	lot.Geohash = EncodeGeohash(lot.Latitude, lot.Longitude, GeohashPrecision)
+	return nil
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package models
+
+import (
+	"time"
+)
+
+// Invoice 停车费收据，由已结束或已支付的停车会话（或历史停车记录）生成，每个来源只开具一张
+type Invoice struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	InvoiceNo       string    `gorm:"size:30;uniqueIndex;not null" json:"invoice_no"` // 收据编号，按月连续编号
+	SessionID       *uint     `gorm:"uniqueIndex" json:"session_id"`                  // 来源停车会话
+	ParkingRecordID *uint     `gorm:"uniqueIndex" json:"parking_record_id"`           // 来源停车记录（无会话的历史记录）
+	UserID          *uint     `gorm:"index" json:"user_id"`
+	ParkingLotID    *uint     `gorm:"index" json:"parking_lot_id"`
+	ParkingLotName  string    `gorm:"size:100" json:"parking_lot_name"`
+	ParkingLotAddr  string    `gorm:"size:255" json:"parking_lot_address"`
+	PlateNumber     string    `gorm:"size:30" json:"plate_number"`
+	SpotType        string    `gorm:"size:20" json:"spot_type"`
+	SpotCode        string    `gorm:"size:20" json:"spot_code"`
+	StartTime       time.Time `json:"start_time"`
+	EndTime         time.Time `json:"end_time"`
+	DurationMinutes int       `json:"duration_minutes"`
+	TariffRule      string    `gorm:"size:200" json:"tariff_rule"`                             // 计费规则描述
+	Subtotal        float64   `gorm:"type:decimal(10,2)" json:"subtotal"`                      // 停车费（不含附加费）
+	Surcharge       float64   `gorm:"type:decimal(10,2)" json:"surcharge"`                     // 特殊车位附加费
+	Total           float64   `gorm:"type:decimal(10,2)" json:"total"`                         // 应付金额
+	PaymentStatus   string    `gorm:"size:20;not null;default:'unpaid'" json:"payment_status"` // unpaid, paid
+	PaymentMethod   string    `gorm:"size:20" json:"payment_method"`
+	PaymentOrderNo  string    `gorm:"size:40" json:"payment_order_no"`
+	IssuedAt        time.Time `gorm:"index" json:"issued_at"` // 开具时间
+
+	Items []InvoiceItem `gorm:"foreignKey:InvoiceID" json:"items"`
+}
+
+// InvoiceItem 收据费用明细
+type InvoiceItem struct {
+	ID        uint    `gorm:"primarykey" json:"-"`
+	InvoiceID uint    `gorm:"not null;index" json:"-"`
+	Name      string  `gorm:"size:50" json:"name"`
+	Quantity  int     `json:"quantity"`
+	UnitPrice float64 `gorm:"type:decimal(10,2)" json:"unit_price"`
+	Amount    float64 `gorm:"type:decimal(10,2)" json:"amount"`
+}
+
+// InvoiceSequence 收据编号序列，按月份连续递增
+type InvoiceSequence struct {
+	Period string `gorm:"primarykey;size:6" json:"period"` // 年月，如 202501
+	LastNo int    `gorm:"not null;default:0" json:"last_no"`
+}
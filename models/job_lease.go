@@ -0,0 +1,21 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package models
+
+import (
+	"time"
+)
+
+// JobLease 后台任务租约，多实例部署时保证同一任务同一时刻只在一个实例上运行
+type JobLease struct {
+	Name      string    `gorm:"primarykey;size:50" json:"name"` // 任务名称
+	Holder    string    `gorm:"size:100" json:"holder"`         // 当前持有者（实例标识）
+	ExpiresAt time.Time `gorm:"not null" json:"expires_at"`     // 租约到期时间
+	UpdatedAt time.Time `json:"updated_at"`
+}
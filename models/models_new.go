@@ -24,8 +24,15 @@ type User struct {
 	Username string `gorm:"size:50;uniqueIndex;not null" json:"username"`
 	Password string `gorm:"size:255;not null" json:"-"`
 	Email    string `gorm:"size:100;uniqueIndex" json:"email"`
-	UserType string `gorm:"size:20;not null;default:'user'" json:"user_type"` // admin, user
+	UserType string `gorm:"size:20;not null;default:'user'" json:"user_type"` // super_admin, admin, operator, technician, user, analyst
 	IsActive bool   `gorm:"default:true" json:"is_active"`
+	Nickname string `gorm:"size:50" json:"nickname"` // 昵称
+	Phone    string `gorm:"size:20" json:"phone"`    // 手机号
+
+	OrganizationID *uint `gorm:"index" json:"organization_id"` // 后台工作人员所属组织，普通用户和平台超级管理员为空
+
+	FailedLogins int        `gorm:"default:0" json:"-"`     // 连续登录失败次数，登录成功或重置密码后清零
+	LockedUntil  *time.Time `json:"locked_until,omitempty"` // 登录锁定截止时间
 }
 
 // HashPassword 哈希密码
@@ -50,14 +57,16 @@ type Vehicle struct {
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
-	UserID      uint   `gorm:"not null" json:"user_id"`
+	UserID      uint   `gorm:"not null" json:"user_id"` // 车主，共享给其他驾驶人见 VehicleMember
 	PlateNumber string `gorm:"size:30;not null;uniqueIndex" json:"plate_number"`
-	Brand       string `gorm:"size:50;not null" json:"brand"`
-	Model       string `gorm:"size:50;not null" json:"model"`
-	Color       string `gorm:"size:30" json:"color"`
-	Type        string `gorm:"size:30;not null;default:'小型汽车'" json:"type"`
-	RegDate     string `gorm:"size:15" json:"reg_date"`
-	IsDefault   bool   `gorm:"default:false" json:"is_default"`
+	// NormalizedPlate 归一化后的车牌，保存时由 PlateNumber 生成，用于匹配识别端上报的车牌
+	NormalizedPlate string `gorm:"size:30;index" json:"-"`
+	Brand           string `gorm:"size:50;not null" json:"brand"`
+	Model           string `gorm:"size:50;not null" json:"model"`
+	Color           string `gorm:"size:30" json:"color"`
+	Type            string `gorm:"size:30;not null;default:'小型汽车'" json:"type"`
+	RegDate         string `gorm:"size:15" json:"reg_date"`
+	IsDefault       bool   `gorm:"default:false" json:"is_default"` // 车主的默认车辆标记，返回给用户时为当前用户自己的默认车辆标记
 
 	// 关联字段
 	User           User            `gorm:"foreignKey:UserID" json:"-"`
@@ -71,6 +80,7 @@ type ParkingRecord struct {
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
 	VehicleID    uint    `gorm:"not null" json:"vehicle_id"`
+	SessionID    *uint   `gorm:"index" json:"session_id"` // 结算生成该记录的停车会话，历史记录为空
 	ParkingLotID *uint   `json:"parking_lot_id"`
 	Location     string  `gorm:"size:100;not null" json:"location"`
 	StartTime    string  `gorm:"size:25" json:"start_time"`
@@ -94,12 +104,21 @@ type ParkingLot struct {
 	Address        string  `gorm:"size:255" json:"address"`
 	Latitude       float64 `gorm:"type:decimal(10,8)" json:"latitude"`
 	Longitude      float64 `gorm:"type:decimal(11,8)" json:"longitude"`
+	Geohash        string  `gorm:"size:12;index" json:"-"` // 由经纬度计算的 geohash，用于附近停车场的空间检索
 	TotalSpots     int     `gorm:"not null;default:0" json:"total_spots"`
 	AvailableSpots int     `gorm:"not null;default:0" json:"available_spots"`
 	HourlyRate     float64 `gorm:"type:decimal(10,2);default:10.00" json:"hourly_rate"`
 	IsActive       bool    `gorm:"default:true" json:"is_active"`
 	OperatingHours string  `gorm:"size:50;default:'24小时'" json:"operating_hours"`
 	PaymentMethods string  `gorm:"size:100;default:'微信,支付宝,现金'" json:"payment_methods"`
+	OrganizationID *uint   `gorm:"index" json:"organization_id"` // 所属运营商
+
+	// 设施信息
+	HeightLimit  float64 `gorm:"type:decimal(4,2);not null;default:0" json:"height_limit"` // 限高（米），0表示不限高
+	Coverage     string  `gorm:"size:10" json:"coverage"`                                  // indoor, outdoor, mixed，空表示未登记
+	EVConnectors string  `gorm:"size:100" json:"ev_connectors"`                            // 逗号分隔的充电接口类型
+	HasSecurity  bool    `gorm:"default:false" json:"has_security"`                        // 有保安值守或监控
+	HasRestroom  bool    `gorm:"default:false" json:"has_restroom"`                        // 有卫生间
 
 	// 关联字段
 	SpecialSpots    []SpecialSpot    `gorm:"foreignKey:ParkingLotID" json:"special_spots"`
@@ -114,18 +133,24 @@ type ParkingSession struct {
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
-	UserID       uint       `gorm:"not null;index" json:"user_id"`
-	VehicleID    uint       `gorm:"not null" json:"vehicle_id"`
-	ParkingLotID uint       `gorm:"not null" json:"parking_lot_id"`
-	SpotCode     string     `gorm:"size:20;not null" json:"spot_code"`         // 车位编号
-	SpotType     string     `gorm:"size:20;default:'normal'" json:"spot_type"` // normal, charging, disabled, vip
-	StartTime    time.Time  `gorm:"not null" json:"start_time"`
-	EndTime      *time.Time `json:"end_time"`
-	Status       string     `gorm:"size:20;not null;default:'active'" json:"status"` // active, ended, paid
+	UserID        *uint      `gorm:"index" json:"user_id"`              // 未注册车牌产生的匿名会话为空
+	VehicleID     *uint      `json:"vehicle_id"`                        // 未注册车牌产生的匿名会话为空
+	PlateNumber   string     `gorm:"size:30;index" json:"plate_number"` // 车牌号（归一化后）
+	ParkingLotID  uint       `gorm:"not null" json:"parking_lot_id"`
+	ParkingSpotID *uint      `gorm:"index" json:"parking_spot_id"`              // 分配的车位（停车场无车位清单时为空）
+	SpotCode      string     `gorm:"size:20;not null" json:"spot_code"`         // 车位编号
+	SpotType      string     `gorm:"size:20;default:'normal'" json:"spot_type"` // normal, charging, disabled, vip
+	StartTime     time.Time  `gorm:"not null" json:"start_time"`
+	EndTime       *time.Time `json:"end_time"`
+	Status        string     `gorm:"size:20;not null;default:'active'" json:"status"` // active, ended, paid
 
 	// 费用相关
+	TariffID            *uint      `json:"tariff_id"`                                             // 开始停车时锁定的收费标准版本
+	PassID              *uint      `json:"pass_id"`                                               // 开始停车时有效的月卡，有效期内免收停车费
+	AccessEntryID       *uint      `json:"access_entry_id"`                                       // 开始停车时命中的白名单记录，有效期内免收停车费
 	FeeRate             float64    `gorm:"type:decimal(10,2);not null" json:"fee_rate"`           // 每小时费率
 	FeeCurrent          float64    `gorm:"type:decimal(10,2);default:0" json:"fee_current"`       // 当前费用
+	FeeSurcharge        float64    `gorm:"type:decimal(10,2);default:0" json:"fee_surcharge"`     // 当前费用中的特殊车位附加费
 	NextBillingTime     *time.Time `json:"next_billing_time"`                                     // 下次计费时间
 	NextFeeAmount       *float64   `gorm:"type:decimal(10,2)" json:"next_fee_amount"`             // 下次计费金额
 	CurrentBillingCycle int        `gorm:"default:0" json:"current_billing_cycle"`                // 当前计费周期
@@ -142,9 +167,20 @@ type ParkingSession struct {
 	ProgressToDestination int      `gorm:"default:0" json:"progress_to_destination_percent"`    // 到达目的地进度百分比
 
 	// 关联字段
-	User       User       `gorm:"foreignKey:UserID" json:"user"`
-	Vehicle    Vehicle    `gorm:"foreignKey:VehicleID" json:"vehicle"`
-	ParkingLot ParkingLot `gorm:"foreignKey:ParkingLotID" json:"parking_lot"`
+	User        User         `gorm:"foreignKey:UserID" json:"user"`
+	Vehicle     Vehicle      `gorm:"foreignKey:VehicleID" json:"vehicle"`
+	ParkingLot  ParkingLot   `gorm:"foreignKey:ParkingLotID" json:"parking_lot"`
+	ParkingSpot *ParkingSpot `gorm:"foreignKey:ParkingSpotID" json:"parking_spot,omitempty"`
+}
+
+// SessionFeeItem 停车会话结算时的费用明细，收据按结算时的明细开具
+type SessionFeeItem struct {
+	ID        uint    `gorm:"primarykey" json:"-"`
+	SessionID uint    `gorm:"not null;index" json:"-"`
+	Name      string  `gorm:"size:50" json:"name"`
+	Quantity  int     `json:"quantity"`
+	UnitPrice float64 `gorm:"type:decimal(10,2)" json:"unit_price"`
+	Amount    float64 `gorm:"type:decimal(10,2)" json:"amount"`
 }
 
 type SpecialSpot struct {
@@ -167,12 +203,15 @@ type SpecialSpot struct {
 type ParkingLotWithDistance struct {
 	ParkingLot
 	Distance        string                 `json:"distance"`
+	DistanceM       float64                `json:"distance_m"` // 距离（米）
+	OpenNow         bool                   `json:"open_now"`   // 当前是否营业
 	SpecialSpotsMap map[string]SpecialSpot `json:"special_spots_map"`
 }
 
 // VehicleWithStats 包含统计信息的车辆结构
 type VehicleWithStats struct {
 	Vehicle
+	Role        string `json:"role"` // 当前用户在该车辆上的角色：owner, driver
 	LastParking *struct {
 		Location string `json:"location"`
 		Time     string `json:"time"`
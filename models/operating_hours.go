@@ -0,0 +1,54 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package models
+
+import (
+	"time"
+)
+
+// ParkingLotHours 停车场每周营业时段，一天可以有多个时段。
+// 关门时间早于开门时间表示跨夜营业（如 22:00-06:00），24:00 表示营业到当天结束。
+// 停车场没有任何每周时段时沿用 ParkingLot.OperatingHours（"24小时" 或 "HH:MM-HH:MM"）
+type ParkingLotHours struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	ParkingLotID uint   `gorm:"not null;index" json:"parking_lot_id"`
+	Weekday      int    `gorm:"not null" json:"weekday"`           // 0 表示周日，1-6 表示周一至周六
+	OpenTime     string `gorm:"size:5;not null" json:"open_time"`  // 开门时间 HH:MM
+	CloseTime    string `gorm:"size:5;not null" json:"close_time"` // 关门时间 HH:MM
+}
+
+// ParkingLotHoliday 停车场节假日安排，当天不按每周时段营业：全天关闭或按特殊时段营业
+type ParkingLotHoliday struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	ParkingLotID uint   `gorm:"not null;uniqueIndex:idx_lot_holiday_date" json:"parking_lot_id"`
+	Date         string `gorm:"size:10;not null;uniqueIndex:idx_lot_holiday_date" json:"date"` // 日期 2006-01-02
+	Name         string `gorm:"size:50" json:"name"`                                           // 节假日名称
+	Closed       bool   `gorm:"default:false" json:"closed"`                                   // 全天关闭
+	OpenTime     string `gorm:"size:5" json:"open_time"`                                       // 特殊营业时段，Closed 为 false 时使用
+	CloseTime    string `gorm:"size:5" json:"close_time"`
+}
+
+// ParkingLotClosure 停车场临时关闭（施工、活动管制等），时段内不营业
+type ParkingLotClosure struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	ParkingLotID uint      `gorm:"not null;index" json:"parking_lot_id"`
+	StartAt      time.Time `gorm:"not null;index" json:"start_at"`
+	EndAt        time.Time `gorm:"not null;index" json:"end_at"`
+	Reason       string    `gorm:"size:255" json:"reason"`
+	CreatedBy    *uint     `json:"created_by"`
+}
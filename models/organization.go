@@ -0,0 +1,33 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultOrganizationCode 默认运营商编码，升级前的停车场、设备和后台账号归入该组织
+const DefaultOrganizationCode = "default"
+
+// Organization 停车运营商（租户），拥有停车场、设备及其统计数据，
+// 后台工作人员只能查看和操作本组织的数据
+type Organization struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	Code         string `gorm:"size:50;not null;uniqueIndex" json:"code"` // 组织编码
+	Name         string `gorm:"size:100;not null" json:"name"`            // 组织名称
+	ContactName  string `gorm:"size:50" json:"contact_name"`              // 联系人
+	ContactPhone string `gorm:"size:20" json:"contact_phone"`             // 联系电话
+	IsActive     bool   `gorm:"default:true" json:"is_active"`            // 是否启用
+}
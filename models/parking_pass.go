@@ -0,0 +1,73 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 月卡状态
+const (
+	PassStatusPending   = "pending"   // 待支付
+	PassStatusActive    = "active"    // 生效中（是否在有效期内以 ValidFrom/ValidUntil 为准）
+	PassStatusExpired   = "expired"   // 已过期
+	PassStatusCancelled = "cancelled" // 已取消
+)
+
+// PassPlan 停车场月卡套餐
+type PassPlan struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	ParkingLotID uint    `gorm:"not null;index" json:"parking_lot_id"`
+	Name         string  `gorm:"size:50;not null" json:"name"`              // 套餐名称
+	DurationDays int     `gorm:"not null" json:"duration_days"`             // 每期有效天数
+	Price        float64 `gorm:"type:decimal(10,2);not null" json:"price"`  // 每期价格
+	SpotType     string  `gorm:"size:20;default:'normal'" json:"spot_type"` // 适用车位类型
+	ReservedSpot bool    `gorm:"default:false" json:"reserved_spot"`        // 是否包含固定车位
+	IsActive     bool    `gorm:"default:true" json:"is_active"`             // 是否在售
+	Description  string  `gorm:"size:200" json:"description"`               // 套餐说明
+
+	// 关联
+	ParkingLot ParkingLot `gorm:"foreignKey:ParkingLotID" json:"-"`
+}
+
+// ParkingPass 月卡，绑定车辆，有效期内在对应停车场停车免收停车费
+type ParkingPass struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	UserID        uint       `gorm:"not null;index" json:"user_id"`
+	VehicleID     uint       `gorm:"not null;index" json:"vehicle_id"`
+	PlateNumber   string     `gorm:"size:30;index" json:"plate_number"` // 车牌号（归一化后），用于车牌识别入场时匹配
+	ParkingLotID  uint       `gorm:"not null;index" json:"parking_lot_id"`
+	PlanID        uint       `gorm:"not null" json:"plan_id"`
+	ValidFrom     time.Time  `gorm:"not null" json:"valid_from"`                             // 生效时间
+	ValidUntil    time.Time  `gorm:"not null;index" json:"valid_until"`                      // 到期时间，续费后顺延
+	Status        string     `gorm:"size:20;not null;default:'pending';index" json:"status"` // pending, active, expired, cancelled
+	ParkingSpotID *uint      `json:"parking_spot_id"`                                        // 固定车位
+	SpotCode      string     `gorm:"size:20" json:"spot_code"`                               // 固定车位编号
+	CancelledAt   *time.Time `json:"cancelled_at"`
+
+	// 关联
+	Plan       PassPlan   `gorm:"foreignKey:PlanID" json:"plan"`
+	Vehicle    Vehicle    `gorm:"foreignKey:VehicleID" json:"vehicle"`
+	ParkingLot ParkingLot `gorm:"foreignKey:ParkingLotID" json:"parking_lot"`
+}
+
+// CoversAt 判断月卡在指定时间是否有效
+func (p *ParkingPass) CoversAt(t time.Time) bool {
+	return p.Status == PassStatusActive && !t.Before(p.ValidFrom) && t.Before(p.ValidUntil)
+}
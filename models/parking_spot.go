@@ -0,0 +1,60 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 车位状态
+const (
+	SpotStatusFree         = "free"           // 空闲
+	SpotStatusOccupied     = "occupied"       // 占用
+	SpotStatusReserved     = "reserved"       // 预留
+	SpotStatusOutOfService = "out_of_service" // 停用
+)
+
+// ParkingSpot 车位（停车场 + 楼层 + 区域 + 编号唯一确定一个车位）
+type ParkingSpot struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	ParkingLotID    uint      `gorm:"not null;uniqueIndex:idx_parking_spot_location" json:"parking_lot_id"` // 停车场ID
+	Floor           string    `gorm:"size:10;not null;uniqueIndex:idx_parking_spot_location" json:"floor"`  // 楼层
+	Zone            string    `gorm:"size:20;not null;uniqueIndex:idx_parking_spot_location" json:"zone"`   // 区域
+	Code            string    `gorm:"size:20;not null;uniqueIndex:idx_parking_spot_location" json:"code"`   // 车位编号
+	SpotType        string    `gorm:"size:20;not null;default:'normal'" json:"spot_type"`                   // normal, charging, disabled, vip
+	Status          string    `gorm:"size:20;not null;default:'free';index" json:"status"`                  // free, occupied, reserved, out_of_service
+	StatusUpdatedAt time.Time `json:"status_updated_at"`                                                    // 状态更新时间
+
+	// 关联
+	ParkingLot ParkingLot `gorm:"foreignKey:ParkingLotID" json:"-"`
+}
+
+// IsValidSpotStatus 判断车位状态是否合法
+func IsValidSpotStatus(status string) bool {
+	switch status {
+	case SpotStatusFree, SpotStatusOccupied, SpotStatusReserved, SpotStatusOutOfService:
+		return true
+	}
+	return false
+}
+
+// IsValidSpecialSpotType 判断特殊车位类型是否合法（普通车位 normal 不单独计数）
+func IsValidSpecialSpotType(spotType string) bool {
+	switch spotType {
+	case "charging", "disabled", "vip":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,24 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package models
+
+import (
+	"time"
+)
+
+// PasswordResetToken 密码重置令牌，只保存令牌的哈希，使用一次后失效
+type PasswordResetToken struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	TokenHash string     `gorm:"size:64;not null;uniqueIndex" json:"-"` // 令牌的 SHA-256 哈希
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`            // 过期时间
+	UsedAt    *time.Time `json:"used_at"`                               // 使用时间，使用或被新令牌取代后不再有效
+}
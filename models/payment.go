@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 支付订单用途
+const (
+	PaymentPurposeParking = "parking" // 停车费
+	PaymentPurposeNoShow  = "no_show" // 预约违约金
+	PaymentPurposePass    = "pass"    // 月卡购买或续费
+)
+
+// 支付订单状态
+const (
+	PaymentStatusPending           = "pending"            // 待支付
+	PaymentStatusPaid              = "paid"               // 已支付
+	PaymentStatusFailed            = "failed"             // 支付失败
+	PaymentStatusPartiallyRefunded = "partially_refunded" // 部分退款
+	PaymentStatusRefunded          = "refunded"           // 全额退款
+)
+
+// 退款状态
+const (
+	RefundStatusPending   = "pending"
+	RefundStatusSucceeded = "succeeded"
+	RefundStatusFailed    = "failed"
+)
+
+// 资金流水类型
+const (
+	LedgerEntryCharge = "charge" // 收款
+	LedgerEntryRefund = "refund" // 退款
+)
+
+// PaymentOrder 支付订单，一次收款对应一个订单，通过支付渠道异步回调确认结果
+type PaymentOrder struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	OrderNo         string          `gorm:"size:40;uniqueIndex;not null" json:"order_no"`           // 订单号
+	UserID          *uint           `gorm:"uniqueIndex:idx_payment_idempotency" json:"user_id"`     // 付款用户
+	IdempotencyKey  *string         `gorm:"size:64;uniqueIndex:idx_payment_idempotency" json:"-"`   // 客户端幂等键，重试时返回同一订单
+	Purpose         string          `gorm:"size:20;not null;default:'parking'" json:"purpose"`      // parking, no_show, pass
+	SessionID       *uint           `gorm:"index" json:"session_id"`                                // 停车费对应的会话
+	ReservationID   *uint           `gorm:"index" json:"reservation_id"`                            // 违约金对应的预约
+	PassID          *uint           `gorm:"index" json:"pass_id"`                                   // 购买或续费的月卡
+	ParkingLotID    uint            `gorm:"not null;index" json:"parking_lot_id"`                   // 收款停车场
+	Amount          float64         `gorm:"type:decimal(10,2);not null" json:"amount"`              // 订单金额
+	RefundedAmount  float64         `gorm:"type:decimal(10,2);default:0" json:"refunded_amount"`    // 已退款金额
+	Method          string          `gorm:"size:20" json:"method"`                                  // 支付方式，取自停车场 PaymentMethods
+	Provider        string          `gorm:"size:20" json:"provider"`                                // 支付渠道
+	ProviderTradeNo string          `gorm:"size:64;index" json:"provider_trade_no"`                 // 渠道交易号
+	Status          string          `gorm:"size:20;not null;default:'pending';index" json:"status"` // pending, paid, failed, partially_refunded, refunded
+	FailureReason   string          `gorm:"size:200" json:"failure_reason,omitempty"`               // 失败原因
+	PaidAt          *time.Time      `json:"paid_at"`                                                // 支付成功时间
+	Description     string          `gorm:"size:200" json:"description"`                            // 订单描述
+	Refunds         []PaymentRefund `gorm:"foreignKey:OrderID" json:"refunds,omitempty"`
+}
+
+// PaymentRefund 退款单，一个订单可以多次部分退款，累计不超过订单金额
+type PaymentRefund struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	RefundNo         string     `gorm:"size:40;uniqueIndex;not null" json:"refund_no"` // 退款单号
+	OrderID          uint       `gorm:"not null;uniqueIndex:idx_refund_idempotency" json:"order_id"`
+	IdempotencyKey   *string    `gorm:"size:64;uniqueIndex:idx_refund_idempotency" json:"-"` // 幂等键，重复提交返回同一退款单
+	Amount           float64    `gorm:"type:decimal(10,2);not null" json:"amount"`           // 退款金额
+	Reason           string     `gorm:"size:200" json:"reason"`                              // 退款原因
+	Status           string     `gorm:"size:20;not null;default:'pending'" json:"status"`    // pending, succeeded, failed
+	ProviderRefundNo string     `gorm:"size:64" json:"provider_refund_no"`                   // 渠道退款单号
+	FailureReason    string     `gorm:"size:200" json:"failure_reason,omitempty"`            // 失败原因
+	OperatorID       *uint      `json:"operator_id"`                                         // 操作人
+	CompletedAt      *time.Time `json:"completed_at"`                                        // 退款完成时间
+}
+
+// LedgerEntry 资金流水，只追加不修改；收款为正、退款为负，按会话汇总可与停车费核对
+type LedgerEntry struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+
+	EntryType     string  `gorm:"size:20;not null" json:"entry_type"`        // charge, refund
+	OrderID       uint    `gorm:"not null;index" json:"order_id"`            // 支付订单
+	RefundID      *uint   `json:"refund_id"`                                 // 退款单（退款流水）
+	SessionID     *uint   `gorm:"index" json:"session_id"`                   // 停车会话
+	ReservationID *uint   `gorm:"index" json:"reservation_id"`               // 预约
+	PassID        *uint   `gorm:"index" json:"pass_id"`                      // 月卡
+	ParkingLotID  uint    `gorm:"not null;index" json:"parking_lot_id"`      // 停车场
+	Amount        float64 `gorm:"type:decimal(10,2);not null" json:"amount"` // 金额，收款为正、退款为负
+	Method        string  `gorm:"size:20" json:"method"`                     // 支付方式
+	Provider      string  `gorm:"size:20" json:"provider"`                   // 支付渠道
+	ProviderRef   string  `gorm:"size:64" json:"provider_ref"`               // 渠道交易号或退款单号
+	Description   string  `gorm:"size:200" json:"description"`               // 说明
+}
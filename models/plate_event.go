@@ -0,0 +1,51 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 车牌事件类型（与边缘识别端 client.py 的 type 字段一致）
+const (
+	PlateEventEntry = 0 // 入场
+	PlateEventExit  = 1 // 出场
+)
+
+// PlateEvent 车牌识别事件（边缘端上报的原始记录）
+type PlateEvent struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	PlateNumber  string    `gorm:"size:30;not null;index" json:"plate_number"` // 车牌号（归一化后）
+	ParkingLotID uint      `gorm:"not null;index" json:"parking_lot_id"`       // 停车场ID
+	EventType    int       `gorm:"not null" json:"event_type"`                 // 0入场 1出场
+	EventTime    time.Time `json:"event_time"`                                 // 识别时间
+	SessionID    *uint     `json:"session_id"`                                 // 关联的停车会话
+	Result       string    `gorm:"size:30" json:"result"`                      // 处理结果
+	CredentialID *uint     `gorm:"index" json:"credential_id"`                 // 上报的设备凭证
+}
+
+// NormalizePlate 车牌归一化：去掉分隔点和空格并转为大写，
+// 使识别端上报的 "浙A12345" 能匹配登记的 "浙A·12345"
+func NormalizePlate(plate string) string {
+	replacer := strings.NewReplacer("·", "", "•", "", ".", "", " ", "", "-", "")
+	return strings.ToUpper(replacer.Replace(strings.TrimSpace(plate)))
+}
+
+// BeforeSave 保存车辆时维护归一化车牌
+func (vehicle *Vehicle) BeforeSave(tx *gorm.DB) error {
+	vehicle.NormalizedPlate = NormalizePlate(vehicle.PlateNumber)
+	return nil
+}
@@ -0,0 +1,51 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 预约状态
+const (
+	ReservationStatusHeld      = "held"      // 已预留车位，等待车辆到达
+	ReservationStatusConverted = "converted" // 车辆已到达，转为停车会话
+	ReservationStatusCancelled = "cancelled" // 用户取消
+	ReservationStatusNoShow    = "no_show"   // 超过保留时间未到达
+)
+
+// Reservation 车位预约，预约期间占用停车场可用车位
+type Reservation struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	UserID          uint       `gorm:"not null;index" json:"user_id"`
+	VehicleID       uint       `gorm:"not null" json:"vehicle_id"`
+	PlateNumber     string     `gorm:"size:30;index" json:"plate_number"` // 车牌号（归一化后），用于车牌识别入场时匹配
+	ParkingLotID    uint       `gorm:"not null;index" json:"parking_lot_id"`
+	SpotType        string     `gorm:"size:20;default:'normal'" json:"spot_type"` // normal, charging, disabled, vip
+	ParkingSpotID   *uint      `json:"parking_spot_id"`                           // 预留的车位（停车场无车位清单时为空）
+	SpotCode        string     `gorm:"size:20" json:"spot_code"`                  // 预留的车位编号
+	StartTime       time.Time  `gorm:"not null" json:"start_time"`                // 预约时段开始
+	EndTime         time.Time  `gorm:"not null" json:"end_time"`                  // 预约时段结束
+	HoldUntil       time.Time  `gorm:"not null;index" json:"hold_until"`          // 车位保留截止时间（开始时间 + 宽限期）
+	Status          string     `gorm:"size:20;not null;default:'held';index" json:"status"`
+	NoShowFee       float64    `gorm:"type:decimal(10,2);default:0" json:"no_show_fee"` // 未到达产生的违约金
+	NoShowFeePaidAt *time.Time `json:"no_show_fee_paid_at"`                             // 违约金支付时间
+	SessionID       *uint      `json:"session_id"`                                      // 转换后的停车会话
+	ClosedAt        *time.Time `json:"closed_at"`                                       // 转换、取消或过期的时间
+
+	// 关联
+	Vehicle    Vehicle    `gorm:"foreignKey:VehicleID" json:"vehicle"`
+	ParkingLot ParkingLot `gorm:"foreignKey:ParkingLotID" json:"parking_lot"`
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package models
+
+// 用户角色（User.UserType）
+const (
+	RoleSuperAdmin = "super_admin" // 平台超级管理员，拥有全部权限，可跨组织查看和操作
+	RoleAdmin      = "admin"       // 组织管理员，拥有本组织内除平台权限外的全部权限
+	RoleOperator   = "operator"    // 停车场运营：车场配置、名单、退款和运营数据
+	RoleTechnician = "technician"  // 运维技术员：设备维护与设备凭证管理
+	RoleUser       = "user"        // 普通用户，只能访问自己的数据
+	RoleAnalyst    = "analyst"     // 数据分析员，只读访问统计、设备和财务数据
+)
+
+// 权限
+const (
+	PermParkingManage = "parking:manage" // 车场可用车位、收费标准、车位、月卡套餐、黑白名单与车牌报警
+	PermStatsRead     = "stats:read"     // 停车统计与施工统计
+	PermDeviceRead    = "device:read"    // 设备、报警与监控摄像头数据
+	PermDeviceManage  = "device:manage"  // 签发、轮换和吊销设备凭证
+	PermTollRead      = "toll:read"      // 收费站通行记录
+	PermFinanceRead   = "finance:read"   // 查看任意支付订单、对账与收据导出
+	PermPaymentRefund = "payment:refund" // 发起退款
+	PermUserManage    = "user:manage"    // 用户管理
+	PermAuditRead     = "audit:read"     // 查询审计日志
+	PermOrgManage     = "org:manage"     // 平台权限：管理组织及其停车场、设备和工作人员归属
+)
+
+// platformPermissions 只有平台超级管理员拥有的权限
+var platformPermissions = map[string]bool{
+	PermOrgManage: true,
+}
+
+// rolePermissions 各角色拥有的权限，超级管理员和组织管理员的权限见 RoleHasPermission
+var rolePermissions = map[string][]string{
+	RoleOperator:   {PermParkingManage, PermStatsRead, PermTollRead, PermFinanceRead, PermPaymentRefund},
+	RoleTechnician: {PermDeviceRead, PermDeviceManage},
+	RoleAnalyst:    {PermStatsRead, PermDeviceRead, PermTollRead, PermFinanceRead},
+	RoleUser:       {},
+}
+
+// IsValidRole 判断角色是否存在
+func IsValidRole(role string) bool {
+	if role == RoleAdmin || role == RoleSuperAdmin {
+		return true
+	}
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// IsStaffRole 判断是否为后台工作人员角色（管理端登录）
+func IsStaffRole(role string) bool {
+	return IsValidRole(role) && role != RoleUser
+}
+
+// RoleHasPermission 判断角色是否拥有某项权限
+func RoleHasPermission(role, permission string) bool {
+	if role == RoleSuperAdmin {
+		return true
+	}
+	if role == RoleAdmin {
+		return !platformPermissions[permission]
+	}
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// RolePermissions 返回角色拥有的权限列表
+func RolePermissions(role string) []string {
+	if role == RoleAdmin || role == RoleSuperAdmin {
+		permissions := []string{PermParkingManage, PermStatsRead, PermDeviceRead, PermDeviceManage,
+			PermTollRead, PermFinanceRead, PermPaymentRefund, PermUserManage, PermAuditRead}
+		if role == RoleSuperAdmin {
+			permissions = append(permissions, PermOrgManage)
+		}
+		return permissions
+	}
+	return append([]string{}, rolePermissions[role]...)
+}
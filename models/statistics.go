@@ -61,6 +61,8 @@ type TotalOccupancy struct {
 	AvailableSpots int       `json:"available_spots"`                         // 可用车位
 	Timestamp      time.Time `json:"timestamp"`                               // 记录时间
 	Period         string    `gorm:"size:20" json:"period"`                   // 统计周期
+
+	OrganizationID *uint `gorm:"index" json:"organization_id"` // 所属运营商
 }
 
 // MotorParkingCongestion 非机动车停车拥堵数据
@@ -77,6 +79,8 @@ type MotorParkingCongestion struct {
 	CongestionRate  float64   `gorm:"type:decimal(5,2)" json:"congestion_rate"` // 拥堵率
 	Timestamp       time.Time `json:"timestamp"`                                // 记录时间
 	ReportedBy      string    `gorm:"size:100" json:"reported_by"`              // 上报人
+
+	OrganizationID *uint `gorm:"index" json:"organization_id"` // 所属运营商
 }
 
 // TollRecord 收费记录
@@ -96,6 +100,8 @@ type TollRecord struct {
 	Status        string     `gorm:"size:20;default:'completed'" json:"status"` // 状态
 	Distance      float64    `gorm:"type:decimal(10,2)" json:"distance"`        // 距离(公里)
 
+	OrganizationID *uint `gorm:"index" json:"organization_id"` // 所属运营商
+
 	// 关联
 	Vehicle Vehicle `gorm:"foreignKey:VehicleID" json:"-"`
 }
@@ -117,6 +123,8 @@ type ConstructionStats struct {
 	TrafficImpact string     `gorm:"size:500" json:"traffic_impact"`        // 交通影响
 	Budget        float64    `gorm:"type:decimal(12,2)" json:"budget"`      // 预算
 	ActualCost    float64    `gorm:"type:decimal(12,2)" json:"actual_cost"` // 实际成本
+
+	OrganizationID *uint `gorm:"index" json:"organization_id"` // 所属运营商
 }
 
 // MonitoringCamera 监控摄像头
@@ -137,4 +145,6 @@ type MonitoringCamera struct {
 	ViewAngle   int       `json:"view_angle"`                             // 视角角度
 	NightVision bool      `gorm:"default:false" json:"night_vision"`      // 夜视功能
 	InstallDate time.Time `json:"install_date"`                           // 安装日期
+
+	OrganizationID *uint `gorm:"index" json:"organization_id"` // 所属运营商
 }
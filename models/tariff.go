@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ParkingTariff 停车场收费标准（按停车场和车位类型区分，修改时新增版本而不覆盖旧版本）
+//
+// 标准规则（standard）以 coze/charge/Parking_charging_system.py 为准：
+// 停车时长按分钟向上取整，不超过免费时长（free_time）不收费；否则收取起步价 FirstPeriodPrice（reg1），
+// 再加上 min(MaxFee, 超出首段的计费单位数 × UnitPrice)（reg2、reg3），MaxFee 在整个停车期间只作用一次。
+// 在此基础上的扩展：
+//   - 首段时长 FirstPeriodMinutes 可单独配置，Python 中首段固定为一个计费单位（unit），
+//     两者相等时计费结果与 Python 相同；
+//   - MaxFee 为 0 表示不封顶；
+//   - DailyCap 为每 24 小时（从入场起算）的费用上限，首段费用计入第一个 24 小时，
+//     每个计费单位按开始时间归入所在的 24 小时，为 0 时不限，与 Python 相同；
+//   - 停车时长为 0 按免费处理，不返回 Python 的异常值；
+//   - 特殊车位附加费、月卡和白名单免费时段在计费规则之外处理。
+//
+// 分时段规则（banded）按 Bands 中的时段价格分段计费，未被时段覆盖的时间按 UnitMinutes/UnitPrice 计费，
+// 不收首段费用，免费时长、DailyCap 和 MaxFee 的含义与标准规则相同：先按每 24 小时封顶，再按整个停车期间封顶。
+type ParkingTariff struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	ParkingLotID       uint      `gorm:"not null;index" json:"parking_lot_id"`                            // 停车场ID
+	SpotType           string    `gorm:"size:20;not null;default:'normal'" json:"spot_type"`              // 车位类型
+	Version            int       `gorm:"not null;default:1" json:"version"`                               // 版本号
+	RuleType           string    `gorm:"size:20;not null;default:'standard'" json:"rule_type"`            // 计费规则类型
+	FreeMinutes        int       `gorm:"not null;default:0" json:"free_minutes"`                          // 免费时长（分钟）
+	FirstPeriodMinutes int       `gorm:"not null;default:60" json:"first_period_minutes"`                 // 首段时长（分钟）
+	FirstPeriodPrice   float64   `gorm:"type:decimal(10,2);not null;default:0" json:"first_period_price"` // 首段价格（起步价）
+	UnitMinutes        int       `gorm:"not null;default:60" json:"unit_minutes"`                         // 计费单位（分钟）
+	UnitPrice          float64   `gorm:"type:decimal(10,2);not null;default:0" json:"unit_price"`         // 单位价格
+	DailyCap           float64   `gorm:"type:decimal(10,2);not null;default:0" json:"daily_cap"`          // 每24小时封顶，0表示不封顶
+	MaxFee             float64   `gorm:"type:decimal(10,2);not null;default:0" json:"max_fee"`            // 整个停车期间首段后的费用上限，0表示不封顶
+	EffectiveFrom      time.Time `json:"effective_from"`                                                  // 生效时间
+	IsActive           bool      `gorm:"default:true" json:"is_active"`                                   // 是否启用
+
+	// 关联
+	ParkingLot ParkingLot   `gorm:"foreignKey:ParkingLotID" json:"-"`
+	Bands      []TariffBand `gorm:"foreignKey:TariffID" json:"bands,omitempty"`
+
+	// Holidays 计费区间内按节假日价格计费的日期（2006-01-02），计费前由停车场节假日安排填充
+	Holidays map[string]bool `gorm:"-" json:"-"`
+}
+
+// 时段价格适用的日期类型
+const (
+	TariffDayWeekday = "weekday" // 工作日
+	TariffDayWeekend = "weekend" // 周末，未配置时按工作日价格
+	TariffDayHoliday = "holiday" // 停车场节假日，未配置时按周末或工作日价格
+)
+
+// IsValidTariffDayType 判断时段价格的日期类型是否合法
+func IsValidTariffDayType(dayType string) bool {
+	switch dayType {
+	case TariffDayWeekday, TariffDayWeekend, TariffDayHoliday:
+		return true
+	}
+	return false
+}
+
+// TariffBand 收费标准的时段价格，随收费标准版本一起创建，不单独修改。
+// 结束时间早于开始时间表示跨夜（如夜间 20:00-08:00），跨夜时段按开始当天的日期类型计价
+type TariffBand struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	TariffID    uint    `gorm:"not null;index" json:"tariff_id"`
+	DayType     string  `gorm:"size:10;not null;default:'weekday'" json:"day_type"`      // 日期类型
+	Name        string  `gorm:"size:20" json:"name"`                                     // 时段名称，如 日间、夜间
+	StartTime   string  `gorm:"size:5;not null" json:"start_time"`                       // 开始时间 HH:MM
+	EndTime     string  `gorm:"size:5;not null" json:"end_time"`                         // 结束时间 HH:MM
+	UnitMinutes int     `gorm:"not null;default:60" json:"unit_minutes"`                 // 计费单位（分钟）
+	UnitPrice   float64 `gorm:"type:decimal(10,2);not null;default:0" json:"unit_price"` // 单位价格
+	Cap         float64 `gorm:"type:decimal(10,2);not null;default:0" json:"cap"`        // 单次时段封顶（如夜间封顶），0表示不封顶
+}
@@ -0,0 +1,48 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package models
+
+import (
+	"time"
+)
+
+// 车辆成员角色
+const (
+	VehicleRoleOwner  = "owner"  // 车主：可邀请和移除驾驶人、删除车辆
+	VehicleRoleDriver = "driver" // 驾驶人：可使用车辆停车、预约，并查看车辆的停车会话
+)
+
+// 车辆成员状态
+const (
+	VehicleMemberPending  = "pending"  // 已邀请，等待对方接受
+	VehicleMemberActive   = "active"   // 已接受邀请（车主始终为 active）
+	VehicleMemberDeclined = "declined" // 对方拒绝邀请
+	VehicleMemberRevoked  = "revoked"  // 被车主移除或本人退出
+)
+
+// VehicleMember 车辆的共享成员，一辆车由车主和若干驾驶人共用。
+// 默认车辆按成员分别记录，每个用户可以有自己的默认车辆
+type VehicleMember struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	VehicleID   uint       `gorm:"not null;uniqueIndex:idx_vehicle_member" json:"vehicle_id"`
+	UserID      uint       `gorm:"not null;uniqueIndex:idx_vehicle_member;index" json:"user_id"`
+	Role        string     `gorm:"size:20;not null;default:'driver'" json:"role"`          // owner, driver
+	Status      string     `gorm:"size:20;not null;default:'pending';index" json:"status"` // pending, active, declined, revoked
+	IsDefault   bool       `gorm:"default:false" json:"is_default"`                        // 是否为该用户的默认车辆
+	InvitedBy   *uint      `json:"invited_by"`                                             // 发出邀请的车主
+	RespondedAt *time.Time `json:"responded_at"`                                           // 接受或拒绝邀请的时间
+	RevokedAt   *time.Time `json:"revoked_at"`                                             // 被移除或退出的时间
+
+	// 关联
+	Vehicle Vehicle `gorm:"foreignKey:VehicleID" json:"vehicle"`
+	User    User    `gorm:"foreignKey:UserID" json:"user"`
+}
@@ -735,14 +735,17 @@ CREATE TABLE IF NOT EXISTS `parking_sessions` (
   `created_at` datetime(3) DEFAULT NULL,
   `updated_at` datetime(3) DEFAULT NULL,
   `deleted_at` datetime(3) DEFAULT NULL,
-  `user_id` bigint unsigned NOT NULL,
-  `vehicle_id` bigint unsigned NOT NULL,
+  `user_id` bigint unsigned DEFAULT NULL COMMENT '用户ID，匿名会话为空',
+  `vehicle_id` bigint unsigned DEFAULT NULL COMMENT '车辆ID，匿名会话为空',
+  `plate_number` varchar(30) DEFAULT NULL COMMENT '车牌号（归一化后）',
   `parking_lot_id` bigint unsigned NOT NULL,
+  `parking_spot_id` bigint unsigned DEFAULT NULL COMMENT '分配的车位ID，停车场无车位清单时为空',
   `spot_code` varchar(20) NOT NULL COMMENT '车位编号',
   `spot_type` varchar(20) DEFAULT 'normal' COMMENT '车位类型：normal,charging,disabled,vip',
   `start_time` datetime(3) NOT NULL COMMENT '停车开始时间',
   `end_time` datetime(3) DEFAULT NULL COMMENT '停车结束时间',
   `status` varchar(20) NOT NULL DEFAULT 'active' COMMENT '状态：active,ended,paid',
+  `pass_id` bigint unsigned DEFAULT NULL COMMENT '开始停车时有效的月卡ID',
   `fee_rate` decimal(10,2) NOT NULL COMMENT '每小时费率',
   `fee_current` decimal(10,2) DEFAULT '0.00' COMMENT '当前费用',
   `next_billing_time` datetime(3) DEFAULT NULL COMMENT '下次计费时间',
@@ -761,6 +764,8 @@ CREATE TABLE IF NOT EXISTS `parking_sessions` (
   KEY `idx_parking_sessions_deleted_at` (`deleted_at`),
   KEY `idx_parking_sessions_user_id` (`user_id`),
   KEY `idx_user_id` (`user_id`),
+  KEY `idx_parking_sessions_plate_number` (`plate_number`),
+  KEY `idx_parking_sessions_parking_spot_id` (`parking_spot_id`),
   CONSTRAINT `fk_parking_sessions_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`),
   CONSTRAINT `fk_parking_sessions_vehicle` FOREIGN KEY (`vehicle_id`) REFERENCES `vehicles` (`id`),
   CONSTRAINT `fk_parking_sessions_parking_lot` FOREIGN KEY (`parking_lot_id`) REFERENCES `parking_lots` (`id`)
@@ -0,0 +1,67 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"urban_traffic_backend/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrPlateBlacklisted 车辆在该停车场的黑名单中
+var ErrPlateBlacklisted = errors.New("该车辆已被禁止进入此停车场")
+
+// CheckAccessList 查询车牌在停车场指定时间有效的名单记录，黑名单优先于白名单，没有时返回 nil
+func CheckAccessList(db *gorm.DB, lotID uint, plate string, at time.Time) (*models.AccessListEntry, error) {
+	var entries []models.AccessListEntry
+	err := db.Where("parking_lot_id = ? AND plate_number = ?", lotID, plate).
+		Where("(valid_from IS NULL OR valid_from <= ?) AND (valid_until IS NULL OR valid_until > ?)", at, at).
+		Order("id desc").
+		Find(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var whitelisted *models.AccessListEntry
+	for i := range entries {
+		switch entries[i].ListType {
+		case models.AccessListBlacklist:
+			return &entries[i], nil
+		case models.AccessListWhitelist:
+			if whitelisted == nil {
+				whitelisted = &entries[i]
+			}
+		}
+	}
+	return whitelisted, nil
+}
+
+// RaiseBlacklistAlarm 黑名单车辆出现时生成车牌报警，source 说明车辆出现的途径
+func RaiseBlacklistAlarm(db *gorm.DB, lot *models.ParkingLot, entry *models.AccessListEntry, source string, at time.Time) error {
+	message := fmt.Sprintf("黑名单车辆 %s %s", entry.PlateNumber, source)
+	if entry.Reason != "" {
+		message += "，原因：" + entry.Reason
+	}
+	alarm := models.PlateAlarm{
+		ParkingLotID: lot.ID,
+		PlateNumber:  entry.PlateNumber,
+		EntryID:      &entry.ID,
+		AlarmType:    "黑名单车辆",
+		Severity:     "high",
+		Message:      truncate(message, 500),
+		Status:       "active",
+		AlarmTime:    at,
+		Location:     truncate(lot.Name, 100),
+	}
+	return db.Create(&alarm).Error
+}
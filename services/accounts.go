@@ -0,0 +1,251 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"urban_traffic_backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrUsernameTaken 用户名已被使用
+	ErrUsernameTaken = errors.New("用户名已存在")
+	// ErrEmailTaken 邮箱已被使用
+	ErrEmailTaken = errors.New("邮箱已被注册")
+	// ErrInvalidUsername 用户名不合法
+	ErrInvalidUsername = errors.New("用户名长度须为3-50个字符，且不能包含空格")
+	// ErrInvalidEmail 邮箱格式不正确
+	ErrInvalidEmail = errors.New("邮箱格式不正确")
+	// ErrWeakPassword 密码不满足要求
+	ErrWeakPassword = errors.New("密码长度须为6-72个字符")
+	// ErrInvalidResetToken 重置令牌无效、已使用或已过期
+	ErrInvalidResetToken = errors.New("重置令牌无效或已过期")
+)
+
+// PasswordResetTTL 密码重置令牌有效期，由 PASSWORD_RESET_TTL_SECONDS 配置，默认 30 分钟
+func PasswordResetTTL() time.Duration {
+	return envDuration("PASSWORD_RESET_TTL_SECONDS", 30*time.Minute)
+}
+
+// ValidateUsername 校验用户名
+func ValidateUsername(username string) error {
+	n := utf8.RuneCountInString(username)
+	if n < 3 || n > 50 || strings.ContainsAny(username, " \t\r\n") {
+		return ErrInvalidUsername
+	}
+	return nil
+}
+
+// NormalizeEmail 校验并归一化邮箱（去掉显示名、转为小写）
+func NormalizeEmail(email string) (string, error) {
+	addr, err := mail.ParseAddress(strings.TrimSpace(email))
+	if err != nil || len(addr.Address) > 100 {
+		return "", ErrInvalidEmail
+	}
+	return strings.ToLower(addr.Address), nil
+}
+
+// ValidatePassword 校验密码长度，bcrypt 只使用前 72 字节
+func ValidatePassword(password string) error {
+	if utf8.RuneCountInString(password) < 6 || len(password) > 72 {
+		return ErrWeakPassword
+	}
+	return nil
+}
+
+// CheckAccountAvailable 检查用户名和邮箱是否已被其他用户使用（含已删除用户，唯一索引仍占用）。
+// excludeUserID 为当前用户，修改资料时排除自己
+func CheckAccountAvailable(db *gorm.DB, username, email string, excludeUserID uint) error {
+	if username != "" {
+		var count int64
+		db.Unscoped().Model(&models.User{}).Where("username = ? AND id <> ?", username, excludeUserID).Count(&count)
+		if count > 0 {
+			return ErrUsernameTaken
+		}
+	}
+	if email != "" {
+		var count int64
+		db.Unscoped().Model(&models.User{}).Where("email = ? AND id <> ?", email, excludeUserID).Count(&count)
+		if count > 0 {
+			return ErrEmailTaken
+		}
+	}
+	return nil
+}
+
+// RegisterUser 注册普通用户
+func RegisterUser(username, email, password, nickname, phone string) (*models.User, error) {
+	username = strings.TrimSpace(username)
+	if err := ValidateUsername(username); err != nil {
+		return nil, err
+	}
+	email, err := NormalizeEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidatePassword(password); err != nil {
+		return nil, err
+	}
+
+	user := models.User{
+		Username: username,
+		Password: password,
+		Email:    email,
+		UserType: "user",
+		IsActive: true,
+		Nickname: strings.TrimSpace(nickname),
+		Phone:    strings.TrimSpace(phone),
+	}
+	if err := user.HashPassword(); err != nil {
+		return nil, err
+	}
+
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := CheckAccountAvailable(tx, user.Username, user.Email, 0); err != nil {
+			return err
+		}
+		return tx.Create(&user).Error
+	})
+	if err != nil {
+		// 并发注册时由唯一索引兜底
+		if errors.Is(err, gorm.ErrDuplicatedKey) || strings.Contains(err.Error(), "Duplicate entry") {
+			if checkErr := CheckAccountAvailable(models.DB, user.Username, user.Email, 0); checkErr != nil {
+				return nil, checkErr
+			}
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// RequestPasswordReset 为邮箱对应的用户生成一次性重置令牌并通过通知渠道发送，之前未使用的令牌作废。
+// 邮箱未注册时同样返回成功，避免暴露注册信息
+func RequestPasswordReset(email string) error {
+	email, err := NormalizeEmail(email)
+	if err != nil {
+		return err
+	}
+	// 先确认通知渠道可用，无论邮箱是否注册结果都相同
+	notifier, err := activeNotifier()
+	if err != nil {
+		return err
+	}
+
+	var user models.User
+	err = models.DB.Where("email = ? AND is_active = ?", email, true).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := IssuePasswordResetToken(models.DB, user.ID)
+	if err != nil {
+		return err
+	}
+	body := fmt.Sprintf("%s，您好：您的密码重置令牌为 %s，%d 分钟内有效，仅可使用一次。如非本人操作请忽略。",
+		user.Username, token, int(PasswordResetTTL().Minutes()))
+	if err := notifier.Send(user.Email, "重置密码", body); err != nil {
+		log.Printf("send password reset to user %d failed: %v", user.ID, err)
+		return err
+	}
+	return nil
+}
+
+// IssuePasswordResetToken 生成一次性重置令牌，只保存哈希，返回明文令牌；之前未使用的令牌作废
+func IssuePasswordResetToken(db *gorm.DB, userID uint) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", userID).
+			Update("used_at", now).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&models.PasswordResetToken{
+			UserID:    userID,
+			TokenHash: hashToken(token),
+			ExpiresAt: now.Add(PasswordResetTTL()),
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ResetPassword 使用重置令牌设置新密码，令牌使用后立即失效，用户的所有登录会话同时撤销
+func ResetPassword(token, newPassword string) error {
+	if err := ValidatePassword(newPassword); err != nil {
+		return err
+	}
+
+	return models.DB.Transaction(func(tx *gorm.DB) error {
+		var reset models.PasswordResetToken
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hashToken(strings.TrimSpace(token)), time.Now()).
+			First(&reset).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidResetToken
+		}
+		if err != nil {
+			return err
+		}
+
+		var user models.User
+		if err := tx.First(&user, reset.UserID).Error; err != nil {
+			return ErrInvalidResetToken
+		}
+		if err := SetUserPassword(tx, &user, newPassword); err != nil {
+			return err
+		}
+		// 密码已被重置，之前的登录全部失效
+		if _, err := RevokeUserSessions(tx, user.ID, 0); err != nil {
+			return err
+		}
+		return tx.Model(&reset).Update("used_at", time.Now()).Error
+	})
+}
+
+// SetUserPassword 哈希并保存用户的新密码
+func SetUserPassword(db *gorm.DB, user *models.User, password string) error {
+	user.Password = password
+	if err := user.HashPassword(); err != nil {
+		return err
+	}
+	// 重置或修改密码后解除登录锁定
+	return db.Model(user).Updates(map[string]interface{}{
+		"password":      user.Password,
+		"failed_logins": 0,
+		"locked_until":  nil,
+	}).Error
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package services
+
+import (
+	"strconv"
+	"strings"
+
+	"urban_traffic_backend/models"
+
+	"gorm.io/gorm"
+)
+
+// AmenityFilter 按设施筛选停车场的条件，零值表示不筛选
+type AmenityFilter struct {
+	MinHeight    float64  // 车辆高度（米），只保留不限高或限高不低于该值的停车场
+	Coverage     string   // indoor 或 outdoor，室内和露天都有的停车场两者都匹配
+	EVConnectors []string // 登记了其中任一充电接口的停车场
+	EVCharging   bool     // 有充电车位或登记了充电接口
+	Security     bool     // 有保安值守或监控
+	Restroom     bool     // 有卫生间
+	Accessible   bool     // 有无障碍车位
+}
+
+// ParseAmenityFilter 解析设施筛选参数 min_height、coverage、ev_connector、ev、security、restroom、accessible，
+// query 返回查询参数的值
+func ParseAmenityFilter(query func(key string) string) (AmenityFilter, error) {
+	filter := AmenityFilter{
+		Coverage:   strings.TrimSpace(query("coverage")),
+		EVCharging: query("ev") == "true",
+		Security:   query("security") == "true",
+		Restroom:   query("restroom") == "true",
+		Accessible: query("accessible") == "true",
+	}
+	if value := strings.TrimSpace(query("min_height")); value != "" {
+		height, err := strconv.ParseFloat(value, 64)
+		if err != nil || height < 0 || height > 10 {
+			return filter, ErrInvalidHeightLimit
+		}
+		filter.MinHeight = height
+	}
+	if filter.Coverage == models.LotCoverageMixed || !models.IsValidLotCoverage(filter.Coverage) {
+		return filter, ErrInvalidCoverage
+	}
+	connectors, err := NormalizeEVConnectors(query("ev_connector"))
+	if err != nil {
+		return filter, err
+	}
+	if connectors != "" {
+		filter.EVConnectors = strings.Split(connectors, ",")
+	}
+	return filter, nil
+}
+
+// AmenityScope 按设施筛选停车场
+func AmenityScope(filter AmenityFilter) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if filter.MinHeight > 0 {
+			db = db.Where("(parking_lots.height_limit = 0 OR parking_lots.height_limit >= ?)", filter.MinHeight)
+		}
+		if filter.Coverage != "" {
+			db = db.Where("parking_lots.coverage IN ?", []string{filter.Coverage, models.LotCoverageMixed})
+		}
+		if len(filter.EVConnectors) > 0 {
+			conditions := make([]string, len(filter.EVConnectors))
+			args := make([]interface{}, len(filter.EVConnectors))
+			for i, connector := range filter.EVConnectors {
+				conditions[i] = "FIND_IN_SET(?, parking_lots.ev_connectors) > 0"
+				args[i] = connector
+			}
+			db = db.Where("("+strings.Join(conditions, " OR ")+")", args...)
+		}
+		if filter.EVCharging {
+			db = db.Where("(parking_lots.ev_connectors <> '' OR EXISTS (?))", specialSpotExists(db, "charging"))
+		}
+		if filter.Security {
+			db = db.Where("parking_lots.has_security = ?", true)
+		}
+		if filter.Restroom {
+			db = db.Where("parking_lots.has_restroom = ?", true)
+		}
+		if filter.Accessible {
+			db = db.Where("EXISTS (?)", specialSpotExists(db, "disabled"))
+		}
+		return db
+	}
+}
+
+// specialSpotExists 停车场登记了某类特殊车位的子查询
+func specialSpotExists(db *gorm.DB, spotType string) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true}).Model(&models.SpecialSpot{}).Select("1").
+		Where("special_spots.parking_lot_id = parking_lots.id AND special_spots.spot_type = ? AND special_spots.total_count > 0", spotType)
+}
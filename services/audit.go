@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package services
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"urban_traffic_backend/models"
+
+	"gorm.io/gorm"
+)
+
+// 不参与差异比较的字段
+var auditIgnoredFields = map[string]bool{
+	"updated_at": true,
+}
+
+// AuditSnapshot 将对象序列化为审计快照，调用时立即序列化，之后对象的修改不影响快照
+func AuditSnapshot(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// RecordAudit 追加一条审计日志，根据修改前后快照计算字段差异
+func RecordAudit(db *gorm.DB, entry *models.AuditLog) error {
+	entry.ID = 0
+	entry.Route = truncate(entry.Route, 200)
+	entry.Path = truncate(entry.Path, 255)
+	entry.ActorName = truncate(entry.ActorName, 100)
+	entry.TargetID = truncate(entry.TargetID, 64)
+	entry.IP = truncate(entry.IP, 64)
+	entry.UserAgent = truncate(entry.UserAgent, 255)
+	entry.Changes = auditChanges(entry.Before, entry.After)
+	return db.Create(entry).Error
+}
+
+// auditChanges 比较两个 JSON 对象快照的顶层字段，返回发生变化的字段。
+// 新建时 before 为空，删除时 after 为空，此时所有字段都视为变化
+func auditChanges(before, after string) string {
+	if before == "" && after == "" {
+		return ""
+	}
+	beforeFields := map[string]interface{}{}
+	afterFields := map[string]interface{}{}
+	if before != "" && json.Unmarshal([]byte(before), &beforeFields) != nil {
+		return ""
+	}
+	if after != "" && json.Unmarshal([]byte(after), &afterFields) != nil {
+		return ""
+	}
+
+	changes := map[string]map[string]interface{}{}
+	for key, value := range beforeFields {
+		if auditIgnoredFields[key] {
+			continue
+		}
+		if newValue, ok := afterFields[key]; !ok || !reflect.DeepEqual(value, newValue) {
+			changes[key] = map[string]interface{}{"before": value, "after": afterFields[key]}
+		}
+	}
+	for key, value := range afterFields {
+		if _, ok := beforeFields[key]; ok || auditIgnoredFields[key] {
+			continue
+		}
+		changes[key] = map[string]interface{}{"before": nil, "after": value}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+	return AuditSnapshot(changes)
+}
@@ -0,0 +1,324 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"urban_traffic_backend/models"
+
+	"gorm.io/gorm"
+)
+
+// occupancyPeriodHours 分时段占用率的时段长度（小时），每天分为 00:00-06:00、06:00-12:00 等四个时段
+const occupancyPeriodHours = 6
+
+// RecordAvailability 记录停车场当前车位数的采样，车位数与上一条采样相同时不记录。
+// 在修改可用车位数的同一事务中调用，使采样与车位数同时提交
+func RecordAvailability(tx *gorm.DB, lotID uint) error {
+	var lot models.ParkingLot
+	err := tx.Select("id", "organization_id", "total_spots", "available_spots").First(&lot, lotID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var last models.AvailabilitySample
+	err = tx.Where("parking_lot_id = ?", lotID).Order("sampled_at desc, id desc").First(&last).Error
+	if err == nil && last.TotalSpots == lot.TotalSpots && last.AvailableSpots == lot.AvailableSpots {
+		return nil
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	return tx.Create(&models.AvailabilitySample{
+		ParkingLotID:   lot.ID,
+		OrganizationID: lot.OrganizationID,
+		TotalSpots:     lot.TotalSpots,
+		AvailableSpots: lot.AvailableSpots,
+		SampledAt:      time.Now(),
+	}).Error
+}
+
+// AvailabilityRollupJob 车位统计汇总任务：由可用车位采样计算每小时饱和度、分时段占用率和各运营商总占用率。
+// 间隔由 AVAILABILITY_ROLLUP_INTERVAL_SECONDS 配置，默认 5 分钟；每次重新计算最近
+// AVAILABILITY_ROLLUP_LOOKBACK_SECONDS（默认 2 小时）所在时段的统计，
+// 并清理超过 AVAILABILITY_SAMPLE_RETENTION_SECONDS（默认 30 天）的采样
+func AvailabilityRollupJob() Job {
+	return Job{
+		Name:     "availability_rollup",
+		Interval: envDuration("AVAILABILITY_ROLLUP_INTERVAL_SECONDS", 5*time.Minute),
+		Run:      RollupAvailability,
+	}
+}
+
+// occupancyState 某时刻起生效的车位数
+type occupancyState struct {
+	at              time.Time
+	total, occupied int
+}
+
+// occupancyAverage 一段时间内按时长加权的平均车位数
+type occupancyAverage struct {
+	total, occupied float64
+}
+
+// rate 占用率（百分比）
+func (a occupancyAverage) rate() float64 {
+	if a.total <= 0 {
+		return 0
+	}
+	return math.Round(a.occupied/a.total*10000) / 100
+}
+
+// averageOccupancy 计算 [from, to) 内按时长加权的平均车位数，timeline 按时间升序；
+// 第一条状态之前的时间没有数据，不计入平均
+func averageOccupancy(timeline []occupancyState, from, to time.Time) (occupancyAverage, bool) {
+	var total, occupied, covered float64
+	for i, state := range timeline {
+		start := state.at
+		if start.Before(from) {
+			start = from
+		}
+		end := to
+		if i+1 < len(timeline) && timeline[i+1].at.Before(to) {
+			end = timeline[i+1].at
+		}
+		if !end.After(start) {
+			continue
+		}
+		weight := end.Sub(start).Seconds()
+		total += float64(state.total) * weight
+		occupied += float64(state.occupied) * weight
+		covered += weight
+	}
+	if covered == 0 {
+		return occupancyAverage{}, false
+	}
+	return occupancyAverage{total: total / covered, occupied: occupied / covered}, true
+}
+
+// RollupAvailability 重新计算最近时段的停车饱和度、分时段占用率和总占用率，可重复执行
+func RollupAvailability(ctx context.Context, now time.Time) error {
+	now = now.In(time.Local)
+	lookbackStart := now.Add(-envDuration("AVAILABILITY_ROLLUP_LOOKBACK_SECONDS", 2*time.Hour))
+	// 从回看起点所在时段的开始计算，保证分时段占用率覆盖整个时段
+	from := time.Date(lookbackStart.Year(), lookbackStart.Month(), lookbackStart.Day(),
+		lookbackStart.Hour()/occupancyPeriodHours*occupancyPeriodHours, 0, 0, 0, time.Local)
+
+	timelines, organizations, err := loadOccupancyTimelines(from, now)
+	if err != nil {
+		return err
+	}
+
+	// 每小时饱和度，同时按运营商汇总总占用率
+	for hour := from; hour.Before(now); hour = hour.Add(time.Hour) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		end := hour.Add(time.Hour)
+		if end.After(now) {
+			end = now
+		}
+
+		totals := make(map[uint]*occupancyAverage)
+		for lotID, timeline := range timelines {
+			avg, ok := averageOccupancy(timeline, hour, end)
+			if !ok {
+				continue
+			}
+			if err := saveSaturation(lotID, hour, avg); err != nil {
+				return err
+			}
+			orgID := organizations[lotID]
+			if totals[orgID] == nil {
+				totals[orgID] = &occupancyAverage{}
+			}
+			totals[orgID].total += avg.total
+			totals[orgID].occupied += avg.occupied
+		}
+		for orgID, avg := range totals {
+			if err := saveTotalOccupancy(orgID, hour, *avg); err != nil {
+				return err
+			}
+		}
+	}
+
+	// 分时段占用率
+	for period := from; period.Before(now); period = period.Add(occupancyPeriodHours * time.Hour) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		end := period.Add(occupancyPeriodHours * time.Hour)
+		label := fmt.Sprintf("%02d:00-%02d:00", period.Hour(), period.Hour()+occupancyPeriodHours)
+		if end.After(now) {
+			end = now
+		}
+		for lotID, timeline := range timelines {
+			avg, ok := averageOccupancy(timeline, period, end)
+			if !ok {
+				continue
+			}
+			if err := saveOccupancyRate(lotID, period, label, avg); err != nil {
+				return err
+			}
+		}
+	}
+
+	retention := envDuration("AVAILABILITY_SAMPLE_RETENTION_SECONDS", 30*24*time.Hour)
+	result := models.DB.Where("sampled_at < ?", now.Add(-retention)).Delete(&models.AvailabilitySample{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("availability: removed %d expired samples", result.RowsAffected)
+	}
+	return nil
+}
+
+// loadOccupancyTimelines 读取各停车场在 [from, to) 内的车位数变化，以及停车场所属运营商（未归属时为 0）。
+// from 之前的最后一条采样作为起始状态；从未采样的停车场按当前车位数视为不变
+func loadOccupancyTimelines(from, to time.Time) (map[uint][]occupancyState, map[uint]uint, error) {
+	var lots []models.ParkingLot
+	if err := models.DB.Select("id", "organization_id", "total_spots", "available_spots").
+		Where("is_active = ?", true).Find(&lots).Error; err != nil {
+		return nil, nil, err
+	}
+
+	var before []models.AvailabilitySample
+	latest := models.DB.Model(&models.AvailabilitySample{}).Select("MAX(id)").
+		Where("sampled_at < ?", from).Group("parking_lot_id")
+	if err := models.DB.Where("id IN (?)", latest).Find(&before).Error; err != nil {
+		return nil, nil, err
+	}
+	var samples []models.AvailabilitySample
+	if err := models.DB.Where("sampled_at >= ? AND sampled_at < ?", from, to).
+		Order("sampled_at, id").Find(&samples).Error; err != nil {
+		return nil, nil, err
+	}
+
+	timelines := make(map[uint][]occupancyState, len(lots))
+	organizations := make(map[uint]uint, len(lots))
+	for _, lot := range lots {
+		timelines[lot.ID] = nil
+		if lot.OrganizationID != nil {
+			organizations[lot.ID] = *lot.OrganizationID
+		}
+	}
+	stateOf := func(sample models.AvailabilitySample, at time.Time) occupancyState {
+		return occupancyState{at: at, total: sample.TotalSpots, occupied: sample.TotalSpots - sample.AvailableSpots}
+	}
+	for _, sample := range before {
+		if _, ok := timelines[sample.ParkingLotID]; ok {
+			timelines[sample.ParkingLotID] = append(timelines[sample.ParkingLotID], stateOf(sample, from))
+		}
+	}
+	for _, sample := range samples {
+		if _, ok := timelines[sample.ParkingLotID]; ok {
+			timelines[sample.ParkingLotID] = append(timelines[sample.ParkingLotID], stateOf(sample, sample.SampledAt))
+		}
+	}
+	for _, lot := range lots {
+		if len(timelines[lot.ID]) == 0 {
+			timelines[lot.ID] = []occupancyState{{at: from, total: lot.TotalSpots, occupied: lot.TotalSpots - lot.AvailableSpots}}
+		}
+	}
+	return timelines, organizations, nil
+}
+
+// saveSaturation 写入或更新停车场某小时的饱和度
+func saveSaturation(lotID uint, hour time.Time, avg occupancyAverage) error {
+	occupied := int(math.Round(avg.occupied))
+	total := int(math.Round(avg.total))
+	var row models.ParkingSaturation
+	err := models.DB.Where("parking_lot_id = ? AND timestamp = ?", lotID, hour).First(&row).Error
+	if err == nil {
+		return models.DB.Model(&row).Updates(map[string]interface{}{
+			"saturation_rate": avg.rate(),
+			"occupied_spots":  occupied,
+			"total_spots":     total,
+		}).Error
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	return models.DB.Create(&models.ParkingSaturation{
+		ParkingLotID:   lotID,
+		SaturationRate: avg.rate(),
+		OccupiedSpots:  occupied,
+		TotalSpots:     total,
+		Timestamp:      hour,
+		Hour:           hour.Hour(),
+	}).Error
+}
+
+// saveOccupancyRate 写入或更新停车场某时段的占用率
+func saveOccupancyRate(lotID uint, period time.Time, label string, avg occupancyAverage) error {
+	var row models.ParkingOccupancyRate
+	err := models.DB.Where("parking_lot_id = ? AND timestamp = ? AND period = ?", lotID, period, label).First(&row).Error
+	if err == nil {
+		return models.DB.Model(&row).Update("occupancy_rate", avg.rate()).Error
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	return models.DB.Create(&models.ParkingOccupancyRate{
+		ParkingLotID:  lotID,
+		OccupancyRate: avg.rate(),
+		Period:        label,
+		Timestamp:     period,
+	}).Error
+}
+
+// saveTotalOccupancy 写入或更新运营商某小时的总占用率，orgID 为 0 表示未归属运营商的停车场
+func saveTotalOccupancy(orgID uint, hour time.Time, avg occupancyAverage) error {
+	total := int(math.Round(avg.total))
+	occupied := int(math.Round(avg.occupied))
+	values := map[string]interface{}{
+		"total_spots":     total,
+		"occupied_spots":  occupied,
+		"available_spots": total - occupied,
+		"occupancy_rate":  avg.rate(),
+	}
+
+	query := models.DB.Where("timestamp = ? AND period = ?", hour, "hourly")
+	var organizationID *uint
+	if orgID != 0 {
+		organizationID = &orgID
+		query = query.Where("organization_id = ?", orgID)
+	} else {
+		query = query.Where("organization_id IS NULL")
+	}
+
+	var row models.TotalOccupancy
+	err := query.First(&row).Error
+	if err == nil {
+		return models.DB.Model(&row).Updates(values).Error
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	return models.DB.Create(&models.TotalOccupancy{
+		TotalSpots:     total,
+		OccupiedSpots:  occupied,
+		OccupancyRate:  avg.rate(),
+		AvailableSpots: total - occupied,
+		Timestamp:      hour,
+		Period:         "hourly",
+		OrganizationID: organizationID,
+	}).Error
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAverageOccupancy(t *testing.T) {
+	from := time.Date(2025, 1, 6, 10, 0, 0, 0, time.Local)
+	to := from.Add(time.Hour)
+	at := func(minutes int) time.Time {
+		return from.Add(time.Duration(minutes) * time.Minute)
+	}
+
+	tests := []struct {
+		name     string
+		timeline []occupancyState
+		wantOK   bool
+		want     occupancyAverage
+		wantRate float64
+	}{
+		{"没有采样", nil, false, occupancyAverage{}, 0},
+		{"只有时段之后的采样", []occupancyState{{at(60), 100, 50}}, false, occupancyAverage{}, 0},
+		{"时段之前的状态延续整个时段", []occupancyState{{at(-60), 100, 50}}, true, occupancyAverage{100, 50}, 50},
+		{
+			"时段之前多次变化取最后一次",
+			[]occupancyState{{at(-60), 100, 10}, {at(-30), 100, 30}},
+			true, occupancyAverage{100, 30}, 30,
+		},
+		{
+			"时段中间变化按时长加权",
+			[]occupancyState{{at(-60), 100, 40}, {at(30), 100, 80}},
+			true, occupancyAverage{100, 60}, 60,
+		},
+		{
+			"总车位数变化",
+			[]occupancyState{{at(0), 100, 50}, {at(30), 200, 50}},
+			true, occupancyAverage{150, 50}, 33.33,
+		},
+		{
+			"第一条采样之前不计入平均",
+			[]occupancyState{{at(15), 100, 20}},
+			true, occupancyAverage{100, 20}, 20,
+		},
+		{"总车位数为0", []occupancyState{{at(0), 0, 0}}, true, occupancyAverage{0, 0}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := averageOccupancy(tt.timeline, from, to)
+			if ok != tt.wantOK {
+				t.Fatalf("averageOccupancy() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if got != tt.want {
+				t.Errorf("averageOccupancy() = %+v, want %+v", got, tt.want)
+			}
+			if rate := got.rate(); rate != tt.wantRate {
+				t.Errorf("rate() = %v, want %v", rate, tt.wantRate)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"urban_traffic_backend/models"
+
+	"gorm.io/gorm"
+)
+
+// billingBatchSize 每批重新计费的会话数
+const billingBatchSize = 200
+
+// BillingJob 计费任务：周期性按收费标准刷新所有进行中会话的费用字段，
+// 间隔由 BILLING_INTERVAL_SECONDS 配置，默认 60 秒
+func BillingJob() Job {
+	return Job{
+		Name:     "billing",
+		Interval: envDuration("BILLING_INTERVAL_SECONDS", time.Minute),
+		Run:      RefreshActiveSessions,
+	}
+}
+
+// RefreshActiveSessions 重新计算所有进行中会话的 FeeCurrent、NextBillingTime、
+// NextFeeAmount 和 CurrentBillingCycle
+func RefreshActiveSessions(ctx context.Context, now time.Time) error {
+	var sessions []models.ParkingSession
+	var updated int
+
+	result := models.DB.Where("status = ?", "active").
+		FindInBatches(&sessions, billingBatchSize, func(tx *gorm.DB, batch int) error {
+			for i := range sessions {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+
+				session := &sessions[i]
+				quote, err := QuoteSession(models.DB, session, now)
+				if err != nil {
+					log.Printf("billing: quote session %d failed: %v", session.ID, err)
+					continue
+				}
+				ApplyQuote(session, quote)
+
+				// 只更新计费字段，且仅在会话仍为进行中时更新，避免覆盖同时发生的出场或支付
+				err = models.DB.Model(&models.ParkingSession{}).
+					Where("id = ? AND status = ?", session.ID, "active").
+					Updates(map[string]interface{}{
+						"tariff_id":             session.TariffID,
+						"fee_current":           session.FeeCurrent,
+						"next_billing_time":     session.NextBillingTime,
+						"next_fee_amount":       session.NextFeeAmount,
+						"current_billing_cycle": session.CurrentBillingCycle,
+						"pricing_rule":          session.PricingRule,
+					}).Error
+				if err != nil {
+					return err
+				}
+				updated++
+			}
+			return nil
+		})
+
+	if result.Error != nil && result.Error != context.Canceled {
+		return result.Error
+	}
+	if updated > 0 {
+		log.Printf("billing: refreshed %d active sessions", updated)
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package services
+
+import (
+	"errors"
+	"time"
+
+	"urban_traffic_backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrLotFull 停车场已无可用车位
+var ErrLotFull = errors.New("停车场已满")
+
+// ErrSpotTypeFull 该类型的特殊车位已满
+var ErrSpotTypeFull = errors.New("该类型车位已满")
+
+// HasSpotInventory 判断停车场是否登记了车位清单；
+// 有清单的停车场的可用车位数由车位状态派生，否则沿用计数方式
+func HasSpotInventory(db *gorm.DB, lotID uint) bool {
+	var count int64
+	db.Model(&models.ParkingSpot{}).Where("parking_lot_id = ?", lotID).Limit(1).Count(&count)
+	return count > 0
+}
+
+// OccupyCapacity 占用一个车位（必须在事务中调用）。
+// 有车位清单的停车场分配一个该类型的空闲车位并返回；否则扣减计数，返回的车位为 nil
+func OccupyCapacity(tx *gorm.DB, lotID uint, spotType string) (*models.ParkingSpot, error) {
+	return claimCapacity(tx, lotID, spotType, models.SpotStatusOccupied)
+}
+
+// ReserveCapacity 为预约预留一个车位，计入停车场占用（必须在事务中调用）
+func ReserveCapacity(tx *gorm.DB, lotID uint, spotType string) (*models.ParkingSpot, error) {
+	return claimCapacity(tx, lotID, spotType, models.SpotStatusReserved)
+}
+
+// OccupyReservedSpot 预约车辆到达，将预留车位转为占用；计数方式的停车场预约时已扣减，无需处理
+func OccupyReservedSpot(tx *gorm.DB, lotID uint, spotID *uint) error {
+	if spotID == nil {
+		return nil
+	}
+	err := tx.Model(&models.ParkingSpot{}).
+		Where("id = ? AND status = ?", *spotID, models.SpotStatusReserved).
+		Updates(map[string]interface{}{
+			"status":            models.SpotStatusOccupied,
+			"status_updated_at": time.Now(),
+		}).Error
+	if err != nil {
+		return err
+	}
+	return SyncLotAvailability(tx, lotID)
+}
+
+// ReleaseCapacity 释放车位：有分配车位时将其置为空闲。有车位清单的停车场可用数始终由车位状态派生，
+// 未分配车位的会话或预约（登记清单前创建、车牌识别开启的会话）只重新派生，不回补计数；
+// 没有车位清单的停车场回补计数
+func ReleaseCapacity(tx *gorm.DB, lotID uint, spotType string, spotID *uint) error {
+	if spotID != nil {
+		err := tx.Model(&models.ParkingSpot{}).
+			Where("id = ? AND status IN ?", *spotID, []string{models.SpotStatusOccupied, models.SpotStatusReserved}).
+			Updates(map[string]interface{}{
+				"status":            models.SpotStatusFree,
+				"status_updated_at": time.Now(),
+			}).Error
+		if err != nil {
+			return err
+		}
+		return SyncLotAvailability(tx, lotID)
+	}
+	if HasSpotInventory(tx, lotID) {
+		return SyncLotAvailability(tx, lotID)
+	}
+
+	result := tx.Model(&models.ParkingLot{}).
+		Where("id = ? AND available_spots < total_spots", lotID).
+		UpdateColumn("available_spots", gorm.Expr("available_spots + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		if err := RecordAvailability(tx, lotID); err != nil {
+			return err
+		}
+	}
+	if !isSpecialSpotType(spotType) {
+		return nil
+	}
+	return tx.Model(&models.SpecialSpot{}).
+		Where("parking_lot_id = ? AND spot_type = ? AND available_count < total_count", lotID, spotType).
+		UpdateColumn("available_count", gorm.Expr("available_count + 1")).Error
+}
+
+// SetSpotStatus 更新车位状态（传感器上报或管理员调整），并重新派生停车场可用数
+func SetSpotStatus(tx *gorm.DB, spot *models.ParkingSpot, status string) error {
+	spot.Status = status
+	spot.StatusUpdatedAt = time.Now()
+	err := tx.Model(spot).Updates(map[string]interface{}{
+		"status":            spot.Status,
+		"status_updated_at": spot.StatusUpdatedAt,
+	}).Error
+	if err != nil {
+		return err
+	}
+	return SyncLotAvailability(tx, spot.ParkingLotID)
+}
+
+// SyncLotAvailability 由车位清单重新计算停车场总车位、可用车位以及各类特殊车位数量
+func SyncLotAvailability(tx *gorm.DB, lotID uint) error {
+	var rows []struct {
+		SpotType string
+		Total    int
+		Free     int
+	}
+	err := tx.Model(&models.ParkingSpot{}).
+		Select("spot_type, COUNT(*) AS total, SUM(CASE WHEN status = ? THEN 1 ELSE 0 END) AS free", models.SpotStatusFree).
+		Where("parking_lot_id = ?", lotID).
+		Group("spot_type").
+		Scan(&rows).Error
+	if err != nil || len(rows) == 0 {
+		return err
+	}
+
+	var total, free int
+	for _, row := range rows {
+		total += row.Total
+		free += row.Free
+		if !isSpecialSpotType(row.SpotType) {
+			continue
+		}
+
+		// 特殊车位计数行不存在时创建，附加费保持管理员配置的值
+		spot := models.SpecialSpot{ParkingLotID: lotID, SpotType: row.SpotType}
+		if err := tx.Where(&spot).FirstOrCreate(&spot).Error; err != nil {
+			return err
+		}
+		err := tx.Model(&spot).UpdateColumns(map[string]interface{}{
+			"total_count":     row.Total,
+			"available_count": row.Free,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Model(&models.ParkingLot{}).Where("id = ?", lotID).UpdateColumns(map[string]interface{}{
+		"total_spots":     total,
+		"available_spots": free,
+	}).Error
+	if err != nil {
+		return err
+	}
+	return RecordAvailability(tx, lotID)
+}
+
+// claimCapacity 按目标状态（占用或预留）分配车位或扣减计数
+func claimCapacity(tx *gorm.DB, lotID uint, spotType, status string) (*models.ParkingSpot, error) {
+	if spotType == "" {
+		spotType = "normal"
+	}
+
+	if HasSpotInventory(tx, lotID) {
+		var spot models.ParkingSpot
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("parking_lot_id = ? AND spot_type = ? AND status = ?", lotID, spotType, models.SpotStatusFree).
+			Order("floor, zone, code").
+			First(&spot).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if isSpecialSpotType(spotType) {
+				return nil, ErrSpotTypeFull
+			}
+			return nil, ErrLotFull
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := SetSpotStatus(tx, &spot, status); err != nil {
+			return nil, err
+		}
+		return &spot, nil
+	}
+
+	result := tx.Model(&models.ParkingLot{}).
+		Where("id = ? AND available_spots > 0", lotID).
+		UpdateColumn("available_spots", gorm.Expr("available_spots - 1"))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrLotFull
+	}
+	if err := RecordAvailability(tx, lotID); err != nil {
+		return nil, err
+	}
+
+	if !isSpecialSpotType(spotType) {
+		return nil, nil
+	}
+	result = tx.Model(&models.SpecialSpot{}).
+		Where("parking_lot_id = ? AND spot_type = ? AND available_count > 0", lotID, spotType).
+		UpdateColumn("available_count", gorm.Expr("available_count - 1"))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrSpotTypeFull
+	}
+	return nil, nil
+}
+
+func isSpecialSpotType(spotType string) bool {
+	return spotType != "" && spotType != "normal"
+}
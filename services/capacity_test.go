@@ -0,0 +1,169 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package services
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"urban_traffic_backend/models"
+)
+
+// capacityScript 停车场的车位情况：inventory 为是否登记了车位清单，freeSpot 为清单中是否有空闲车位，
+// lotAffected 和 specialAffected 为计数方式下扣减或回补停车场、特殊车位计数影响的行数
+type capacityScript struct {
+	inventory, freeSpot          bool
+	lotAffected, specialAffected int64
+}
+
+func (c capacityScript) db() *scriptedDB {
+	s := &scriptedDB{affected: map[string]int64{
+		"available_spots - 1": c.lotAffected,
+		"available_spots + 1": c.lotAffected,
+		"available_count - 1": c.specialAffected,
+		"available_count + 1": c.specialAffected,
+	}}
+	if c.inventory {
+		s.queries = append(s.queries, scriptedQuery{
+			match:   "select count(*) from `parking_spots`",
+			columns: []string{"count(*)"},
+			rows:    [][]driver.Value{{int64(1)}},
+		})
+	}
+	if c.freeSpot {
+		s.queries = append(s.queries, scriptedQuery{
+			match:   "order by floor, zone, code",
+			columns: []string{"id", "parking_lot_id", "spot_type", "status"},
+			rows:    [][]driver.Value{{int64(7), int64(1), "normal", models.SpotStatusFree}},
+		})
+	}
+	return s
+}
+
+func TestClaimCapacity(t *testing.T) {
+	tests := []struct {
+		name       string
+		script     capacityScript
+		spotType   string
+		status     string
+		wantSpot   uint
+		wantErr    error
+		wantExec   []string
+		wantNoExec []string
+	}{
+		{
+			"计数方式扣减停车场计数",
+			capacityScript{lotAffected: 1},
+			"", models.SpotStatusOccupied, 0, nil,
+			[]string{"available_spots - 1"}, []string{"available_count - 1"},
+		},
+		{
+			"计数方式已满",
+			capacityScript{lotAffected: 0},
+			"normal", models.SpotStatusOccupied, 0, ErrLotFull,
+			nil, []string{"available_count - 1"},
+		},
+		{
+			"计数方式同时扣减特殊车位",
+			capacityScript{lotAffected: 1, specialAffected: 1},
+			"charging", models.SpotStatusReserved, 0, nil,
+			[]string{"available_spots - 1", "available_count - 1"}, nil,
+		},
+		{
+			"计数方式特殊车位已满",
+			capacityScript{lotAffected: 1, specialAffected: 0},
+			"charging", models.SpotStatusOccupied, 0, ErrSpotTypeFull,
+			[]string{"available_count - 1"}, nil,
+		},
+		{
+			"车位清单分配空闲车位",
+			capacityScript{inventory: true, freeSpot: true},
+			"normal", models.SpotStatusReserved, 7, nil,
+			[]string{"update `parking_spots` set"}, []string{"available_spots - 1"},
+		},
+		{
+			"车位清单没有空闲车位",
+			capacityScript{inventory: true},
+			"normal", models.SpotStatusOccupied, 0, ErrLotFull,
+			nil, []string{"update `parking_spots` set", "available_spots - 1"},
+		},
+		{
+			"车位清单没有空闲的特殊车位",
+			capacityScript{inventory: true},
+			"charging", models.SpotStatusOccupied, 0, ErrSpotTypeFull,
+			nil, []string{"update `parking_spots` set", "available_spots - 1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.script.db()
+			db := s.open(t)
+			spot, err := claimCapacity(db, 1, tt.spotType, tt.status)
+			if err != tt.wantErr {
+				t.Fatalf("claimCapacity() error = %v, want %v", err, tt.wantErr)
+			}
+			switch {
+			case tt.wantSpot == 0 && spot != nil:
+				t.Errorf("claimCapacity() spot = %+v, want nil", spot)
+			case tt.wantSpot != 0 && (spot == nil || spot.ID != tt.wantSpot || spot.Status != tt.status):
+				t.Errorf("claimCapacity() spot = %+v, want id %d with status %s", spot, tt.wantSpot, tt.status)
+			}
+			s.checkExecuted(t, tt.wantExec, tt.wantNoExec)
+		})
+	}
+}
+
+func TestReleaseCapacity(t *testing.T) {
+	spotID := uint(7)
+	tests := []struct {
+		name       string
+		script     capacityScript
+		spotType   string
+		spotID     *uint
+		wantExec   []string
+		wantNoExec []string
+	}{
+		{
+			"分配了车位时置为空闲",
+			capacityScript{inventory: true},
+			"normal", &spotID,
+			[]string{"update `parking_spots` set"}, []string{"available_spots + 1"},
+		},
+		{
+			"车位清单停车场未分配车位时不回补计数",
+			capacityScript{inventory: true},
+			"normal", nil,
+			nil, []string{"update `parking_spots` set", "available_spots + 1"},
+		},
+		{
+			"计数方式回补停车场计数",
+			capacityScript{lotAffected: 1},
+			"normal", nil,
+			[]string{"available_spots + 1"}, []string{"available_count + 1"},
+		},
+		{
+			"计数方式同时回补特殊车位",
+			capacityScript{lotAffected: 1, specialAffected: 1},
+			"charging", nil,
+			[]string{"available_spots + 1", "available_count + 1"}, nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.script.db()
+			db := s.open(t)
+			if err := ReleaseCapacity(db, 1, tt.spotType, tt.spotID); err != nil {
+				t.Fatal(err)
+			}
+			s.checkExecuted(t, tt.wantExec, tt.wantNoExec)
+		})
+	}
+}
@@ -0,0 +1,194 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"urban_traffic_backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 设备密钥格式为 "utd_" 加 64 位十六进制随机数
+const deviceKeyPrefix = "utd_"
+
+var (
+	// ErrInvalidDeviceKey 设备密钥无效、已吊销或宽限期已过
+	ErrInvalidDeviceKey = errors.New("无效的设备密钥")
+	// ErrCredentialSubject 凭证必须且只能绑定一台设备或一个摄像头
+	ErrCredentialSubject = errors.New("凭证必须绑定一台设备或一个摄像头")
+	// ErrCredentialRevoked 凭证已吊销，不能再轮换
+	ErrCredentialRevoked = errors.New("凭证已吊销")
+)
+
+// DeviceKeyRotationGrace 轮换后旧密钥的宽限期，由 DEVICE_KEY_ROTATION_GRACE_SECONDS 配置，默认 1 小时，
+// 给现场设备留出更新密钥的时间
+func DeviceKeyRotationGrace() time.Duration {
+	return envDuration("DEVICE_KEY_ROTATION_GRACE_SECONDS", time.Hour)
+}
+
+// deviceLastSeenInterval 最近使用时间的刷新间隔，避免设备每次上报都写凭证表
+const deviceLastSeenInterval = time.Minute
+
+// CreateDeviceCredential 为设备或摄像头签发凭证，返回的明文密钥只在签发时可见
+func CreateDeviceCredential(db *gorm.DB, name string, deviceID, cameraID *uint, global bool, createdBy uint) (*models.DeviceCredential, string, error) {
+	if (deviceID == nil) == (cameraID == nil) {
+		return nil, "", ErrCredentialSubject
+	}
+	if deviceID != nil {
+		if err := db.First(&models.Device{}, *deviceID).Error; err != nil {
+			return nil, "", err
+		}
+	} else if err := db.First(&models.MonitoringCamera{}, *cameraID).Error; err != nil {
+		return nil, "", err
+	}
+
+	key, err := newDeviceKey()
+	if err != nil {
+		return nil, "", err
+	}
+	credential := models.DeviceCredential{
+		Name:      truncate(strings.TrimSpace(name), 100),
+		DeviceID:  deviceID,
+		CameraID:  cameraID,
+		KeyPrefix: key[:12],
+		KeyHash:   hashToken(key),
+		CreatedBy: &createdBy,
+		Global:    global,
+		Status:    models.DeviceCredentialActive,
+	}
+	if err := db.Create(&credential).Error; err != nil {
+		return nil, "", err
+	}
+	return &credential, key, nil
+}
+
+// RotateDeviceCredential 为凭证生成新密钥，旧密钥在宽限期内仍然有效
+func RotateDeviceCredential(db *gorm.DB, id uint, now time.Time) (*models.DeviceCredential, string, error) {
+	var credential models.DeviceCredential
+	var key string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&credential, id).Error; err != nil {
+			return err
+		}
+		if credential.RevokedAt != nil {
+			return ErrCredentialRevoked
+		}
+
+		var err error
+		key, err = newDeviceKey()
+		if err != nil {
+			return err
+		}
+		graceUntil := now.Add(DeviceKeyRotationGrace())
+		credential.PreviousKeyHash = credential.KeyHash
+		credential.PreviousExpiresAt = &graceUntil
+		credential.KeyHash = hashToken(key)
+		credential.KeyPrefix = key[:12]
+		credential.RotatedAt = &now
+		return tx.Save(&credential).Error
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return &credential, key, nil
+}
+
+// RevokeDeviceCredential 吊销凭证，当前密钥和宽限期内的旧密钥立即失效
+func RevokeDeviceCredential(db *gorm.DB, id uint, now time.Time) (*models.DeviceCredential, error) {
+	var credential models.DeviceCredential
+	if err := db.First(&credential, id).Error; err != nil {
+		return nil, err
+	}
+	if credential.RevokedAt != nil {
+		return &credential, nil
+	}
+	credential.RevokedAt = &now
+	credential.Status = models.DeviceCredentialRevoked
+	credential.PreviousKeyHash = ""
+	credential.PreviousExpiresAt = nil
+	if err := db.Save(&credential).Error; err != nil {
+		return nil, err
+	}
+	return &credential, nil
+}
+
+// AuthenticateDevice 校验设备密钥并记录最近使用时间和来源IP
+func AuthenticateDevice(key, ip string, now time.Time) (*models.DeviceCredential, error) {
+	key = strings.TrimSpace(key)
+	if !strings.HasPrefix(key, deviceKeyPrefix) {
+		return nil, ErrInvalidDeviceKey
+	}
+	hash := hashToken(key)
+
+	var credential models.DeviceCredential
+	err := models.DB.
+		Where("revoked_at IS NULL AND (key_hash = ? OR (previous_key_hash = ? AND previous_expires_at > ?))", hash, hash, now).
+		First(&credential).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidDeviceKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if credential.LastSeenAt == nil || now.Sub(*credential.LastSeenAt) >= deviceLastSeenInterval || credential.LastSeenIP != ip {
+		credential.LastSeenAt = &now
+		credential.LastSeenIP = truncate(ip, 64)
+		models.DB.Model(&credential).UpdateColumns(map[string]interface{}{
+			"last_seen_at": now,
+			"last_seen_ip": credential.LastSeenIP,
+		})
+	}
+	return &credential, nil
+}
+
+// CredentialCanAccessLot 判断凭证能否上报停车场的数据：平台级凭证可上报任意停车场，
+// 其余凭证只能上报其设备或摄像头所属组织的停车场，未归属组织的凭证只能上报同样未归属组织的停车场
+func CredentialCanAccessLot(db *gorm.DB, credential *models.DeviceCredential, lot *models.ParkingLot) (bool, error) {
+	if credential.Global {
+		return true, nil
+	}
+	orgID, err := CredentialOrganization(db, credential)
+	if err != nil {
+		return false, err
+	}
+	if orgID == nil || lot.OrganizationID == nil {
+		return orgID == nil && lot.OrganizationID == nil, nil
+	}
+	return *orgID == *lot.OrganizationID, nil
+}
+
+// CredentialOrganization 凭证绑定的设备或摄像头所属组织，未归属任何组织时返回 nil
+func CredentialOrganization(db *gorm.DB, credential *models.DeviceCredential) (*uint, error) {
+	var orgIDs []*uint
+	var err error
+	switch {
+	case credential.DeviceID != nil:
+		err = db.Model(&models.Device{}).Where("id = ?", *credential.DeviceID).Pluck("organization_id", &orgIDs).Error
+	case credential.CameraID != nil:
+		err = db.Model(&models.MonitoringCamera{}).Where("id = ?", *credential.CameraID).Pluck("organization_id", &orgIDs).Error
+	}
+	if err != nil || len(orgIDs) == 0 {
+		return nil, err
+	}
+	return orgIDs[0], nil
+}
+
+func newDeviceKey() (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	return deviceKeyPrefix + token, nil
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package services
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"urban_traffic_backend/models"
+
+	"gorm.io/gorm"
+)
+
+// earthRadiusMeters 地球平均半径（米）
+const earthRadiusMeters = 6371000.0
+
+// maxGeohashCells 检索区域最多拆成多少个 geohash 单元格，超过时改用更短的前缀
+const maxGeohashCells = 24
+
+// ErrInvalidBoundingBox 矩形范围格式错误或超出经纬度范围
+var ErrInvalidBoundingBox = errors.New("bbox 格式须为 最小经度,最小纬度,最大经度,最大纬度")
+
+// BoundingBox 经纬度矩形范围
+type BoundingBox struct {
+	MinLat, MinLon, MaxLat, MaxLon float64
+}
+
+// ParseBoundingBox 解析 "最小经度,最小纬度,最大经度,最大纬度" 格式的矩形范围
+func ParseBoundingBox(value string) (BoundingBox, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return BoundingBox{}, ErrInvalidBoundingBox
+	}
+	var v [4]float64
+	for i, part := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return BoundingBox{}, ErrInvalidBoundingBox
+		}
+		v[i] = f
+	}
+	box := BoundingBox{MinLon: v[0], MinLat: v[1], MaxLon: v[2], MaxLat: v[3]}
+	if box.MinLat > box.MaxLat || box.MinLon > box.MaxLon ||
+		box.MinLat < -90 || box.MaxLat > 90 || box.MinLon < -180 || box.MaxLon > 180 {
+		return BoundingBox{}, ErrInvalidBoundingBox
+	}
+	return box, nil
+}
+
+// RadiusBoundingBox 以某点为中心、半径为 radiusM 米的圆的外接矩形
+func RadiusBoundingBox(lat, lon, radiusM float64) BoundingBox {
+	dLat := radiusM / earthRadiusMeters * 180 / math.Pi
+	dLon := 180.0
+	if cos := math.Cos(lat * math.Pi / 180); cos > 1e-6 {
+		dLon = math.Min(180, dLat/cos)
+	}
+	return BoundingBox{
+		MinLat: math.Max(-90, lat-dLat),
+		MaxLat: math.Min(90, lat+dLat),
+		MinLon: math.Max(-180, lon-dLon),
+		MaxLon: math.Min(180, lon+dLon),
+	}
+}
+
+// Contains 判断点是否在矩形范围内
+func (box BoundingBox) Contains(lat, lon float64) bool {
+	return lat >= box.MinLat && lat <= box.MaxLat && lon >= box.MinLon && lon <= box.MaxLon
+}
+
+// DiagonalMeters 矩形范围对角线的球面距离（米）
+func (box BoundingBox) DiagonalMeters() float64 {
+	return DistanceMeters(box.MinLat, box.MinLon, box.MaxLat, box.MaxLon)
+}
+
+// DistanceSQL 停车场到某点球面距离（米）的 SQL 表达式及其参数，计算方式与 DistanceMeters 相同
+func DistanceSQL(lat, lon float64) (string, []interface{}) {
+	return "(? * 2 * ASIN(SQRT(LEAST(1, POWER(SIN(RADIANS(parking_lots.latitude - ?) / 2), 2) + " +
+			"COS(RADIANS(?)) * COS(RADIANS(parking_lots.latitude)) * POWER(SIN(RADIANS(parking_lots.longitude - ?) / 2), 2)))))",
+		[]interface{}{earthRadiusMeters, lat, lat, lon}
+}
+
+// DistanceMeters 两点间的球面距离（米）
+func DistanceMeters(lat1, lon1, lat2, lon2 float64) float64 {
+	dLat := (lat2 - lat1) * math.Pi / 180
+	dLon := (lon2 - lon1) * math.Pi / 180
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return earthRadiusMeters * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// GeohashCover 覆盖矩形范围的 geohash 前缀。选取单元格数不超过 maxGeohashCells 的最长前缀，
+// 使数据库可以按 geohash 索引做少量范围扫描
+func GeohashCover(box BoundingBox) []string {
+	for precision := models.GeohashPrecision; precision >= 1; precision-- {
+		latHeight, lonWidth := models.GeohashCellSize(precision)
+		latFrom, latTo := math.Floor((box.MinLat+90)/latHeight), math.Floor((box.MaxLat+90)/latHeight)
+		lonFrom, lonTo := math.Floor((box.MinLon+180)/lonWidth), math.Floor((box.MaxLon+180)/lonWidth)
+		if (latTo-latFrom+1)*(lonTo-lonFrom+1) > maxGeohashCells {
+			continue
+		}
+
+		seen := map[string]bool{}
+		var cells []string
+		for i := latFrom; i <= latTo; i++ {
+			for j := lonFrom; j <= lonTo; j++ {
+				// 取单元格中心点编码，避免边界上的浮点误差
+				lat := math.Min(90, -90+(i+0.5)*latHeight)
+				lon := math.Min(180, -180+(j+0.5)*lonWidth)
+				cell := models.EncodeGeohash(lat, lon, precision)
+				if !seen[cell] {
+					seen[cell] = true
+					cells = append(cells, cell)
+				}
+			}
+		}
+		return cells
+	}
+	return nil
+}
+
+// GeoScope 按 geohash 前缀和经纬度范围筛选停车场，前缀条件命中 geohash 索引，经纬度条件做精确过滤
+func GeoScope(box BoundingBox) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		cells := GeohashCover(box)
+		if len(cells) > 0 {
+			conditions := make([]string, len(cells))
+			args := make([]interface{}, len(cells))
+			for i, cell := range cells {
+				conditions[i] = "geohash LIKE ?"
+				args[i] = cell + "%"
+			}
+			db = db.Where("("+strings.Join(conditions, " OR ")+")", args...)
+		}
+		return db.Where("latitude BETWEEN ? AND ? AND longitude BETWEEN ? AND ?",
+			box.MinLat, box.MaxLat, box.MinLon, box.MaxLon)
+	}
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"urban_traffic_backend/models"
+)
+
+func TestEncodeGeohash(t *testing.T) {
+	tests := []struct {
+		lat, lon  float64
+		precision int
+		want      string
+	}{
+		{57.64911, 10.40744, 11, "u4pruydqqvj"},
+		{0, 0, 5, "s0000"},
+		{-90, -180, 3, "000"},
+	}
+
+	for _, tt := range tests {
+		if got := models.EncodeGeohash(tt.lat, tt.lon, tt.precision); got != tt.want {
+			t.Errorf("EncodeGeohash(%v, %v, %d) = %q, want %q", tt.lat, tt.lon, tt.precision, got, tt.want)
+		}
+	}
+}
+
+// TestGeohashCover 前缀数量不超过上限，且范围内任意一点的 geohash 都以其中某个前缀开头；
+// 范围大到一位前缀也超过上限时不返回前缀，由经纬度条件筛选
+func TestGeohashCover(t *testing.T) {
+	tests := []struct {
+		name     string
+		box      BoundingBox
+		wantNone bool
+	}{
+		{"一公里半径", RadiusBoundingBox(30.2594, 120.1644, 1000), false},
+		{"最大检索半径", RadiusBoundingBox(30.2594, 120.1644, 50000), false},
+		{"跨越赤道和本初子午线", BoundingBox{MinLat: -0.01, MinLon: -0.01, MaxLat: 0.01, MaxLon: 0.01}, false},
+		{"单点", BoundingBox{MinLat: 30.25, MinLon: 120.16, MaxLat: 30.25, MaxLon: 120.16}, false},
+		{"全球", BoundingBox{MinLat: -90, MinLon: -180, MaxLat: 90, MaxLon: 180}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cover := GeohashCover(tt.box)
+			if tt.wantNone {
+				if cover != nil {
+					t.Fatalf("GeohashCover = %v, want nil", cover)
+				}
+				return
+			}
+			if len(cover) == 0 || len(cover) > maxGeohashCells {
+				t.Fatalf("GeohashCover returned %d prefixes, want 1..%d", len(cover), maxGeohashCells)
+			}
+
+			const steps = 20
+			for i := 0; i <= steps; i++ {
+				for j := 0; j <= steps; j++ {
+					lat := tt.box.MinLat + (tt.box.MaxLat-tt.box.MinLat)*float64(i)/steps
+					lon := tt.box.MinLon + (tt.box.MaxLon-tt.box.MinLon)*float64(j)/steps
+					hash := models.EncodeGeohash(lat, lon, models.GeohashPrecision)
+					covered := false
+					for _, prefix := range cover {
+						covered = covered || strings.HasPrefix(hash, prefix)
+					}
+					if !covered {
+						t.Fatalf("point (%v, %v) geohash %s not covered by %v", lat, lon, hash, cover)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestParseBoundingBox(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    BoundingBox
+		wantErr bool
+	}{
+		{"120.1,30.2,120.2,30.3", BoundingBox{MinLon: 120.1, MinLat: 30.2, MaxLon: 120.2, MaxLat: 30.3}, false},
+		{" 120.1, 30.2 ,120.2,30.3 ", BoundingBox{MinLon: 120.1, MinLat: 30.2, MaxLon: 120.2, MaxLat: 30.3}, false},
+		{"120.1,30.2,120.2", BoundingBox{}, true},
+		{"120.2,30.2,120.1,30.3", BoundingBox{}, true},
+		{"120.1,30.2,120.2,91", BoundingBox{}, true},
+		{"a,30.2,120.2,30.3", BoundingBox{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseBoundingBox(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseBoundingBox(%q) = %+v, %v; want %+v, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"urban_traffic_backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrInvoiceNotAllowed 会话尚未结束，不能开具收据
+var ErrInvoiceNotAllowed = errors.New("停车会话尚未结束，不能开具收据")
+
+// InvoiceBackfillJob 收据补开任务：为已支付但未开具收据的停车会话补开收据（支付时开具失败的情况），
+// 间隔由 INVOICE_BACKFILL_INTERVAL_SECONDS 配置，默认 10 分钟
+func InvoiceBackfillJob() Job {
+	return Job{
+		Name:     "invoice_backfill",
+		Interval: envDuration("INVOICE_BACKFILL_INTERVAL_SECONDS", 10*time.Minute),
+		Run:      BackfillInvoices,
+	}
+}
+
+// BackfillInvoices 为已支付但未开具收据的停车会话补开收据，单个会话失败不影响其余会话
+func BackfillInvoices(ctx context.Context, now time.Time) error {
+	var missing []uint
+	err := models.DB.Model(&models.ParkingSession{}).
+		Where("status = ? AND end_time < ?", "paid", now).
+		Where("NOT EXISTS (SELECT 1 FROM invoices WHERE invoices.session_id = parking_sessions.id)").
+		Pluck("id", &missing).Error
+	if err != nil {
+		return err
+	}
+
+	var issued int
+	for _, sessionID := range missing {
+		if ctx.Err() != nil {
+			return nil
+		}
+		err := models.DB.Transaction(func(tx *gorm.DB) error {
+			_, err := IssueSessionInvoice(tx, sessionID)
+			return err
+		})
+		if err != nil {
+			log.Printf("invoice: issue invoice for session %d failed: %v", sessionID, err)
+			continue
+		}
+		issued++
+	}
+
+	if issued > 0 {
+		log.Printf("invoice: issued %d missing invoices", issued)
+	}
+	return nil
+}
+
+// IssueSessionInvoice 为已结束或已支付的停车会话开具收据并返回。
+// 已开具过时不重新编号，只刷新支付信息（先开具后支付的情况）
+func IssueSessionInvoice(tx *gorm.DB, sessionID uint) (*models.Invoice, error) {
+	var session models.ParkingSession
+	if err := tx.Preload("ParkingLot").First(&session, sessionID).Error; err != nil {
+		return nil, err
+	}
+	if (session.Status != "ended" && session.Status != "paid") || session.EndTime == nil {
+		return nil, ErrInvoiceNotAllowed
+	}
+
+	paymentStatus, method, orderNo, err := sessionPayment(tx, &session)
+	if err != nil {
+		return nil, err
+	}
+
+	var existing models.Invoice
+	err = tx.Preload("Items").Where("session_id = ?", session.ID).First(&existing).Error
+	if err == nil {
+		if existing.PaymentStatus != paymentStatus || existing.PaymentOrderNo != orderNo {
+			existing.PaymentStatus = paymentStatus
+			existing.PaymentMethod = method
+			existing.PaymentOrderNo = orderNo
+			err := tx.Model(&existing).Updates(map[string]interface{}{
+				"payment_status":   paymentStatus,
+				"payment_method":   method,
+				"payment_order_no": orderNo,
+			}).Error
+			if err != nil {
+				return nil, err
+			}
+		}
+		return &existing, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	// 按结算时保存的明细开具，升级前结算的会话没有明细，按结算金额单项列示
+	var feeItems []models.SessionFeeItem
+	if err := tx.Where("session_id = ?", session.ID).Order("id").Find(&feeItems).Error; err != nil {
+		return nil, err
+	}
+	total := roundMoney(session.FeeCurrent)
+	if len(feeItems) == 0 && total > 0 {
+		feeItems = []models.SessionFeeItem{{Name: "停车费", Quantity: 1, UnitPrice: total, Amount: total}}
+	}
+
+	invoice := models.Invoice{
+		SessionID:       &session.ID,
+		UserID:          session.UserID,
+		ParkingLotID:    &session.ParkingLotID,
+		ParkingLotName:  session.ParkingLot.Name,
+		ParkingLotAddr:  session.ParkingLot.Address,
+		PlateNumber:     session.PlateNumber,
+		SpotType:        session.SpotType,
+		SpotCode:        session.SpotCode,
+		StartTime:       session.StartTime,
+		EndTime:         *session.EndTime,
+		DurationMinutes: int(session.EndTime.Sub(session.StartTime).Minutes()),
+		TariffRule:      truncate(session.PricingRule, 200),
+		Surcharge:       roundMoney(session.FeeSurcharge),
+		Total:           total,
+		PaymentStatus:   paymentStatus,
+		PaymentMethod:   method,
+		PaymentOrderNo:  orderNo,
+	}
+	var itemsTotal float64
+	for _, item := range feeItems {
+		itemsTotal += item.Amount
+		invoice.Items = append(invoice.Items, models.InvoiceItem{
+			Name:      item.Name,
+			Quantity:  item.Quantity,
+			UnitPrice: item.UnitPrice,
+			Amount:    item.Amount,
+		})
+	}
+	invoice.Subtotal = roundMoney(itemsTotal - invoice.Surcharge)
+
+	if err := createInvoice(tx, &invoice); err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+// IssueRecordInvoice 为没有会话明细的历史停车记录开具收据，费用按记录金额单项列示。
+// 由会话结算生成的记录按会话开具，与会话共用同一张收据
+func IssueRecordInvoice(tx *gorm.DB, recordID uint) (*models.Invoice, error) {
+	var record models.ParkingRecord
+	// 车辆删除后停车记录仍可开具收据
+	err := tx.Preload("Vehicle", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Preload("ParkingLot").First(&record, recordID).Error
+	if err != nil {
+		return nil, err
+	}
+	if record.SessionID != nil {
+		return IssueSessionInvoice(tx, *record.SessionID)
+	}
+
+	var existing models.Invoice
+	err = tx.Preload("Items").Where("parking_record_id = ?", recordID).First(&existing).Error
+	if err == nil {
+		return &existing, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	start, _ := time.ParseInLocation("2006-01-02 15:04:05", record.StartTime, time.Local)
+	end, err := time.ParseInLocation("2006-01-02 15:04:05", record.EndTime, time.Local)
+	if err != nil {
+		return nil, ErrInvoiceNotAllowed
+	}
+
+	invoice := models.Invoice{
+		ParkingRecordID: &record.ID,
+		UserID:          &record.Vehicle.UserID,
+		ParkingLotID:    record.ParkingLotID,
+		ParkingLotName:  record.Location,
+		PlateNumber:     models.NormalizePlate(record.Vehicle.PlateNumber),
+		SpotType:        record.SpotType,
+		StartTime:       start,
+		EndTime:         end,
+		DurationMinutes: int(record.Duration * 60),
+		Subtotal:        roundMoney(record.Fee),
+		Total:           roundMoney(record.Fee),
+		// 没有会话的历史记录关联不到支付订单，无法确认已支付
+		PaymentStatus: "unpaid",
+		Items: []models.InvoiceItem{
+			{Name: "停车费", Quantity: 1, UnitPrice: roundMoney(record.Fee), Amount: roundMoney(record.Fee)},
+		},
+	}
+	if record.ParkingLotID != nil {
+		invoice.ParkingLotName = record.ParkingLot.Name
+		invoice.ParkingLotAddr = record.ParkingLot.Address
+	}
+
+	if err := createInvoice(tx, &invoice); err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+// createInvoice 分配收据编号并保存收据及明细
+func createInvoice(tx *gorm.DB, invoice *models.Invoice) error {
+	now := time.Now()
+	invoiceNo, err := nextInvoiceNo(tx, now)
+	if err != nil {
+		return err
+	}
+	invoice.InvoiceNo = invoiceNo
+	invoice.IssuedAt = now
+	return tx.Create(invoice).Error
+}
+
+// nextInvoiceNo 按月取下一个收据编号，格式 INV + 年月 + 6 位序号，序列行加锁保证并发下不重号
+func nextInvoiceNo(tx *gorm.DB, now time.Time) (string, error) {
+	period := now.Format("200601")
+	seq := models.InvoiceSequence{Period: period}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&seq).Error; err != nil {
+		return "", err
+	}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&seq, "period = ?", period).Error; err != nil {
+		return "", err
+	}
+	seq.LastNo++
+	if err := tx.Model(&seq).Update("last_no", seq.LastNo).Error; err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("INV%s%06d", period, seq.LastNo), nil
+}
+
+// sessionPayment 查询会话的支付状态、支付方式和订单号
+func sessionPayment(tx *gorm.DB, session *models.ParkingSession) (string, string, string, error) {
+	if session.Status != "paid" {
+		return "unpaid", "", "", nil
+	}
+
+	var order models.PaymentOrder
+	err := tx.Where("session_id = ? AND purpose = ? AND status <> ? AND status <> ?",
+		session.ID, models.PaymentPurposeParking, models.PaymentStatusPending, models.PaymentStatusFailed).
+		Order("id desc").
+		First(&order).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "paid", "", "", nil
+	}
+	if err != nil {
+		return "", "", "", err
+	}
+	return "paid", order.Method, order.OrderNo, nil
+}
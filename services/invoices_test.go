@@ -0,0 +1,170 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package services
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"testing"
+	"time"
+
+	"urban_traffic_backend/models"
+)
+
+func sequenceQuery(period string, lastNo int) scriptedQuery {
+	return scriptedQuery{
+		match:   "from `invoice_sequences`",
+		columns: []string{"period", "last_no"},
+		rows:    [][]driver.Value{{period, int64(lastNo)}},
+	}
+}
+
+// TestNextInvoiceNo 收据编号按月从 1 开始递增，格式 INV + 年月 + 6 位序号
+func TestNextInvoiceNo(t *testing.T) {
+	tests := []struct {
+		name   string
+		now    time.Time
+		lastNo int
+		want   string
+	}{
+		{"当月第一张", time.Date(2025, 1, 1, 0, 0, 0, 0, time.Local), 0, "INV202501000001"},
+		{"当月已有编号", time.Date(2025, 1, 31, 23, 59, 0, 0, time.Local), 41, "INV202501000042"},
+		{"十二月", time.Date(2024, 12, 15, 8, 0, 0, 0, time.Local), 999, "INV202412001000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			period := tt.now.Format("200601")
+			s := &scriptedDB{queries: []scriptedQuery{sequenceQuery(period, tt.lastNo)}}
+			db := s.open(t)
+
+			got, err := nextInvoiceNo(db, tt.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("nextInvoiceNo() = %q, want %q", got, tt.want)
+			}
+			// 序列行不存在时先创建，取号前加锁，取号后保存新的序号
+			s.checkExecuted(t, []string{
+				"insert into `invoice_sequences`",
+				fmt.Sprintf("update `invoice_sequences` set `last_no`=? where `period` = ? [%d] [%s]", tt.lastNo+1, period),
+			}, nil)
+			if !s.queried("from `invoice_sequences`", "for update") {
+				t.Errorf("sequence row not locked, log %v", s.log)
+			}
+		})
+	}
+}
+
+func TestIssueSessionInvoice(t *testing.T) {
+	start := time.Date(2025, 1, 6, 8, 0, 0, 0, time.Local)
+	end := start.Add(150 * time.Minute)
+	sessionColumns := []string{"id", "parking_lot_id", "plate_number", "start_time", "end_time", "status", "fee_current", "fee_surcharge", "pricing_rule"}
+	session := func(status string, endTime interface{}, fee, surcharge float64) scriptedQuery {
+		return scriptedQuery{match: "from `parking_sessions`", columns: sessionColumns,
+			rows: [][]driver.Value{{int64(3), int64(1), "京A12345", start, endTime, status, fee, surcharge, "首小时10元"}}}
+	}
+	feeItems := scriptedQuery{match: "from `session_fee_items`", columns: []string{"id", "session_id", "name", "quantity", "unit_price", "amount"},
+		rows: [][]driver.Value{
+			{int64(1), int64(3), "首段费用", int64(1), 10.0, 10.0},
+			{int64(2), int64(3), "超时费用", int64(2), 5.0, 10.0},
+			{int64(3), int64(3), "充电车位附加费", int64(1), 3.0, 3.0},
+		}}
+	existing := scriptedQuery{match: "from `invoices`", columns: []string{"id", "invoice_no", "session_id", "payment_status", "total"},
+		rows: [][]driver.Value{{int64(8), "INV202501000007", int64(3), "unpaid", 23.0}}}
+	paidOrder := scriptedQuery{match: "from `payment_orders`", columns: []string{"id", "order_no", "method", "status"},
+		rows: [][]driver.Value{{int64(9), "PO1", "微信", models.PaymentStatusPaid}}}
+
+	tests := []struct {
+		name         string
+		queries      []scriptedQuery
+		wantErr      error
+		wantNo       string // 为空表示新编号
+		wantItems    []string
+		wantSubtotal float64
+		wantTotal    float64
+		wantPayment  string
+		wantOrderNo  string
+	}{
+		{
+			"会话未结束", []scriptedQuery{session("active", nil, 0, 0)}, ErrInvoiceNotAllowed,
+			"", nil, 0, 0, "", "",
+		},
+		{
+			"按结算明细开具", []scriptedQuery{session("ended", end, 23, 3), feeItems}, nil,
+			"", []string{"首段费用", "超时费用", "充电车位附加费"}, 20, 23, "unpaid", "",
+		},
+		{
+			"没有明细时按结算金额单项列示", []scriptedQuery{session("ended", end, 15, 0)}, nil,
+			"", []string{"停车费"}, 15, 15, "unpaid", "",
+		},
+		{
+			"已支付取订单信息", []scriptedQuery{session("paid", end, 23, 3), feeItems, paidOrder}, nil,
+			"", []string{"首段费用", "超时费用", "充电车位附加费"}, 20, 23, "paid", "PO1",
+		},
+		{
+			"已开具的收据不重新编号", []scriptedQuery{session("paid", end, 23, 3), existing, paidOrder}, nil,
+			"INV202501000007", nil, 0, 23, "paid", "PO1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queries := append([]scriptedQuery{
+				{match: "from `parking_lots`", columns: []string{"id", "name"}, rows: [][]driver.Value{{int64(1), "测试停车场"}}},
+				sequenceQuery(time.Now().Format("200601"), 41),
+			}, tt.queries...)
+			s := &scriptedDB{queries: queries}
+			db := s.open(t)
+
+			invoice, err := IssueSessionInvoice(db, 3)
+			if err != tt.wantErr {
+				t.Fatalf("IssueSessionInvoice() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				s.checkExecuted(t, nil, []string{"insert into `invoices`"})
+				return
+			}
+
+			if tt.wantNo == "" {
+				if want := "INV" + time.Now().Format("200601") + "000042"; invoice.InvoiceNo != want {
+					t.Errorf("InvoiceNo = %q, want %q", invoice.InvoiceNo, want)
+				}
+				s.checkExecuted(t, []string{"insert into `invoices`", "update `invoice_sequences`"}, nil)
+			} else {
+				if invoice.InvoiceNo != tt.wantNo {
+					t.Errorf("InvoiceNo = %q, want %q", invoice.InvoiceNo, tt.wantNo)
+				}
+				s.checkExecuted(t, nil, []string{"insert into `invoices`", "update `invoice_sequences`"})
+			}
+			if tt.wantItems != nil {
+				var names []string
+				for _, item := range invoice.Items {
+					names = append(names, item.Name)
+				}
+				if fmt.Sprint(names) != fmt.Sprint(tt.wantItems) {
+					t.Errorf("Items = %v, want %v", names, tt.wantItems)
+				}
+				if invoice.Subtotal != tt.wantSubtotal {
+					t.Errorf("Subtotal = %v, want %v", invoice.Subtotal, tt.wantSubtotal)
+				}
+				if invoice.DurationMinutes != 150 {
+					t.Errorf("DurationMinutes = %d, want 150", invoice.DurationMinutes)
+				}
+			}
+			if invoice.Total != tt.wantTotal {
+				t.Errorf("Total = %v, want %v", invoice.Total, tt.wantTotal)
+			}
+			if invoice.PaymentStatus != tt.wantPayment || invoice.PaymentOrderNo != tt.wantOrderNo {
+				t.Errorf("payment = %s/%s, want %s/%s", invoice.PaymentStatus, invoice.PaymentOrderNo, tt.wantPayment, tt.wantOrderNo)
+			}
+		})
+	}
+}
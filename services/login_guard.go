@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package services
+
+import (
+	"time"
+
+	"urban_traffic_backend/models"
+
+	"gorm.io/gorm"
+)
+
+// LoginMaxFailures 连续登录失败多少次后锁定账号，由 LOGIN_MAX_FAILURES 配置，默认 5 次
+func LoginMaxFailures() int {
+	return int(envFloat("LOGIN_MAX_FAILURES", 5))
+}
+
+// LoginLockoutBase 首次锁定时长，之后每多失败一次翻倍，由 LOGIN_LOCKOUT_SECONDS 配置，默认 1 分钟
+func LoginLockoutBase() time.Duration {
+	return envDuration("LOGIN_LOCKOUT_SECONDS", time.Minute)
+}
+
+// LoginLockoutMax 锁定时长上限，由 LOGIN_LOCKOUT_MAX_SECONDS 配置，默认 1 小时
+func LoginLockoutMax() time.Duration {
+	return envDuration("LOGIN_LOCKOUT_MAX_SECONDS", time.Hour)
+}
+
+// LoginLockRemaining 账号剩余锁定时长，未锁定时返回 0
+func LoginLockRemaining(user *models.User, now time.Time) time.Duration {
+	if user.LockedUntil == nil || !user.LockedUntil.After(now) {
+		return 0
+	}
+	return user.LockedUntil.Sub(now)
+}
+
+// RecordLoginFailure 记录一次密码错误。失败次数达到上限后锁定账号，
+// 锁定时长从 LoginLockoutBase 开始按失败次数指数退避，返回本次锁定时长（未锁定为 0）
+func RecordLoginFailure(db *gorm.DB, user *models.User, now time.Time) (time.Duration, error) {
+	var lockFor time.Duration
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// 并发的失败尝试各自累加，以数据库中的计数为准
+		if err := tx.Model(user).UpdateColumn("failed_logins", gorm.Expr("failed_logins + 1")).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(user).Select("failed_logins").First(user).Error; err != nil {
+			return err
+		}
+
+		excess := user.FailedLogins - LoginMaxFailures()
+		if excess < 0 {
+			return nil
+		}
+		lockFor = LoginLockoutBase()
+		for i := 0; i < excess && lockFor < LoginLockoutMax(); i++ {
+			lockFor *= 2
+		}
+		if lockFor > LoginLockoutMax() {
+			lockFor = LoginLockoutMax()
+		}
+		lockedUntil := now.Add(lockFor)
+		user.LockedUntil = &lockedUntil
+		return tx.Model(user).UpdateColumn("locked_until", lockedUntil).Error
+	})
+	return lockFor, err
+}
+
+// RecordLoginSuccess 登录成功后清零失败次数并解除锁定
+func RecordLoginSuccess(db *gorm.DB, user *models.User) error {
+	if user.FailedLogins == 0 && user.LockedUntil == nil {
+		return nil
+	}
+	user.FailedLogins = 0
+	user.LockedUntil = nil
+	return db.Model(user).UpdateColumns(map[string]interface{}{
+		"failed_logins": 0,
+		"locked_until":  nil,
+	}).Error
+}
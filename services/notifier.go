@@ -0,0 +1,63 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package services
+
+import (
+	"errors"
+	"log"
+	"os"
+)
+
+// Notifier 用户通知渠道（邮件、短信等），密码重置令牌等通过通知渠道发送给用户
+type Notifier interface {
+	// Name 渠道名称，与 NOTIFIER 配置对应
+	Name() string
+	// Send 向收件人发送通知
+	Send(to, subject, body string) error
+}
+
+// notifiers 已注册的通知渠道
+var notifiers = map[string]Notifier{}
+
+func init() {
+	RegisterNotifier(consoleNotifier{})
+}
+
+// RegisterNotifier 注册通知渠道，同名渠道会被覆盖
+func RegisterNotifier(notifier Notifier) {
+	notifiers[notifier.Name()] = notifier
+}
+
+// ErrNotifierNotConfigured 未配置通知渠道，无法发送重置令牌等通知
+var ErrNotifierNotConfigured = errors.New("未配置通知渠道")
+
+// activeNotifier 当前使用的通知渠道，由 NOTIFIER 配置；未配置时返回 ErrNotifierNotConfigured，
+// 不会退回到控制台输出
+func activeNotifier() (Notifier, error) {
+	name := os.Getenv("NOTIFIER")
+	if name == "" {
+		return nil, ErrNotifierNotConfigured
+	}
+	notifier, ok := notifiers[name]
+	if !ok {
+		return nil, errors.New("未配置的通知渠道: " + name)
+	}
+	return notifier, nil
+}
+
+// consoleNotifier 开发环境使用的通知渠道，需显式配置 NOTIFIER=console。
+// 通知正文可能包含重置令牌等凭据，只记录收件人和标题，不输出正文
+type consoleNotifier struct{}
+
+func (consoleNotifier) Name() string { return "console" }
+
+func (consoleNotifier) Send(to, subject, body string) error {
+	log.Printf("notify %s: [%s] (%d bytes body omitted)", to, subject, len(body))
+	return nil
+}
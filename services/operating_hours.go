@@ -0,0 +1,281 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package services
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"urban_traffic_backend/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrLotClosed 停车场在该时间不营业
+	ErrLotClosed = errors.New("停车场该时段不营业")
+	// ErrInvalidHours 营业时段不合法
+	ErrInvalidHours = errors.New("营业时段须为 HH:MM，开门和关门时间不能相同")
+	// ErrInvalidWeekday 星期不合法
+	ErrInvalidWeekday = errors.New("星期须为 0-6（0 表示周日）")
+	// ErrInvalidHolidayDate 节假日日期不合法
+	ErrInvalidHolidayDate = errors.New("日期格式须为 2006-01-02")
+	// ErrInvalidClosure 临时关闭时段不合法
+	ErrInvalidClosure = errors.New("临时关闭的结束时间须晚于开始时间")
+)
+
+// LotSchedule 停车场的营业安排：每周时段、节假日和临时关闭
+type LotSchedule struct {
+	OperatingHours string                     `json:"operating_hours"` // 没有每周时段时沿用的营业时间文本
+	Weekly         []models.ParkingLotHours   `json:"weekly"`
+	Holidays       []models.ParkingLotHoliday `json:"holidays"`
+	Closures       []models.ParkingLotClosure `json:"closures"`
+}
+
+// clockMinutes 解析 HH:MM 为当天的分钟数，允许 24:00
+func clockMinutes(value string) (int, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 || len(parts[0]) != 2 || len(parts[1]) != 2 {
+		return 0, ErrInvalidHours
+	}
+	h, err1 := strconv.Atoi(parts[0])
+	m, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil || h < 0 || h > 24 || m < 0 || m > 59 || h == 24 && m != 0 {
+		return 0, ErrInvalidHours
+	}
+	return h*60 + m, nil
+}
+
+// ValidateHoursRange 校验营业时段，关门时间早于开门时间表示跨夜
+func ValidateHoursRange(openTime, closeTime string) error {
+	open, err := clockMinutes(openTime)
+	if err != nil || open == 24*60 {
+		return ErrInvalidHours
+	}
+	closing, err := clockMinutes(closeTime)
+	if err != nil || open == closing {
+		return ErrInvalidHours
+	}
+	return nil
+}
+
+// dayInterval 某天的营业时段，结束时间可能在次日
+type dayInterval struct {
+	start, end time.Time
+}
+
+// intervalOn 把 HH:MM-HH:MM 时段落到某一天上，跨夜时段的结束时间在次日
+func intervalOn(day time.Time, openTime, closeTime string) (dayInterval, bool) {
+	open, err := clockMinutes(openTime)
+	if err != nil {
+		return dayInterval{}, false
+	}
+	closing, err := clockMinutes(closeTime)
+	if err != nil || open == closing {
+		return dayInterval{}, false
+	}
+	if closing < open {
+		closing += 24 * 60
+	}
+	return dayInterval{
+		start: day.Add(time.Duration(open) * time.Minute),
+		end:   day.Add(time.Duration(closing) * time.Minute),
+	}, true
+}
+
+// intervals 停车场在某天（当地零点）开始的营业时段
+func (s *LotSchedule) intervals(day time.Time) []dayInterval {
+	date := day.Format("2006-01-02")
+	for _, holiday := range s.Holidays {
+		if holiday.Date != date {
+			continue
+		}
+		if holiday.Closed {
+			return nil
+		}
+		if interval, ok := intervalOn(day, holiday.OpenTime, holiday.CloseTime); ok {
+			return []dayInterval{interval}
+		}
+		return nil
+	}
+
+	if len(s.Weekly) == 0 {
+		hours := strings.TrimSpace(s.OperatingHours)
+		if hours == "" || hours == "24小时" {
+			return []dayInterval{{start: day, end: day.AddDate(0, 0, 1)}}
+		}
+		parts := strings.Split(hours, "-")
+		if len(parts) == 2 {
+			if interval, ok := intervalOn(day, parts[0], parts[1]); ok {
+				return []dayInterval{interval}
+			}
+		}
+		// 无法识别的旧营业时间文本视为全天营业
+		return []dayInterval{{start: day, end: day.AddDate(0, 0, 1)}}
+	}
+
+	var result []dayInterval
+	weekday := int(day.Weekday())
+	for _, entry := range s.Weekly {
+		if entry.Weekday != weekday {
+			continue
+		}
+		if interval, ok := intervalOn(day, entry.OpenTime, entry.CloseTime); ok {
+			result = append(result, interval)
+		}
+	}
+	return result
+}
+
+// IsOpen 停车场在某时刻是否营业：不在临时关闭时段内，且落在当天或前一天（跨夜）的营业时段内
+func (s *LotSchedule) IsOpen(t time.Time) bool {
+	for _, closure := range s.Closures {
+		if !t.Before(closure.StartAt) && t.Before(closure.EndAt) {
+			return false
+		}
+	}
+
+	// 营业时段按服务器本地时间解释
+	t = t.In(time.Local)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+	for _, d := range []time.Time{day, day.AddDate(0, 0, -1)} {
+		for _, interval := range s.intervals(d) {
+			if !t.Before(interval.start) && t.Before(interval.end) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// LoadLotSchedules 批量读取停车场的营业安排，只读取 from 之后仍有效的节假日和临时关闭
+func LoadLotSchedules(db *gorm.DB, lots []models.ParkingLot, from time.Time) (map[uint]*LotSchedule, error) {
+	schedules := make(map[uint]*LotSchedule, len(lots))
+	if len(lots) == 0 {
+		return schedules, nil
+	}
+	ids := make([]uint, 0, len(lots))
+	for _, lot := range lots {
+		ids = append(ids, lot.ID)
+		schedules[lot.ID] = &LotSchedule{
+			OperatingHours: lot.OperatingHours,
+			Weekly:         []models.ParkingLotHours{},
+			Holidays:       []models.ParkingLotHoliday{},
+			Closures:       []models.ParkingLotClosure{},
+		}
+	}
+
+	var weekly []models.ParkingLotHours
+	if err := db.Where("parking_lot_id IN ?", ids).Order("weekday, open_time").Find(&weekly).Error; err != nil {
+		return nil, err
+	}
+	for _, entry := range weekly {
+		schedules[entry.ParkingLotID].Weekly = append(schedules[entry.ParkingLotID].Weekly, entry)
+	}
+
+	// 前一天的跨夜时段可能延续到 from 当天
+	since := from.AddDate(0, 0, -1).Format("2006-01-02")
+	var holidays []models.ParkingLotHoliday
+	if err := db.Where("parking_lot_id IN ? AND date >= ?", ids, since).Order("date").Find(&holidays).Error; err != nil {
+		return nil, err
+	}
+	for _, holiday := range holidays {
+		schedules[holiday.ParkingLotID].Holidays = append(schedules[holiday.ParkingLotID].Holidays, holiday)
+	}
+
+	var closures []models.ParkingLotClosure
+	if err := db.Where("parking_lot_id IN ? AND end_at > ?", ids, from).Order("start_at").Find(&closures).Error; err != nil {
+		return nil, err
+	}
+	for _, closure := range closures {
+		schedules[closure.ParkingLotID].Closures = append(schedules[closure.ParkingLotID].Closures, closure)
+	}
+	return schedules, nil
+}
+
+// LoadLotSchedule 读取单个停车场的营业安排
+func LoadLotSchedule(db *gorm.DB, lot *models.ParkingLot, from time.Time) (*LotSchedule, error) {
+	schedules, err := LoadLotSchedules(db, []models.ParkingLot{*lot}, from)
+	if err != nil {
+		return nil, err
+	}
+	return schedules[lot.ID], nil
+}
+
+// CheckLotOpen 停车场在 t 时刻不营业时返回 ErrLotClosed
+func CheckLotOpen(db *gorm.DB, lot *models.ParkingLot, t time.Time) error {
+	schedule, err := LoadLotSchedule(db, lot, t)
+	if err != nil {
+		return err
+	}
+	if !schedule.IsOpen(t) {
+		return ErrLotClosed
+	}
+	return nil
+}
+
+// SetWeeklyHours 替换停车场的每周营业时段，传入空列表表示恢复按营业时间文本营业
+func SetWeeklyHours(db *gorm.DB, lotID uint, entries []models.ParkingLotHours) ([]models.ParkingLotHours, error) {
+	for i := range entries {
+		if entries[i].Weekday < 0 || entries[i].Weekday > 6 {
+			return nil, ErrInvalidWeekday
+		}
+		if err := ValidateHoursRange(entries[i].OpenTime, entries[i].CloseTime); err != nil {
+			return nil, err
+		}
+		entries[i].ID = 0
+		entries[i].ParkingLotID = lotID
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("parking_lot_id = ?", lotID).Delete(&models.ParkingLotHours{}).Error; err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		return tx.Create(&entries).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// SaveHoliday 新增或覆盖停车场某天的节假日安排
+func SaveHoliday(db *gorm.DB, holiday *models.ParkingLotHoliday) error {
+	if _, err := time.ParseInLocation("2006-01-02", holiday.Date, time.Local); err != nil {
+		return ErrInvalidHolidayDate
+	}
+	if holiday.Closed {
+		holiday.OpenTime, holiday.CloseTime = "", ""
+	} else if err := ValidateHoursRange(holiday.OpenTime, holiday.CloseTime); err != nil {
+		return err
+	}
+
+	var existing models.ParkingLotHoliday
+	err := db.Where("parking_lot_id = ? AND date = ?", holiday.ParkingLotID, holiday.Date).First(&existing).Error
+	if err == nil {
+		holiday.ID = existing.ID
+		holiday.CreatedAt = existing.CreatedAt
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	return db.Save(holiday).Error
+}
+
+// CreateClosure 新增临时关闭时段
+func CreateClosure(db *gorm.DB, closure *models.ParkingLotClosure) error {
+	if !closure.EndAt.After(closure.StartAt) {
+		return ErrInvalidClosure
+	}
+	return db.Create(closure).Error
+}
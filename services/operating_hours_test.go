@@ -0,0 +1,146 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package services
+
+import (
+	"testing"
+	"time"
+
+	"urban_traffic_backend/models"
+)
+
+func TestValidateHoursRange(t *testing.T) {
+	tests := []struct {
+		name        string
+		open, close string
+		wantErr     bool
+	}{
+		{"日间", "08:00", "20:00", false},
+		{"跨夜", "20:00", "08:00", false},
+		{"营业到午夜", "08:00", "24:00", false},
+		{"开关门相同", "08:00", "08:00", true},
+		{"开门不能为24:00", "24:00", "08:00", true},
+		{"分钟超出", "08:60", "20:00", true},
+		{"小时超出", "25:00", "20:00", true},
+		{"24点后带分钟", "08:00", "24:30", true},
+		{"格式错误", "8:00", "20:00", true},
+		{"空值", "", "20:00", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateHoursRange(tt.open, tt.close)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateHoursRange(%q, %q) = %v, wantErr %v", tt.open, tt.close, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIntervalOn(t *testing.T) {
+	day := time.Date(2026, 10, 12, 0, 0, 0, 0, time.Local)
+	tests := []struct {
+		name        string
+		open, close string
+		wantOK      bool
+		wantStart   time.Time
+		wantEnd     time.Time
+	}{
+		{"日间", "08:00", "20:00", true, day.Add(8 * time.Hour), day.Add(20 * time.Hour)},
+		{"跨夜结束在次日", "20:00", "08:00", true, day.Add(20 * time.Hour), day.Add(32 * time.Hour)},
+		{"营业到午夜", "00:00", "24:00", true, day, day.Add(24 * time.Hour)},
+		{"开关门相同", "08:00", "08:00", false, time.Time{}, time.Time{}},
+		{"格式错误", "08:00", "2000", false, time.Time{}, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := intervalOn(day, tt.open, tt.close)
+			if ok != tt.wantOK {
+				t.Fatalf("intervalOn(%q, %q) ok = %v, want %v", tt.open, tt.close, ok, tt.wantOK)
+			}
+			if ok && (!got.start.Equal(tt.wantStart) || !got.end.Equal(tt.wantEnd)) {
+				t.Errorf("intervalOn(%q, %q) = [%v, %v), want [%v, %v)",
+					tt.open, tt.close, got.start, got.end, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+// TestLotScheduleIsOpen 2026-10-12 为周一，2026-10-18 为周日
+func TestLotScheduleIsOpen(t *testing.T) {
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 10, day, hour, minute, 0, 0, time.Local)
+	}
+	weekly := []models.ParkingLotHours{
+		{Weekday: 1, OpenTime: "08:00", CloseTime: "20:00"},
+		{Weekday: 2, OpenTime: "22:00", CloseTime: "06:00"},
+		{Weekday: 3, OpenTime: "08:00", CloseTime: "12:00"},
+		{Weekday: 3, OpenTime: "14:00", CloseTime: "18:00"},
+	}
+
+	tests := []struct {
+		name     string
+		schedule LotSchedule
+		at       time.Time
+		want     bool
+	}{
+		{"未配置营业时间全天营业", LotSchedule{}, at(12, 3, 0), true},
+		{"24小时", LotSchedule{OperatingHours: "24小时"}, at(12, 3, 0), true},
+		{"旧营业时间文本内", LotSchedule{OperatingHours: "07:00-22:00"}, at(12, 7, 0), true},
+		{"旧营业时间文本外", LotSchedule{OperatingHours: "07:00-22:00"}, at(12, 22, 0), false},
+		{"无法识别的旧文本全天营业", LotSchedule{OperatingHours: "工作日全天"}, at(12, 3, 0), true},
+		{"每周时段开门时刻", LotSchedule{Weekly: weekly}, at(12, 8, 0), true},
+		{"每周时段关门时刻", LotSchedule{Weekly: weekly}, at(12, 20, 0), false},
+		{"当天未配置时段", LotSchedule{Weekly: weekly}, at(18, 12, 0), false},
+		{"跨夜时段当晚", LotSchedule{Weekly: weekly}, at(13, 23, 0), true},
+		{"跨夜时段次日凌晨", LotSchedule{Weekly: weekly}, at(14, 5, 59), true},
+		{"跨夜时段结束后", LotSchedule{Weekly: weekly}, at(14, 6, 0), false},
+		{"同日多个时段之间", LotSchedule{Weekly: weekly}, at(14, 13, 0), false},
+		{"同日第二个时段", LotSchedule{Weekly: weekly}, at(14, 15, 0), true},
+		{
+			"节假日全天关闭",
+			LotSchedule{Weekly: weekly, Holidays: []models.ParkingLotHoliday{{Date: "2026-10-12", Closed: true}}},
+			at(12, 10, 0), false,
+		},
+		{
+			"节假日特殊时段替代每周时段",
+			LotSchedule{Weekly: weekly, Holidays: []models.ParkingLotHoliday{{Date: "2026-10-18", OpenTime: "10:00", CloseTime: "16:00"}}},
+			at(18, 12, 0), true,
+		},
+		{
+			"节假日时段外",
+			LotSchedule{Weekly: weekly, Holidays: []models.ParkingLotHoliday{{Date: "2026-10-12", OpenTime: "10:00", CloseTime: "16:00"}}},
+			at(12, 9, 0), false,
+		},
+		{
+			"前一天节假日关闭时没有跨夜时段",
+			LotSchedule{Weekly: weekly, Holidays: []models.ParkingLotHoliday{{Date: "2026-10-13", Closed: true}}},
+			at(14, 5, 0), false,
+		},
+		{
+			"临时关闭期间",
+			LotSchedule{Weekly: weekly, Closures: []models.ParkingLotClosure{{StartAt: at(12, 9, 0), EndAt: at(12, 11, 0)}}},
+			at(12, 10, 0), false,
+		},
+		{
+			"临时关闭结束时刻恢复营业",
+			LotSchedule{Weekly: weekly, Closures: []models.ParkingLotClosure{{StartAt: at(12, 9, 0), EndAt: at(12, 11, 0)}}},
+			at(12, 11, 0), true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.schedule.IsOpen(tt.at); got != tt.want {
+				t.Errorf("IsOpen(%v) = %v, want %v", tt.at, got, tt.want)
+			}
+		})
+	}
+}
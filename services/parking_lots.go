@@ -0,0 +1,300 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package services
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"urban_traffic_backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrInvalidLotName 停车场名称不合法
+	ErrInvalidLotName = errors.New("停车场名称不能为空且不能超过100个字符")
+	// ErrInvalidAddress 地址过长
+	ErrInvalidAddress = errors.New("地址不能超过255个字符")
+	// ErrInvalidCoordinates 经纬度超出范围
+	ErrInvalidCoordinates = errors.New("经纬度无效")
+	// ErrInvalidCapacity 车位数不合法
+	ErrInvalidCapacity = errors.New("车位数无效")
+	// ErrInvalidRate 费率不合法
+	ErrInvalidRate = errors.New("费率不能为负数")
+	// ErrInvalidPaymentMethods 支付方式不合法
+	ErrInvalidPaymentMethods = errors.New("支付方式无效")
+	// ErrInvalidOperatingHours 营业时间格式不合法
+	ErrInvalidOperatingHours = errors.New("营业时间须为 24小时 或 HH:MM-HH:MM")
+	// ErrCapacityDerived 登记了车位清单的停车场，车位数由车位清单派生
+	ErrCapacityDerived = errors.New("车位数由车位清单派生，请通过车位管理修改")
+	// ErrLotInUse 停车场还有进行中的停车会话、预约或有效月卡
+	ErrLotInUse = errors.New("停车场还有进行中的停车会话、预约或有效月卡")
+	// ErrInvalidSpecialSpotType 特殊车位类型不合法
+	ErrInvalidSpecialSpotType = errors.New("特殊车位类型须为 charging、disabled 或 vip")
+	// ErrSpecialSpotInUse 该类型特殊车位还有进行中的停车会话或车位清单
+	ErrSpecialSpotInUse = errors.New("该类型车位还在使用中")
+	// ErrInvalidHeightLimit 限高不合法
+	ErrInvalidHeightLimit = errors.New("限高须在 0-10 米之间，0 表示不限高")
+	// ErrInvalidCoverage 遮蔽类型不合法
+	ErrInvalidCoverage = errors.New("遮蔽类型须为 indoor、outdoor 或 mixed")
+	// ErrInvalidEVConnectors 充电接口类型不合法
+	ErrInvalidEVConnectors = errors.New("充电接口类型须为 " + strings.Join(models.EVConnectorTypes, "、") + " 之一")
+)
+
+// 支持的支付方式
+var lotPaymentMethods = map[string]bool{"微信": true, "支付宝": true, "现金": true, "银联": true, "ETC": true}
+
+var operatingHoursPattern = regexp.MustCompile(`^([01]\d|2[0-3]):[0-5]\d-([01]\d|2[0-4]):[0-5]\d$`)
+
+// ValidateParkingLot 校验停车场的名称、经纬度、车位数、费率、支付方式、营业时间和设施信息，并归一化文本字段
+func ValidateParkingLot(lot *models.ParkingLot) error {
+	lot.Name = strings.TrimSpace(lot.Name)
+	if lot.Name == "" || utf8.RuneCountInString(lot.Name) > 100 {
+		return ErrInvalidLotName
+	}
+	lot.Address = strings.TrimSpace(lot.Address)
+	if utf8.RuneCountInString(lot.Address) > 255 {
+		return ErrInvalidAddress
+	}
+	if lot.Latitude < -90 || lot.Latitude > 90 || lot.Longitude < -180 || lot.Longitude > 180 ||
+		lot.Latitude == 0 && lot.Longitude == 0 {
+		return ErrInvalidCoordinates
+	}
+	if lot.TotalSpots < 0 || lot.AvailableSpots < 0 || lot.AvailableSpots > lot.TotalSpots {
+		return ErrInvalidCapacity
+	}
+	if lot.HourlyRate < 0 {
+		return ErrInvalidRate
+	}
+
+	methods, err := normalizePaymentMethods(lot.PaymentMethods)
+	if err != nil {
+		return err
+	}
+	lot.PaymentMethods = methods
+
+	lot.OperatingHours = strings.TrimSpace(lot.OperatingHours)
+	if lot.OperatingHours == "" {
+		lot.OperatingHours = "24小时"
+	}
+	if lot.OperatingHours != "24小时" && !operatingHoursPattern.MatchString(lot.OperatingHours) {
+		return ErrInvalidOperatingHours
+	}
+
+	if lot.HeightLimit < 0 || lot.HeightLimit > 10 {
+		return ErrInvalidHeightLimit
+	}
+	lot.Coverage = strings.TrimSpace(lot.Coverage)
+	if !models.IsValidLotCoverage(lot.Coverage) {
+		return ErrInvalidCoverage
+	}
+	connectors, err := NormalizeEVConnectors(lot.EVConnectors)
+	if err != nil {
+		return err
+	}
+	lot.EVConnectors = connectors
+	return nil
+}
+
+// NormalizeEVConnectors 校验逗号分隔的充电接口类型，去掉重复项，允许为空
+func NormalizeEVConnectors(value string) (string, error) {
+	value = strings.ReplaceAll(value, "，", ",")
+	var connectors []string
+	seen := map[string]bool{}
+	for _, connector := range strings.Split(value, ",") {
+		connector = strings.ToLower(strings.TrimSpace(connector))
+		if connector == "" || seen[connector] {
+			continue
+		}
+		if !models.IsValidEVConnector(connector) {
+			return "", ErrInvalidEVConnectors
+		}
+		seen[connector] = true
+		connectors = append(connectors, connector)
+	}
+	return strings.Join(connectors, ","), nil
+}
+
+// normalizePaymentMethods 校验逗号分隔的支付方式，去掉重复项
+func normalizePaymentMethods(value string) (string, error) {
+	value = strings.ReplaceAll(value, "，", ",")
+	var methods []string
+	seen := map[string]bool{}
+	for _, method := range strings.Split(value, ",") {
+		method = strings.TrimSpace(method)
+		if method == "" || seen[method] {
+			continue
+		}
+		if !lotPaymentMethods[method] {
+			return "", ErrInvalidPaymentMethods
+		}
+		seen[method] = true
+		methods = append(methods, method)
+	}
+	if len(methods) == 0 {
+		return "", ErrInvalidPaymentMethods
+	}
+	return strings.Join(methods, ","), nil
+}
+
+// UpdateParkingLot 按 apply 修改停车场并校验。未登记车位清单的停车场修改总车位数时，
+// 可用车位数按增减量同步调整；登记了车位清单的停车场不允许修改车位数
+func UpdateParkingLot(db *gorm.DB, lotID uint, apply func(lot *models.ParkingLot)) (*models.ParkingLot, error) {
+	var lot models.ParkingLot
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&lot, lotID).Error; err != nil {
+			return err
+		}
+		oldTotal := lot.TotalSpots
+		apply(&lot)
+
+		if lot.TotalSpots != oldTotal {
+			if HasSpotInventory(tx, lot.ID) {
+				return ErrCapacityDerived
+			}
+			lot.AvailableSpots += lot.TotalSpots - oldTotal
+			if lot.AvailableSpots < 0 {
+				lot.AvailableSpots = 0
+			}
+			var specialTotal int
+			tx.Model(&models.SpecialSpot{}).Where("parking_lot_id = ?", lot.ID).
+				Select("COALESCE(SUM(total_count), 0)").Scan(&specialTotal)
+			if lot.TotalSpots < specialTotal {
+				return ErrInvalidCapacity
+			}
+		}
+		if err := ValidateParkingLot(&lot); err != nil {
+			return err
+		}
+		if err := tx.Omit(clause.Associations).Save(&lot).Error; err != nil {
+			return err
+		}
+		return RecordAvailability(tx, lot.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &lot, nil
+}
+
+// DeleteParkingLot 删除停车场，还有进行中的停车会话、保留中的预约或有效月卡时拒绝删除。
+// 停车场的车位、特殊车位、收费标准、月卡套餐、黑白名单和布控记录随之软删除，营业时间、节假日和临时闭场安排直接删除
+func DeleteParkingLot(db *gorm.DB, lot *models.ParkingLot) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		checks := []*gorm.DB{
+			tx.Model(&models.ParkingSession{}).Where("parking_lot_id = ? AND status = ?", lot.ID, "active"),
+			tx.Model(&models.Reservation{}).Where("parking_lot_id = ? AND status = ?", lot.ID, models.ReservationStatusHeld),
+			tx.Model(&models.ParkingPass{}).
+				Where("parking_lot_id = ? AND status = ? AND valid_until > ?", lot.ID, models.PassStatusActive, time.Now()),
+		}
+		for _, query := range checks {
+			var inUse int64
+			if err := query.Count(&inUse).Error; err != nil {
+				return err
+			}
+			if inUse > 0 {
+				return ErrLotInUse
+			}
+		}
+
+		dependents := []interface{}{
+			&models.ParkingSpot{}, &models.SpecialSpot{}, &models.ParkingTariff{}, &models.PassPlan{},
+			&models.AccessListEntry{}, &models.PlateAlarm{},
+			&models.ParkingLotHours{}, &models.ParkingLotHoliday{}, &models.ParkingLotClosure{},
+		}
+		for _, model := range dependents {
+			if err := tx.Where("parking_lot_id = ?", lot.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(lot).Error
+	})
+}
+
+// SaveSpecialSpot 新增或修改停车场某类特殊车位的数量和附加费。
+// 登记了车位清单的停车场数量由车位清单派生，只能修改附加费；
+// 计数方式的停车场可用数量按增减量同步调整，各类特殊车位总数不能超过停车场总车位数
+func SaveSpecialSpot(db *gorm.DB, lotID uint, spotType string, totalCount *int, additionalFee *float64) (*models.SpecialSpot, error) {
+	if !models.IsValidSpecialSpotType(spotType) {
+		return nil, ErrInvalidSpecialSpotType
+	}
+	if totalCount != nil && *totalCount < 0 {
+		return nil, ErrInvalidCapacity
+	}
+	if additionalFee != nil && *additionalFee < 0 {
+		return nil, ErrInvalidRate
+	}
+
+	var spot models.SpecialSpot
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var lot models.ParkingLot
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&lot, lotID).Error; err != nil {
+			return err
+		}
+		spot = models.SpecialSpot{ParkingLotID: lotID, SpotType: spotType}
+		if err := tx.Where(&spot).FirstOrInit(&spot).Error; err != nil {
+			return err
+		}
+
+		if totalCount != nil && *totalCount != spot.TotalCount {
+			if HasSpotInventory(tx, lotID) {
+				return ErrCapacityDerived
+			}
+			var otherTotal int
+			tx.Model(&models.SpecialSpot{}).
+				Where("parking_lot_id = ? AND spot_type <> ?", lotID, spotType).
+				Select("COALESCE(SUM(total_count), 0)").Scan(&otherTotal)
+			if otherTotal+*totalCount > lot.TotalSpots {
+				return ErrInvalidCapacity
+			}
+			spot.AvailableCount += *totalCount - spot.TotalCount
+			if spot.AvailableCount < 0 {
+				spot.AvailableCount = 0
+			}
+			spot.TotalCount = *totalCount
+		}
+		if additionalFee != nil {
+			spot.AdditionalFee = *additionalFee
+		}
+		return tx.Save(&spot).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &spot, nil
+}
+
+// DeleteSpecialSpot 删除停车场某类特殊车位，还有该类型的车位清单或进行中的停车会话时拒绝删除
+func DeleteSpecialSpot(db *gorm.DB, lotID uint, spotType string) (*models.SpecialSpot, error) {
+	var spot models.SpecialSpot
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("parking_lot_id = ? AND spot_type = ?", lotID, spotType).First(&spot).Error; err != nil {
+			return err
+		}
+		var inUse int64
+		tx.Model(&models.ParkingSpot{}).Where("parking_lot_id = ? AND spot_type = ?", lotID, spotType).Count(&inUse)
+		if inUse == 0 {
+			tx.Model(&models.ParkingSession{}).
+				Where("parking_lot_id = ? AND spot_type = ? AND status = ?", lotID, spotType, "active").Count(&inUse)
+		}
+		if inUse > 0 {
+			return ErrSpecialSpotInUse
+		}
+		return tx.Delete(&spot).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &spot, nil
+}
@@ -0,0 +1,240 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"urban_traffic_backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PassJob 月卡到期任务：将过期月卡置为已过期并释放其固定车位，
+// 间隔由 PASS_EXPIRY_INTERVAL_SECONDS 配置，默认 5 分钟
+func PassJob() Job {
+	return Job{
+		Name:     "pass_expiry",
+		Interval: envDuration("PASS_EXPIRY_INTERVAL_SECONDS", 5*time.Minute),
+		Run:      ExpirePasses,
+	}
+}
+
+// FindActivePass 查找车辆在该停车场指定时间有效的月卡，没有时返回 nil。
+// 车辆按车辆ID或归一化车牌匹配，车牌识别入场时只有车牌
+func FindActivePass(db *gorm.DB, lotID uint, vehicleID *uint, plate string, at time.Time) (*models.ParkingPass, error) {
+	query := db.Where("parking_lot_id = ? AND status = ? AND valid_from <= ? AND valid_until > ?",
+		lotID, models.PassStatusActive, at, at)
+	if vehicleID != nil {
+		query = query.Where("(vehicle_id = ? OR plate_number = ?)", *vehicleID, plate)
+	} else {
+		query = query.Where("plate_number = ?", plate)
+	}
+
+	var pass models.ParkingPass
+	err := query.Order("valid_until desc").First(&pass).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pass, nil
+}
+
+// ClaimPassSpot 月卡车辆入场时占用其固定车位，套餐不含固定车位或车位不可用时返回 nil
+func ClaimPassSpot(tx *gorm.DB, pass *models.ParkingPass) (*models.ParkingSpot, error) {
+	if pass.ParkingSpotID == nil {
+		return nil, nil
+	}
+
+	result := tx.Model(&models.ParkingSpot{}).
+		Where("id = ? AND status = ?", *pass.ParkingSpotID, models.SpotStatusReserved).
+		Updates(map[string]interface{}{
+			"status":            models.SpotStatusOccupied,
+			"status_updated_at": time.Now(),
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, result.Error
+	}
+	if err := SyncLotAvailability(tx, pass.ParkingLotID); err != nil {
+		return nil, err
+	}
+
+	var spot models.ParkingSpot
+	if err := tx.First(&spot, *pass.ParkingSpotID).Error; err != nil {
+		return nil, err
+	}
+	return &spot, nil
+}
+
+// ReleaseSessionCapacity 会话结束时释放车位；月卡固定车位在月卡有效期内重新保留给月卡，不对外开放
+func ReleaseSessionCapacity(tx *gorm.DB, session *models.ParkingSession) error {
+	if session.PassID != nil && session.ParkingSpotID != nil {
+		var pass models.ParkingPass
+		err := tx.Where("id = ? AND parking_spot_id = ?", *session.PassID, *session.ParkingSpotID).First(&pass).Error
+		if err == nil && pass.CoversAt(time.Now()) {
+			return tx.Model(&models.ParkingSpot{}).
+				Where("id = ? AND status = ?", *session.ParkingSpotID, models.SpotStatusOccupied).
+				Updates(map[string]interface{}{
+					"status":            models.SpotStatusReserved,
+					"status_updated_at": time.Now(),
+				}).Error
+		}
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+	}
+	return ReleaseCapacity(tx, session.ParkingLotID, session.SpotType, session.ParkingSpotID)
+}
+
+// ActivatePass 月卡支付成功：首次支付时生效并分配固定车位，续费时有效期顺延一期
+func ActivatePass(tx *gorm.DB, passID uint, now time.Time) error {
+	var pass models.ParkingPass
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Plan").First(&pass, passID).Error; err != nil {
+		return err
+	}
+
+	switch pass.Status {
+	case models.PassStatusPending:
+		pass.Status = models.PassStatusActive
+		// 购买后超过原定生效时间才支付的，从支付时起算一整期
+		if pass.ValidFrom.Before(now) {
+			pass.ValidFrom = now
+			pass.ValidUntil = now.AddDate(0, 0, pass.Plan.DurationDays)
+		}
+		if err := assignPassSpot(tx, &pass); err != nil {
+			return err
+		}
+	case models.PassStatusActive:
+		// 续费：有效期顺延一期，固定车位保持不变
+		base := pass.ValidUntil
+		if base.Before(now) {
+			base = now
+		}
+		pass.ValidUntil = base.AddDate(0, 0, pass.Plan.DurationDays)
+	case models.PassStatusExpired:
+		// 过期后续费：从现在起算，过期时已释放的固定车位重新分配
+		pass.Status = models.PassStatusActive
+		pass.ValidFrom = now
+		pass.ValidUntil = now.AddDate(0, 0, pass.Plan.DurationDays)
+		pass.ParkingSpotID = nil
+		pass.SpotCode = ""
+		if err := assignPassSpot(tx, &pass); err != nil {
+			return err
+		}
+	default:
+		log.Printf("pass %d paid in status %s, ignored", pass.ID, pass.Status)
+		return nil
+	}
+
+	return tx.Model(&pass).Updates(map[string]interface{}{
+		"status":          pass.Status,
+		"valid_from":      pass.ValidFrom,
+		"valid_until":     pass.ValidUntil,
+		"parking_spot_id": pass.ParkingSpotID,
+		"spot_code":       pass.SpotCode,
+	}).Error
+}
+
+// CancelPass 取消月卡，立即停止免费并释放未被占用的固定车位
+func CancelPass(tx *gorm.DB, pass *models.ParkingPass, now time.Time) error {
+	if err := releasePassSpot(tx, pass); err != nil {
+		return err
+	}
+	pass.Status = models.PassStatusCancelled
+	pass.CancelledAt = &now
+	return tx.Model(pass).Updates(map[string]interface{}{
+		"status":       pass.Status,
+		"cancelled_at": pass.CancelledAt,
+	}).Error
+}
+
+// ExpirePasses 将已过有效期的月卡置为已过期并释放固定车位
+func ExpirePasses(ctx context.Context, now time.Time) error {
+	var ids []uint
+	err := models.DB.Model(&models.ParkingPass{}).
+		Where("status = ? AND valid_until <= ?", models.PassStatusActive, now).
+		Pluck("id", &ids).Error
+	if err != nil {
+		return err
+	}
+
+	var expired int
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			return nil
+		}
+		err := models.DB.Transaction(func(tx *gorm.DB) error {
+			var pass models.ParkingPass
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("id = ? AND status = ? AND valid_until <= ?", id, models.PassStatusActive, now).
+				First(&pass).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := releasePassSpot(tx, &pass); err != nil {
+				return err
+			}
+			expired++
+			return tx.Model(&pass).Update("status", models.PassStatusExpired).Error
+		})
+		if err != nil {
+			log.Printf("pass: expire pass %d failed: %v", id, err)
+		}
+	}
+
+	if expired > 0 {
+		log.Printf("pass: expired %d passes", expired)
+	}
+	return nil
+}
+
+// assignPassSpot 为含固定车位的月卡分配车位。固定车位只能从车位清单中分配，
+// 没有可分配的车位时月卡照常生效，仅不含固定车位
+func assignPassSpot(tx *gorm.DB, pass *models.ParkingPass) error {
+	if !pass.Plan.ReservedSpot || !HasSpotInventory(tx, pass.ParkingLotID) {
+		return nil
+	}
+	spot, err := ReserveCapacity(tx, pass.ParkingLotID, pass.Plan.SpotType)
+	switch {
+	case err == nil:
+		pass.ParkingSpotID = &spot.ID
+		pass.SpotCode = spot.Code
+	case errors.Is(err, ErrLotFull), errors.Is(err, ErrSpotTypeFull):
+		log.Printf("pass %d activated without reserved spot: no spot available", pass.ID)
+	default:
+		return err
+	}
+	return nil
+}
+
+// releasePassSpot 释放月卡的固定车位；车位正被月卡车辆占用时保持占用，离场时按普通车位释放
+func releasePassSpot(tx *gorm.DB, pass *models.ParkingPass) error {
+	if pass.ParkingSpotID == nil {
+		return nil
+	}
+	result := tx.Model(&models.ParkingSpot{}).
+		Where("id = ? AND status = ?", *pass.ParkingSpotID, models.SpotStatusReserved).
+		Updates(map[string]interface{}{
+			"status":            models.SpotStatusFree,
+			"status_updated_at": time.Now(),
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+	return SyncLotAvailability(tx, pass.ParkingLotID)
+}
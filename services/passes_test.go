@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package services
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"urban_traffic_backend/models"
+)
+
+// TestQuoteSessionPassWaiver 月卡有效期内免收停车费，到期或取消后从该时刻起按收费标准计费。
+// 停车场按默认标准计费：首小时 10 元，之后每小时 5 元
+func TestQuoteSessionPassWaiver(t *testing.T) {
+	start := time.Date(2025, 1, 6, 8, 0, 0, 0, time.Local)
+	at := start.Add(5 * time.Hour)
+	hours := func(h int) time.Time { return start.Add(time.Duration(h) * time.Hour) }
+
+	tests := []struct {
+		name        string
+		hasPass     bool
+		validUntil  time.Time
+		cancelledAt interface{}
+		want        float64
+		wantNote    bool
+	}{
+		{"没有月卡", false, time.Time{}, nil, 30, false},
+		{"月卡覆盖整个停车期间", true, hours(10), nil, 0, true},
+		{"停车期间到期", true, hours(2), nil, 20, true},
+		{"取消时间早于到期时间", true, hours(10), hours(3), 15, true},
+		{"入场前已到期", true, hours(-1), nil, 30, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &scriptedDB{queries: []scriptedQuery{
+				{match: "from `parking_lots`", columns: []string{"id", "hourly_rate"}, rows: [][]driver.Value{{int64(1), 10.0}}},
+				{match: "from `parking_passes`", columns: []string{"id", "valid_until", "status", "cancelled_at"},
+					rows: [][]driver.Value{{int64(2), tt.validUntil, models.PassStatusActive, tt.cancelledAt}}},
+			}}
+			db := s.open(t)
+
+			session := &models.ParkingSession{ParkingLotID: 1, SpotType: "normal", StartTime: start}
+			if tt.hasPass {
+				passID := uint(2)
+				session.PassID = &passID
+			}
+			quote, err := QuoteSession(db, session, at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if quote.Total != tt.want {
+				t.Errorf("Total = %v, want %v (items %+v)", quote.Total, tt.want, quote.Items)
+			}
+			if note := strings.HasPrefix(quote.Description, "月卡有效期内免费"); note != tt.wantNote {
+				t.Errorf("Description = %q, want pass note %v", quote.Description, tt.wantNote)
+			}
+		})
+	}
+}
+
+// TestActivatePass 首次支付按原定或支付时间生效，续费从到期时间（已过期时从支付时间）顺延一期
+func TestActivatePass(t *testing.T) {
+	now := time.Date(2025, 1, 6, 8, 0, 0, 0, time.Local)
+	days := func(d int) time.Time { return now.AddDate(0, 0, d) }
+
+	tests := []struct {
+		name           string
+		status         string
+		validFrom      time.Time
+		validUntil     time.Time
+		reservedSpot   bool
+		wantUpdate     bool
+		wantValidFrom  time.Time
+		wantValidUntil time.Time
+		wantSpot       bool
+	}{
+		{"首次支付按原定时间生效", models.PassStatusPending, days(1), days(31), false, true, days(1), days(31), false},
+		{"首次支付晚于原定生效时间", models.PassStatusPending, days(-2), days(28), false, true, now, days(30), false},
+		{"首次支付分配固定车位", models.PassStatusPending, days(1), days(31), true, true, days(1), days(31), true},
+		{"有效期内续费顺延一期", models.PassStatusActive, days(-25), days(5), true, true, days(-25), days(35), false},
+		{"到期未处理时续费从支付时间起算", models.PassStatusActive, days(-33), days(-3), false, true, days(-33), days(30), false},
+		{"过期后续费重新分配固定车位", models.PassStatusExpired, days(-40), days(-10), true, true, now, days(30), true},
+		{"已取消的月卡不处理", models.PassStatusCancelled, days(-10), days(20), false, false, time.Time{}, time.Time{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &scriptedDB{queries: []scriptedQuery{
+				{match: "from `parking_passes`", columns: []string{"id", "parking_lot_id", "plan_id", "valid_from", "valid_until", "status"},
+					rows: [][]driver.Value{{int64(2), int64(1), int64(4), tt.validFrom, tt.validUntil, tt.status}}},
+				{match: "from `pass_plans`", columns: []string{"id", "duration_days", "reserved_spot", "spot_type"},
+					rows: [][]driver.Value{{int64(4), int64(30), tt.reservedSpot, "normal"}}},
+				{match: "select count(*) from `parking_spots`", columns: []string{"count(*)"}, rows: [][]driver.Value{{int64(1)}}},
+				{match: "order by floor, zone, code", columns: []string{"id", "parking_lot_id", "code", "spot_type", "status"},
+					rows: [][]driver.Value{{int64(7), int64(1), "B-007", "normal", models.SpotStatusFree}}},
+			}}
+			db := s.open(t)
+
+			if err := ActivatePass(db, 2, now); err != nil {
+				t.Fatal(err)
+			}
+			if !tt.wantUpdate {
+				s.checkExecuted(t, nil, []string{"update `parking_passes`"})
+				return
+			}
+			// 更新参数依次为 parking_spot_id, plan_id, spot_code, status, valid_from, valid_until
+			spot := "[<nil>] [4] []"
+			if tt.wantSpot {
+				spot = "[7] [4] [B-007]"
+			}
+			want := []string{"update `parking_passes` set", fmt.Sprintf("%s [%s] [%v] [%v]", spot, models.PassStatusActive, tt.wantValidFrom, tt.wantValidUntil)}
+			s.checkExecuted(t, want, nil)
+		})
+	}
+}
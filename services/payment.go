@@ -0,0 +1,593 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package services
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"urban_traffic_backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrPaymentMethodUnavailable 停车场不支持该线上支付方式
+	ErrPaymentMethodUnavailable = errors.New("停车场不支持该支付方式")
+	// ErrIdempotencyConflict 幂等键已用于其他支付
+	ErrIdempotencyConflict = errors.New("幂等键已用于其他支付")
+	// ErrOrderNotFound 支付订单不存在
+	ErrOrderNotFound = errors.New("支付订单不存在")
+	// ErrCallbackAmountMismatch 回调金额与订单金额不一致
+	ErrCallbackAmountMismatch = errors.New("回调金额与订单金额不一致")
+	// ErrRefundNotAllowed 订单当前状态不可退款
+	ErrRefundNotAllowed = errors.New("订单当前状态不可退款")
+	// ErrInvalidRefundAmount 退款金额无效或超过可退金额
+	ErrInvalidRefundAmount = errors.New("退款金额无效或超过可退金额")
+)
+
+// onlinePaymentMethods 可在 App 内通过支付渠道完成的支付方式，现金等需在岗亭支付
+var onlinePaymentMethods = map[string]bool{
+	"微信":  true,
+	"支付宝": true,
+}
+
+// PaymentRequest 创建支付订单的参数
+type PaymentRequest struct {
+	UserID         *uint
+	ParkingLot     *models.ParkingLot
+	Purpose        string
+	SessionID      *uint
+	ReservationID  *uint
+	PassID         *uint
+	Amount         float64
+	Method         string // 为空时使用停车场支持的第一种线上支付方式
+	IdempotencyKey string
+	Description    string
+}
+
+// OnlinePaymentMethods 返回停车场支持的线上支付方式
+func OnlinePaymentMethods(lot *models.ParkingLot) []string {
+	var methods []string
+	for _, method := range strings.Split(lot.PaymentMethods, ",") {
+		method = strings.TrimSpace(method)
+		if onlinePaymentMethods[method] {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+// SelectPaymentMethod 从停车场支持的支付方式中选择线上支付方式
+func SelectPaymentMethod(lot *models.ParkingLot, requested string) (string, error) {
+	methods := OnlinePaymentMethods(lot)
+	for _, method := range methods {
+		if requested == "" || method == requested {
+			return method, nil
+		}
+	}
+	return "", ErrPaymentMethodUnavailable
+}
+
+// CreatePaymentOrder 创建支付订单并向支付渠道下单，支付结果由渠道回调确认。
+// 相同幂等键或同一会话/预约已有未失败的订单时直接返回该订单，避免重复扣款；金额为 0 时直接完成
+func CreatePaymentOrder(req PaymentRequest) (*models.PaymentOrder, error) {
+	if req.IdempotencyKey != "" && req.UserID != nil {
+		var existing models.PaymentOrder
+		err := models.DB.Where("user_id = ? AND idempotency_key = ?", *req.UserID, req.IdempotencyKey).
+			First(&existing).Error
+		if err == nil {
+			if existing.Purpose != req.Purpose || !sameRef(existing.SessionID, req.SessionID) ||
+				!sameRef(existing.ReservationID, req.ReservationID) || !sameRef(existing.PassID, req.PassID) {
+				return nil, ErrIdempotencyConflict
+			}
+			return &existing, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	method, err := SelectPaymentMethod(req.ParkingLot, req.Method)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := activePaymentProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	order := models.PaymentOrder{
+		OrderNo:       newSerialNo("PO", now),
+		UserID:        req.UserID,
+		Purpose:       req.Purpose,
+		SessionID:     req.SessionID,
+		ReservationID: req.ReservationID,
+		PassID:        req.PassID,
+		ParkingLotID:  req.ParkingLot.ID,
+		Amount:        roundMoney(req.Amount),
+		Method:        method,
+		Provider:      provider.Name(),
+		Status:        models.PaymentStatusPending,
+		Description:   req.Description,
+	}
+	if req.IdempotencyKey != "" {
+		order.IdempotencyKey = &req.IdempotencyKey
+	}
+
+	var reused *models.PaymentOrder
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		// 锁定会话、预约或月卡，防止并发请求为同一笔费用创建多个订单
+		if err := lockPaymentReference(tx, &order); err != nil {
+			return err
+		}
+
+		// 月卡可多次续费，只复用尚未完成的订单
+		query := paymentReferenceQuery(tx, &order)
+		if order.Purpose == models.PaymentPurposePass {
+			query = query.Where("status = ?", models.PaymentStatusPending)
+		} else {
+			query = query.Where("status <> ?", models.PaymentStatusFailed)
+		}
+		var existing models.PaymentOrder
+		err := query.Order("id desc").First(&existing).Error
+		if err == nil {
+			reused = &existing
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if order.Amount <= 0 {
+			order.Status = models.PaymentStatusPaid
+			order.PaidAt = &now
+		}
+		if err := tx.Create(&order).Error; err != nil {
+			return err
+		}
+		if order.Status == models.PaymentStatusPaid {
+			return markReferencePaid(tx, &order, now)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reused != nil {
+		return reused, nil
+	}
+	if order.Status == models.PaymentStatusPaid {
+		return &order, nil
+	}
+
+	// 订单提交后再向渠道下单，保证回调到达时订单已存在
+	tradeNo, err := provider.CreatePayment(&order)
+	if err != nil {
+		order.Status = models.PaymentStatusFailed
+		order.FailureReason = truncate(err.Error(), 200)
+		models.DB.Model(&order).Where("status = ?", models.PaymentStatusPending).Updates(map[string]interface{}{
+			"status":         order.Status,
+			"failure_reason": order.FailureReason,
+		})
+		return &order, nil
+	}
+
+	order.ProviderTradeNo = tradeNo
+	if err := models.DB.Model(&order).Update("provider_trade_no", tradeNo).Error; err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// HandlePaymentCallback 处理支付渠道回调：校验签名后更新订单状态、记录收款流水并标记会话已支付。
+// 渠道可能重复回调，已处理过的订单直接返回成功
+func HandlePaymentCallback(providerName string, payload []byte, signature string) error {
+	provider, ok := GetPaymentProvider(providerName)
+	if !ok {
+		return errors.New("未知的支付渠道: " + providerName)
+	}
+	callback, err := provider.ParseCallback(payload, signature)
+	if err != nil {
+		return err
+	}
+
+	return models.DB.Transaction(func(tx *gorm.DB) error {
+		var order models.PaymentOrder
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("order_no = ? AND provider = ?", callback.OrderNo, providerName).
+			First(&order).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrOrderNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if order.Status != models.PaymentStatusPending {
+			return nil
+		}
+
+		now := time.Now()
+		if !callback.Success {
+			return tx.Model(&order).Updates(map[string]interface{}{
+				"status":            models.PaymentStatusFailed,
+				"failure_reason":    truncate(callback.Reason, 200),
+				"provider_trade_no": callback.TradeNo,
+			}).Error
+		}
+		if roundMoney(callback.Amount) != roundMoney(order.Amount) {
+			return ErrCallbackAmountMismatch
+		}
+
+		order.Status = models.PaymentStatusPaid
+		order.PaidAt = &now
+		order.ProviderTradeNo = callback.TradeNo
+		err = tx.Model(&order).Updates(map[string]interface{}{
+			"status":            order.Status,
+			"paid_at":           order.PaidAt,
+			"provider_trade_no": order.ProviderTradeNo,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		entry := ledgerEntryForOrder(&order, models.LedgerEntryCharge, order.Amount, order.ProviderTradeNo)
+		entry.Description = order.Description
+		if err := tx.Create(&entry).Error; err != nil {
+			return err
+		}
+		return markReferencePaid(tx, &order, now)
+	})
+}
+
+// RefundOrder 对已支付订单发起全额或部分退款，累计退款（含处理中的退款）不超过订单金额。
+// 相同幂等键重复提交返回同一退款单。先在事务中创建处理中的退款单，事务外调用渠道退款，
+// 再按渠道结果更新退款单、订单和流水，避免渠道请求期间持有订单行锁；渠道退款失败时退款单记为失败并返回
+func RefundOrder(orderNo string, amount float64, reason, idempotencyKey string, operatorID *uint) (*models.PaymentRefund, error) {
+	var order models.PaymentOrder
+	var refund models.PaymentRefund
+	var provider PaymentProvider
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("order_no = ?", orderNo).
+			First(&order).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrOrderNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if idempotencyKey != "" {
+			err := tx.Where("order_id = ? AND idempotency_key = ?", order.ID, idempotencyKey).First(&refund).Error
+			if err == nil {
+				return nil
+			}
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+		}
+
+		if order.Status != models.PaymentStatusPaid && order.Status != models.PaymentStatusPartiallyRefunded {
+			return ErrRefundNotAllowed
+		}
+		// 处理中的退款尚未计入已退款金额，同样占用可退金额
+		var pending float64
+		if err := tx.Model(&models.PaymentRefund{}).
+			Where("order_id = ? AND status = ?", order.ID, models.RefundStatusPending).
+			Select("COALESCE(SUM(amount), 0)").Scan(&pending).Error; err != nil {
+			return err
+		}
+		amount = roundMoney(amount)
+		if amount <= 0 || amount > roundMoney(order.Amount-order.RefundedAmount-pending) {
+			return ErrInvalidRefundAmount
+		}
+
+		var ok bool
+		provider, ok = GetPaymentProvider(order.Provider)
+		if !ok {
+			return errors.New("未知的支付渠道: " + order.Provider)
+		}
+
+		refund = models.PaymentRefund{
+			RefundNo:   newSerialNo("RF", time.Now()),
+			OrderID:    order.ID,
+			Amount:     amount,
+			Reason:     reason,
+			Status:     models.RefundStatusPending,
+			OperatorID: operatorID,
+		}
+		if idempotencyKey != "" {
+			refund.IdempotencyKey = &idempotencyKey
+		}
+		return tx.Create(&refund).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	// 幂等重复提交返回已有的退款单
+	if provider == nil {
+		return &refund, nil
+	}
+
+	providerRefundNo, refundErr := provider.Refund(&order, &refund)
+	if err := completeRefund(refund.ID, providerRefundNo, refundErr); err != nil {
+		return nil, err
+	}
+	if err := models.DB.First(&refund, refund.ID).Error; err != nil {
+		return nil, err
+	}
+	return &refund, nil
+}
+
+// completeRefund 按渠道退款结果更新处理中的退款单；退款成功时累计订单已退款金额并记录退款流水
+func completeRefund(refundID uint, providerRefundNo string, refundErr error) error {
+	return models.DB.Transaction(func(tx *gorm.DB) error {
+		var refund models.PaymentRefund
+		if err := tx.First(&refund, refundID).Error; err != nil {
+			return err
+		}
+		var order models.PaymentOrder
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, refund.OrderID).Error; err != nil {
+			return err
+		}
+		if refund.Status != models.RefundStatusPending {
+			return nil
+		}
+
+		now := time.Now()
+		if refundErr != nil {
+			refund.Status = models.RefundStatusFailed
+			refund.FailureReason = truncate(refundErr.Error(), 200)
+			refund.CompletedAt = &now
+			return tx.Save(&refund).Error
+		}
+
+		refund.Status = models.RefundStatusSucceeded
+		refund.ProviderRefundNo = providerRefundNo
+		refund.CompletedAt = &now
+		if err := tx.Save(&refund).Error; err != nil {
+			return err
+		}
+
+		order.RefundedAmount = roundMoney(order.RefundedAmount + refund.Amount)
+		order.Status = models.PaymentStatusPartiallyRefunded
+		if order.RefundedAmount >= order.Amount {
+			order.Status = models.PaymentStatusRefunded
+		}
+		err := tx.Model(&order).Updates(map[string]interface{}{
+			"refunded_amount": order.RefundedAmount,
+			"status":          order.Status,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		entry := ledgerEntryForOrder(&order, models.LedgerEntryRefund, -refund.Amount, providerRefundNo)
+		entry.RefundID = &refund.ID
+		entry.Description = truncate("退款："+refund.Reason, 200)
+		return tx.Create(&entry).Error
+	})
+}
+
+// ReconciliationItem 对账差异明细
+type ReconciliationItem struct {
+	SessionID uint    `json:"session_id"`
+	Status    string  `json:"status"`
+	Fee       float64 `json:"fee"`
+	Charged   float64 `json:"charged"`
+	Refunded  float64 `json:"refunded"`
+	Issue     string  `json:"issue"` // amount_mismatch, missing_charge, unmarked_payment
+}
+
+// ReconciliationReport 停车会话与资金流水的对账结果
+type ReconciliationReport struct {
+	From            time.Time            `json:"from"`
+	To              time.Time            `json:"to"`
+	SessionsChecked int                  `json:"sessions_checked"`
+	PaidSessions    int                  `json:"paid_sessions"`
+	UnpaidSessions  int                  `json:"unpaid_sessions"`
+	TotalFee        float64              `json:"total_fee"`
+	TotalCharged    float64              `json:"total_charged"`
+	TotalRefunded   float64              `json:"total_refunded"`
+	NetReceived     float64              `json:"net_received"`
+	Mismatches      []ReconciliationItem `json:"mismatches"`
+}
+
+// ReconcileSessions 核对时间段内结束的停车会话与资金流水：
+// 已支付会话的收款应等于停车费，未支付会话不应有收款。db 可带按停车场限定范围的条件
+func ReconcileSessions(db *gorm.DB, from, to time.Time) (*ReconciliationReport, error) {
+	var sessions []models.ParkingSession
+	err := db.Where("status IN ? AND end_time >= ? AND end_time < ?", []string{"ended", "paid"}, from, to).
+		Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ReconciliationReport{From: from, To: to, Mismatches: []ReconciliationItem{}}
+	if len(sessions) == 0 {
+		return report, nil
+	}
+
+	ids := make([]uint, 0, len(sessions))
+	for _, session := range sessions {
+		ids = append(ids, session.ID)
+	}
+
+	var sums []struct {
+		SessionID uint
+		EntryType string
+		Total     float64
+	}
+	err = db.Model(&models.LedgerEntry{}).
+		Select("session_id, entry_type, SUM(amount) AS total").
+		Where("session_id IN ?", ids).
+		Group("session_id, entry_type").
+		Scan(&sums).Error
+	if err != nil {
+		return nil, err
+	}
+
+	charged := map[uint]float64{}
+	refunded := map[uint]float64{}
+	for _, sum := range sums {
+		if sum.EntryType == models.LedgerEntryCharge {
+			charged[sum.SessionID] += sum.Total
+		} else {
+			refunded[sum.SessionID] -= sum.Total
+		}
+	}
+
+	for _, session := range sessions {
+		item := ReconciliationItem{
+			SessionID: session.ID,
+			Status:    session.Status,
+			Fee:       roundMoney(session.FeeCurrent),
+			Charged:   roundMoney(charged[session.ID]),
+			Refunded:  roundMoney(refunded[session.ID]),
+		}
+		report.SessionsChecked++
+		report.TotalCharged += item.Charged
+		report.TotalRefunded += item.Refunded
+
+		if session.Status == "paid" {
+			report.PaidSessions++
+			report.TotalFee += item.Fee
+			switch {
+			case item.Charged == 0 && item.Fee > 0:
+				item.Issue = "missing_charge"
+			case item.Charged != item.Fee:
+				item.Issue = "amount_mismatch"
+			}
+		} else {
+			report.UnpaidSessions++
+			if item.Charged > 0 {
+				item.Issue = "unmarked_payment"
+			}
+		}
+		if item.Issue != "" {
+			report.Mismatches = append(report.Mismatches, item)
+		}
+	}
+
+	report.TotalFee = roundMoney(report.TotalFee)
+	report.TotalCharged = roundMoney(report.TotalCharged)
+	report.TotalRefunded = roundMoney(report.TotalRefunded)
+	report.NetReceived = roundMoney(report.TotalCharged - report.TotalRefunded)
+	return report, nil
+}
+
+// lockPaymentReference 锁定订单对应的会话、预约或月卡
+func lockPaymentReference(tx *gorm.DB, order *models.PaymentOrder) error {
+	locking := tx.Clauses(clause.Locking{Strength: "UPDATE"})
+	if order.SessionID != nil {
+		return locking.First(&models.ParkingSession{}, *order.SessionID).Error
+	}
+	if order.ReservationID != nil {
+		return locking.First(&models.Reservation{}, *order.ReservationID).Error
+	}
+	if order.PassID != nil {
+		return locking.First(&models.ParkingPass{}, *order.PassID).Error
+	}
+	return nil
+}
+
+func paymentReferenceQuery(tx *gorm.DB, order *models.PaymentOrder) *gorm.DB {
+	query := tx.Where("purpose = ?", order.Purpose)
+	if order.SessionID != nil {
+		return query.Where("session_id = ?", *order.SessionID)
+	}
+	if order.ReservationID != nil {
+		return query.Where("reservation_id = ?", *order.ReservationID)
+	}
+	if order.PassID != nil {
+		return query.Where("pass_id = ?", *order.PassID)
+	}
+	return query.Where("1 = 0")
+}
+
+// markReferencePaid 订单支付成功后更新会话、预约或月卡的状态
+func markReferencePaid(tx *gorm.DB, order *models.PaymentOrder, now time.Time) error {
+	switch order.Purpose {
+	case models.PaymentPurposeParking:
+		if order.SessionID == nil {
+			return nil
+		}
+		err := tx.Model(&models.ParkingSession{}).
+			Where("id = ? AND status = ?", *order.SessionID, "ended").
+			Update("status", "paid").Error
+		if err != nil {
+			return err
+		}
+		// 支付完成后自动开具收据，开具失败不影响支付结果，用户可稍后重新申请
+		if _, err := IssueSessionInvoice(tx, *order.SessionID); err != nil {
+			log.Printf("payment: issue invoice for session %d failed: %v", *order.SessionID, err)
+		}
+		return nil
+	case models.PaymentPurposeNoShow:
+		if order.ReservationID == nil {
+			return nil
+		}
+		return tx.Model(&models.Reservation{}).
+			Where("id = ? AND no_show_fee_paid_at IS NULL", *order.ReservationID).
+			Update("no_show_fee_paid_at", now).Error
+	case models.PaymentPurposePass:
+		if order.PassID == nil {
+			return nil
+		}
+		return ActivatePass(tx, *order.PassID, now)
+	}
+	return nil
+}
+
+func ledgerEntryForOrder(order *models.PaymentOrder, entryType string, amount float64, providerRef string) models.LedgerEntry {
+	return models.LedgerEntry{
+		EntryType:     entryType,
+		OrderID:       order.ID,
+		SessionID:     order.SessionID,
+		ReservationID: order.ReservationID,
+		PassID:        order.PassID,
+		ParkingLotID:  order.ParkingLotID,
+		Amount:        roundMoney(amount),
+		Method:        order.Method,
+		Provider:      order.Provider,
+		ProviderRef:   providerRef,
+	}
+}
+
+// newSerialNo 生成单号：前缀 + 时间 + 6 位随机数
+func newSerialNo(prefix string, now time.Time) string {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		n = big.NewInt(now.UnixNano() % 1000000)
+	}
+	return fmt.Sprintf("%s%s%06d", prefix, now.Format("20060102150405"), n.Int64())
+}
+
+func sameRef(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max])
+}
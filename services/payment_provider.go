@@ -0,0 +1,141 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"urban_traffic_backend/models"
+)
+
+// PaymentCallback 支付渠道回调解析结果
+type PaymentCallback struct {
+	OrderNo string  `json:"order_no"`
+	TradeNo string  `json:"trade_no"`
+	Success bool    `json:"success"`
+	Amount  float64 `json:"amount"`
+	Reason  string  `json:"reason"`
+}
+
+// PaymentProvider 支付渠道。下单后渠道通过回调异步通知支付结果，回调须经签名校验
+type PaymentProvider interface {
+	// Name 渠道名称，与回调地址 /api/payments/callback/:provider 对应
+	Name() string
+	// CreatePayment 在渠道下单，返回渠道交易号
+	CreatePayment(order *models.PaymentOrder) (string, error)
+	// Refund 向渠道发起退款，返回渠道退款单号
+	Refund(order *models.PaymentOrder, refund *models.PaymentRefund) (string, error)
+	// ParseCallback 校验回调签名并解析回调内容
+	ParseCallback(payload []byte, signature string) (*PaymentCallback, error)
+}
+
+// ErrInvalidSignature 回调签名校验失败
+var ErrInvalidSignature = errors.New("回调签名无效")
+
+// paymentProviders 已注册的支付渠道
+var paymentProviders = map[string]PaymentProvider{}
+
+// InitPaymentProviders 注册内置支付渠道，须在加载环境变量之后调用。
+// 本地模拟渠道只在配置了 PAYMENT_MOCK_SECRET 时注册，未配置时不接受模拟渠道的下单和回调
+func InitPaymentProviders() {
+	secret := os.Getenv("PAYMENT_MOCK_SECRET")
+	if secret == "" {
+		log.Println("payment: PAYMENT_MOCK_SECRET not set, mock provider disabled")
+		return
+	}
+	RegisterPaymentProvider(newMockProvider(secret))
+}
+
+// RegisterPaymentProvider 注册支付渠道，同名渠道会被覆盖
+func RegisterPaymentProvider(provider PaymentProvider) {
+	paymentProviders[provider.Name()] = provider
+}
+
+// GetPaymentProvider 按名称获取支付渠道
+func GetPaymentProvider(name string) (PaymentProvider, bool) {
+	provider, ok := paymentProviders[name]
+	return provider, ok
+}
+
+// activePaymentProvider 线上支付使用的渠道，由 PAYMENT_PROVIDER 配置，默认使用本地模拟渠道（须已注册）
+func activePaymentProvider() (PaymentProvider, error) {
+	name := os.Getenv("PAYMENT_PROVIDER")
+	if name == "" {
+		name = "mock"
+	}
+	provider, ok := GetPaymentProvider(name)
+	if !ok {
+		return nil, errors.New("未配置的支付渠道: " + name)
+	}
+	return provider, nil
+}
+
+// mockProvider 本地开发用的模拟渠道：下单后延迟一段时间以签名回调的方式通知支付成功，退款立即成功。
+// 签名密钥由 PAYMENT_MOCK_SECRET 配置，回调延迟由 PAYMENT_MOCK_DELAY_SECONDS 配置，默认 2 秒
+type mockProvider struct {
+	secret []byte
+}
+
+func newMockProvider(secret string) *mockProvider {
+	return &mockProvider{secret: []byte(secret)}
+}
+
+func (p *mockProvider) Name() string {
+	return "mock"
+}
+
+func (p *mockProvider) CreatePayment(order *models.PaymentOrder) (string, error) {
+	tradeNo := "MOCK" + order.OrderNo
+	callback := PaymentCallback{
+		OrderNo: order.OrderNo,
+		TradeNo: tradeNo,
+		Success: true,
+		Amount:  order.Amount,
+	}
+
+	// 模拟用户完成支付后渠道异步回调，走与真实回调相同的验签和处理流程
+	go func() {
+		time.Sleep(envDuration("PAYMENT_MOCK_DELAY_SECONDS", 2*time.Second))
+		payload, _ := json.Marshal(callback)
+		if err := HandlePaymentCallback(p.Name(), payload, p.Sign(payload)); err != nil {
+			log.Printf("payment: mock callback for order %s failed: %v", callback.OrderNo, err)
+		}
+	}()
+
+	return tradeNo, nil
+}
+
+func (p *mockProvider) Refund(order *models.PaymentOrder, refund *models.PaymentRefund) (string, error) {
+	return "MOCK" + refund.RefundNo, nil
+}
+
+func (p *mockProvider) ParseCallback(payload []byte, signature string) (*PaymentCallback, error) {
+	if !hmac.Equal([]byte(p.Sign(payload)), []byte(signature)) {
+		return nil, ErrInvalidSignature
+	}
+	var callback PaymentCallback
+	if err := json.Unmarshal(payload, &callback); err != nil {
+		return nil, err
+	}
+	return &callback, nil
+}
+
+// Sign 计算回调签名（HMAC-SHA256 十六进制）
+func (p *mockProvider) Sign(payload []byte) string {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,313 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package services
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"urban_traffic_backend/models"
+)
+
+// fakeProvider 记录下单和退款调用的支付渠道，refundErr 不为空时退款失败
+type fakeProvider struct {
+	payments, refunds int
+	refundErr         error
+}
+
+func (p *fakeProvider) Name() string { return "fake" }
+
+func (p *fakeProvider) CreatePayment(order *models.PaymentOrder) (string, error) {
+	p.payments++
+	return "FAKE" + order.OrderNo, nil
+}
+
+func (p *fakeProvider) Refund(order *models.PaymentOrder, refund *models.PaymentRefund) (string, error) {
+	p.refunds++
+	return "FAKE" + refund.RefundNo, p.refundErr
+}
+
+func (p *fakeProvider) ParseCallback([]byte, string) (*PaymentCallback, error) {
+	return nil, ErrInvalidSignature
+}
+
+// registerProvider 注册测试用的支付渠道，测试结束后移除
+func registerProvider(t *testing.T, provider PaymentProvider) {
+	t.Helper()
+	RegisterPaymentProvider(provider)
+	t.Cleanup(func() { delete(paymentProviders, provider.Name()) })
+}
+
+var orderColumns = []string{"id", "order_no", "purpose", "session_id", "parking_lot_id", "amount", "refunded_amount", "provider", "status"}
+
+func orderRow(status string, amount, refunded float64) []driver.Value {
+	return []driver.Value{int64(9), "PO1", models.PaymentPurposeParking, int64(3), int64(1), amount, refunded, "fake", status}
+}
+
+func TestCreatePaymentOrder(t *testing.T) {
+	userID := uint(5)
+	sessionID, otherSessionID := uint(3), uint(4)
+	lot := &models.ParkingLot{ID: 1, PaymentMethods: "现金,微信"}
+
+	tests := []struct {
+		name         string
+		sessionID    uint
+		amount       float64
+		key          string
+		lot          *models.ParkingLot
+		keyOrder     bool // 幂等键已有订单（会话 3）
+		sessionOrder bool // 会话已有未失败的订单
+		wantErr      error
+		wantOrder    uint // 返回已有订单的 ID，为 0 表示新建订单
+		wantStatus   string
+		wantPayments int
+	}{
+		{"相同幂等键返回已有订单", sessionID, 10, "k1", lot, true, false, nil, 9, models.PaymentStatusPending, 0},
+		{"幂等键用于其他会话", otherSessionID, 10, "k1", lot, true, false, ErrIdempotencyConflict, 0, "", 0},
+		{"同一会话已有订单时复用", sessionID, 10, "", lot, false, true, nil, 9, models.PaymentStatusPending, 0},
+		{"新建订单并向渠道下单", sessionID, 10, "k2", lot, false, false, nil, 0, models.PaymentStatusPending, 1},
+		{"金额为0直接完成", sessionID, 0, "", lot, false, false, nil, 0, models.PaymentStatusPaid, 0},
+		{"停车场不支持线上支付", sessionID, 10, "", &models.ParkingLot{ID: 1, PaymentMethods: "现金"}, false, false, ErrPaymentMethodUnavailable, 0, "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PAYMENT_PROVIDER", "fake")
+			provider := &fakeProvider{}
+			registerProvider(t, provider)
+
+			s := &scriptedDB{queries: []scriptedQuery{
+				{match: "from `parking_sessions`", columns: []string{"id", "status"}, rows: [][]driver.Value{{int64(3), "ended"}}},
+			}}
+			if tt.keyOrder {
+				s.queries = append(s.queries, scriptedQuery{match: "idempotency_key = ?", columns: orderColumns,
+					rows: [][]driver.Value{orderRow(models.PaymentStatusPending, 10, 0)}})
+			}
+			if tt.sessionOrder {
+				s.queries = append(s.queries, scriptedQuery{match: "and status <> ?", columns: orderColumns,
+					rows: [][]driver.Value{orderRow(models.PaymentStatusPending, 10, 0)}})
+			}
+			s.open(t)
+
+			sid := tt.sessionID
+			order, err := CreatePaymentOrder(PaymentRequest{
+				UserID:         &userID,
+				ParkingLot:     tt.lot,
+				Purpose:        models.PaymentPurposeParking,
+				SessionID:      &sid,
+				Amount:         tt.amount,
+				IdempotencyKey: tt.key,
+			})
+			if err != tt.wantErr {
+				t.Fatalf("CreatePaymentOrder() error = %v, want %v", err, tt.wantErr)
+			}
+			if provider.payments != tt.wantPayments {
+				t.Errorf("provider payments = %d, want %d", provider.payments, tt.wantPayments)
+			}
+			if err != nil {
+				s.checkExecuted(t, nil, []string{"insert into `payment_orders`"})
+				return
+			}
+			if order.Status != tt.wantStatus {
+				t.Errorf("order status = %s, want %s", order.Status, tt.wantStatus)
+			}
+			if tt.wantOrder != 0 {
+				if order.ID != tt.wantOrder {
+					t.Errorf("order id = %d, want existing order %d", order.ID, tt.wantOrder)
+				}
+				s.checkExecuted(t, nil, []string{"insert into `payment_orders`"})
+				return
+			}
+			s.checkExecuted(t, []string{"insert into `payment_orders`"}, nil)
+			if order.Method != "微信" || order.Provider != "fake" {
+				t.Errorf("order method/provider = %s/%s, want 微信/fake", order.Method, order.Provider)
+			}
+		})
+	}
+}
+
+func TestHandlePaymentCallback(t *testing.T) {
+	provider := newMockProvider("secret")
+	callback := func(success bool, amount float64) []byte {
+		payload, _ := json.Marshal(PaymentCallback{OrderNo: "PO1", TradeNo: "T1", Success: success, Amount: amount})
+		return payload
+	}
+
+	tests := []struct {
+		name       string
+		order      []driver.Value // 为 nil 表示订单不存在
+		payload    []byte
+		signature  string // 为空时使用正确签名
+		wantErr    error
+		wantExec   []string
+		wantNoExec []string
+	}{
+		{
+			"签名无效", orderRow(models.PaymentStatusPending, 10, 0), callback(true, 10), "bad", ErrInvalidSignature,
+			nil, []string{"update `payment_orders`"},
+		},
+		{
+			"订单不存在", nil, callback(true, 10), "", ErrOrderNotFound,
+			nil, []string{"update `payment_orders`"},
+		},
+		{
+			"重复回调不再处理", orderRow(models.PaymentStatusPaid, 10, 0), callback(true, 10), "", nil,
+			nil, []string{"update `payment_orders`", "insert into `ledger_entries`"},
+		},
+		{
+			"金额不一致", orderRow(models.PaymentStatusPending, 10, 0), callback(true, 8), "", ErrCallbackAmountMismatch,
+			nil, []string{"update `payment_orders`", "insert into `ledger_entries`"},
+		},
+		{
+			"支付失败", orderRow(models.PaymentStatusPending, 10, 0), callback(false, 10), "", nil,
+			[]string{"[" + models.PaymentStatusFailed + "]"}, []string{"insert into `ledger_entries`", "update `parking_sessions`"},
+		},
+		{
+			"支付成功记录流水并标记会话已支付", orderRow(models.PaymentStatusPending, 10, 0), callback(true, 10), "", nil,
+			[]string{"[" + models.PaymentStatusPaid + "]", "insert into `ledger_entries`", "update `parking_sessions`"}, nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registerProvider(t, provider)
+			s := &scriptedDB{}
+			if tt.order != nil {
+				row := append([]driver.Value(nil), tt.order...)
+				row[7] = provider.Name()
+				s.queries = append(s.queries, scriptedQuery{match: "from `payment_orders`", columns: orderColumns, rows: [][]driver.Value{row}})
+			}
+			s.open(t)
+
+			signature := tt.signature
+			if signature == "" {
+				signature = provider.Sign(tt.payload)
+			}
+			if err := HandlePaymentCallback(provider.Name(), tt.payload, signature); err != tt.wantErr {
+				t.Fatalf("HandlePaymentCallback() error = %v, want %v", err, tt.wantErr)
+			}
+			s.checkExecuted(t, tt.wantExec, tt.wantNoExec)
+		})
+	}
+}
+
+// TestRefundOrder 累计退款（含处理中的退款）不超过订单金额，相同幂等键返回同一退款单
+func TestRefundOrder(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      string
+		refunded    float64 // 订单已退款金额，订单金额为 100
+		pending     float64 // 处理中的退款金额
+		key         string
+		existing    bool // 幂等键已有退款单
+		amount      float64
+		refundErr   error
+		wantErr     error
+		wantRefunds int
+		wantExec    []string
+		wantNoExec  []string
+	}{
+		{
+			"部分退款", models.PaymentStatusPaid, 0, 0, "", false, 30, nil, nil, 1,
+			[]string{"insert into `payment_refunds`", "[" + models.PaymentStatusPartiallyRefunded + "]", "insert into `ledger_entries`"}, nil,
+		},
+		{
+			"退完剩余金额", models.PaymentStatusPartiallyRefunded, 70, 0, "", false, 30, nil, nil, 1,
+			[]string{"[" + models.PaymentStatusRefunded + "]", "insert into `ledger_entries`"}, nil,
+		},
+		{
+			"处理中的退款占用可退金额", models.PaymentStatusPartiallyRefunded, 50, 30, "", false, 30, nil, ErrInvalidRefundAmount, 0,
+			nil, []string{"insert into `payment_refunds`"},
+		},
+		{
+			"退款金额为0", models.PaymentStatusPaid, 0, 0, "", false, 0, nil, ErrInvalidRefundAmount, 0,
+			nil, []string{"insert into `payment_refunds`"},
+		},
+		{
+			"未支付订单不可退款", models.PaymentStatusPending, 0, 0, "", false, 10, nil, ErrRefundNotAllowed, 0,
+			nil, []string{"insert into `payment_refunds`"},
+		},
+		{
+			"已全额退款不可再退", models.PaymentStatusRefunded, 100, 0, "", false, 10, nil, ErrRefundNotAllowed, 0,
+			nil, []string{"insert into `payment_refunds`"},
+		},
+		{
+			"相同幂等键返回已有退款单", models.PaymentStatusRefunded, 100, 0, "k1", true, 30, nil, nil, 0,
+			nil, []string{"insert into `payment_refunds`", "update `payment_orders`"},
+		},
+		{
+			"渠道退款失败", models.PaymentStatusPaid, 0, 0, "k2", false, 30, errors.New("渠道异常"), nil, 1,
+			[]string{"insert into `payment_refunds`", "[" + models.RefundStatusFailed + "]"},
+			[]string{"update `payment_orders`", "insert into `ledger_entries`"},
+		},
+	}
+
+	refundColumns := []string{"id", "refund_no", "order_id", "amount", "status"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &fakeProvider{refundErr: tt.refundErr}
+			registerProvider(t, provider)
+
+			s := &scriptedDB{queries: []scriptedQuery{
+				{match: "from `payment_orders`", columns: orderColumns, rows: [][]driver.Value{orderRow(tt.status, 100, tt.refunded)}},
+				{match: "coalesce(sum(amount), 0)", columns: []string{"total"}, rows: [][]driver.Value{{tt.pending}}},
+				{match: "`payment_refunds`.`id` = ?", columns: refundColumns,
+					rows: [][]driver.Value{{int64(1), "RF1", int64(9), tt.amount, models.RefundStatusPending}}},
+			}}
+			if tt.existing {
+				s.queries = append(s.queries, scriptedQuery{match: "idempotency_key = ?", columns: refundColumns,
+					rows: [][]driver.Value{{int64(2), "RF0", int64(9), 30.0, models.RefundStatusSucceeded}}})
+			}
+			s.open(t)
+
+			refund, err := RefundOrder("PO1", tt.amount, "测试", tt.key, nil)
+			if err != tt.wantErr {
+				t.Fatalf("RefundOrder() error = %v, want %v", err, tt.wantErr)
+			}
+			if provider.refunds != tt.wantRefunds {
+				t.Errorf("provider refunds = %d, want %d", provider.refunds, tt.wantRefunds)
+			}
+			if tt.existing && (refund == nil || refund.RefundNo != "RF0") {
+				t.Errorf("RefundOrder() = %+v, want existing refund RF0", refund)
+			}
+			s.checkExecuted(t, tt.wantExec, tt.wantNoExec)
+		})
+	}
+}
+
+func TestMockProviderParseCallback(t *testing.T) {
+	provider := newMockProvider("secret")
+	payload, _ := json.Marshal(PaymentCallback{OrderNo: "PO1", TradeNo: "T1", Success: true, Amount: 10})
+
+	tests := []struct {
+		name      string
+		payload   []byte
+		signature string
+		wantErr   error
+	}{
+		{"签名正确", payload, provider.Sign(payload), nil},
+		{"内容被篡改", append(append([]byte(nil), payload[:len(payload)-1]...), ' ', '}'), provider.Sign(payload), ErrInvalidSignature},
+		{"其他密钥的签名", payload, newMockProvider("other").Sign(payload), ErrInvalidSignature},
+		{"空签名", payload, "", ErrInvalidSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			callback, err := provider.ParseCallback(tt.payload, tt.signature)
+			if err != tt.wantErr {
+				t.Fatalf("ParseCallback() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (callback.OrderNo != "PO1" || callback.Amount != 10 || !callback.Success) {
+				t.Errorf("ParseCallback() = %+v", callback)
+			}
+		})
+	}
+}
@@ -0,0 +1,545 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"urban_traffic_backend/models"
+
+	"gorm.io/gorm"
+)
+
+// FeeItem 费用明细项
+type FeeItem struct {
+	Name      string  `json:"name"`
+	Quantity  int     `json:"quantity"`
+	UnitPrice float64 `json:"unit_price"`
+	Amount    float64 `json:"amount"`
+}
+
+// FeeQuote 计费结果
+type FeeQuote struct {
+	TariffID        *uint        `json:"tariff_id"`
+	Total           float64      `json:"total"`
+	Surcharge       float64      `json:"surcharge"` // 其中特殊车位附加费
+	Items           []FeeItem    `json:"items"`
+	Bands           []BandCharge `json:"bands,omitempty"`   // 分时段计费明细
+	BillingCycle    int          `json:"billing_cycle"`     // 已计费周期数
+	CycleMinutes    int          `json:"cycle_minutes"`     // 当前计费周期长度（分钟）
+	NextBillingTime *time.Time   `json:"next_billing_time"` // 下次计费时间
+	NextFeeAmount   *float64     `json:"next_fee_amount"`   // 下次计费增加的金额
+	Description     string       `json:"description"`       // 计费规则描述
+}
+
+// PricingRule 计费规则，不同 RuleType 的收费标准注册各自的实现
+type PricingRule interface {
+	// Fee 计算 [start, end] 时间段的停车费明细（不含车位附加费）
+	Fee(tariff *models.ParkingTariff, start, end time.Time) []FeeItem
+	// NextBoundary 返回 now 之后费用下一次上涨的时间点，不再上涨时返回零值
+	NextBoundary(tariff *models.ParkingTariff, start, now time.Time) time.Time
+	// CycleMinutes 返回 now 所在计费周期的长度（分钟）
+	CycleMinutes(tariff *models.ParkingTariff, start, now time.Time) int
+	// Describe 返回展示给用户的规则描述
+	Describe(tariff *models.ParkingTariff) string
+}
+
+// boundaryLookahead 查找下次计费时间时最多向后查找的时长。
+// 达到时段封顶或每日封顶后，最迟在下一个 24 小时周期开始时恢复计费；
+// 达到整个停车期间封顶（MaxFee）后不再计费，不返回下次计费时间
+const boundaryLookahead = 25 * time.Hour
+
+// maxBoundarySteps 查找下次计费时间时逐个检查的边界数，超过后在剩余的查找时长内二分查找
+const maxBoundarySteps = 48
+
+// maxFeeItemName 整个停车期间封顶（MaxFee）的优惠明细名称，出现该明细后费用不会再上涨
+const maxFeeItemName = "封顶优惠"
+
+var pricingRules = map[string]PricingRule{
+	"standard": standardRule{},
+	"banded":   bandedRule{},
+}
+
+// RegisterPricingRule 注册计费规则
+func RegisterPricingRule(ruleType string, rule PricingRule) {
+	pricingRules[ruleType] = rule
+}
+
+// IsPricingRuleRegistered 判断计费规则类型是否可用
+func IsPricingRuleRegistered(ruleType string) bool {
+	_, ok := pricingRules[ruleType]
+	return ok
+}
+
+// DefaultTariff 停车场未配置收费标准时，由 HourlyRate 推导：首小时按小时费率，后续每小时半价
+func DefaultTariff(lot *models.ParkingLot, spotType string) *models.ParkingTariff {
+	return &models.ParkingTariff{
+		ParkingLotID:       lot.ID,
+		SpotType:           spotType,
+		RuleType:           "standard",
+		FirstPeriodMinutes: 60,
+		FirstPeriodPrice:   lot.HourlyRate,
+		UnitMinutes:        60,
+		UnitPrice:          roundMoney(lot.HourlyRate / 2),
+		IsActive:           true,
+	}
+}
+
+// FindTariff 查找停车场某车位类型在指定时间生效的收费标准，
+// 没有该车位类型的标准时使用普通车位标准，仍没有则使用默认标准
+func FindTariff(db *gorm.DB, lot *models.ParkingLot, spotType string, at time.Time) (*models.ParkingTariff, error) {
+	if spotType == "" {
+		spotType = "normal"
+	}
+	spotTypes := []string{spotType}
+	if spotType != "normal" {
+		spotTypes = append(spotTypes, "normal")
+	}
+
+	for _, st := range spotTypes {
+		var tariff models.ParkingTariff
+		err := db.Preload("Bands").
+			Where("parking_lot_id = ? AND spot_type = ? AND is_active = ? AND effective_from <= ?", lot.ID, st, true, at).
+			Order("effective_from desc, version desc").
+			First(&tariff).Error
+		if err == nil {
+			return &tariff, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	return DefaultTariff(lot, spotType), nil
+}
+
+// QuoteSession 计算停车会话截至 at 的费用，所有处理器统一通过此函数计费
+func QuoteSession(db *gorm.DB, session *models.ParkingSession, at time.Time) (*FeeQuote, error) {
+	var lot models.ParkingLot
+	if err := db.First(&lot, session.ParkingLotID).Error; err != nil {
+		return nil, err
+	}
+
+	// 会话开始时锁定收费标准版本，后续调价不影响进行中的会话
+	var tariff *models.ParkingTariff
+	if session.TariffID != nil {
+		var t models.ParkingTariff
+		if err := db.Unscoped().Preload("Bands").First(&t, *session.TariffID).Error; err == nil {
+			tariff = &t
+		}
+	}
+	if tariff == nil {
+		var err error
+		tariff, err = FindTariff(db, &lot, session.SpotType, session.StartTime)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var surcharge float64
+	if session.SpotType != "" && session.SpotType != "normal" {
+		var spot models.SpecialSpot
+		if err := db.Where("parking_lot_id = ? AND spot_type = ?", lot.ID, session.SpotType).First(&spot).Error; err == nil {
+			surcharge = spot.AdditionalFee
+		}
+	}
+
+	// 月卡或白名单有效期内免收停车费，到期（或取消、移出名单）后从该时刻起按收费标准计费
+	start := session.StartTime
+	var note string
+	unlimited := false
+	if session.PassID != nil {
+		var pass models.ParkingPass
+		if err := db.Unscoped().First(&pass, *session.PassID).Error; err == nil {
+			coveredUntil := pass.ValidUntil
+			if pass.CancelledAt != nil && pass.CancelledAt.Before(coveredUntil) {
+				coveredUntil = *pass.CancelledAt
+			}
+			if coveredUntil.After(start) {
+				start = coveredUntil
+			}
+			note = "月卡有效期内免费，"
+		}
+	}
+	if session.AccessEntryID != nil {
+		var entry models.AccessListEntry
+		if err := db.Unscoped().First(&entry, *session.AccessEntryID).Error; err == nil {
+			coveredUntil := entry.ValidUntil
+			if entry.DeletedAt.Valid && (coveredUntil == nil || entry.DeletedAt.Time.Before(*coveredUntil)) {
+				coveredUntil = &entry.DeletedAt.Time
+			}
+			if coveredUntil == nil {
+				unlimited = true
+			} else if coveredUntil.After(start) {
+				start = *coveredUntil
+			}
+			note = "白名单车辆免费，"
+		}
+	}
+
+	if unlimited {
+		start = at
+	}
+	if err := LoadTariffHolidays(db, tariff, start, at); err != nil {
+		return nil, err
+	}
+	quote, err := QuoteTariff(tariff, session.SpotType, surcharge, start, at)
+	if err != nil {
+		return nil, err
+	}
+	if unlimited {
+		quote.NextBillingTime = nil
+		quote.NextFeeAmount = nil
+	}
+	quote.Description = note + quote.Description
+	return quote, nil
+}
+
+// QuoteTariff 按收费标准计算 [start, at] 的费用，surcharge 为特殊车位附加费
+func QuoteTariff(tariff *models.ParkingTariff, spotType string, surcharge float64, start, at time.Time) (*FeeQuote, error) {
+	rule, ok := pricingRules[tariff.RuleType]
+	if !ok {
+		return nil, fmt.Errorf("unknown pricing rule type: %s", tariff.RuleType)
+	}
+	if at.Before(start) {
+		at = start
+	}
+
+	quote := &FeeQuote{
+		Items:        rule.Fee(tariff, start, at),
+		CycleMinutes: rule.CycleMinutes(tariff, start, at),
+		Description:  rule.Describe(tariff),
+	}
+	if tariff.ID != 0 {
+		quote.TariffID = &tariff.ID
+	}
+	if breakdown, ok := rule.(BreakdownRule); ok {
+		quote.Bands = breakdown.Breakdown(tariff, start, at)
+	}
+
+	for _, item := range quote.Items {
+		quote.Total += item.Amount
+		if item.Amount > 0 {
+			quote.BillingCycle += item.Quantity
+		}
+	}
+
+	// 特殊车位附加费在开始计费后按次收取
+	if surcharge > 0 && quote.Total > 0 {
+		quote.Items = append(quote.Items, FeeItem{Name: SpotTypeName(spotType) + "附加费", Quantity: 1, UnitPrice: surcharge, Amount: surcharge})
+		quote.Total += surcharge
+		quote.Surcharge = surcharge
+	}
+	quote.Total = roundMoney(quote.Total)
+
+	quote.NextBillingTime, quote.NextFeeAmount = nextIncrease(rule, tariff, surcharge, start, at, quote.Total)
+	return quote, nil
+}
+
+// nextIncrease 查找 at 之后费用上涨的时间和金额，boundaryLookahead 内不再上涨时返回 nil。
+// 计费按分钟向上取整，越过边界一秒即进入下一计费周期；封顶后边界不一定涨价，先逐个边界向后查找，
+// 达到整个停车期间封顶后停止；超过 maxBoundarySteps 个边界（如每日封顶后按分钟计费）时，
+// 利用费用随时间单调不减在剩余时长内二分查找
+func nextIncrease(rule PricingRule, tariff *models.ParkingTariff, surcharge float64, start, at time.Time, total float64) (*time.Time, *float64) {
+	feeAt := func(t time.Time) (float64, bool) {
+		items := rule.Fee(tariff, start, t)
+		amount := sumItems(items)
+		if surcharge > 0 && amount > 0 {
+			amount += surcharge
+		}
+		capped := false
+		for _, item := range items {
+			capped = capped || item.Name == maxFeeItemName
+		}
+		return roundMoney(amount), capped
+	}
+
+	limit := at.Add(boundaryLookahead)
+	cursor := at
+	for step := 0; step < maxBoundarySteps; step++ {
+		next := rule.NextBoundary(tariff, start, cursor)
+		if next.IsZero() || next.Before(cursor) || next.After(limit) {
+			return nil, nil
+		}
+		nextTotal, capped := feeAt(next.Add(time.Second))
+		if increase := roundMoney(nextTotal - total); increase > 0 {
+			return &next, &increase
+		}
+		if capped {
+			return nil, nil
+		}
+		cursor = next.Add(time.Second)
+	}
+
+	// 计费时长按入场后的整秒计算，在整秒上查找，lo 处尚未上涨、hi 处已上涨
+	second := func(n int64) time.Time { return start.Add(time.Duration(n) * time.Second) }
+	lo := int64(cursor.Sub(start) / time.Second)
+	hi := int64((limit.Sub(start) + time.Second - 1) / time.Second)
+	hiTotal, _ := feeAt(second(hi))
+	if hiTotal <= total {
+		return nil, nil
+	}
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		if midTotal, _ := feeAt(second(mid)); midTotal > total {
+			hi, hiTotal = mid, midTotal
+		} else {
+			lo = mid
+		}
+	}
+	next := second(lo)
+	increase := roundMoney(hiTotal - total)
+	return &next, &increase
+}
+
+// DescribeTariff 返回收费标准的规则描述
+func DescribeTariff(tariff *models.ParkingTariff) string {
+	if rule, ok := pricingRules[tariff.RuleType]; ok {
+		return rule.Describe(tariff)
+	}
+	return ""
+}
+
+// ApplyQuote 将计费结果写入会话的计费字段
+func ApplyQuote(session *models.ParkingSession, quote *FeeQuote) {
+	session.TariffID = quote.TariffID
+	session.FeeCurrent = quote.Total
+	session.FeeSurcharge = quote.Surcharge
+	session.NextBillingTime = quote.NextBillingTime
+	session.NextFeeAmount = quote.NextFeeAmount
+	session.CurrentBillingCycle = quote.BillingCycle
+	session.PricingRule = quote.Description
+}
+
+// SaveSettledFeeItems 会话结算时保存费用明细，之后调价或月卡、白名单变化不影响按结算明细开具的收据
+func SaveSettledFeeItems(tx *gorm.DB, sessionID uint, quote *FeeQuote) error {
+	if err := tx.Where("session_id = ?", sessionID).Delete(&models.SessionFeeItem{}).Error; err != nil {
+		return err
+	}
+	if len(quote.Items) == 0 {
+		return nil
+	}
+	items := make([]models.SessionFeeItem, 0, len(quote.Items))
+	for _, item := range quote.Items {
+		items = append(items, models.SessionFeeItem{
+			SessionID: sessionID,
+			Name:      item.Name,
+			Quantity:  item.Quantity,
+			UnitPrice: item.UnitPrice,
+			Amount:    item.Amount,
+		})
+	}
+	return tx.Create(&items).Error
+}
+
+// standardRule 标准计费规则，与 coze/charge/Parking_charging_system.py 的计费公式相同：
+// 起步价 + min(封顶, 超出首段的计费单位数 × 单位价格)，另可按每 24 小时封顶，见 models.ParkingTariff
+type standardRule struct{}
+
+func (standardRule) Fee(t *models.ParkingTariff, start, end time.Time) []FeeItem {
+	minutes := billableMinutes(start, end)
+	if minutes <= t.FreeMinutes {
+		return nil
+	}
+
+	items := []FeeItem{{Name: "首段费用", Quantity: 1, UnitPrice: t.FirstPeriodPrice, Amount: t.FirstPeriodPrice}}
+	total := t.FirstPeriodPrice
+	units := standardUnits(t, minutes)
+	if units > 0 {
+		amount := roundMoney(float64(units) * t.UnitPrice)
+		items = append(items, FeeItem{Name: "计时费用", Quantity: units, UnitPrice: t.UnitPrice, Amount: amount})
+		total += amount
+	}
+
+	if t.DailyCap > 0 {
+		var discount float64
+		for _, fee := range standardDayFees(t, units) {
+			if fee > t.DailyCap {
+				discount += fee - t.DailyCap
+			}
+		}
+		if discount = roundMoney(discount); discount > 0 {
+			items = append(items, FeeItem{Name: "每日封顶优惠", Quantity: 1, UnitPrice: -discount, Amount: -discount})
+			total -= discount
+		}
+	}
+	// 封顶只作用于首段之后的费用，整个停车期间只封顶一次
+	if t.MaxFee > 0 && total-t.FirstPeriodPrice > t.MaxFee {
+		discount := roundMoney(total - t.FirstPeriodPrice - t.MaxFee)
+		items = append(items, FeeItem{Name: maxFeeItemName, Quantity: 1, UnitPrice: -discount, Amount: -discount})
+	}
+	return items
+}
+
+// standardDayFees 按入场起算的 24 小时周期汇总费用：首段费用计入第一个周期，
+// 计费单位按开始时间归入所在的周期
+func standardDayFees(t *models.ParkingTariff, units int) []float64 {
+	const day = 24 * 60
+	unitMinutes := maxInt(t.UnitMinutes, 1)
+	// 第 i 个计费单位从首段之后 i 个计费单位处开始，返回开始于 minute 之前的计费单位数
+	unitsBefore := func(minute int) int {
+		if minute <= t.FirstPeriodMinutes {
+			return 0
+		}
+		n := (minute - t.FirstPeriodMinutes + unitMinutes - 1) / unitMinutes
+		if n > units {
+			return units
+		}
+		return n
+	}
+
+	days := 1
+	if units > 0 {
+		days = (t.FirstPeriodMinutes+(units-1)*unitMinutes)/day + 1
+	}
+	fees := make([]float64, days)
+	fees[0] = t.FirstPeriodPrice
+	for k := range fees {
+		fees[k] += float64(unitsBefore((k+1)*day)-unitsBefore(k*day)) * t.UnitPrice
+	}
+	return fees
+}
+
+// standardUnits 超出首段的计费单位数，首段时长等于计费单位时即 ceil(minutes/unit) - 1
+func standardUnits(t *models.ParkingTariff, minutes int) int {
+	unitMinutes := maxInt(t.UnitMinutes, 1)
+	if minutes <= t.FirstPeriodMinutes {
+		return 0
+	}
+	return (minutes - t.FirstPeriodMinutes + unitMinutes - 1) / unitMinutes
+}
+
+func (standardRule) NextBoundary(t *models.ParkingTariff, start, now time.Time) time.Time {
+	minutes := billableMinutes(start, now)
+
+	var boundary int
+	switch {
+	case minutes <= t.FreeMinutes:
+		boundary = t.FreeMinutes
+	case minutes <= t.FirstPeriodMinutes:
+		boundary = t.FirstPeriodMinutes
+	default:
+		boundary = t.FirstPeriodMinutes + standardUnits(t, minutes)*maxInt(t.UnitMinutes, 1)
+	}
+
+	return start.Add(time.Duration(boundary) * time.Minute)
+}
+
+func (standardRule) CycleMinutes(t *models.ParkingTariff, start, now time.Time) int {
+	minutes := billableMinutes(start, now)
+	if minutes <= t.FreeMinutes && t.FreeMinutes > 0 {
+		return t.FreeMinutes
+	}
+	if minutes <= t.FirstPeriodMinutes {
+		return maxInt(t.FirstPeriodMinutes, 1)
+	}
+	return maxInt(t.UnitMinutes, 1)
+}
+
+func (standardRule) Describe(t *models.ParkingTariff) string {
+	var parts []string
+	if t.FreeMinutes > 0 {
+		parts = append(parts, fmt.Sprintf("%d分钟内免费", t.FreeMinutes))
+	}
+	parts = append(parts, fmt.Sprintf("首%s%s元", durationName(t.FirstPeriodMinutes), formatMoney(t.FirstPeriodPrice)))
+	parts = append(parts, fmt.Sprintf("后续每%s%s元", durationName(t.UnitMinutes), formatMoney(t.UnitPrice)))
+	if t.DailyCap > 0 {
+		parts = append(parts, fmt.Sprintf("每日封顶%s元", formatMoney(t.DailyCap)))
+	}
+	if t.MaxFee > 0 {
+		parts = append(parts, fmt.Sprintf("首段后最多收取%s元", formatMoney(t.MaxFee)))
+	}
+	return strings.Join(parts, "，")
+}
+
+// billableMinutes 计费时长按分钟向上取整
+func billableMinutes(start, end time.Time) int {
+	seconds := int(end.Sub(start).Seconds())
+	if seconds <= 0 {
+		return 0
+	}
+	return (seconds + 59) / 60
+}
+
+// mergeFeeItems 合并同名明细
+func mergeFeeItems(items []FeeItem) []FeeItem {
+	var merged []FeeItem
+	index := make(map[string]int)
+	for _, item := range items {
+		if i, ok := index[item.Name]; ok {
+			merged[i].Quantity += item.Quantity
+			merged[i].Amount = roundMoney(merged[i].Amount + item.Amount)
+			continue
+		}
+		index[item.Name] = len(merged)
+		merged = append(merged, item)
+	}
+	return merged
+}
+
+func sumItems(items []FeeItem) float64 {
+	var total float64
+	for _, item := range items {
+		total += item.Amount
+	}
+	return total
+}
+
+// SpotTypeName 车位类型中文名称
+func SpotTypeName(spotType string) string {
+	switch spotType {
+	case "charging":
+		return "充电车位"
+	case "disabled":
+		return "无障碍车位"
+	case "vip":
+		return "VIP车位"
+	default:
+		return "普通车位"
+	}
+}
+
+func durationName(minutes int) string {
+	if minutes%60 == 0 {
+		if minutes == 60 {
+			return "小时"
+		}
+		return fmt.Sprintf("%d小时", minutes/60)
+	}
+	return fmt.Sprintf("%d分钟", minutes)
+}
+
+func formatMoney(amount float64) string {
+	if amount == math.Trunc(amount) {
+		return fmt.Sprintf("%.0f", amount)
+	}
+	return fmt.Sprintf("%.2f", amount)
+}
+
+func roundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,382 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"urban_traffic_backend/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidTariffBand 时段价格参数不合法
+	ErrInvalidTariffBand = errors.New("时段价格参数无效：时间须为 HH:MM，计费单位须大于0，价格和封顶不能为负")
+	// ErrTariffBandOverlap 同一日期类型的时段价格重叠
+	ErrTariffBandOverlap = errors.New("同一日期类型的时段价格不能重叠")
+	// ErrTariffBandsRequired 分时段规则未配置时段价格
+	ErrTariffBandsRequired = errors.New("分时段计费规则至少需要一个时段价格")
+)
+
+// baseBandName 未被时段覆盖的时间在明细中的名称
+const baseBandName = "其他时段"
+
+// BandCharge 分时段计费明细：停车时间落在某个时段价格上的一段及其费用
+type BandCharge struct {
+	Name      string    `json:"name"`
+	DayType   string    `json:"day_type,omitempty"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	Minutes   int       `json:"minutes"`
+	Units     int       `json:"units"`
+	UnitPrice float64   `json:"unit_price"`
+	Amount    float64   `json:"amount"` // 时段封顶后的金额
+	Capped    bool      `json:"capped"` // 是否已达到时段封顶
+}
+
+// BreakdownRule 可按时段给出计费明细的计费规则
+type BreakdownRule interface {
+	Breakdown(tariff *models.ParkingTariff, start, end time.Time) []BandCharge
+}
+
+// ValidateTariffBands 校验时段价格：时间、计费单位和价格合法，同一日期类型的时段（含跨夜部分）互不重叠
+func ValidateTariffBands(bands []models.TariffBand) error {
+	type span struct{ from, to int }
+	spans := make(map[string][]span)
+	for i := range bands {
+		band := &bands[i]
+		if band.DayType == "" {
+			band.DayType = models.TariffDayWeekday
+		}
+		if !models.IsValidTariffDayType(band.DayType) || band.UnitMinutes <= 0 || band.UnitPrice < 0 || band.Cap < 0 {
+			return ErrInvalidTariffBand
+		}
+		if ValidateHoursRange(band.StartTime, band.EndTime) != nil {
+			return ErrInvalidTariffBand
+		}
+		from, _ := clockMinutes(band.StartTime)
+		to, _ := clockMinutes(band.EndTime)
+		if to < from {
+			to += 24 * 60
+		}
+		for _, other := range spans[band.DayType] {
+			// 跨夜时段会延续到次日，与前后一天的时段一起比较
+			for _, shift := range []int{-24 * 60, 0, 24 * 60} {
+				if from < other.to+shift && other.from+shift < to {
+					return ErrTariffBandOverlap
+				}
+			}
+		}
+		spans[band.DayType] = append(spans[band.DayType], span{from, to})
+	}
+	return nil
+}
+
+// LoadTariffHolidays 为分时段收费标准填充 [from, to] 内停车场的节假日日期
+func LoadTariffHolidays(db *gorm.DB, tariff *models.ParkingTariff, from, to time.Time) error {
+	if len(tariff.Bands) == 0 {
+		return nil
+	}
+	var dates []string
+	if err := db.Model(&models.ParkingLotHoliday{}).
+		Where("parking_lot_id = ? AND date BETWEEN ? AND ?", tariff.ParkingLotID,
+			from.In(time.Local).AddDate(0, 0, -1).Format("2006-01-02"), to.In(time.Local).Format("2006-01-02")).
+		Pluck("date", &dates).Error; err != nil {
+		return err
+	}
+	tariff.Holidays = make(map[string]bool, len(dates))
+	for _, date := range dates {
+		tariff.Holidays[date] = true
+	}
+	return nil
+}
+
+// bandSegment 停车时间落在同一个时段价格上的连续一段，band 为 nil 表示按基础单价计费
+type bandSegment struct {
+	band     *models.TariffBand
+	from, to time.Time
+}
+
+// dayBands 某天适用的时段价格：节假日优先使用节假日价格，其次周末价格，都未配置时使用工作日价格
+func dayBands(t *models.ParkingTariff, day time.Time) []*models.TariffBand {
+	var dayTypes []string
+	if t.Holidays[day.Format("2006-01-02")] {
+		dayTypes = append(dayTypes, models.TariffDayHoliday)
+	}
+	if weekday := day.Weekday(); weekday == time.Saturday || weekday == time.Sunday {
+		dayTypes = append(dayTypes, models.TariffDayWeekend)
+	}
+	dayTypes = append(dayTypes, models.TariffDayWeekday)
+
+	for _, dayType := range dayTypes {
+		var result []*models.TariffBand
+		for i := range t.Bands {
+			if t.Bands[i].DayType == dayType {
+				result = append(result, &t.Bands[i])
+			}
+		}
+		if len(result) > 0 {
+			return result
+		}
+	}
+	return nil
+}
+
+// bandSegments 把 [start, end) 按时段价格切分，时段重叠时（如周五夜间延续到周六）先开始的时段优先
+func bandSegments(t *models.ParkingTariff, start, end time.Time) []bandSegment {
+	start, end = start.In(time.Local), end.In(time.Local)
+	if !end.After(start) {
+		return nil
+	}
+
+	var occurrences []bandSegment
+	first := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.Local).AddDate(0, 0, -1)
+	for day := first; day.Before(end); day = day.AddDate(0, 0, 1) {
+		for _, band := range dayBands(t, day) {
+			if interval, ok := intervalOn(day, band.StartTime, band.EndTime); ok {
+				occurrences = append(occurrences, bandSegment{band: band, from: interval.start, to: interval.end})
+			}
+		}
+	}
+	sort.SliceStable(occurrences, func(i, j int) bool {
+		return occurrences[i].from.Before(occurrences[j].from)
+	})
+
+	var segments []bandSegment
+	cursor := start
+	for _, occurrence := range occurrences {
+		if !cursor.Before(end) {
+			break
+		}
+		if !occurrence.to.After(cursor) {
+			continue
+		}
+		if occurrence.from.After(cursor) {
+			gapEnd := minTime(occurrence.from, end)
+			segments = append(segments, bandSegment{from: cursor, to: gapEnd})
+			cursor = gapEnd
+			if !cursor.Before(end) {
+				break
+			}
+		}
+		segmentEnd := minTime(occurrence.to, end)
+		segments = append(segments, bandSegment{band: occurrence.band, from: cursor, to: segmentEnd})
+		cursor = segmentEnd
+	}
+	if cursor.Before(end) {
+		segments = append(segments, bandSegment{from: cursor, to: end})
+	}
+	return segments
+}
+
+// segmentUnit 分段的计费单位和单价
+func segmentUnit(t *models.ParkingTariff, segment bandSegment) (int, float64) {
+	if segment.band == nil {
+		return maxInt(t.UnitMinutes, 1), t.UnitPrice
+	}
+	return maxInt(segment.band.UnitMinutes, 1), segment.band.UnitPrice
+}
+
+// bandName 时段在明细中的名称
+func bandName(band *models.TariffBand) string {
+	if band == nil {
+		return baseBandName
+	}
+	if band.Name != "" {
+		return band.Name
+	}
+	return band.StartTime + "-" + band.EndTime
+}
+
+// dayTypeNames 日期类型的展示名称，按展示顺序排列
+var dayTypeNames = []struct{ dayType, name string }{
+	{models.TariffDayWeekday, "工作日"},
+	{models.TariffDayWeekend, "周末"},
+	{models.TariffDayHoliday, "节假日"},
+}
+
+func dayTypeName(dayType string) string {
+	for _, dt := range dayTypeNames {
+		if dt.dayType == dayType {
+			return dt.name
+		}
+	}
+	return ""
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+// bandedRule 分时段计费规则：不同时段（工作日/周末/节假日）按各自单价分段计费，
+// 每段单独按计费单位向上取整，可设置单次时段封顶，每 24 小时费用不超过 DailyCap，
+// 整个停车期间不超过 MaxFee
+type bandedRule struct{}
+
+func (bandedRule) Breakdown(t *models.ParkingTariff, start, end time.Time) []BandCharge {
+	if billableMinutes(start, end) <= t.FreeMinutes {
+		return nil
+	}
+
+	var charges []BandCharge
+	for _, segment := range bandSegments(t, start, end) {
+		unitMinutes, unitPrice := segmentUnit(t, segment)
+		minutes := billableMinutes(segment.from, segment.to)
+		units := (minutes + unitMinutes - 1) / unitMinutes
+		charge := BandCharge{
+			Name:      bandName(segment.band),
+			StartTime: segment.from,
+			EndTime:   segment.to,
+			Minutes:   minutes,
+			Units:     units,
+			UnitPrice: unitPrice,
+			Amount:    roundMoney(float64(units) * unitPrice),
+		}
+		if segment.band != nil {
+			charge.DayType = segment.band.DayType
+			if segment.band.Cap > 0 && charge.Amount > segment.band.Cap {
+				charge.Amount = segment.band.Cap
+				charge.Capped = true
+			}
+		}
+		charges = append(charges, charge)
+	}
+	return charges
+}
+
+func (r bandedRule) Fee(t *models.ParkingTariff, start, end time.Time) []FeeItem {
+	charges := r.Breakdown(t, start, end)
+	if len(charges) == 0 {
+		return nil
+	}
+
+	var items []FeeItem
+	index := make(map[string]int)
+	var bandDiscount, capDiscount float64
+	dayFees := make(map[int]float64)
+	for _, charge := range charges {
+		full := roundMoney(float64(charge.Units) * charge.UnitPrice)
+		// 周末和节假日的时段在名称前标明日期类型，与工作日的同名时段分别列出
+		name := charge.Name + "费用"
+		if charge.DayType != "" && charge.DayType != models.TariffDayWeekday {
+			name = dayTypeName(charge.DayType) + name
+		}
+		if i, ok := index[name]; ok {
+			items[i].Quantity += charge.Units
+			items[i].Amount = roundMoney(items[i].Amount + full)
+		} else {
+			index[name] = len(items)
+			items = append(items, FeeItem{Name: name, Quantity: charge.Units, UnitPrice: charge.UnitPrice, Amount: full})
+		}
+		bandDiscount += full - charge.Amount
+		// 分段按开始时间归入所在的 24 小时周期
+		dayFees[int(charge.StartTime.Sub(start)/(24*time.Hour))] += charge.Amount
+	}
+	if t.DailyCap > 0 {
+		for _, fee := range dayFees {
+			if fee > t.DailyCap {
+				capDiscount += fee - t.DailyCap
+			}
+		}
+	}
+
+	if bandDiscount > 0 {
+		items = append(items, FeeItem{Name: "时段封顶优惠", Quantity: 1, UnitPrice: -roundMoney(bandDiscount), Amount: -roundMoney(bandDiscount)})
+	}
+	if capDiscount > 0 {
+		items = append(items, FeeItem{Name: "每日封顶优惠", Quantity: 1, UnitPrice: -roundMoney(capDiscount), Amount: -roundMoney(capDiscount)})
+	}
+	// 分时段规则没有首段费用，MaxFee 即整个停车期间的费用上限
+	if total := roundMoney(sumItems(items)); t.MaxFee > 0 && total > t.MaxFee {
+		discount := roundMoney(total - t.MaxFee)
+		items = append(items, FeeItem{Name: maxFeeItemName, Quantity: 1, UnitPrice: -discount, Amount: -discount})
+	}
+	return items
+}
+
+func (bandedRule) NextBoundary(t *models.ParkingTariff, start, now time.Time) time.Time {
+	minutes := billableMinutes(start, now)
+	if minutes <= t.FreeMinutes {
+		return start.Add(time.Duration(t.FreeMinutes) * time.Minute)
+	}
+
+	segments := bandSegments(t, start, now)
+	if len(segments) == 0 {
+		return time.Time{}
+	}
+	current := segments[len(segments)-1]
+	unitMinutes, _ := segmentUnit(t, current)
+	units := (billableMinutes(current.from, now) + unitMinutes - 1) / unitMinutes
+	boundary := current.from.Add(time.Duration(units*unitMinutes) * time.Minute)
+
+	// 当前时段在计费单位结束前结束时，下一时段开始即开始计费
+	ahead := bandSegments(t, start, boundary)
+	if len(ahead) >= len(segments) {
+		if end := ahead[len(segments)-1].to; end.Before(boundary) {
+			boundary = end
+		}
+	}
+	return boundary
+}
+
+func (bandedRule) CycleMinutes(t *models.ParkingTariff, start, now time.Time) int {
+	if billableMinutes(start, now) <= t.FreeMinutes && t.FreeMinutes > 0 {
+		return t.FreeMinutes
+	}
+	segments := bandSegments(t, start, now)
+	if len(segments) == 0 {
+		unitMinutes, _ := segmentUnit(t, bandSegment{})
+		return unitMinutes
+	}
+	unitMinutes, _ := segmentUnit(t, segments[len(segments)-1])
+	return unitMinutes
+}
+
+func (bandedRule) Describe(t *models.ParkingTariff) string {
+	var parts []string
+	if t.FreeMinutes > 0 {
+		parts = append(parts, fmt.Sprintf("%d分钟内免费", t.FreeMinutes))
+	}
+
+	for _, dt := range dayTypeNames {
+		var bands []string
+		for i := range t.Bands {
+			band := &t.Bands[i]
+			if band.DayType != dt.dayType {
+				continue
+			}
+			text := fmt.Sprintf("%s%s-%s每%s%s元", band.Name, band.StartTime, band.EndTime,
+				durationName(maxInt(band.UnitMinutes, 1)), formatMoney(band.UnitPrice))
+			if band.Cap > 0 {
+				text += fmt.Sprintf("（封顶%s元）", formatMoney(band.Cap))
+			}
+			bands = append(bands, text)
+		}
+		if len(bands) > 0 {
+			parts = append(parts, dt.name+strings.Join(bands, "、"))
+		}
+	}
+
+	parts = append(parts, fmt.Sprintf("其他时段每%s%s元", durationName(maxInt(t.UnitMinutes, 1)), formatMoney(t.UnitPrice)))
+	if t.DailyCap > 0 {
+		parts = append(parts, fmt.Sprintf("每日封顶%s元", formatMoney(t.DailyCap)))
+	}
+	if t.MaxFee > 0 {
+		parts = append(parts, fmt.Sprintf("最多收取%s元", formatMoney(t.MaxFee)))
+	}
+	return strings.Join(parts, "，")
+}
@@ -0,0 +1,153 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"urban_traffic_backend/models"
+)
+
+func TestValidateTariffBands(t *testing.T) {
+	band := func(dayType, start, end string) models.TariffBand {
+		return models.TariffBand{DayType: dayType, StartTime: start, EndTime: end, UnitMinutes: 60, UnitPrice: 2}
+	}
+
+	tests := []struct {
+		name    string
+		bands   []models.TariffBand
+		wantErr error
+	}{
+		{"日间和夜间", []models.TariffBand{band("weekday", "08:00", "20:00"), band("weekday", "20:00", "08:00")}, nil},
+		{"未填日期类型按工作日", []models.TariffBand{band("", "08:00", "20:00")}, nil},
+		{"不同日期类型可以重叠", []models.TariffBand{band("weekday", "08:00", "20:00"), band("weekend", "09:00", "18:00")}, nil},
+		{"同日重叠", []models.TariffBand{band("weekday", "08:00", "12:00"), band("weekday", "11:00", "14:00")}, ErrTariffBandOverlap},
+		{"跨夜部分与次日早间重叠", []models.TariffBand{band("weekday", "22:00", "07:00"), band("weekday", "06:00", "09:00")}, ErrTariffBandOverlap},
+		{"日期类型不合法", []models.TariffBand{band("workday", "08:00", "20:00")}, ErrInvalidTariffBand},
+		{"开始结束相同", []models.TariffBand{band("weekday", "08:00", "08:00")}, ErrInvalidTariffBand},
+		{"计费单位为0", []models.TariffBand{{DayType: "weekday", StartTime: "08:00", EndTime: "20:00"}}, ErrInvalidTariffBand},
+		{"价格为负", []models.TariffBand{{DayType: "weekday", StartTime: "08:00", EndTime: "20:00", UnitMinutes: 60, UnitPrice: -1}}, ErrInvalidTariffBand},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateTariffBands(tt.bands); err != tt.wantErr {
+				t.Errorf("ValidateTariffBands() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestBandSegments 2025-01-06 为周一，2025-01-10 为周五
+func TestBandSegments(t *testing.T) {
+	at := func(day, hour int) time.Time {
+		return time.Date(2025, 1, day, hour, 0, 0, 0, time.Local)
+	}
+	tariff := &models.ParkingTariff{
+		UnitMinutes: 60,
+		UnitPrice:   5,
+		Bands: []models.TariffBand{
+			{DayType: models.TariffDayWeekday, Name: "夜间", StartTime: "20:00", EndTime: "08:00", UnitMinutes: 60, UnitPrice: 2},
+			{DayType: models.TariffDayWeekend, Name: "日间", StartTime: "07:00", EndTime: "18:00", UnitMinutes: 60, UnitPrice: 3},
+			{DayType: models.TariffDayHoliday, Name: "节日", StartTime: "10:00", EndTime: "16:00", UnitMinutes: 60, UnitPrice: 1},
+		},
+		Holidays: map[string]bool{"2025-01-08": true},
+	}
+
+	type segment struct {
+		name     string
+		from, to time.Time
+	}
+	tests := []struct {
+		name       string
+		start, end time.Time
+		want       []segment
+	}{
+		{"结束不晚于开始", at(6, 10), at(6, 10), nil},
+		{"只在其他时段", at(6, 10), at(6, 12), []segment{{baseBandName, at(6, 10), at(6, 12)}}},
+		{
+			"跨夜时段前后",
+			at(6, 19), at(7, 9),
+			[]segment{{baseBandName, at(6, 19), at(6, 20)}, {"夜间", at(6, 20), at(7, 8)}, {baseBandName, at(7, 8), at(7, 9)}},
+		},
+		{
+			"周五夜间延续到周六时先开始的时段优先",
+			at(10, 19), at(11, 10),
+			[]segment{{baseBandName, at(10, 19), at(10, 20)}, {"夜间", at(10, 20), at(11, 8)}, {"日间", at(11, 8), at(11, 10)}},
+		},
+		{
+			"节假日使用节假日时段",
+			at(8, 9), at(8, 11),
+			[]segment{{baseBandName, at(8, 9), at(8, 10)}, {"节日", at(8, 10), at(8, 11)}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []segment
+			for _, s := range bandSegments(tariff, tt.start, tt.end) {
+				got = append(got, segment{bandName(s.band), s.from, s.to})
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("bandSegments() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i].name != tt.want[i].name || !got[i].from.Equal(tt.want[i].from) || !got[i].to.Equal(tt.want[i].to) {
+					t.Errorf("segment %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBandedRuleFee(t *testing.T) {
+	at := func(day, hour int) time.Time {
+		return time.Date(2025, 1, day, hour, 0, 0, 0, time.Local)
+	}
+	tariff := &models.ParkingTariff{
+		RuleType:    "banded",
+		FreeMinutes: 30,
+		UnitMinutes: 60,
+		UnitPrice:   5,
+		Bands: []models.TariffBand{
+			{DayType: models.TariffDayWeekday, Name: "夜间", StartTime: "20:00", EndTime: "08:00", UnitMinutes: 60, UnitPrice: 2, Cap: 10},
+			{DayType: models.TariffDayWeekend, Name: "日间", StartTime: "07:00", EndTime: "18:00", UnitMinutes: 30, UnitPrice: 1.5},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		start, end time.Time
+		want       []FeeItem
+	}{
+		{"免费时长内", at(6, 10), at(6, 10).Add(30 * time.Minute), nil},
+		{"其他时段不足一个单位向上取整", at(6, 10), at(6, 11).Add(10 * time.Minute), []FeeItem{
+			{Name: "其他时段费用", Quantity: 2, UnitPrice: 5, Amount: 10},
+		}},
+		{"夜间时段封顶", at(6, 19), at(7, 9), []FeeItem{
+			{Name: "其他时段费用", Quantity: 2, UnitPrice: 5, Amount: 10},
+			{Name: "夜间费用", Quantity: 12, UnitPrice: 2, Amount: 24},
+			{Name: "时段封顶优惠", Quantity: 1, UnitPrice: -14, Amount: -14},
+		}},
+		{"周末时段标明日期类型", at(11, 8), at(11, 10), []FeeItem{
+			{Name: "周末日间费用", Quantity: 4, UnitPrice: 1.5, Amount: 6},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := bandedRule{}.Fee(tariff, tt.start, tt.end)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Fee() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
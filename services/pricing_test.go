@@ -0,0 +1,186 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package services
+
+import (
+	"testing"
+	"time"
+
+	"urban_traffic_backend/models"
+)
+
+// pythonPrice coze/charge/Parking_charging_system.py 的计费公式
+func pythonPrice(totalSeconds, freeTime, unit int, reg1, reg2, reg3 float64) float64 {
+	times := (totalSeconds + 59) / 60
+	if times <= freeTime {
+		return 0
+	}
+	increment := float64((times+unit-1)/unit-1) * reg3
+	if increment > reg2 {
+		increment = reg2
+	}
+	return reg1 + increment
+}
+
+// TestStandardRuleMatchesPython 首段时长等于计费单位时，标准规则与 Python 计费公式结果相同
+func TestStandardRuleMatchesPython(t *testing.T) {
+	start := time.Date(2025, 1, 3, 8, 0, 0, 0, time.Local)
+	tests := []struct {
+		name             string
+		seconds          int
+		free, unit       int
+		reg1, reg2, reg3 float64
+	}{
+		{"免费时长内", 15 * 60, 15, 60, 10, 60, 5},
+		{"刚超过免费时长", 15*60 + 1, 15, 60, 10, 60, 5},
+		{"首段内", 59 * 60, 0, 60, 10, 60, 5},
+		{"首段后一秒", 60*60 + 1, 0, 60, 10, 60, 5},
+		{"多个计费单位", 5*3600 + 30, 0, 60, 10, 60, 5},
+		{"达到封顶", 20 * 3600, 15, 60, 10, 60, 5},
+		{"多日只封顶一次", 3*24*3600 + 7, 15, 60, 10, 60, 5},
+		{"计费单位不整除一天", 30 * 3600, 0, 45, 4, 100, 2},
+		{"半小时计费单位", 200 * 60, 10, 30, 3, 40, 1.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tariff := &models.ParkingTariff{
+				RuleType:           "standard",
+				FreeMinutes:        tt.free,
+				FirstPeriodMinutes: tt.unit,
+				FirstPeriodPrice:   tt.reg1,
+				UnitMinutes:        tt.unit,
+				UnitPrice:          tt.reg3,
+				MaxFee:             tt.reg2,
+			}
+			quote, err := QuoteTariff(tariff, "normal", 0, start, start.Add(time.Duration(tt.seconds)*time.Second))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := pythonPrice(tt.seconds, tt.free, tt.unit, tt.reg1, tt.reg2, tt.reg3); quote.Total != want {
+				t.Errorf("Total = %v, want %v (items %+v)", quote.Total, want, quote.Items)
+			}
+		})
+	}
+}
+
+// TestTariffCaps 每日封顶按入场起算的 24 小时分别作用，整个停车期间封顶只作用一次
+func TestTariffCaps(t *testing.T) {
+	start := time.Date(2025, 1, 6, 8, 0, 0, 0, time.Local)
+	standard := func(dailyCap, maxFee float64) *models.ParkingTariff {
+		return &models.ParkingTariff{
+			RuleType:           "standard",
+			FirstPeriodMinutes: 60,
+			FirstPeriodPrice:   10,
+			UnitMinutes:        60,
+			UnitPrice:          5,
+			DailyCap:           dailyCap,
+			MaxFee:             maxFee,
+		}
+	}
+	banded := func(dailyCap, maxFee float64) *models.ParkingTariff {
+		return &models.ParkingTariff{
+			RuleType:    "banded",
+			UnitMinutes: 60,
+			UnitPrice:   5,
+			DailyCap:    dailyCap,
+			MaxFee:      maxFee,
+			Bands: []models.TariffBand{
+				{DayType: models.TariffDayWeekday, Name: "夜间", StartTime: "20:00", EndTime: "08:00", UnitMinutes: 60, UnitPrice: 2},
+			},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		tariff   *models.ParkingTariff
+		duration time.Duration
+		want     float64
+	}{
+		{"不封顶", standard(0, 0), 10 * 24 * time.Hour, 10 + 239*5},
+		{"未达每日封顶", standard(60, 0), 5 * time.Hour, 30},
+		{"每日封顶", standard(60, 0), 10 * 24 * time.Hour, 600},
+		{"最后一天未满封顶", standard(60, 0), 24*time.Hour + 3*time.Hour, 60 + 15},
+		{"单次封顶", standard(0, 100), 10 * 24 * time.Hour, 110},
+		{"每日封顶后再单次封顶", standard(60, 100), 10 * 24 * time.Hour, 110},
+		{"分时段每日封顶", banded(50, 0), 3 * 24 * time.Hour, 150},
+		{"分时段单次封顶", banded(50, 80), 3 * 24 * time.Hour, 80},
+		{"分时段未达封顶", banded(50, 80), 2 * time.Hour, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quote, err := QuoteTariff(tt.tariff, "normal", 0, start, start.Add(tt.duration))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if quote.Total != tt.want {
+				t.Errorf("Total = %v, want %v (items %+v)", quote.Total, tt.want, quote.Items)
+			}
+		})
+	}
+}
+
+// TestNextIncrease 封顶后的下次计费时间：每日封顶后为下一个 24 小时周期开始，整个停车期间封顶后不再计费
+func TestNextIncrease(t *testing.T) {
+	start := time.Date(2025, 1, 6, 8, 0, 0, 0, time.Local)
+	perMinute := func(dailyCap, maxFee float64) *models.ParkingTariff {
+		return &models.ParkingTariff{
+			RuleType:           "standard",
+			FirstPeriodMinutes: 60,
+			FirstPeriodPrice:   5,
+			UnitMinutes:        1,
+			UnitPrice:          0.1,
+			DailyCap:           dailyCap,
+			MaxFee:             maxFee,
+		}
+	}
+	nightCap := &models.ParkingTariff{
+		RuleType:    "banded",
+		UnitMinutes: 60,
+		UnitPrice:   5,
+		Bands: []models.TariffBand{
+			{DayType: models.TariffDayWeekday, Name: "夜间", StartTime: "20:00", EndTime: "08:00", UnitMinutes: 1, UnitPrice: 0.1, Cap: 10},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		tariff   *models.ParkingTariff
+		at       time.Duration
+		wantNext time.Duration // 为 0 表示不再计费
+		wantFee  float64
+	}{
+		{"未封顶按分钟计费", perMinute(0, 0), 2 * time.Hour, 2 * time.Hour, 0.1},
+		{"每日封顶后次日恢复", perMinute(20, 0), 10 * time.Hour, 24 * time.Hour, 0.1},
+		{"整个停车期间封顶", perMinute(0, 10), 10 * time.Hour, 0, 0},
+		{"夜间封顶后日间恢复", nightCap, 14 * time.Hour, 24 * time.Hour, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quote, err := QuoteTariff(tt.tariff, "normal", 0, start, start.Add(tt.at))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantNext == 0 {
+				if quote.NextBillingTime != nil {
+					t.Errorf("NextBillingTime = %v, want nil", quote.NextBillingTime)
+				}
+				return
+			}
+			if quote.NextBillingTime == nil || !quote.NextBillingTime.Equal(start.Add(tt.wantNext)) {
+				t.Fatalf("NextBillingTime = %v, want %v", quote.NextBillingTime, start.Add(tt.wantNext))
+			}
+			if *quote.NextFeeAmount != tt.wantFee {
+				t.Errorf("NextFeeAmount = %v, want %v", *quote.NextFeeAmount, tt.wantFee)
+			}
+		})
+	}
+}
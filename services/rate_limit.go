@@ -0,0 +1,133 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package services
+
+import (
+	"errors"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitPolicy 令牌桶限流策略：每秒补充 Rate 个令牌，桶容量 Burst
+type RateLimitPolicy struct {
+	Name  string
+	Rate  float64
+	Burst int
+}
+
+// NewRateLimitPolicy 按路由分组创建限流策略，可通过 RATE_LIMIT_<NAME>_RPS 和
+// RATE_LIMIT_<NAME>_BURST 覆盖默认值，RPS 配置为 0 时关闭该分组的限流
+func NewRateLimitPolicy(name string, rate float64, burst int) RateLimitPolicy {
+	prefix := "RATE_LIMIT_" + strings.ToUpper(name)
+	return RateLimitPolicy{
+		Name:  name,
+		Rate:  envFloat(prefix+"_RPS", rate),
+		Burst: int(envFloat(prefix+"_BURST", float64(burst))),
+	}
+}
+
+// Enabled 策略是否生效
+func (p RateLimitPolicy) Enabled() bool {
+	return p.Rate > 0 && p.Burst > 0
+}
+
+// RateLimitStore 令牌桶存储后端，多节点部署时可注册共享存储的实现
+type RateLimitStore interface {
+	// Name 后端名称，与 RATE_LIMIT_BACKEND 配置对应
+	Name() string
+	// Take 从 key 对应的令牌桶取一个令牌，取不到时返回需要等待的时长
+	Take(key string, policy RateLimitPolicy, now time.Time) (bool, time.Duration)
+}
+
+// rateLimitStores 已注册的限流存储后端
+var rateLimitStores = map[string]RateLimitStore{}
+
+func init() {
+	RegisterRateLimitStore(NewMemoryRateLimitStore())
+}
+
+// RegisterRateLimitStore 注册限流存储后端，同名后端会被覆盖
+func RegisterRateLimitStore(store RateLimitStore) {
+	rateLimitStores[store.Name()] = store
+}
+
+// ActiveRateLimitStore 当前使用的限流存储后端，由 RATE_LIMIT_BACKEND 配置，默认单机内存
+func ActiveRateLimitStore() (RateLimitStore, error) {
+	name := os.Getenv("RATE_LIMIT_BACKEND")
+	if name == "" {
+		name = "memory"
+	}
+	store, ok := rateLimitStores[name]
+	if !ok {
+		return nil, errors.New("未配置的限流后端: " + name)
+	}
+	return store, nil
+}
+
+// memoryRateLimitStore 单机内存令牌桶，适用于单节点部署
+type memoryRateLimitStore struct {
+	mu          sync.Mutex
+	buckets     map[string]*tokenBucket
+	lastCleanup time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Duration // 从空桶补满所需时长，超过该时长未使用的桶可以回收
+}
+
+// memoryRateLimitCleanupInterval 回收空闲令牌桶的间隔
+const memoryRateLimitCleanupInterval = time.Minute
+
+// NewMemoryRateLimitStore 创建单机内存限流后端
+func NewMemoryRateLimitStore() RateLimitStore {
+	return &memoryRateLimitStore{buckets: map[string]*tokenBucket{}}
+}
+
+func (s *memoryRateLimitStore) Name() string { return "memory" }
+
+func (s *memoryRateLimitStore) Take(key string, policy RateLimitPolicy, now time.Time) (bool, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastCleanup) >= memoryRateLimitCleanupInterval {
+		for k, bucket := range s.buckets {
+			if now.Sub(bucket.updated) >= bucket.full {
+				delete(s.buckets, k)
+			}
+		}
+		s.lastCleanup = now
+	}
+
+	burst := float64(policy.Burst)
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{
+			tokens:  burst,
+			updated: now,
+			full:    time.Duration(burst / policy.Rate * float64(time.Second)),
+		}
+		s.buckets[key] = bucket
+	}
+
+	if elapsed := now.Sub(bucket.updated).Seconds(); elapsed > 0 {
+		bucket.tokens = math.Min(burst, bucket.tokens+elapsed*policy.Rate)
+		bucket.updated = now
+	}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+	wait := (1 - bucket.tokens) / policy.Rate
+	return false, time.Duration(wait * float64(time.Second))
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"urban_traffic_backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ReservationGracePeriod 预约开始后车位继续保留的时间，由 RESERVATION_GRACE_SECONDS 配置，默认 15 分钟
+func ReservationGracePeriod() time.Duration {
+	return envDuration("RESERVATION_GRACE_SECONDS", 15*time.Minute)
+}
+
+// ReservationMaxAdvance 最多可提前多久预约，由 RESERVATION_MAX_ADVANCE_SECONDS 配置，默认 2 小时。
+// 预约创建即占用车位，限制提前量避免车位被长时间空占
+func ReservationMaxAdvance() time.Duration {
+	return envDuration("RESERVATION_MAX_ADVANCE_SECONDS", 2*time.Hour)
+}
+
+// ReservationNoShowFee 预约未到达的违约金，由 RESERVATION_NO_SHOW_FEE 配置，默认 10 元
+func ReservationNoShowFee() float64 {
+	return envFloat("RESERVATION_NO_SHOW_FEE", 10)
+}
+
+// ReservationJob 预约过期任务：释放超过保留时间仍未到达的预约车位并记录违约金，
+// 间隔由 RESERVATION_EXPIRY_INTERVAL_SECONDS 配置，默认 60 秒
+func ReservationJob() Job {
+	return Job{
+		Name:     "reservation_expiry",
+		Interval: envDuration("RESERVATION_EXPIRY_INTERVAL_SECONDS", time.Minute),
+		Run:      ExpireReservations,
+	}
+}
+
+// FindHeldReservation 查找车辆在该停车场仍保留中的预约并加锁（必须在事务中调用），没有时返回 nil。
+// 车辆按车辆ID或归一化车牌匹配，车牌识别入场时只有车牌
+func FindHeldReservation(tx *gorm.DB, lotID uint, vehicleID *uint, plate string) (*models.Reservation, error) {
+	query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("parking_lot_id = ? AND status = ?", lotID, models.ReservationStatusHeld)
+	if vehicleID != nil {
+		query = query.Where("(vehicle_id = ? OR plate_number = ?)", *vehicleID, plate)
+	} else {
+		query = query.Where("plate_number = ?", plate)
+	}
+
+	var reservation models.Reservation
+	err := query.Order("start_time").First(&reservation).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &reservation, nil
+}
+
+// ClaimReservation 车辆到达时使用预约的车位：预留车位转为占用，并把车位信息带入即将创建的会话
+func ClaimReservation(tx *gorm.DB, reservation *models.Reservation, session *models.ParkingSession) error {
+	if err := OccupyReservedSpot(tx, reservation.ParkingLotID, reservation.ParkingSpotID); err != nil {
+		return err
+	}
+
+	session.SpotType = reservation.SpotType
+	session.ParkingSpotID = reservation.ParkingSpotID
+	session.SpotCode = reservation.SpotCode
+	if session.UserID == nil {
+		session.UserID = &reservation.UserID
+	}
+	if session.VehicleID == nil {
+		session.VehicleID = &reservation.VehicleID
+	}
+	return nil
+}
+
+// CompleteReservation 会话创建后将预约标记为已转换
+func CompleteReservation(tx *gorm.DB, reservation *models.Reservation, sessionID uint, now time.Time) error {
+	reservation.Status = models.ReservationStatusConverted
+	reservation.SessionID = &sessionID
+	reservation.ClosedAt = &now
+	return tx.Model(reservation).Updates(map[string]interface{}{
+		"status":     reservation.Status,
+		"session_id": reservation.SessionID,
+		"closed_at":  reservation.ClosedAt,
+	}).Error
+}
+
+// CancelReservation 取消预约并释放预留车位
+func CancelReservation(tx *gorm.DB, reservation *models.Reservation, now time.Time) error {
+	return closeReservation(tx, reservation, models.ReservationStatusCancelled, 0, now)
+}
+
+// ExpireReservations 将超过保留时间仍未到达的预约置为未到达，释放车位并记录违约金
+func ExpireReservations(ctx context.Context, now time.Time) error {
+	var ids []uint
+	err := models.DB.Model(&models.Reservation{}).
+		Where("status = ? AND hold_until < ?", models.ReservationStatusHeld, now).
+		Pluck("id", &ids).Error
+	if err != nil {
+		return err
+	}
+
+	fee := ReservationNoShowFee()
+	var expired int
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return nil
+		}
+
+		// 逐条加锁处理，车辆恰好在此时入场转换的预约会被跳过
+		err := models.DB.Transaction(func(tx *gorm.DB) error {
+			var reservation models.Reservation
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("id = ? AND status = ?", id, models.ReservationStatusHeld).
+				First(&reservation).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := closeReservation(tx, &reservation, models.ReservationStatusNoShow, fee, now); err != nil {
+				return err
+			}
+			expired++
+			return nil
+		})
+		if err != nil {
+			log.Printf("reservation: expire reservation %d failed: %v", id, err)
+		}
+	}
+
+	if expired > 0 {
+		log.Printf("reservation: expired %d no-show reservations", expired)
+	}
+	return nil
+}
+
+func closeReservation(tx *gorm.DB, reservation *models.Reservation, status string, fee float64, now time.Time) error {
+	if err := ReleaseCapacity(tx, reservation.ParkingLotID, reservation.SpotType, reservation.ParkingSpotID); err != nil {
+		return err
+	}
+
+	reservation.Status = status
+	reservation.NoShowFee = fee
+	reservation.ClosedAt = &now
+	return tx.Model(reservation).Updates(map[string]interface{}{
+		"status":      reservation.Status,
+		"no_show_fee": reservation.NoShowFee,
+		"closed_at":   reservation.ClosedAt,
+	}).Error
+}
@@ -0,0 +1,194 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"urban_traffic_backend/models"
+
+	"gorm.io/gorm/clause"
+)
+
+// Job 周期性后台任务
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context, now time.Time) error
+}
+
+// Scheduler 后台任务调度器，每次执行前先获取数据库租约，
+// 多个实例同时运行时同一任务只会在持有租约的实例上执行
+type Scheduler struct {
+	holder string
+	jobs   []Job
+	wg     sync.WaitGroup
+}
+
+// NewScheduler 创建调度器，实例标识由主机名、进程号和随机数组成
+func NewScheduler() *Scheduler {
+	hostname, _ := os.Hostname()
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return &Scheduler{
+		holder: fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), hex.EncodeToString(suffix)),
+	}
+}
+
+// Register 注册任务，须在 Start 之前调用
+func (s *Scheduler) Register(job Job) {
+	s.jobs = append(s.jobs, job)
+}
+
+// Start 为每个任务启动一个协程，ctx 取消后任务停止并释放租约
+func (s *Scheduler) Start(ctx context.Context) {
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(ctx, job)
+	}
+}
+
+// Wait 等待所有任务退出
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	log.Printf("job %s started (interval %s)", job.Name, job.Interval)
+	for {
+		s.runOnce(ctx, job)
+
+		select {
+		case <-ctx.Done():
+			s.releaseLease(job.Name)
+			log.Printf("job %s stopped", job.Name)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) runOnce(ctx context.Context, job Job) {
+	// 租约有效期为两个周期，实例退出后其他实例最迟两个周期后接手
+	ttl := 2 * job.Interval
+	acquired, err := s.acquireLease(job.Name, ttl)
+	if err != nil {
+		log.Printf("job %s: acquire lease failed: %v", job.Name, err)
+		return
+	}
+	if !acquired {
+		return
+	}
+
+	// 执行时间可能超过租约有效期，执行期间定期续约，续约失败时取消本次执行
+	runCtx, cancel := context.WithCancel(ctx)
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		s.keepLease(runCtx, cancel, job.Name, ttl)
+	}()
+
+	if err := job.Run(runCtx, time.Now()); err != nil {
+		log.Printf("job %s failed: %v", job.Name, err)
+	}
+	cancel()
+	<-renewed
+}
+
+// keepLease 每隔三分之一有效期续约一次，直到 ctx 取消；租约已被其他实例接手或无法续约时调用 cancel
+func (s *Scheduler) keepLease(ctx context.Context, cancel context.CancelFunc, name string, ttl time.Duration) {
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		renewed, err := s.acquireLease(name, ttl)
+		if err != nil {
+			log.Printf("job %s: renew lease failed, cancelling run: %v", name, err)
+			cancel()
+			return
+		}
+		if !renewed {
+			log.Printf("job %s: lease taken over by another instance, cancelling run", name)
+			cancel()
+			return
+		}
+	}
+}
+
+func (s *Scheduler) acquireLease(name string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+
+	lease := models.JobLease{Name: name, ExpiresAt: now}
+	if err := models.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&lease).Error; err != nil {
+		return false, err
+	}
+
+	result := models.DB.Model(&models.JobLease{}).
+		Where("name = ? AND (holder = ? OR expires_at < ?)", name, s.holder, now).
+		Updates(map[string]interface{}{
+			"holder":     s.holder,
+			"expires_at": now.Add(ttl),
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (s *Scheduler) releaseLease(name string) {
+	models.DB.Model(&models.JobLease{}).
+		Where("name = ? AND holder = ?", name, s.holder).
+		Update("expires_at", time.Now())
+}
+
+// envDuration 读取以秒为单位的时间间隔配置
+func envDuration(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds <= 0 {
+		log.Printf("invalid %s=%q, using default %s", key, value, def)
+		return def
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// envFloat 读取数值配置
+func envFloat(key string, def float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || number < 0 {
+		log.Printf("invalid %s=%q, using default %v", key, value, def)
+		return def
+	}
+	return number
+}
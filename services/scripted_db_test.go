@@ -0,0 +1,194 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package services
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"urban_traffic_backend/models"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// scriptedQuery 包含 match 片段的查询返回的结果，once 为 true 时只使用一次
+type scriptedQuery struct {
+	match   string
+	columns []string
+	rows    [][]driver.Value
+	once    bool
+}
+
+// scriptedDB 测试用的数据库：查询按 SQL 片段（小写）返回预设结果，未匹配的查询没有数据；
+// 写入语句按片段返回预设的影响行数，默认为 1。执行过的语句连同参数记录在 log 中
+type scriptedDB struct {
+	mu       sync.Mutex
+	queries  []scriptedQuery
+	affected map[string]int64
+	log      []string
+}
+
+// open 以 scriptedDB 为连接创建 gorm 数据库，并替换 models.DB，测试结束后恢复
+func (s *scriptedDB) open(t *testing.T) *gorm.DB {
+	t.Helper()
+	sqlDB := sql.OpenDB(s)
+	t.Cleanup(func() { sqlDB.Close() })
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sqlDB, SkipInitializeWithVersion: true}), &gorm.Config{
+		DisableAutomaticPing: true,
+		Logger:               logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := models.DB
+	models.DB = db
+	t.Cleanup(func() { models.DB = previous })
+	return db
+}
+
+// executed 是否执行过包含 match 片段的写入语句
+func (s *scriptedDB) executed(match string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, statement := range s.log {
+		if strings.HasPrefix(statement, "exec ") && strings.Contains(statement, match) {
+			return true
+		}
+	}
+	return false
+}
+
+// queried 是否执行过同时包含 matches 中所有片段的查询
+func (s *scriptedDB) queried(matches ...string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, statement := range s.log {
+		if !strings.HasPrefix(statement, "query ") {
+			continue
+		}
+		found := true
+		for _, match := range matches {
+			found = found && strings.Contains(statement, match)
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// checkExecuted 检查 want 中的片段都执行过，notWant 中的片段都未执行
+func (s *scriptedDB) checkExecuted(t *testing.T, want, notWant []string) {
+	t.Helper()
+	for _, match := range want {
+		if !s.executed(match) {
+			t.Errorf("expected statement containing %q, log %v", match, s.log)
+		}
+	}
+	for _, match := range notWant {
+		if s.executed(match) {
+			t.Errorf("unexpected statement containing %q", match)
+		}
+	}
+}
+
+func (s *scriptedDB) Connect(context.Context) (driver.Conn, error) { return scriptedConn{s}, nil }
+func (s *scriptedDB) Driver() driver.Driver                        { return scriptedDriver{} }
+
+type scriptedDriver struct{}
+
+func (scriptedDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("scripted driver only supports sql.OpenDB")
+}
+
+type scriptedConn struct{ s *scriptedDB }
+
+func (c scriptedConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("scripted driver does not support prepared statements")
+}
+func (c scriptedConn) Close() error              { return nil }
+func (c scriptedConn) Begin() (driver.Tx, error) { return c, nil }
+func (c scriptedConn) Commit() error             { return nil }
+func (c scriptedConn) Rollback() error           { return nil }
+
+func (c scriptedConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	s := c.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query = strings.ToLower(query)
+	s.log = append(s.log, "query "+query+formatArgs(args))
+	for i, q := range s.queries {
+		if !strings.Contains(query, q.match) {
+			continue
+		}
+		if q.once {
+			s.queries = append(s.queries[:i:i], s.queries[i+1:]...)
+		}
+		return &scriptedRows{columns: q.columns, values: append([][]driver.Value(nil), q.rows...)}, nil
+	}
+	if strings.HasPrefix(query, "select count(") {
+		return &scriptedRows{columns: []string{"count(*)"}, values: [][]driver.Value{{int64(0)}}}, nil
+	}
+	return &scriptedRows{columns: []string{"id"}}, nil
+}
+
+func (c scriptedConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	s := c.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query = strings.ToLower(query)
+	s.log = append(s.log, "exec "+query+formatArgs(args))
+	for match, affected := range s.affected {
+		if strings.Contains(query, match) {
+			return scriptedResult(affected), nil
+		}
+	}
+	return scriptedResult(1), nil
+}
+
+func formatArgs(args []driver.NamedValue) string {
+	var b strings.Builder
+	for _, arg := range args {
+		fmt.Fprintf(&b, " [%v]", arg.Value)
+	}
+	return b.String()
+}
+
+type scriptedResult int64
+
+func (r scriptedResult) LastInsertId() (int64, error) { return 1, nil }
+func (r scriptedResult) RowsAffected() (int64, error) { return int64(r), nil }
+
+type scriptedRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *scriptedRows) Columns() []string { return r.columns }
+func (r *scriptedRows) Close() error      { return nil }
+
+func (r *scriptedRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
@@ -0,0 +1,299 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"urban_traffic_backend/models"
+
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrInvalidToken 访问令牌无效、已过期或已撤销
+	ErrInvalidToken = errors.New("无效的token")
+	// ErrInvalidRefreshToken 刷新令牌无效、已过期或已撤销
+	ErrInvalidRefreshToken = errors.New("刷新令牌无效或已过期")
+	// ErrAccountDisabled 账号已被管理员停用
+	ErrAccountDisabled = errors.New("账号已停用")
+)
+
+// TokenPair 登录或刷新后返回给客户端的令牌
+type TokenPair struct {
+	AccessToken  string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresIn    int       `json:"expires_in"` // 访问令牌有效期（秒）
+	ExpiresAt    time.Time `json:"expires_at"`
+	SessionID    uint      `json:"session_id"`
+}
+
+// AccessClaims 访问令牌中的用户信息
+type AccessClaims struct {
+	UserID    uint   `json:"user_id"`
+	Username  string `json:"username"`
+	UserType  string `json:"user_type"`
+	SessionID uint   `json:"sid"`
+	// OrganizationID 后台工作人员所属组织，用于限定可访问的数据范围
+	OrganizationID *uint `json:"org_id,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// AccessTokenTTL 访问令牌有效期，由 ACCESS_TOKEN_TTL_SECONDS 配置，默认 15 分钟
+func AccessTokenTTL() time.Duration {
+	return envDuration("ACCESS_TOKEN_TTL_SECONDS", 15*time.Minute)
+}
+
+// RefreshTokenTTL 刷新令牌有效期，由 REFRESH_TOKEN_TTL_SECONDS 配置，默认 30 天
+func RefreshTokenTTL() time.Duration {
+	return envDuration("REFRESH_TOKEN_TTL_SECONDS", 30*24*time.Hour)
+}
+
+// TokenCleanupJob 清理过期的撤销记录和登录会话，间隔由 TOKEN_CLEANUP_INTERVAL_SECONDS 配置，默认 1 小时
+func TokenCleanupJob() Job {
+	return Job{
+		Name:     "token_cleanup",
+		Interval: envDuration("TOKEN_CLEANUP_INTERVAL_SECONDS", time.Hour),
+		Run:      CleanupTokens,
+	}
+}
+
+// jwtSecret 签名密钥由 JWT_SECRET 配置
+func jwtSecret() []byte {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		secret = "urban-traffic-secret-key-2024"
+	}
+	return []byte(secret)
+}
+
+// IssueTokens 用户登录：创建登录会话并签发访问令牌和刷新令牌
+func IssueTokens(user *models.User, userAgent, ip string) (*TokenPair, error) {
+	refreshToken, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := models.AuthSession{
+		UserID:           user.ID,
+		RefreshTokenHash: hashToken(refreshToken),
+		UserAgent:        truncate(userAgent, 255),
+		IP:               truncate(ip, 64),
+		LastUsedAt:       now,
+		ExpiresAt:        now.Add(RefreshTokenTTL()),
+	}
+	if err := models.DB.Create(&session).Error; err != nil {
+		return nil, err
+	}
+
+	return signTokenPair(user, &session, refreshToken, now)
+}
+
+// RefreshTokens 使用刷新令牌换取新的令牌对，旧刷新令牌随即失效。
+// 已轮换掉的刷新令牌被再次使用时视为泄露，撤销整个登录会话
+func RefreshTokens(refreshToken, userAgent, ip string) (*TokenPair, error) {
+	hash := hashToken(refreshToken)
+	now := time.Now()
+
+	var pair *TokenPair
+	var reused bool
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		var session models.AuthSession
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("refresh_token_hash = ?", hash).
+			First(&session).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("previous_token_hash = ? AND revoked_at IS NULL", hash).
+				First(&session).Error
+			if err == nil {
+				reused = true
+				log.Printf("auth: refresh token reuse detected for session %d, revoking", session.ID)
+				return tx.Model(&session).Update("revoked_at", now).Error
+			}
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if session.RevokedAt != nil || !session.ExpiresAt.After(now) {
+			return ErrInvalidRefreshToken
+		}
+
+		var user models.User
+		if err := tx.Where("id = ? AND is_active = ?", session.UserID, true).First(&user).Error; err != nil {
+			return ErrInvalidRefreshToken
+		}
+
+		newToken, err := randomToken()
+		if err != nil {
+			return err
+		}
+		session.PreviousTokenHash = session.RefreshTokenHash
+		session.RefreshTokenHash = hashToken(newToken)
+		session.LastUsedAt = now
+		session.ExpiresAt = now.Add(RefreshTokenTTL())
+		if userAgent != "" {
+			session.UserAgent = truncate(userAgent, 255)
+		}
+		if ip != "" {
+			session.IP = truncate(ip, 64)
+		}
+		if err := tx.Save(&session).Error; err != nil {
+			return err
+		}
+
+		pair, err = signTokenPair(&user, &session, newToken, now)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reused {
+		return nil, ErrInvalidRefreshToken
+	}
+	return pair, nil
+}
+
+// ParseAccessToken 校验访问令牌的签名和有效期，并检查令牌及其登录会话未被撤销、账号未被停用
+func ParseAccessToken(tokenString string) (*AccessClaims, error) {
+	claims := &AccessClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, ErrInvalidToken
+		}
+		return jwtSecret(), nil
+	})
+	if err != nil || !token.Valid || claims.ID == "" || claims.SessionID == 0 {
+		return nil, ErrInvalidToken
+	}
+
+	var revoked int64
+	models.DB.Model(&models.RevokedToken{}).Where("jti = ?", claims.ID).Count(&revoked)
+	if revoked > 0 {
+		return nil, ErrInvalidToken
+	}
+	var active int64
+	models.DB.Model(&models.AuthSession{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", claims.SessionID, claims.UserID).
+		Count(&active)
+	if active == 0 {
+		return nil, ErrInvalidToken
+	}
+	var enabled int64
+	models.DB.Model(&models.User{}).Where("id = ? AND is_active = ?", claims.UserID, true).Count(&enabled)
+	if enabled == 0 {
+		return nil, ErrAccountDisabled
+	}
+	return claims, nil
+}
+
+// RevokeAccessToken 将访问令牌加入撤销列表
+func RevokeAccessToken(db *gorm.DB, claims *AccessClaims) error {
+	expiresAt := time.Now().Add(AccessTokenTTL())
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.RevokedToken{
+		JTI:       claims.ID,
+		UserID:    claims.UserID,
+		ExpiresAt: expiresAt,
+	}).Error
+}
+
+// RevokeSession 撤销用户的一个登录会话，该会话签发的访问令牌和刷新令牌随即失效
+func RevokeSession(db *gorm.DB, userID, sessionID uint) (bool, error) {
+	result := db.Model(&models.AuthSession{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+// RevokeUserSessions 撤销用户的全部登录会话（退出所有设备），exceptSessionID 非 0 时保留该会话
+func RevokeUserSessions(db *gorm.DB, userID, exceptSessionID uint) (int64, error) {
+	query := db.Model(&models.AuthSession{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+	if exceptSessionID != 0 {
+		query = query.Where("id <> ?", exceptSessionID)
+	}
+	result := query.Update("revoked_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+// ActiveSessions 用户当前有效的登录会话
+func ActiveSessions(db *gorm.DB, userID uint) ([]models.AuthSession, error) {
+	var sessions []models.AuthSession
+	err := db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at desc").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// CleanupTokens 删除已过期的撤销记录，以及过期或撤销超过一个刷新周期的登录会话
+func CleanupTokens(ctx context.Context, now time.Time) error {
+	if err := models.DB.Where("expires_at <= ?", now).Delete(&models.RevokedToken{}).Error; err != nil {
+		return err
+	}
+	// 撤销的会话保留到访问令牌必然过期之后，保证会话检查仍能拒绝其访问令牌
+	cutoff := now.Add(-AccessTokenTTL())
+	return models.DB.Where("expires_at <= ? OR revoked_at <= ?", cutoff, cutoff).
+		Delete(&models.AuthSession{}).Error
+}
+
+func signTokenPair(user *models.User, session *models.AuthSession, refreshToken string, now time.Time) (*TokenPair, error) {
+	jti, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := now.Add(AccessTokenTTL())
+	claims := AccessClaims{
+		UserID:         user.ID,
+		Username:       user.Username,
+		UserType:       user.UserType,
+		SessionID:      session.ID,
+		OrganizationID: user.OrganizationID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti[:32],
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+	accessToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret())
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(AccessTokenTTL().Seconds()),
+		ExpiresAt:    expiresAt,
+		SessionID:    session.ID,
+	}, nil
+}
+
+// randomToken 生成 32 字节随机数的十六进制字符串
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"urban_traffic_backend/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidRole 角色不存在
+	ErrInvalidRole = errors.New("无效的角色")
+	// ErrStaffOrganization 后台工作人员（平台超级管理员除外）必须归属组织
+	ErrStaffOrganization = errors.New("后台工作人员必须归属组织")
+)
+
+// SetUserActive 启用或停用账号。停用时撤销全部登录会话，已签发的令牌立即失效；
+// 重新启用时同时解除登录锁定
+func SetUserActive(db *gorm.DB, user *models.User, active bool) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{"is_active": active}
+		if active {
+			updates["failed_logins"] = 0
+			updates["locked_until"] = nil
+		}
+		if err := tx.Model(user).Updates(updates).Error; err != nil {
+			return err
+		}
+		if !active {
+			if _, err := RevokeUserSessions(tx, user.ID, 0); err != nil {
+				return err
+			}
+		}
+		return tx.First(user, user.ID).Error
+	})
+}
+
+// ChangeUserRole 修改用户角色及所属组织。普通用户和平台超级管理员不归属组织，
+// 其余工作人员必须指定组织。角色和组织写在访问令牌中，修改后撤销其全部登录会话
+func ChangeUserRole(db *gorm.DB, user *models.User, role string, organizationID *uint) error {
+	if !models.IsValidRole(role) {
+		return ErrInvalidRole
+	}
+	if role == models.RoleUser || role == models.RoleSuperAdmin {
+		organizationID = nil
+	} else if organizationID == nil {
+		return ErrStaffOrganization
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if organizationID != nil {
+			if err := tx.First(&models.Organization{}, *organizationID).Error; err != nil {
+				return err
+			}
+		}
+		err := tx.Model(user).Updates(map[string]interface{}{
+			"user_type":       role,
+			"organization_id": organizationID,
+		}).Error
+		if err != nil {
+			return err
+		}
+		if _, err := RevokeUserSessions(tx, user.ID, 0); err != nil {
+			return err
+		}
+		return tx.First(user, user.ID).Error
+	})
+}
+
+// ForcePasswordReset 管理员强制用户重置密码：原密码立即作废，全部登录会话撤销，
+// 并通过通知渠道向用户邮箱发送重置令牌，用户须使用令牌设置新密码后才能登录
+func ForcePasswordReset(db *gorm.DB, user *models.User) error {
+	// 无法发送令牌时不作废原密码，避免用户被锁定
+	notifier, err := activeNotifier()
+	if err != nil {
+		return err
+	}
+
+	var token string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// 用随机密码替换原密码，任何人都无法再用原密码登录
+		placeholder, err := randomToken()
+		if err != nil {
+			return err
+		}
+		if err := SetUserPassword(tx, user, placeholder[:48]); err != nil {
+			return err
+		}
+		if _, err := RevokeUserSessions(tx, user.ID, 0); err != nil {
+			return err
+		}
+		token, err = IssuePasswordResetToken(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("%s，您好：管理员已重置您的密码，请使用重置令牌 %s 设置新密码，%d 分钟内有效，仅可使用一次。",
+		user.Username, token, int(PasswordResetTTL().Minutes()))
+	if err := notifier.Send(user.Email, "重置密码", body); err != nil {
+		log.Printf("send forced password reset to user %d failed: %v", user.ID, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,300 @@
+/*
+ * Copyright (c) 2025 LTQY. All rights reserved.
+ *
+ * This source code is licensed under the MIT license found in the
+ * LICENSE file in the root directory of this source tree.
+ *
+ */
+
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"urban_traffic_backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrVehicleNotFound 车辆不存在或当前用户无权使用
+	ErrVehicleNotFound = errors.New("车辆不存在")
+	// ErrNotVehicleOwner 只有车主可以执行该操作
+	ErrNotVehicleOwner = errors.New("只有车主可以执行该操作")
+	// ErrInviteeNotFound 被邀请的账号不存在
+	ErrInviteeNotFound = errors.New("被邀请的用户不存在")
+	// ErrAlreadyMember 被邀请的用户已是该车辆的成员或已有待处理的邀请
+	ErrAlreadyMember = errors.New("该用户已是车辆成员或已被邀请")
+	// ErrInvitationNotFound 邀请不存在或已处理
+	ErrInvitationNotFound = errors.New("邀请不存在或已处理")
+	// ErrOwnerCannotLeave 车主不能移除自己，需删除车辆
+	ErrOwnerCannotLeave = errors.New("车主不能退出自己的车辆")
+	// ErrVehicleInUse 车辆有进行中的停车、预约或生效中的月卡，不能删除
+	ErrVehicleInUse = errors.New("车辆有进行中的停车、预约或生效中的月卡，不能删除")
+)
+
+// MemberVehicleIDs 用户可以使用的车辆ID子查询：本人作为车主或已接受邀请的驾驶人
+func MemberVehicleIDs(userID uint) *gorm.DB {
+	return models.DB.Model(&models.VehicleMember{}).Select("vehicle_id").
+		Where("user_id = ? AND status = ?", userID, models.VehicleMemberActive)
+}
+
+// FindMembership 用户在车辆上的有效成员记录
+func FindMembership(db *gorm.DB, vehicleID, userID uint) (*models.VehicleMember, error) {
+	var member models.VehicleMember
+	err := db.Preload("Vehicle").
+		Where("vehicle_id = ? AND user_id = ? AND status = ?", vehicleID, userID, models.VehicleMemberActive).
+		First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || err == nil && member.Vehicle.ID == 0 {
+		return nil, ErrVehicleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// RegisterVehicle 登记车辆并将登记人设为车主，用户还没有默认车辆时设为默认
+func RegisterVehicle(db *gorm.DB, vehicle *models.Vehicle) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var defaults int64
+		tx.Model(&models.VehicleMember{}).
+			Where("user_id = ? AND status = ? AND is_default = ?", vehicle.UserID, models.VehicleMemberActive, true).
+			Count(&defaults)
+		vehicle.IsDefault = defaults == 0
+		if err := tx.Create(vehicle).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		return tx.Create(&models.VehicleMember{
+			VehicleID:   vehicle.ID,
+			UserID:      vehicle.UserID,
+			Role:        models.VehicleRoleOwner,
+			Status:      models.VehicleMemberActive,
+			IsDefault:   vehicle.IsDefault,
+			RespondedAt: &now,
+		}).Error
+	})
+}
+
+// SetDefaultVehicle 将车辆设为用户的默认车辆，该用户的其他车辆取消默认。车主的设置同步到车辆上
+func SetDefaultVehicle(db *gorm.DB, userID, vehicleID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		member, err := FindMembership(tx, vehicleID, userID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&models.VehicleMember{}).Where("user_id = ?", userID).Update("is_default", false).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(member).Update("is_default", true).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Vehicle{}).Where("user_id = ?", userID).Update("is_default", false).Error; err != nil {
+			return err
+		}
+		if member.Role == models.VehicleRoleOwner {
+			return tx.Model(&models.Vehicle{}).Where("id = ?", vehicleID).Update("is_default", true).Error
+		}
+		return nil
+	})
+}
+
+// DeleteVehicle 车主删除车辆，所有成员记录随之删除；停车记录保留用于收据和财务对账。
+// 车辆有进行中的停车会话、保留中的预约或生效中的月卡时返回 ErrVehicleInUse
+func DeleteVehicle(db *gorm.DB, userID, vehicleID uint) (*models.Vehicle, error) {
+	var vehicle models.Vehicle
+	err := db.Transaction(func(tx *gorm.DB) error {
+		member, err := FindMembership(tx, vehicleID, userID)
+		if err != nil {
+			return err
+		}
+		if member.Role != models.VehicleRoleOwner {
+			return ErrNotVehicleOwner
+		}
+		vehicle = member.Vehicle
+
+		inUse, err := vehicleInUse(tx, vehicleID)
+		if err != nil {
+			return err
+		}
+		if inUse {
+			return ErrVehicleInUse
+		}
+		if err := tx.Where("vehicle_id = ?", vehicleID).Delete(&models.VehicleMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&vehicle).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &vehicle, nil
+}
+
+// vehicleInUse 车辆是否有进行中的停车会话、保留中的预约或生效中的月卡
+func vehicleInUse(tx *gorm.DB, vehicleID uint) (bool, error) {
+	checks := []struct {
+		model  interface{}
+		status string
+	}{
+		{&models.ParkingSession{}, "active"},
+		{&models.Reservation{}, models.ReservationStatusHeld},
+		{&models.ParkingPass{}, models.PassStatusActive},
+	}
+	for _, check := range checks {
+		var count int64
+		if err := tx.Model(check.model).Where("vehicle_id = ? AND status = ?", vehicleID, check.status).
+			Count(&count).Error; err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// InviteDriver 车主邀请其他用户作为驾驶人共享车辆，account 可以是用户名、邮箱或手机号。
+// 之前拒绝或被移除的用户可以再次邀请
+func InviteDriver(db *gorm.DB, ownerID, vehicleID uint, account string) (*models.VehicleMember, error) {
+	account = strings.TrimSpace(account)
+	if account == "" {
+		return nil, ErrInviteeNotFound
+	}
+
+	var invitation models.VehicleMember
+	err := db.Transaction(func(tx *gorm.DB) error {
+		owner, err := FindMembership(tx, vehicleID, ownerID)
+		if err != nil {
+			return err
+		}
+		if owner.Role != models.VehicleRoleOwner {
+			return ErrNotVehicleOwner
+		}
+
+		var invitee models.User
+		err = tx.Where("(username = ? OR email = ? OR phone = ?) AND is_active = ? AND user_type = ?",
+			account, strings.ToLower(account), account, true, models.RoleUser).
+			First(&invitee).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInviteeNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("vehicle_id = ? AND user_id = ?", vehicleID, invitee.ID).
+			First(&invitation).Error
+		switch {
+		case err == nil:
+			if invitation.Status == models.VehicleMemberActive || invitation.Status == models.VehicleMemberPending {
+				return ErrAlreadyMember
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			invitation = models.VehicleMember{VehicleID: vehicleID, UserID: invitee.ID}
+		default:
+			return err
+		}
+
+		invitation.Role = models.VehicleRoleDriver
+		invitation.Status = models.VehicleMemberPending
+		invitation.IsDefault = false
+		invitation.InvitedBy = &ownerID
+		invitation.RespondedAt = nil
+		invitation.RevokedAt = nil
+		if err := tx.Save(&invitation).Error; err != nil {
+			return err
+		}
+		invitation.Vehicle = owner.Vehicle
+		invitation.User = invitee
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// RespondInvitation 被邀请人接受或拒绝邀请，接受后可以使用该车辆，
+// 还没有默认车辆时将其设为默认
+func RespondInvitation(db *gorm.DB, userID, invitationID uint, accept bool) (*models.VehicleMember, error) {
+	var invitation models.VehicleMember
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND user_id = ? AND status = ?", invitationID, userID, models.VehicleMemberPending).
+			First(&invitation).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvitationNotFound
+		}
+		if err != nil {
+			return err
+		}
+		// 车辆已被车主删除
+		if err := tx.First(&invitation.Vehicle, invitation.VehicleID).Error; err != nil {
+			return ErrInvitationNotFound
+		}
+
+		now := time.Now()
+		invitation.RespondedAt = &now
+		invitation.Status = models.VehicleMemberDeclined
+		if accept {
+			var defaults int64
+			tx.Model(&models.VehicleMember{}).
+				Where("user_id = ? AND status = ? AND is_default = ?", userID, models.VehicleMemberActive, true).
+				Count(&defaults)
+			invitation.Status = models.VehicleMemberActive
+			invitation.IsDefault = defaults == 0
+		}
+		return tx.Omit("Vehicle", "User").Save(&invitation).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// RemoveMember 车主移除驾驶人或撤回邀请，驾驶人也可以自己退出。
+// 移除后不能再使用该车辆，已产生的停车会话仍对本人可见
+func RemoveMember(db *gorm.DB, operatorID, vehicleID, memberUserID uint) (*models.VehicleMember, error) {
+	var member models.VehicleMember
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if operatorID != memberUserID {
+			operator, err := FindMembership(tx, vehicleID, operatorID)
+			if err != nil {
+				return err
+			}
+			if operator.Role != models.VehicleRoleOwner {
+				return ErrNotVehicleOwner
+			}
+		}
+
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("vehicle_id = ? AND user_id = ? AND status IN ?", vehicleID, memberUserID,
+				[]string{models.VehicleMemberActive, models.VehicleMemberPending}).
+			First(&member).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrVehicleNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if member.Role == models.VehicleRoleOwner {
+			return ErrOwnerCannotLeave
+		}
+
+		now := time.Now()
+		member.Status = models.VehicleMemberRevoked
+		member.IsDefault = false
+		member.RevokedAt = &now
+		return tx.Save(&member).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}